@@ -0,0 +1,74 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// apiClientHeader is the header Google uses to attribute traffic to client
+// libraries.
+const apiClientHeader = "X-Goog-Api-Client"
+
+const modulePath = "github.com/hashicorp/go-gcp-common"
+
+// Values of the auth-request-type and cred-type attributes of the
+// x-goog-api-client header.
+const (
+	apiClientAccessToken = "at"
+	apiClientIDToken     = "it"
+
+	apiClientCredImpersonated = "imp"
+	apiClientCredExternal     = "ext"
+)
+
+var (
+	apiClientBaseOnce sync.Once
+	apiClientBase     string
+)
+
+// apiClientBaseValue returns the x-goog-api-client attributes identifying
+// the Go version and the version of this module, e.g.
+// "gl-go/1.21.5 gcputil/v0.5.0".
+func apiClientBaseValue() string {
+	apiClientBaseOnce.Do(func() {
+		goVersion := strings.TrimPrefix(runtime.Version(), "go")
+		if i := strings.IndexAny(goVersion, " +"); i >= 0 {
+			// Development builds, e.g. "devel go1.22-abcdef +0000".
+			goVersion = goVersion[:i]
+		}
+
+		version := "unknown"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			if info.Main.Path == modulePath && info.Main.Version != "" {
+				version = info.Main.Version
+			}
+			for _, dep := range info.Deps {
+				if dep.Path == modulePath {
+					version = dep.Version
+				}
+			}
+		}
+		apiClientBase = "gl-go/" + goVersion + " gcputil/" + version
+	})
+	return apiClientBase
+}
+
+// setAPIClientHeader sets the x-goog-api-client header of req. For token
+// requests, requestType and credType are the auth-request-type and cred-type
+// attributes; they are omitted when empty.
+func setAPIClientHeader(req *http.Request, requestType, credType string) {
+	value := apiClientBaseValue()
+	if requestType != "" {
+		value += " auth-request-type/" + requestType
+	}
+	if credType != "" {
+		value += " cred-type/" + credType
+	}
+	req.Header.Set(apiClientHeader, value)
+}
@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestClient_apiClientHeader(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(apiClientHeader))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token",
+			"accessToken":  "token",
+			"expireTime":   time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{IAMCredentials: srv.URL, STS: srv.URL}})
+	ctx := context.Background()
+	if _, err := c.ExchangeToken(ctx, &STSTokenExchangeRequest{Audience: "aud", SubjectToken: "jwt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GenerateAccessToken(ctx, &IAMTokenExchangeRequest{ServiceAccountEmail: "sa@p.iam.gserviceaccount.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*regexp.Regexp{
+		regexp.MustCompile(`^gl-go/[0-9][^ ]* gcputil/[^ ]+ auth-request-type/at cred-type/ext$`),
+		regexp.MustCompile(`^gl-go/[0-9][^ ]* gcputil/[^ ]+ auth-request-type/at cred-type/imp$`),
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(got))
+	}
+	for i, re := range expected {
+		if !re.MatchString(got[i]) {
+			t.Errorf("request %d: unexpected %s header %q", i, apiClientHeader, got[i])
+		}
+	}
+}
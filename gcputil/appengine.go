@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"errors"
+	"os"
+)
+
+// AppEngineEnvironment is an App Engine runtime environment.
+type AppEngineEnvironment string
+
+const (
+	// AppEngineStandard is the App Engine standard environment (second
+	// generation runtimes).
+	AppEngineStandard AppEngineEnvironment = "standard"
+
+	// AppEngineFlexible is the App Engine flexible environment.
+	AppEngineFlexible AppEngineEnvironment = "flexible"
+)
+
+// Environment variables set by the App Engine runtimes.
+// See https://cloud.google.com/appengine/docs/standard/go/runtime#environment_variables
+const (
+	appEngineEnvEnv      = "GAE_ENV"
+	appEngineInstanceEnv = "GAE_INSTANCE"
+	appEngineServiceEnv  = "GAE_SERVICE"
+)
+
+// DetectAppEngine reports whether the process is running on App Engine, and
+// in which environment.
+func DetectAppEngine() (AppEngineEnvironment, bool) {
+	if os.Getenv(appEngineEnvEnv) == string(AppEngineStandard) {
+		return AppEngineStandard, true
+	}
+	if os.Getenv(appEngineInstanceEnv) != "" && os.Getenv(appEngineServiceEnv) != "" {
+		return AppEngineFlexible, true
+	}
+	return "", false
+}
+
+// AppEngineTokenSource returns a token source for the App Engine app's
+// service account. Both the standard (second generation) and flexible
+// environments expose a metadata-server-compatible endpoint, which is used
+// to obtain tokens. An error is returned if not running on App Engine.
+func AppEngineTokenSource(scopes ...string) (*MetadataTokenSource, error) {
+	if _, ok := DetectAppEngine(); !ok {
+		return nil, errors.New("not running on App Engine")
+	}
+	return NewMetadataTokenSource(nil, "", scopes...), nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestDetectAppEngine(t *testing.T) {
+	tests := map[string]struct {
+		Env      map[string]string
+		Expected AppEngineEnvironment
+	}{
+		"not app engine": {},
+		"standard": {
+			Env:      map[string]string{appEngineEnvEnv: "standard", appEngineInstanceEnv: "i", appEngineServiceEnv: "default"},
+			Expected: AppEngineStandard,
+		},
+		"flexible": {
+			Env:      map[string]string{appEngineInstanceEnv: "i", appEngineServiceEnv: "default"},
+			Expected: AppEngineFlexible,
+		},
+		"flexible without service": {
+			Env: map[string]string{appEngineInstanceEnv: "i"},
+		},
+		"local dev server": {
+			Env: map[string]string{appEngineEnvEnv: "localdev"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, env := range []string{appEngineEnvEnv, appEngineInstanceEnv, appEngineServiceEnv} {
+				t.Setenv(env, test.Env[env])
+			}
+
+			env, ok := DetectAppEngine()
+			if ok != (test.Expected != "") || env != test.Expected {
+				t.Fatalf("expected %q, got %q (%t)", test.Expected, env, ok)
+			}
+
+			_, err := AppEngineTokenSource()
+			if ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !ok && err == nil {
+				t.Fatal("expected error outside App Engine")
+			}
+
+			// The metadata server is not probed for on App Engine, where it
+			// is always available.
+			client := NewMetadataClient(nil)
+			if probe := metadataProbeClient(client); (probe == client) != ok {
+				t.Fatalf("expected probe client to be the given client: %t", ok)
+			} else if !ok && (probe.maxRetries != 0 || probe.timeout != metadataProbeTimeout) {
+				t.Fatalf("expected a fail-fast probe client, got %d retries and timeout %s", probe.maxRetries, probe.timeout)
+			}
+		})
+	}
+}
+
+func TestAppEngineTokenSource(t *testing.T) {
+	md := testutil.NewMetadataServer(t)
+	md.SetEnv(t)
+	t.Setenv(appEngineEnvEnv, "standard")
+
+	ts, err := AppEngineTokenSource("https://www.googleapis.com/auth/datastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != testutil.DefaultMetadataAccessToken {
+		t.Fatalf("unexpected access token %q", token.AccessToken)
+	}
+
+	reqs := md.Requests()
+	if scopes := reqs[len(reqs)-1].URL.Query().Get("scopes"); scopes != "https://www.googleapis.com/auth/datastore" {
+		t.Fatalf("unexpected scopes %q", scopes)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// jwtBearerGrantType is the OAuth 2.0 grant type for exchanging a signed
+	// JWT assertion for an access token.
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	// assertionLifetime is the lifetime of signed JWT assertions.
+	assertionLifetime = time.Hour
+)
+
+// AssertionSigner signs the JWT assertions of a service account with RS256.
+// Implementations allow keeping the private key outside of process memory,
+// e.g. in Cloud KMS, an HSM, or Vault's transit secrets engine. Set
+// GcpCredentials.AssertionSigner to use it instead of PrivateKey.
+type AssertionSigner interface {
+	// KeyID returns the ID of the service account key, which is set as the
+	// kid header of assertions.
+	KeyID() string
+
+	// SignAssertion returns the RSASSA-PKCS1-v1_5 SHA-256 signature of the
+	// JWT signing input, i.e. the encoded header and claims joined by a dot.
+	SignAssertion(ctx context.Context, signingInput []byte) ([]byte, error)
+}
+
+// cryptoAssertionSigner is an AssertionSigner backed by a crypto.Signer.
+type cryptoAssertionSigner struct {
+	keyID  string
+	signer crypto.Signer
+}
+
+// NewCryptoAssertionSigner returns an AssertionSigner for an RSA
+// crypto.Signer, such as the signers provided by KMS and PKCS#11 libraries.
+func NewCryptoAssertionSigner(keyID string, signer crypto.Signer) (AssertionSigner, error) {
+	if signer == nil {
+		return nil, errors.New("signer is required")
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported signer key type %T, must be RSA", signer.Public())
+	}
+	if err := checkFIPSPublicKey(signer.Public()); err != nil {
+		return nil, err
+	}
+	return &cryptoAssertionSigner{keyID: keyID, signer: signer}, nil
+}
+
+func (s *cryptoAssertionSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *cryptoAssertionSigner) SignAssertion(_ context.Context, signingInput []byte) ([]byte, error) {
+	digest := sha256.Sum256(signingInput)
+	return s.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// signJWT encodes the claims as a JWT signed by the given signer.
+func signJWT(ctx context.Context, signer AssertionSigner, claims interface{}) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if kid := signer.KeyID(); kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	sig, err := signer.SignAssertion(ctx, []byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("unable to sign JWT: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// assertionTokenSource exchanges JWT assertions signed by an AssertionSigner
+// for access tokens, like jwt.Config does for in-memory private keys.
+type assertionTokenSource struct {
+	ctx        context.Context
+	signer     AssertionSigner
+	email      string
+	subject    string
+	scopes     []string
+	tokenURL   string
+	httpClient *http.Client
+}
+
+// newAssertionTokenSource returns a token source for the service account
+// with the given email whose assertions are signed by signer. If subject is
+// set, tokens are issued for that user through domain-wide delegation. The
+// HTTP client is taken from ctx, as with the oauth2 package.
+func newAssertionTokenSource(ctx context.Context, signer AssertionSigner, email, subject string, scopes []string, tokenURL string) oauth2.TokenSource {
+	httpClient, ok := ctx.Value(oauth2.HTTPClient).(*http.Client)
+	if !ok {
+		httpClient = packageHTTPClient()
+	}
+	return oauth2.ReuseTokenSource(nil, &assertionTokenSource{
+		ctx:        ctx,
+		signer:     signer,
+		email:      email,
+		subject:    subject,
+		scopes:     scopes,
+		tokenURL:   tokenURL,
+		httpClient: httpClient,
+	})
+}
+
+func (ts *assertionTokenSource) Token() (*oauth2.Token, error) {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   ts.email,
+		"scope": strings.Join(ts.scopes, " "),
+		"aud":   ts.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	}
+	if ts.subject != "" {
+		claims["sub"] = ts.subject
+	}
+	assertion, err := signJWT(ts.ctx, ts.signer, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type": {jwtBearerGrantType},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ts.ctx, http.MethodPost, ts.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ts.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange JWT assertion: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to exchange JWT assertion: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("unable to decode token response: %v", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response did not contain an access token")
+	}
+	tok := &oauth2.Token{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+	}
+	if tokenResp.ExpiresIn > 0 {
+		tok.Expiry = now.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssertionTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewCryptoAssertionSigner("kms-key", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenSrv, requested := newTestOAuth2Server(t)
+	ts := newAssertionTokenSource(context.Background(), signer, "sa@p.iam.gserviceaccount.com", "", []string{"a", "b"}, tokenSrv.URL)
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token:a b" || tok.Expiry.IsZero() {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+	if got := requested(); len(got) != 1 || got[0] != "a b" {
+		t.Fatalf("unexpected requested scopes %v", got)
+	}
+}
+
+func TestSignJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewCryptoAssertionSigner("kms-key", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt, err := signJWT(context.Background(), signer, map[string]string{"iss": "sa@p.iam.gserviceaccount.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed JWT %q", jwt)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Alg != "RS256" || header.Kid != "kms-key" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("invalid signature: %v", err)
+	}
+}
+
+func TestNewCryptoAssertionSigner_unsupportedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCryptoAssertionSigner("key", key); err == nil {
+		t.Fatal("expected error for EC key")
+	}
+}
+
+func TestAssertionTokenSource_subject(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewCryptoAssertionSigner("kms-key", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var claims struct {
+			Sub string `json:"sub"`
+		}
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 || decodeJWTSegment(parts[1], &claims) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token-for:" + claims.Sub,
+			"expires_in":   3600,
+		})
+	}))
+	defer srv.Close()
+
+	ts := newAssertionTokenSource(context.Background(), signer, "sa@p.iam.gserviceaccount.com", "user@example.com", []string{"a"}, srv.URL)
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token-for:user@example.com" {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Audiences is the "aud" claim of a JWT, which may be a single string or an
+// array of strings.
+type Audiences []string
+
+// UnmarshalJSON accepts a string or an array of strings.
+func (a *Audiences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audiences{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.New("audience must be a string or an array of strings")
+	}
+	*a = multiple
+	return nil
+}
+
+// AudienceMatcher checks token audiences against a list of accepted
+// audiences. Accepted audiences are matched exactly, except that a "*"
+// matches any run of letters, digits and dashes, so that e.g.
+// "https://my-service-*.a.run.app" accepts the URLs of a Cloud Run service
+// in any region. A "*" never matches dots, slashes or other separators.
+type AudienceMatcher struct {
+	exact    map[string]struct{}
+	patterns []*regexp.Regexp
+	accepted []string
+}
+
+// NewAudienceMatcher returns an AudienceMatcher for the given accepted
+// audiences. At least one is required.
+func NewAudienceMatcher(accepted ...string) (*AudienceMatcher, error) {
+	if len(accepted) == 0 {
+		return nil, errors.New("at least one accepted audience is required")
+	}
+
+	m := &AudienceMatcher{
+		exact:    map[string]struct{}{},
+		accepted: append([]string(nil), accepted...),
+	}
+	for _, aud := range accepted {
+		if aud == "" || strings.Trim(aud, "*") == "" {
+			return nil, fmt.Errorf("invalid accepted audience %q", aud)
+		}
+		if !strings.Contains(aud, "*") {
+			m.exact[aud] = struct{}{}
+			continue
+		}
+
+		parts := strings.Split(aud, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		pattern, err := regexp.Compile("^" + strings.Join(parts, "[A-Za-z0-9-]*") + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid accepted audience %q: %v", aud, err)
+		}
+		m.patterns = append(m.patterns, pattern)
+	}
+	return m, nil
+}
+
+// Matches reports whether any of the given token audiences is accepted.
+func (m *AudienceMatcher) Matches(audiences ...string) bool {
+	_, ok := m.Match(audiences...)
+	return ok
+}
+
+// Match returns the first of the given token audiences that is accepted, and
+// whether there is one.
+func (m *AudienceMatcher) Match(audiences ...string) (string, bool) {
+	for _, aud := range audiences {
+		if _, ok := m.exact[aud]; ok {
+			return aud, true
+		}
+		for _, pattern := range m.patterns {
+			if pattern.MatchString(aud) {
+				return aud, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Validate returns an error if none of the given token audiences is
+// accepted.
+func (m *AudienceMatcher) Validate(audiences ...string) error {
+	if len(audiences) == 0 {
+		return errors.New("token has no audience")
+	}
+	if !m.Matches(audiences...) {
+		return fmt.Errorf("token audience %q does not match any of the accepted audiences %q", audiences, m.accepted)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAudienceMatcher(t *testing.T) {
+	m, err := NewAudienceMatcher("vault", "https://my-service-*.a.run.app", "https://api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		Audiences   []string
+		Matched     string
+		ShouldError bool
+	}{
+		"exact":              {Audiences: []string{"vault"}, Matched: "vault"},
+		"one of several":     {Audiences: []string{"other", "https://api.example.com"}, Matched: "https://api.example.com"},
+		"first accepted":     {Audiences: []string{"other", "vault", "https://api.example.com"}, Matched: "vault"},
+		"cloud run wildcard": {Audiences: []string{"https://my-service-abc123-uc.a.run.app"}, Matched: "https://my-service-abc123-uc.a.run.app"},
+		"empty wildcard":     {Audiences: []string{"https://my-service-.a.run.app"}, Matched: "https://my-service-.a.run.app"},
+		"wildcard dot":       {Audiences: []string{"https://my-service-x.evil.com/.a.run.app"}, ShouldError: true},
+		"wildcard subdomain": {Audiences: []string{"https://my-service-a.b.a.run.app"}, ShouldError: true},
+		"prefix only":        {Audiences: []string{"https://api.example.com.evil.com"}, ShouldError: true},
+		"case sensitive":     {Audiences: []string{"Vault"}, ShouldError: true},
+		"no audience":        {ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := m.Validate(test.Audiences...)
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if matched, ok := m.Match(test.Audiences...); matched != test.Matched || ok == test.ShouldError {
+				t.Fatalf("expected match %q, got %q (%t)", test.Matched, matched, ok)
+			}
+		})
+	}
+
+	for _, accepted := range [][]string{nil, {""}, {"*"}} {
+		if _, err := NewAudienceMatcher(accepted...); err == nil {
+			t.Errorf("expected error for accepted audiences %q", accepted)
+		}
+	}
+}
+
+func TestAudiences_UnmarshalJSON(t *testing.T) {
+	tests := map[string]struct {
+		JSON        string
+		Expected    Audiences
+		ShouldError bool
+	}{
+		"string":  {JSON: `{"aud":"a"}`, Expected: Audiences{"a"}},
+		"array":   {JSON: `{"aud":["a","b"]}`, Expected: Audiences{"a", "b"}},
+		"missing": {JSON: `{}`},
+		"number":  {JSON: `{"aud":1}`, ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var claims struct {
+				Aud Audiences `json:"aud"`
+			}
+			err := json.Unmarshal([]byte(test.JSON), &claims)
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if !reflect.DeepEqual(claims.Aud, test.Expected) {
+				t.Fatalf("expected %q, got %q", test.Expected, claims.Aud)
+			}
+		})
+	}
+}
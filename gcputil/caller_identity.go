@@ -0,0 +1,41 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrCallerNotServiceAccount is returned by GetCallerServiceAccountEmail if
+// the current credentials do not identify a service account, e.g. user
+// credentials or a static access token.
+var ErrCallerNotServiceAccount = errors.New("credentials do not identify a service account")
+
+// GetCallerServiceAccountEmail returns the email of the service account
+// behind the credentials found by FindCredentials: the client_email of key
+// JSON, the impersonated service account of external_account and
+// impersonated_service_account credentials, or the service account of the
+// metadata server when Application Default Credentials come from it.
+func GetCallerServiceAccountEmail(ctx context.Context) (string, error) {
+	found, err := FindCredentialsWithSource(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	if found.Credentials != nil && found.Credentials.ClientEmail != "" {
+		return found.Credentials.ClientEmail, nil
+	}
+
+	// Application Default Credentials without JSON are those of the
+	// metadata server.
+	if found.Source == CredentialSourceADC && found.Credentials == nil {
+		email, err := metadataProbeClient(NewMetadataClient(nil)).ServiceAccountEmail(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("unable to get service account email from metadata server: %v", err)
+		}
+		return email, nil
+	}
+	return "", fmt.Errorf("%w: credentials from %s", ErrCallerNotServiceAccount, found.Source)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+	"github.com/mitchellh/go-homedir"
+)
+
+func TestGetCallerServiceAccountEmail(t *testing.T) {
+	md := testutil.NewMetadataServer(t)
+
+	tests := map[string]struct {
+		Env   map[string]string
+		Email string
+		Err   error
+	}{
+		"service account key": {
+			Env:   map[string]string{"GOOGLE_CREDENTIALS": `{"type":"service_account","client_email":"key@p.iam.gserviceaccount.com"}`},
+			Email: "key@p.iam.gserviceaccount.com",
+		},
+		"user credentials": {
+			Env: map[string]string{"GOOGLE_CREDENTIALS": `{"type":"authorized_user","client_id":"c","client_secret":"s","refresh_token":"r"}`},
+			Err: ErrCallerNotServiceAccount,
+		},
+		"static access token": {
+			Env: map[string]string{EnvOAuthAccessToken: "ya29.token"},
+			Err: ErrCallerNotServiceAccount,
+		},
+		"metadata server": {
+			Email: testutil.DefaultMetadataServiceAccount,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			homedir.Reset()
+			t.Cleanup(homedir.Reset)
+			for _, env := range []string{EnvOAuthAccessToken, "GOOGLE_CREDENTIALS", "GOOGLE_CLOUD_KEYFILE_JSON", EnvApplicationCredentials} {
+				t.Setenv(env, "")
+			}
+			for k, v := range test.Env {
+				t.Setenv(k, v)
+			}
+			md.SetEnv(t)
+
+			email, err := GetCallerServiceAccountEmail(context.Background())
+			if test.Err != nil {
+				if !errors.Is(err, test.Err) {
+					t.Fatalf("expected %v, got %v", test.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if email != test.Email {
+				t.Fatalf("expected %q, got %q", test.Email, email)
+			}
+		})
+	}
+}
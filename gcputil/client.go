@@ -0,0 +1,487 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+)
+
+// Logger is the logging interface used by Client. It is satisfied by
+// hclog.Logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+// MetricsSink is the metrics interface used by Client. It is satisfied by
+// *metrics.Metrics from github.com/armon/go-metrics.
+type MetricsSink interface {
+	IncrCounter(key []string, val float32)
+	MeasureSince(key []string, start time.Time)
+}
+
+// Options configures a Client.
+type Options struct {
+	// CredentialsJSON is a credential file (e.g. a service account key) used
+	// to authenticate calls to Google APIs. If neither CredentialsJSON nor
+	// TokenSource is set, Application Default Credentials are used.
+	CredentialsJSON string
+
+	// TokenSource authenticates calls to Google APIs. It takes precedence
+	// over CredentialsJSON.
+	TokenSource oauth2.TokenSource
+
+	// Scopes are requested when obtaining credentials from CredentialsJSON
+	// or Application Default Credentials. Defaults to cloud-platform.
+	// Individual calls can request other scopes with WithTokenScopes.
+	Scopes []string
+
+	// Endpoints are the Google API endpoints to use. Empty fields take
+	// their default value, or the endpoint of the universe domain of
+	// CredentialsJSON if it has one. See GCPEndpointsFromEnv to populate
+	// endpoints from the environment.
+	Endpoints *GCPEndpoints
+
+	// HTTPClient is the base HTTP client. Authenticated calls wrap its
+	// transport. Defaults to the client set with SetDefaultHTTPClient, or a
+	// client of the package's shared pooled transport.
+	HTTPClient *http.Client
+
+	// DialContext and Resolver, if set, are used to connect to Google APIs,
+	// e.g. to reach them through internal forward proxies. HTTPClient's
+	// transport must then be an *http.Transport. They default to those set
+	// with SetDefaultDialer.
+	DialContext DialContextFunc
+	Resolver    *net.Resolver
+
+	// ClientCertificateSource, if set, provides client certificates for
+	// mutual TLS, and mTLS endpoints are used unless
+	// GOOGLE_API_USE_MTLS_ENDPOINT is "never". If not set and
+	// GOOGLE_API_USE_CLIENT_CERTIFICATE is "true", Endpoint Verification
+	// (SecureConnect) device certificates are used when available.
+	// HTTPClient's transport must then be an *http.Transport.
+	ClientCertificateSource ClientCertificateSource
+
+	// Transport, if set, tunes connection handling, e.g. HTTP/2 health
+	// checks. HTTPClient's transport must then be an *http.Transport.
+	// Defaults to the options set with SetDefaultTransportOptions when
+	// HTTPClient is not set.
+	Transport *TransportOptions
+
+	// PrivateAccess, if set, routes all *.googleapis.com traffic through the
+	// given Private Google Access VIPs. HTTPClient's transport must then be
+	// an *http.Transport. Defaults to the preset set with
+	// SetDefaultPrivateAccess when neither HTTPClient nor a default HTTP
+	// client is set.
+	PrivateAccess PrivateAccessPreset
+
+	// UserAgent, if set, is sent on every request. Defaults to the user
+	// agent set with SetDefaultUserAgent.
+	UserAgent string
+
+	// RequestReason, if set, is sent in the X-Goog-Request-Reason header of
+	// every request, e.g. to satisfy Access Approval. Defaults to
+	// GOOGLE_CLOUD_REQUEST_REASON. Individual calls can set another reason
+	// with WithRequestReason.
+	RequestReason string
+
+	// ExtendedTokenLifetimes allows requesting access token lifetimes over
+	// DefaultAccessTokenLifetime, up to MaxExtendedAccessTokenLifetime, for
+	// service accounts listed in the
+	// constraints/iam.allowServiceAccountCredentialLifetimeExtension
+	// organization policy. Without it, such lifetimes are refused before
+	// calling the IAM Credentials API.
+	ExtendedTokenLifetimes bool
+
+	// Retry configures retries of failed requests. Defaults to
+	// DefaultRetryOptions.
+	Retry *RetryOptions
+
+	// Logger, if set, receives debug and warning messages. Defaults to the
+	// logger set with SetDefaultLogger.
+	Logger Logger
+
+	// Metrics, if set, receives request latency, retry and error metrics,
+	// and the hits and misses of the client's token and token info caches.
+	Metrics MetricsSink
+
+	// Tracer, if set, traces all HTTP requests made by the client, including
+	// token fetches. Tracing can be toggled at runtime with
+	// HTTPTracer.SetEnabled. Defaults to the tracer set with
+	// SetDefaultTracer.
+	Tracer *HTTPTracer
+}
+
+// Client is an options-based client for the Google APIs used by Vault GCP
+// integrations. It is safe for concurrent use. The package-level functions
+// remain available for compatibility.
+type Client struct {
+	opts      Options
+	endpoints *GCPEndpoints
+
+	// httpClient is used for unauthenticated calls, e.g. STS and public key
+	// lookups.
+	httpClient *http.Client
+
+	// authClient is used for authenticated calls.
+	authClient  *http.Client
+	tokenSource oauth2.TokenSource
+
+	// scoped mints tokens for per-request scopes. It is nil if the client
+	// was created with a token source.
+	scoped *ScopedTokenSource
+
+	iamService *iam.Service
+
+	// tokenInfos caches token info for HasScopes.
+	tokenInfos tokenInfoCache
+
+	// idTokens caches ID token sources for IAPIDToken.
+	idTokens idTokenSources
+
+	// exporter holds the *MonitoringExporter registered with ExportMetrics,
+	// if any.
+	exporter atomic.Value
+}
+
+// NewClient creates a Client from the given options. Credentials are
+// resolved when the client is created.
+func NewClient(ctx context.Context, opts *Options) (*Client, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Endpoints != nil {
+		if err := opts.Endpoints.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Client{opts: *opts}
+	c.applyDefaults()
+
+	certSource := c.opts.ClientCertificateSource
+	if certSource == nil {
+		var err error
+		if certSource, err = defaultClientCertificateSource(); err != nil {
+			return nil, err
+		}
+	}
+	if useMTLSEndpoints(certSource != nil) {
+		c.endpoints = c.endpoints.mtls()
+	}
+
+	c.httpClient = c.opts.HTTPClient
+	if c.opts.DialContext != nil || c.opts.Resolver != nil {
+		httpClient, err := withDialer(c.httpClient, c.opts.DialContext, c.opts.Resolver)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = httpClient
+	}
+	if certSource != nil {
+		transport, err := withClientCertificate(c.httpClient.Transport, certSource)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = withTransport(c.httpClient, transport)
+	}
+	if c.opts.PrivateAccess != "" {
+		transport, err := c.opts.PrivateAccess.Transport(c.httpClient.Transport)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = withTransport(c.httpClient, transport)
+	}
+	if c.opts.Transport != nil {
+		// Tuning is applied to the final transport, since HTTP/2
+		// configuration does not carry over to clones.
+		httpClient, err := withTransportOptions(c.httpClient, c.opts.Transport)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = httpClient
+	}
+	if c.opts.Tracer != nil {
+		c.httpClient = c.opts.Tracer.Client(c.httpClient)
+	} else {
+		c.httpClient = withDefaultTracer(c.httpClient)
+	}
+	if c.opts.UserAgent != "" {
+		c.httpClient = withTransport(c.httpClient, &userAgentTransport{base: transportOrDefault(c.httpClient.Transport), userAgent: c.opts.UserAgent})
+	}
+	c.httpClient = withTransport(c.httpClient, &requestReasonTransport{base: transportOrDefault(c.httpClient.Transport), reason: c.opts.RequestReason})
+
+	ts, err := c.resolveTokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.scoped != nil {
+		c.scoped.onLookup = func(hit bool) { c.incrCache("scoped_token", hit) }
+	}
+	c.tokenSource = oauth2.ReuseTokenSource(nil, ts)
+	c.authClient = &http.Client{
+		Transport: &scopedTransport{
+			base:   transportOrDefault(c.httpClient.Transport),
+			source: c.tokenSource,
+			scoped: c.scoped,
+		},
+		Timeout: c.httpClient.Timeout,
+	}
+
+	c.iamService, err = iam.NewService(ctx, option.WithHTTPClient(c.authClient), option.WithEndpoint(c.endpoints.IAM))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create IAM client: %v", err)
+	}
+	return c, nil
+}
+
+func (c *Client) applyDefaults() {
+	if len(c.opts.Scopes) == 0 {
+		c.opts.Scopes = defaultTokenAuthScopes
+	}
+	c.endpoints = c.opts.Endpoints.withDefaults()
+	if ud := universeDomainFromJSON(c.opts.CredentialsJSON); ud != "" && ud != DefaultUniverseDomain {
+		c.endpoints = GCPEndpointsForUniverse(ud).merge(c.opts.Endpoints)
+	}
+	if c.opts.HTTPClient == nil {
+		c.opts.HTTPClient = defaultHTTPClient()
+	}
+	if c.opts.HTTPClient == nil {
+		c.opts.HTTPClient = newHTTPClient()
+		if c.opts.PrivateAccess == "" {
+			// The shared transport already routes through the default
+			// preset, but a custom dialer would replace it.
+			c.opts.PrivateAccess = defaultPrivateAccess()
+		}
+	}
+	if c.opts.UserAgent == "" {
+		c.opts.UserAgent = defaultUserAgent()
+	}
+	if c.opts.Logger == nil {
+		c.opts.Logger = defaultLogger()
+	}
+	if c.opts.Retry == nil {
+		c.opts.Retry = DefaultRetryOptions()
+	}
+	if c.opts.RequestReason == "" {
+		c.opts.RequestReason = os.Getenv(EnvRequestReason)
+	}
+}
+
+func (c *Client) resolveTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if c.opts.TokenSource != nil {
+		return c.opts.TokenSource, nil
+	}
+
+	// Token fetches made by the credentials use the configured HTTP client.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.httpClient)
+	var err error
+	if c.opts.CredentialsJSON != "" {
+		c.scoped, err = NewScopedTokenSource(ctx, []byte(c.opts.CredentialsJSON), c.opts.Scopes...)
+	} else {
+		c.scoped, err = newDefaultScopedTokenSource(ctx, c.opts.Scopes...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.scoped, nil
+}
+
+// TokenSource returns the token source used to authenticate calls.
+func (c *Client) TokenSource() oauth2.TokenSource {
+	return c.tokenSource
+}
+
+// TokenSourceWithScopes returns a token source for the given scopes that
+// shares the client's credentials. It is not supported if the client was
+// created with Options.TokenSource.
+func (c *Client) TokenSourceWithScopes(scopes ...string) (oauth2.TokenSource, error) {
+	if c.scoped == nil {
+		return nil, errors.New("scoped token sources are not supported with a configured token source")
+	}
+	return c.scoped.WithScopes(scopes...)
+}
+
+// Endpoints returns the endpoints used by the client.
+func (c *Client) Endpoints() GCPEndpoints {
+	return *c.endpoints
+}
+
+// ComputeService returns a Compute Engine client that uses the client's
+// credentials and Compute endpoint.
+func (c *Client) ComputeService(ctx context.Context) (*compute.Service, error) {
+	return compute.NewService(ctx, option.WithHTTPClient(c.authClient), option.WithEndpoint(c.endpointsFor(ctx).Compute))
+}
+
+// HTTPClient returns an HTTP client authenticated with the client's
+// credentials.
+func (c *Client) HTTPClient() *http.Client {
+	return c.authClient
+}
+
+// ServiceAccountPublicKey returns the public key with the given key ID for the
+// given service account.
+func (c *Client) ServiceAccountPublicKey(ctx context.Context, serviceAccount, keyID string) (interface{}, error) {
+	defer c.measure("service_account_public_key", time.Now())
+	return serviceAccountPublicKey(ctx, c.httpClient, serviceAccount, keyID, c.endpointsFor(ctx).APIs)
+}
+
+// OAuth2RSAPublicKey returns the public key with the given key ID from
+// Google's public set of OAuth 2.0 keys.
+func (c *Client) OAuth2RSAPublicKey(ctx context.Context, keyID string) (interface{}, error) {
+	defer c.measure("oauth2_public_key", time.Now())
+	return oauth2RSAPublicKey(ctx, c.httpClient, keyID, c.endpointsFor(ctx).OAuthCerts)
+}
+
+// ServiceAccount returns the service account with the given ID.
+func (c *Client) ServiceAccount(ctx context.Context, accountId *ServiceAccountId) (*iam.ServiceAccount, error) {
+	defer c.measure("service_account", time.Now())
+	if accountId == nil {
+		return nil, errors.New("service account ID is required")
+	}
+	iamService, err := c.iamServiceFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	account, err := iamService.Projects.ServiceAccounts.Get(accountId.ResourceName()).Context(ctx).Do()
+	if err != nil {
+		c.incrError("service_account")
+		return nil, fmt.Errorf("could not find service account '%s': %v", accountId.ResourceName(), err)
+	}
+	return account, nil
+}
+
+// ServiceAccountKey returns the service account key with the given ID,
+// including its public key data.
+func (c *Client) ServiceAccountKey(ctx context.Context, keyId *ServiceAccountKeyId) (*iam.ServiceAccountKey, error) {
+	defer c.measure("service_account_key", time.Now())
+	if keyId == nil {
+		return nil, errors.New("service account key ID is required")
+	}
+	iamService, err := c.iamServiceFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := iamService.Projects.ServiceAccounts.Keys.Get(keyId.ResourceName()).PublicKeyType(ServiceAccountKeyFileType).Context(ctx).Do()
+	if err != nil {
+		c.incrError("service_account_key")
+		return nil, fmt.Errorf("could not find service account key '%s': %v", keyId.ResourceName(), err)
+	}
+	return key, nil
+}
+
+// endpointsFor returns the client's endpoints with any overrides from the
+// context applied.
+func (c *Client) endpointsFor(ctx context.Context) *GCPEndpoints {
+	return resolveEndpoints(ctx, c.endpoints)
+}
+
+// iamServiceFor returns the IAM client for the context, creating a new one if
+// the IAM endpoint is overridden by the context.
+func (c *Client) iamServiceFor(ctx context.Context) (*iam.Service, error) {
+	endpoint := c.endpointsFor(ctx).IAM
+	if endpoint == c.endpoints.IAM {
+		return c.iamService, nil
+	}
+	svc, err := iam.NewService(ctx, option.WithHTTPClient(c.authClient), option.WithEndpoint(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create IAM client: %v", err)
+	}
+	return svc, nil
+}
+
+func (c *Client) measure(op string, start time.Time) {
+	key := []string{"gcputil", op}
+	if c.opts.Metrics != nil {
+		c.opts.Metrics.MeasureSince(key, start)
+	}
+	if e, ok := c.exporter.Load().(*MonitoringExporter); ok {
+		e.MeasureSince(key, start)
+	}
+}
+
+func (c *Client) incrError(op string) {
+	c.incrCounter([]string{"gcputil", op, "error"})
+}
+
+func (c *Client) incrRetry(op string) {
+	c.incrCounter([]string{"gcputil", op, "retry"})
+}
+
+// incrCache counts a hit or miss of one of the client's caches, from which
+// the MonitoringExporter derives a hit rate.
+func (c *Client) incrCache(cache string, hit bool) {
+	c.incrCounter(cacheLookupKey(cache, hit))
+}
+
+// cacheLookupKey returns the metric key counting hits or misses of a cache.
+func cacheLookupKey(cache string, hit bool) []string {
+	if hit {
+		return []string{"gcputil", cache, "cache_hit"}
+	}
+	return []string{"gcputil", cache, "cache_miss"}
+}
+
+func (c *Client) incrCounter(key []string) {
+	if c.opts.Metrics != nil {
+		c.opts.Metrics.IncrCounter(key, 1)
+	}
+	if e, ok := c.exporter.Load().(*MonitoringExporter); ok {
+		e.IncrCounter(key, 1)
+	}
+}
+
+func (c *Client) debug(msg string, args ...interface{}) {
+	if c.opts.Logger != nil {
+		c.opts.Logger.Debug(msg, args...)
+	}
+}
+
+func (c *Client) warn(msg string, args ...interface{}) {
+	if c.opts.Logger != nil {
+		c.opts.Logger.Warn(msg, args...)
+	}
+}
+
+// userAgentTransport sets the User-Agent header on every request.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// withTransport returns a copy of httpClient that uses the given transport.
+func withTransport(httpClient *http.Client, transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: httpClient.CheckRedirect,
+		Jar:           httpClient.Jar,
+		Timeout:       httpClient.Timeout,
+	}
+}
+
+func transportOrDefault(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+	return rt
+}
@@ -0,0 +1,212 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// InstanceLabels returns the labels of the given instance with keys and
+// values normalized to lower case, as expected by ParseGcpLabels-style
+// bound label checks. The returned map is never nil.
+func InstanceLabels(instance *compute.Instance) map[string]string {
+	labels := map[string]string{}
+	if instance == nil {
+		return labels
+	}
+	for k, v := range instance.Labels {
+		labels[normalizeLabel(k)] = normalizeLabel(v)
+	}
+	return labels
+}
+
+// InstanceNetworkTags returns the network tags of the given instance as a
+// set of lower-case tag names. The returned map is never nil.
+func InstanceNetworkTags(instance *compute.Instance) map[string]struct{} {
+	tags := map[string]struct{}{}
+	if instance == nil || instance.Tags == nil {
+		return tags
+	}
+	for _, tag := range instance.Tags.Items {
+		tags[normalizeLabel(tag)] = struct{}{}
+	}
+	return tags
+}
+
+// InstanceMetadata returns the custom metadata of the given instance as a
+// map. Metadata keys are case-sensitive and are returned unchanged; items
+// without a value are returned with an empty value. The returned map is
+// never nil.
+func InstanceMetadata(instance *compute.Instance) map[string]string {
+	metadata := map[string]string{}
+	if instance == nil || instance.Metadata == nil {
+		return metadata
+	}
+	for _, item := range instance.Metadata.Items {
+		if item == nil {
+			continue
+		}
+		value := ""
+		if item.Value != nil {
+			value = *item.Value
+		}
+		metadata[item.Key] = value
+	}
+	return metadata
+}
+
+// MissingLabels returns, in sorted "key:value" form, the required labels that
+// are absent from actual or have a different value. Keys and values are
+// compared case-insensitively. An empty result means all required labels are
+// present.
+func MissingLabels(required, actual map[string]string) []string {
+	normalized := make(map[string]string, len(actual))
+	for k, v := range actual {
+		normalized[normalizeLabel(k)] = normalizeLabel(v)
+	}
+
+	var missing []string
+	for k, v := range required {
+		k, v = normalizeLabel(k), normalizeLabel(v)
+		if actualV, ok := normalized[k]; !ok || actualV != v {
+			missing = append(missing, fmt.Sprintf("%s:%s", k, v))
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// MissingNetworkTags returns, in sorted order, the required tags that are not
+// present in actual. Tags are compared case-insensitively.
+func MissingNetworkTags(required []string, actual map[string]struct{}) []string {
+	var missing []string
+	for _, tag := range required {
+		tag = normalizeLabel(tag)
+		if _, ok := actual[tag]; !ok {
+			missing = append(missing, tag)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// MissingMetadata returns, in sorted order, the keys of required metadata
+// items that are absent from actual or have a different value. Unlike
+// labels, metadata keys and values are compared exactly.
+func MissingMetadata(required, actual map[string]string) []string {
+	var missing []string
+	for k, v := range required {
+		if actualV, ok := actual[k]; !ok || actualV != v {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// InstanceServiceAccount is a service account attached to a compute instance.
+type InstanceServiceAccount struct {
+	Email  string
+	Scopes []string
+}
+
+// InstanceServiceAccounts returns the service accounts attached to the given
+// instance, with the OAuth 2.0 scopes granted to each.
+func InstanceServiceAccounts(instance *compute.Instance) []InstanceServiceAccount {
+	if instance == nil {
+		return nil
+	}
+
+	accounts := make([]InstanceServiceAccount, 0, len(instance.ServiceAccounts))
+	for _, sa := range instance.ServiceAccounts {
+		if sa == nil || sa.Email == "" {
+			continue
+		}
+		accounts = append(accounts, InstanceServiceAccount{
+			Email:  sa.Email,
+			Scopes: append([]string(nil), sa.Scopes...),
+		})
+	}
+	return accounts
+}
+
+// InstanceHasServiceAccount reports whether the service account with the
+// given email is attached to the instance. Emails are compared
+// case-insensitively.
+func InstanceHasServiceAccount(instance *compute.Instance, email string) bool {
+	for _, sa := range InstanceServiceAccounts(instance) {
+		if strings.EqualFold(sa.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// errInstanceFound stops paging through instance group members once the
+// instance has been found.
+var errInstanceFound = errors.New("instance found")
+
+// InstanceInGroup reports whether the given instance is a member of the named
+// instance group. Location is either a zone, for zonal instance groups, or a
+// region, for regional instance groups. Both managed and unmanaged groups are
+// supported, as managed instance groups are backed by an instance group of
+// the same name.
+func InstanceInGroup(ctx context.Context, gceClient *compute.Service, project, location, groupName string, instance *compute.Instance) (bool, error) {
+	if instance == nil || instance.SelfLink == "" {
+		return false, errors.New("instance with self link is required")
+	}
+
+	matches := func(items []*compute.InstanceWithNamedPorts) error {
+		for _, item := range items {
+			if item != nil && selfLinksEqual(item.Instance, instance.SelfLink) {
+				return errInstanceFound
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if IsZone(location) {
+		req := &compute.InstanceGroupsListInstancesRequest{InstanceState: "ALL"}
+		err = gceClient.InstanceGroups.ListInstances(project, location, groupName, req).Pages(ctx, func(page *compute.InstanceGroupsListInstances) error {
+			return matches(page.Items)
+		})
+	} else {
+		req := &compute.RegionInstanceGroupsListInstancesRequest{InstanceState: "ALL"}
+		err = gceClient.RegionInstanceGroups.ListInstances(project, location, groupName, req).Pages(ctx, func(page *compute.RegionInstanceGroupsListInstances) error {
+			return matches(page.Items)
+		})
+	}
+
+	switch {
+	case err == errInstanceFound:
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("unable to list instances of group %q in %q: %v", groupName, location, err)
+	default:
+		return false, nil
+	}
+}
+
+// selfLinksEqual compares two compute self links, ignoring the scheme, host
+// and API version prefix.
+func selfLinksEqual(a, b string) bool {
+	trim := func(link string) string {
+		if idx := strings.Index(link, selfLinkMarker); idx >= 0 {
+			return link[idx:]
+		}
+		return link
+	}
+	return trim(a) == trim(b)
+}
+
+func normalizeLabel(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
@@ -0,0 +1,295 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+func TestInstanceLabelsTagsAndMetadata(t *testing.T) {
+	value := func(s string) *string { return &s }
+
+	tests := map[string]struct {
+		Instance *compute.Instance
+		Labels   map[string]string
+		Tags     map[string]struct{}
+		Metadata map[string]string
+	}{
+		"nil instance": {
+			Labels:   map[string]string{},
+			Tags:     map[string]struct{}{},
+			Metadata: map[string]string{},
+		},
+		"empty instance": {
+			Instance: &compute.Instance{},
+			Labels:   map[string]string{},
+			Tags:     map[string]struct{}{},
+			Metadata: map[string]string{},
+		},
+		"normalized labels and tags": {
+			Instance: &compute.Instance{
+				Labels: map[string]string{"Env": " Prod ", "team": "infra"},
+				Tags:   &compute.Tags{Items: []string{"HTTP-Server", "vault"}},
+			},
+			Labels:   map[string]string{"env": "prod", "team": "infra"},
+			Tags:     map[string]struct{}{"http-server": {}, "vault": {}},
+			Metadata: map[string]string{},
+		},
+		"metadata kept verbatim": {
+			Instance: &compute.Instance{
+				Metadata: &compute.Metadata{Items: []*compute.MetadataItems{
+					{Key: "Role", Value: value("Vault-Server")},
+					{Key: "enable-oslogin"},
+					nil,
+				}},
+			},
+			Labels:   map[string]string{},
+			Tags:     map[string]struct{}{},
+			Metadata: map[string]string{"Role": "Vault-Server", "enable-oslogin": ""},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if labels := InstanceLabels(test.Instance); !reflect.DeepEqual(labels, test.Labels) {
+				t.Errorf("expected labels %v, got %v", test.Labels, labels)
+			}
+			if tags := InstanceNetworkTags(test.Instance); !reflect.DeepEqual(tags, test.Tags) {
+				t.Errorf("expected tags %v, got %v", test.Tags, tags)
+			}
+			if metadata := InstanceMetadata(test.Instance); !reflect.DeepEqual(metadata, test.Metadata) {
+				t.Errorf("expected metadata %v, got %v", test.Metadata, metadata)
+			}
+		})
+	}
+}
+
+func TestMissingLabels(t *testing.T) {
+	actual := InstanceLabels(&compute.Instance{Labels: map[string]string{"Env": "Prod", "team": "infra"}})
+
+	tests := map[string]struct {
+		Required map[string]string
+		Expected []string
+	}{
+		"none required":         {},
+		"all present":           {Required: map[string]string{"env": "prod", "team": "infra"}},
+		"case insensitive":      {Required: map[string]string{"ENV": "PROD"}},
+		"missing key":           {Required: map[string]string{"env": "prod", "owner": "alice"}, Expected: []string{"owner:alice"}},
+		"different value":       {Required: map[string]string{"env": "dev"}, Expected: []string{"env:dev"}},
+		"normalized and sorted": {Required: map[string]string{"Zone": "B", "Area": "A"}, Expected: []string{"area:a", "zone:b"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if missing := MissingLabels(test.Required, actual); !reflect.DeepEqual(missing, test.Expected) {
+				t.Fatalf("expected %v, got %v", test.Expected, missing)
+			}
+		})
+	}
+}
+
+func TestMissingNetworkTags(t *testing.T) {
+	actual := InstanceNetworkTags(&compute.Instance{Tags: &compute.Tags{Items: []string{"HTTP-Server", "vault"}}})
+
+	tests := map[string]struct {
+		Required []string
+		Expected []string
+	}{
+		"none required":    {},
+		"all present":      {Required: []string{"vault", "http-server"}},
+		"case insensitive": {Required: []string{"Vault"}},
+		"missing sorted":   {Required: []string{"vault", "ssh", "db"}, Expected: []string{"db", "ssh"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if missing := MissingNetworkTags(test.Required, actual); !reflect.DeepEqual(missing, test.Expected) {
+				t.Fatalf("expected %v, got %v", test.Expected, missing)
+			}
+		})
+	}
+}
+
+func TestMissingMetadata(t *testing.T) {
+	actual := map[string]string{"Role": "Vault-Server", "enable-oslogin": ""}
+
+	tests := map[string]struct {
+		Required map[string]string
+		Expected []string
+	}{
+		"none required":       {},
+		"all present":         {Required: map[string]string{"Role": "Vault-Server", "enable-oslogin": ""}},
+		"case sensitive key":  {Required: map[string]string{"role": "Vault-Server"}, Expected: []string{"role"}},
+		"case sensitive":      {Required: map[string]string{"Role": "vault-server"}, Expected: []string{"Role"}},
+		"missing keys sorted": {Required: map[string]string{"b": "", "a": "x"}, Expected: []string{"a", "b"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if missing := MissingMetadata(test.Required, actual); !reflect.DeepEqual(missing, test.Expected) {
+				t.Fatalf("expected %v, got %v", test.Expected, missing)
+			}
+		})
+	}
+}
+
+// fakeInstanceGroupServer serves the members of zonal and regional instance
+// groups, one instance per page.
+type fakeInstanceGroupServer struct {
+	groups map[string][]string
+}
+
+func (s *fakeInstanceGroupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	members, ok := s.groups[r.URL.Path]
+	if !ok || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"not found"}}`))
+		return
+	}
+
+	page := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		json.Unmarshal([]byte(token), &page)
+	}
+	resp := &compute.InstanceGroupsListInstances{}
+	if page < len(members) {
+		resp.Items = []*compute.InstanceWithNamedPorts{{Instance: members[page], Status: "RUNNING"}}
+	}
+	if page+1 < len(members) {
+		next, _ := json.Marshal(page + 1)
+		resp.NextPageToken = string(next)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestInstanceInGroup(t *testing.T) {
+	const (
+		zonalPath    = "/compute/v1/projects/p/zones/us-central1-a/instanceGroups/web/listInstances"
+		regionalPath = "/compute/v1/projects/p/regions/us-central1/instanceGroups/web/listInstances"
+		selfLink     = "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a/instances/web-2"
+	)
+	members := []string{
+		"https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a/instances/web-1",
+		"https://compute.googleapis.com/compute/v1/projects/p/zones/us-central1-a/instances/web-2",
+	}
+
+	srv := httptest.NewServer(&fakeInstanceGroupServer{groups: map[string][]string{
+		zonalPath:    members,
+		regionalPath: members,
+	}})
+	t.Cleanup(srv.Close)
+	gceClient, err := compute.NewService(context.Background(), option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/compute/v1/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		Location    string
+		Group       string
+		Instance    *compute.Instance
+		Expected    bool
+		ShouldError bool
+	}{
+		"zonal member on a later page": {
+			Location: "us-central1-a",
+			Group:    "web",
+			Instance: &compute.Instance{SelfLink: selfLink},
+			Expected: true,
+		},
+		"regional member": {
+			Location: "us-central1",
+			Group:    "web",
+			Instance: &compute.Instance{SelfLink: selfLink},
+			Expected: true,
+		},
+		"not a member": {
+			Location: "us-central1-a",
+			Group:    "web",
+			Instance: &compute.Instance{SelfLink: "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a/instances/db-1"},
+		},
+		"unknown group": {
+			Location:    "us-central1-a",
+			Group:       "db",
+			Instance:    &compute.Instance{SelfLink: selfLink},
+			ShouldError: true,
+		},
+		"instance without self link": {
+			Location:    "us-central1-a",
+			Group:       "web",
+			Instance:    &compute.Instance{Name: "web-2"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			member, err := InstanceInGroup(context.Background(), gceClient, "p", test.Location, test.Group, test.Instance)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if member != test.Expected {
+				t.Fatalf("expected %t, got %t", test.Expected, member)
+			}
+		})
+	}
+}
+
+func TestInstanceServiceAccounts(t *testing.T) {
+	instance := &compute.Instance{ServiceAccounts: []*compute.ServiceAccount{
+		{Email: "vault@p.iam.gserviceaccount.com", Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"}},
+		nil,
+		{Scopes: []string{"https://www.googleapis.com/auth/userinfo.email"}},
+		{Email: "logger@p.iam.gserviceaccount.com"},
+	}}
+
+	expected := []InstanceServiceAccount{
+		{Email: "vault@p.iam.gserviceaccount.com", Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"}},
+		{Email: "logger@p.iam.gserviceaccount.com"},
+	}
+	accounts := InstanceServiceAccounts(instance)
+	if !reflect.DeepEqual(accounts, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, accounts)
+	}
+	accounts[0].Scopes[0] = "changed"
+	if instance.ServiceAccounts[0].Scopes[0] == "changed" {
+		t.Fatal("expected scopes to be copied")
+	}
+	if accounts := InstanceServiceAccounts(nil); accounts != nil {
+		t.Fatalf("expected no service accounts for a nil instance, got %+v", accounts)
+	}
+
+	tests := map[string]struct {
+		Instance *compute.Instance
+		Email    string
+		Expected bool
+	}{
+		"attached":         {Instance: instance, Email: "vault@p.iam.gserviceaccount.com", Expected: true},
+		"case insensitive": {Instance: instance, Email: "Vault@P.iam.gserviceaccount.com", Expected: true},
+		"not attached":     {Instance: instance, Email: "other@p.iam.gserviceaccount.com"},
+		"empty email":      {Instance: instance},
+		"nil instance":     {Email: "vault@p.iam.gserviceaccount.com"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if has := InstanceHasServiceAccount(test.Instance, test.Email); has != test.Expected {
+				t.Fatalf("expected %t, got %t", test.Expected, has)
+			}
+		})
+	}
+}
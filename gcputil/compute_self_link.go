@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultComputeSelfLinkPrefix is the prefix of self links returned by the
+// Compute Engine v1 API.
+const defaultComputeSelfLinkPrefix = "https://www.googleapis.com/compute/v1/"
+
+var zoneRegex = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+-[a-z]$`)
+
+var regionRegex = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+$`)
+
+// IsZone reports whether location looks like a zone name, e.g. "us-central1-a".
+func IsZone(location string) bool {
+	return zoneRegex.MatchString(location)
+}
+
+// IsRegion reports whether location looks like a region name, e.g. "us-central1".
+func IsRegion(location string) bool {
+	return regionRegex.MatchString(location)
+}
+
+// ZoneToRegion returns the region containing the given zone, e.g.
+// "us-central1" for "us-central1-a".
+func ZoneToRegion(zone string) (string, error) {
+	if !IsZone(zone) {
+		return "", fmt.Errorf("invalid zone '%s'", zone)
+	}
+	return zone[:strings.LastIndex(zone, "-")], nil
+}
+
+// ComputeResource identifies a Compute Engine resource by its project,
+// location and name, as found in a self link.
+type ComputeResource struct {
+	// Project is the project ID.
+	Project string
+
+	// Zone is set for zonal resources, e.g. instances.
+	Zone string
+
+	// Region is set for regional resources and, derived from Zone, for zonal
+	// resources.
+	Region string
+
+	// Collection is the resource collection, e.g. "instances" or "instanceGroups".
+	Collection string
+
+	// Name is the resource name.
+	Name string
+}
+
+// ParseComputeSelfLink parses a Compute Engine self link such as
+// https://www.googleapis.com/compute/v1/projects/P/zones/Z/instances/N into a
+// ComputeResource. Global resources (projects/P/global/C/N) have neither a
+// zone nor a region.
+func ParseComputeSelfLink(link string) (*ComputeResource, error) {
+	selfLink, err := ParseProjectResourceSelfLink(link)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := selfLink.OrderedCollectionIds
+	if len(ids) < 2 || len(ids) > 3 || ids[0] != "projects" {
+		return nil, fmt.Errorf("self link '%s' is not a compute resource self link", link)
+	}
+
+	resource := &ComputeResource{
+		Project:    selfLink.IdTuples["projects"],
+		Collection: ids[len(ids)-1],
+		Name:       selfLink.IdTuples[ids[len(ids)-1]],
+	}
+	if len(ids) == 3 {
+		switch ids[1] {
+		case "zones":
+			resource.Zone = selfLink.IdTuples["zones"]
+			if resource.Region, err = ZoneToRegion(resource.Zone); err != nil {
+				return nil, fmt.Errorf("self link '%s' has %v", link, err)
+			}
+		case "regions":
+			resource.Region = selfLink.IdTuples["regions"]
+		default:
+			return nil, fmt.Errorf("self link '%s' has unexpected location collection '%s'", link, ids[1])
+		}
+	}
+	return resource, nil
+}
+
+// SelfLink returns the Compute Engine v1 self link of the resource.
+func (r *ComputeResource) SelfLink() string {
+	return defaultComputeSelfLinkPrefix + r.RelativeName()
+}
+
+// RelativeName returns the resource path relative to the API version, e.g.
+// projects/P/zones/Z/instances/N.
+func (r *ComputeResource) RelativeName() string {
+	switch {
+	case r.Zone != "":
+		return fmt.Sprintf("projects/%s/zones/%s/%s/%s", r.Project, r.Zone, r.Collection, r.Name)
+	case r.Region != "":
+		return fmt.Sprintf("projects/%s/regions/%s/%s/%s", r.Project, r.Region, r.Collection, r.Name)
+	default:
+		return fmt.Sprintf("projects/%s/global/%s/%s", r.Project, r.Collection, r.Name)
+	}
+}
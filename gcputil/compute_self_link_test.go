@@ -0,0 +1,74 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"testing"
+)
+
+func TestZoneToRegion(t *testing.T) {
+	testCases := map[string]struct {
+		Expected    string
+		ShouldError bool
+	}{
+		"us-central1-a":             {Expected: "us-central1"},
+		"europe-west4-c":            {Expected: "europe-west4"},
+		"northamerica-northeast1-b": {Expected: "northamerica-northeast1"},
+		"us-central1":               {ShouldError: true},
+		"":                          {ShouldError: true},
+	}
+
+	for k, testCase := range testCases {
+		actual, err := ZoneToRegion(k)
+		if testCase.ShouldError {
+			if err == nil {
+				t.Errorf("input '%s' should have returned error, instead got: %s", k, actual)
+			}
+			continue
+		}
+		if err != nil || actual != testCase.Expected {
+			t.Errorf("input '%s': expected %s, got %s (err: %v)", k, testCase.Expected, actual, err)
+		}
+	}
+}
+
+func TestParseComputeSelfLink(t *testing.T) {
+	testCases := map[string]struct {
+		Expected    *ComputeResource
+		ShouldError bool
+	}{
+		"":                 {ShouldError: true},
+		"projects/p/zones": {ShouldError: true},
+		"https://www.googleapis.com/compute/v1/projects/p/foos/f/instances/i": {ShouldError: true},
+		"https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a/instances/i": {
+			Expected: &ComputeResource{Project: "p", Zone: "us-central1-a", Region: "us-central1", Collection: "instances", Name: "i"},
+		},
+		"https://www.googleapis.com/compute/v1/projects/p/regions/us-central1/instanceGroups/g": {
+			Expected: &ComputeResource{Project: "p", Region: "us-central1", Collection: "instanceGroups", Name: "g"},
+		},
+		"https://www.googleapis.com/compute/v1/projects/p/global/networks/n": {
+			Expected: &ComputeResource{Project: "p", Collection: "networks", Name: "n"},
+		},
+	}
+
+	for k, testCase := range testCases {
+		actual, err := ParseComputeSelfLink(k)
+		if testCase.ShouldError {
+			if err == nil {
+				t.Errorf("input '%s' should have returned error, instead got: %v", k, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("input '%s' returned error: %s", k, err)
+			continue
+		}
+		if *actual != *testCase.Expected {
+			t.Errorf("input '%s': expected %+v, got %+v", k, testCase.Expected, actual)
+		}
+		if actual.SelfLink() != k {
+			t.Errorf("input '%s': self link round trip returned %s", k, actual.SelfLink())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrCredentialsNotFound is returned by a CredentialManager for names it
+// holds no credentials for, and by a SecretManagerCredentialSource for secret
+// versions that do not exist.
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// CredentialManagerOptions configures a CredentialManager.
+type CredentialManagerOptions struct {
+	// Scopes are requested for credentials put without scopes. Defaults to
+	// cloud-platform.
+	Scopes []string
+
+	// HTTPClient is used for token requests. Defaults to the client set with
+	// SetDefaultHTTPClient, or a client of the package's shared pooled
+	// transport.
+	HTTPClient *http.Client
+}
+
+// CredentialManager holds named credential configurations, e.g. one per
+// tenant or Vault mount, each with its own cached token source. It is safe
+// for concurrent use.
+type CredentialManager struct {
+	opts CredentialManagerOptions
+
+	mu      sync.RWMutex
+	entries map[string]*managedCredentials
+}
+
+type managedCredentials struct {
+	creds *GcpCredentials
+	ts    oauth2.TokenSource
+}
+
+// NewCredentialManager returns an empty CredentialManager.
+func NewCredentialManager(opts *CredentialManagerOptions) *CredentialManager {
+	m := &CredentialManager{entries: make(map[string]*managedCredentials)}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if len(m.opts.Scopes) == 0 {
+		m.opts.Scopes = defaultTokenAuthScopes
+	}
+	if m.opts.HTTPClient == nil {
+		m.opts.HTTPClient = packageHTTPClient()
+	}
+	return m
+}
+
+// Put parses the credential JSON and stores it under name, replacing any
+// credentials stored under it. Scopes default to the manager's scopes.
+func (m *CredentialManager) Put(name, credentialsJSON string, scopes ...string) error {
+	entry, err := m.newEntry(name, credentialsJSON, scopes)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.entries[name] = entry
+	m.mu.Unlock()
+	return nil
+}
+
+// Rotate replaces the credentials stored under name and returns the
+// previous credentials, e.g. to delete the previous service account key.
+// The new credentials get a new token cache. An error wrapping
+// ErrCredentialsNotFound is returned if no credentials are stored under
+// name.
+func (m *CredentialManager) Rotate(name, credentialsJSON string, scopes ...string) (*GcpCredentials, error) {
+	entry, err := m.newEntry(name, credentialsJSON, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev, ok := m.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrCredentialsNotFound, name)
+	}
+	m.entries[name] = entry
+	return prev.creds, nil
+}
+
+// Get returns the credentials stored under name and their token source. An
+// error wrapping ErrCredentialsNotFound is returned if there are none.
+func (m *CredentialManager) Get(name string) (*GcpCredentials, oauth2.TokenSource, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.entries[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrCredentialsNotFound, name)
+	}
+	return entry.creds, entry.ts, nil
+}
+
+// TokenSource returns a token source for the credentials stored under name
+// that follows later Put and Rotate calls for that name.
+func (m *CredentialManager) TokenSource(name string) oauth2.TokenSource {
+	return managedTokenSource{m: m, name: name}
+}
+
+type managedTokenSource struct {
+	m    *CredentialManager
+	name string
+}
+
+func (ts managedTokenSource) Token() (*oauth2.Token, error) {
+	_, source, err := ts.m.Get(ts.name)
+	if err != nil {
+		return nil, err
+	}
+	return source.Token()
+}
+
+// Delete removes the credentials stored under name, if any.
+func (m *CredentialManager) Delete(name string) {
+	m.mu.Lock()
+	delete(m.entries, name)
+	m.mu.Unlock()
+}
+
+// Names returns the sorted names of the stored credentials.
+func (m *CredentialManager) Names() []string {
+	m.mu.RLock()
+	names := make([]string, 0, len(m.entries))
+	for name := range m.entries {
+		names = append(names, name)
+	}
+	m.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+func (m *CredentialManager) newEntry(name, credentialsJSON string, scopes []string) (*managedCredentials, error) {
+	if name == "" {
+		return nil, errors.New("credentials name is required")
+	}
+	creds, err := Credentials(credentialsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials %q: %v", name, err)
+	}
+	if len(scopes) == 0 {
+		scopes = m.opts.Scopes
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, m.opts.HTTPClient)
+	ts, err := credentialsTokenSource(ctx, creds, credentialsJSON, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create token source for credentials %q: %v", name, err)
+	}
+	return &managedCredentials{creds: creds, ts: oauth2.ReuseTokenSource(nil, ts)}, nil
+}
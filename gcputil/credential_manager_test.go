@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCredentialManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token-` + r.FormValue("client_id") + `","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+	userJSON := func(clientID string) string {
+		return `{"type":"authorized_user","client_id":"` + clientID + `","client_secret":"s","refresh_token":"r","token_uri":"` + srv.URL + `"}`
+	}
+
+	m := NewCredentialManager(nil)
+	if err := m.Put("tenant-a", userJSON("a1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put("tenant-b", userJSON("b1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put("tenant-c", `{"type":"authorized_user"}`); err == nil {
+		t.Fatal("expected error for invalid credentials")
+	}
+	if got := m.Names(); !reflect.DeepEqual(got, []string{"tenant-a", "tenant-b"}) {
+		t.Fatalf("unexpected names %v", got)
+	}
+
+	ts := m.TokenSource("tenant-a")
+	tok, err := ts.Token()
+	if err != nil || tok.AccessToken != "token-a1" {
+		t.Fatalf("expected token-a1, got %v (err: %v)", tok, err)
+	}
+
+	prev, err := m.Rotate("tenant-a", userJSON("a2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev.ClientId != "a1" {
+		t.Fatalf("unexpected previous credentials %+v", prev)
+	}
+	if tok, err := ts.Token(); err != nil || tok.AccessToken != "token-a2" {
+		t.Fatalf("expected token-a2 after rotation, got %v (err: %v)", tok, err)
+	}
+	if _, err := m.Rotate("missing", userJSON("x")); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("expected ErrCredentialsNotFound, got %v", err)
+	}
+
+	m.Delete("tenant-b")
+	if _, _, err := m.Get("tenant-b"); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("expected ErrCredentialsNotFound, got %v", err)
+	}
+	if creds, _, err := m.Get("tenant-a"); err != nil || creds.ClientId != "a2" {
+		t.Fatalf("unexpected credentials %+v (err: %v)", creds, err)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+)
+
+// Values of the type field of Google credential JSON files.
+const (
+	CredentialTypeServiceAccount             = "service_account"
+	CredentialTypeExternalAccount            = "external_account"
+	CredentialTypeImpersonatedServiceAccount = "impersonated_service_account"
+	CredentialTypeAuthorizedUser             = "authorized_user"
+)
+
+// serviceAccountImpersonationURLRegex splits the
+// service_account_impersonation_url of external accounts and impersonated
+// service accounts into the IAM Credentials endpoint and the service account
+// email.
+var serviceAccountImpersonationURLRegex = regexp.MustCompile(`^(https?://[^/]+)/v1/projects/-/serviceAccounts/([^/:]+):generateAccessToken$`)
+
+// externalAccountFile is the external_account (workload identity federation)
+// credential configuration format.
+type externalAccountFile struct {
+	Audience                       string          `json:"audience"`
+	SubjectTokenType               string          `json:"subject_token_type"`
+	TokenURL                       string          `json:"token_url"`
+	ServiceAccountImpersonationURL string          `json:"service_account_impersonation_url"`
+	CredentialSource               json.RawMessage `json:"credential_source"`
+}
+
+// parseExternalAccount validates an external_account configuration and sets
+// the credentials' ClientEmail to the impersonated service account, if any.
+func parseExternalAccount(creds *GcpCredentials, credentialsJSON string) error {
+	var f externalAccountFile
+	if err := json.Unmarshal([]byte(credentialsJSON), &f); err != nil {
+		return err
+	}
+	switch {
+	case f.Audience == "":
+		return errors.New("external account credentials are missing audience")
+	case f.SubjectTokenType == "":
+		return errors.New("external account credentials are missing subject_token_type")
+	case len(f.CredentialSource) == 0 || string(f.CredentialSource) == "null":
+		return errors.New("external account credentials are missing credential_source")
+	}
+	if f.ServiceAccountImpersonationURL != "" {
+		m := serviceAccountImpersonationURLRegex.FindStringSubmatch(f.ServiceAccountImpersonationURL)
+		if m == nil {
+			return fmt.Errorf("invalid service_account_impersonation_url %q", f.ServiceAccountImpersonationURL)
+		}
+		creds.ClientEmail = m[2]
+	}
+	return nil
+}
+
+// impersonatedServiceAccountFile is the impersonated_service_account
+// credential format, e.g. written by
+// `gcloud auth application-default login --impersonate-service-account`.
+type impersonatedServiceAccountFile struct {
+	ServiceAccountImpersonationURL string          `json:"service_account_impersonation_url"`
+	Delegates                      []string        `json:"delegates"`
+	SourceCredentials              json.RawMessage `json:"source_credentials"`
+}
+
+// parseImpersonatedServiceAccount parses an impersonated_service_account
+// configuration, setting the credentials' ClientEmail to the target service
+// account. It returns the IAM Credentials endpoint and the parsed file.
+func parseImpersonatedServiceAccount(creds *GcpCredentials, credentialsJSON string) (string, *impersonatedServiceAccountFile, error) {
+	var f impersonatedServiceAccountFile
+	if err := json.Unmarshal([]byte(credentialsJSON), &f); err != nil {
+		return "", nil, err
+	}
+	if len(f.SourceCredentials) == 0 || string(f.SourceCredentials) == "null" {
+		return "", nil, errors.New("impersonated service account credentials are missing source_credentials")
+	}
+	m := serviceAccountImpersonationURLRegex.FindStringSubmatch(f.ServiceAccountImpersonationURL)
+	if m == nil {
+		return "", nil, fmt.Errorf("invalid service_account_impersonation_url %q", f.ServiceAccountImpersonationURL)
+	}
+	creds.ClientEmail = m[2]
+	return m[1], &f, nil
+}
+
+// impersonatedServiceAccountTokenSource returns a token source that
+// impersonates the target of impersonated_service_account credentials, via
+// their delegates, with a token from their source credentials.
+func impersonatedServiceAccountTokenSource(ctx context.Context, credentialsJSON string, scopes []string) (oauth2.TokenSource, error) {
+	target := &GcpCredentials{}
+	endpoint, f, err := parseImpersonatedServiceAccount(target, credentialsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := Credentials(string(f.SourceCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("invalid source credentials: %v", err)
+	}
+	if source.Type == CredentialTypeImpersonatedServiceAccount {
+		return nil, errors.New("source credentials of impersonated service account credentials cannot themselves be impersonated")
+	}
+	// The source credentials need the cloud-platform scope to call the IAM
+	// Credentials API.
+	sourceTS, err := credentialsTokenSource(ctx, source, string(f.SourceCredentials), defaultTokenAuthScopes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source credentials: %v", err)
+	}
+
+	httpClient, _ := ctx.Value(oauth2.HTTPClient).(*http.Client)
+	c, err := NewClient(ctx, &Options{
+		TokenSource: sourceTS,
+		Endpoints:   &GCPEndpoints{IAMCredentials: endpoint},
+		HTTPClient:  httpClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.ImpersonatedTokenSource(nil, target.ClientEmail, f.Delegates, scopes, 0)
+}
+
+// isServiceAccountType reports whether credentials of the given type are a
+// service account key. Keys without a type are service account keys.
+func isServiceAccountType(t string) bool {
+	return t == "" || t == CredentialTypeServiceAccount
+}
+
+// withServiceAccountType returns the service account key credentialsJSON with
+// its type set, as the google package rejects keys without one.
+func withServiceAccountType(credentialsJSON string) ([]byte, error) {
+	var key map[string]interface{}
+	if err := json.Unmarshal([]byte(credentialsJSON), &key); err != nil {
+		return nil, err
+	}
+	key["type"] = CredentialTypeServiceAccount
+	return json.Marshal(key)
+}
+
+// isSupportedCredentialType reports whether credentialsTokenSource handles
+// credentials of the given type.
+func isSupportedCredentialType(t string) bool {
+	switch t {
+	case "", CredentialTypeServiceAccount, CredentialTypeExternalAccount,
+		CredentialTypeImpersonatedServiceAccount, CredentialTypeAuthorizedUser:
+		return true
+	}
+	return false
+}
+
+// serviceAccountTokenSource returns a token source for service account key
+// credentials, which exchanges JWT assertions at the credentials' token URL.
+// Outside the default universe, self-signed JWTs are used unless a token URL
+// is set.
+func serviceAccountTokenSource(ctx context.Context, creds *GcpCredentials, scopes []string) (oauth2.TokenSource, error) {
+	tokenURL := creds.TokenURL
+	if tokenURL == "" {
+		if !creds.isDefaultUniverse() {
+			// Other universes have no OAuth 2.0 token endpoint; their APIs
+			// accept self-signed JWTs.
+			return NewSelfSignedJWTTokenSource(creds, scopes...)
+		}
+		tokenURL = serviceAccountTokenURL
+	}
+	if creds.AssertionSigner != nil {
+		return newAssertionTokenSource(ctx, creds.AssertionSigner, creds.ClientEmail, creds.Subject, scopes, tokenURL), nil
+	}
+	if creds.PrivateKeyPassphrase != nil {
+		// jwt.Config cannot decrypt keys; sign with the decrypted key.
+		key, err := creds.Signer()
+		if err != nil {
+			return nil, err
+		}
+		signer, err := NewCryptoAssertionSigner(creds.PrivateKeyId, key)
+		if err != nil {
+			return nil, err
+		}
+		return newAssertionTokenSource(ctx, signer, creds.ClientEmail, creds.Subject, scopes, tokenURL), nil
+	}
+	if FIPSMode() && creds.HasPrivateKey() {
+		// jwt.Config parses the key itself; check it complies beforehand.
+		key, err := creds.Signer()
+		if err != nil {
+			return nil, err
+		}
+		ZeroizeSigner(key)
+	}
+	conf := jwt.Config{
+		Email:      creds.ClientEmail,
+		PrivateKey: []byte(creds.PrivateKey),
+		Scopes:     scopes,
+		TokenURL:   tokenURL,
+		Subject:    creds.Subject,
+	}
+	return conf.TokenSource(ctx), nil
+}
+
+// credentialsTokenSource returns a token source for parsed credentials of a
+// supported type.
+func credentialsTokenSource(ctx context.Context, creds *GcpCredentials, credentialsJSON string, scopes []string) (oauth2.TokenSource, error) {
+	switch creds.Type {
+	case "", CredentialTypeServiceAccount:
+		return serviceAccountTokenSource(ctx, creds, scopes)
+	case CredentialTypeExternalAccount:
+		if len(scopes) == 0 {
+			scopes = defaultTokenAuthScopes
+		}
+		if _, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); !ok {
+			ctx = context.WithValue(ctx, oauth2.HTTPClient, packageHTTPClient())
+		}
+		gcreds, err := google.CredentialsFromJSON(ctx, []byte(credentialsJSON), scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse external account credentials: %v", err)
+		}
+		return gcreds.TokenSource, nil
+	case CredentialTypeImpersonatedServiceAccount:
+		return impersonatedServiceAccountTokenSource(ctx, credentialsJSON, scopes)
+	case CredentialTypeAuthorizedUser:
+		f, err := parseAuthorizedUser(credentialsJSON)
+		if err != nil {
+			return nil, err
+		}
+		httpClient, ok := ctx.Value(oauth2.HTTPClient).(*http.Client)
+		if !ok {
+			httpClient = packageHTTPClient()
+		}
+		return NewRefreshTokenSource(&RefreshTokenOptions{
+			ClientID:     f.ClientID,
+			ClientSecret: f.ClientSecret,
+			RefreshToken: f.RefreshToken,
+			TokenURL:     f.TokenURI,
+			Scopes:       scopes,
+			HTTPClient:   httpClient,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported credential type %q", creds.Type)
+	}
+}
+
+// authorizedUserFile is the authorized_user credential format, e.g. written
+// by `gcloud auth application-default login`.
+type authorizedUserFile struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	TokenURI     string `json:"token_uri"`
+}
+
+func parseAuthorizedUser(credentialsJSON string) (*authorizedUserFile, error) {
+	var f authorizedUserFile
+	if err := json.Unmarshal([]byte(credentialsJSON), &f); err != nil {
+		return nil, err
+	}
+	if f.ClientID == "" || f.ClientSecret == "" || f.RefreshToken == "" {
+		return nil, errors.New("authorized user credentials require client_id, client_secret and refresh_token")
+	}
+	return &f, nil
+}
@@ -0,0 +1,253 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestFindCredentials_externalAccount(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	sts.ExpectSubjectToken("oidc-token")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("oidc-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const audience = "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider"
+
+	tests := map[string]struct {
+		Config      map[string]interface{}
+		ClientEmail string
+		ShouldError bool
+	}{
+		"file source": {
+			Config: map[string]interface{}{
+				"type":               "external_account",
+				"audience":           audience,
+				"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+				"token_url":          sts.TokenURL(),
+				"credential_source":  map[string]string{"file": tokenFile},
+			},
+		},
+		"impersonation email": {
+			Config: map[string]interface{}{
+				"type":                              "external_account",
+				"audience":                          audience,
+				"subject_token_type":                "urn:ietf:params:oauth:token-type:jwt",
+				"token_url":                         sts.TokenURL(),
+				"credential_source":                 map[string]string{"file": tokenFile},
+				"service_account_impersonation_url": "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa@p.iam.gserviceaccount.com:generateAccessToken",
+			},
+			ClientEmail: "sa@p.iam.gserviceaccount.com",
+		},
+		"missing credential source": {
+			Config: map[string]interface{}{
+				"type":               "external_account",
+				"audience":           audience,
+				"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+				"token_url":          sts.TokenURL(),
+			},
+			ShouldError: true,
+		},
+		"unsupported type": {
+			Config:      map[string]interface{}{"type": "something_else"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvOAuthAccessToken, "")
+			configJSON, err := json.Marshal(test.Config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			creds, ts, err := FindCredentials(string(configJSON), context.Background())
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.Type != CredentialTypeExternalAccount || creds.ClientEmail != test.ClientEmail {
+				t.Fatalf("unexpected credentials %+v", creds)
+			}
+			if test.ClientEmail != "" {
+				// Impersonation is not served by the fake STS server.
+				return
+			}
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != "federated-token" {
+				t.Fatalf("unexpected token %+v", tok)
+			}
+		})
+	}
+}
+
+func TestFindCredentials_impersonatedServiceAccount(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("oidc-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := map[string]interface{}{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          sts.TokenURL(),
+		"credential_source":  map[string]string{"file": tokenFile},
+	}
+	const target = "target@p.iam.gserviceaccount.com"
+
+	tests := map[string]struct {
+		Config      map[string]interface{}
+		ShouldError bool
+	}{
+		"delegates": {
+			Config: map[string]interface{}{
+				"type":                              "impersonated_service_account",
+				"service_account_impersonation_url": iamCreds.URL + "/v1/projects/-/serviceAccounts/" + target + ":generateAccessToken",
+				"delegates":                         []string{"hop@p.iam.gserviceaccount.com"},
+				"source_credentials":                source,
+			},
+		},
+		"missing source": {
+			Config: map[string]interface{}{
+				"type":                              "impersonated_service_account",
+				"service_account_impersonation_url": iamCreds.URL + "/v1/projects/-/serviceAccounts/" + target + ":generateAccessToken",
+			},
+			ShouldError: true,
+		},
+		"invalid url": {
+			Config: map[string]interface{}{
+				"type":                              "impersonated_service_account",
+				"service_account_impersonation_url": iamCreds.URL + "/v1/" + target,
+				"source_credentials":                source,
+			},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvOAuthAccessToken, "")
+			configJSON, err := json.Marshal(test.Config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			creds, ts, err := FindCredentials(string(configJSON), context.Background())
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.Type != CredentialTypeImpersonatedServiceAccount || creds.ClientEmail != target {
+				t.Fatalf("unexpected credentials %+v", creds)
+			}
+
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != "iam-access-token-"+target {
+				t.Fatalf("unexpected token %+v", tok)
+			}
+			reqs := iamCreds.RequestsFor(testutil.MethodGenerateAccessToken)
+			if len(reqs) != 1 || reqs[0].Authorization != "Bearer federated-token" {
+				t.Fatalf("expected one request authenticated with the source token, got %+v", reqs)
+			}
+			if delegates, _ := reqs[0].Body["delegates"].([]interface{}); len(delegates) != 1 {
+				t.Fatalf("expected delegates in request, got %v", reqs[0].Body)
+			}
+		})
+	}
+}
+
+func TestFindCredentials_authorizedUser(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("refresh_token") != "refresh" || r.FormValue("client_id") != "client" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"user-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	tests := map[string]struct {
+		Config      map[string]string
+		ShouldError bool
+	}{
+		"refresh token": {
+			Config: map[string]string{
+				"type":          "authorized_user",
+				"client_id":     "client",
+				"client_secret": "secret",
+				"refresh_token": "refresh",
+				"token_uri":     srv.URL,
+			},
+		},
+		"missing refresh token": {
+			Config:      map[string]string{"type": "authorized_user", "client_id": "client", "client_secret": "secret"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvOAuthAccessToken, "")
+			configJSON, err := json.Marshal(test.Config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			creds, ts, err := FindCredentials(string(configJSON), context.Background())
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.Type != CredentialTypeAuthorizedUser || creds.HasPrivateKey() {
+				t.Fatalf("unexpected credentials %+v", creds)
+			}
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != "user-token" {
+				t.Fatalf("unexpected token %+v", tok)
+			}
+		})
+	}
+}
@@ -11,26 +11,24 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/hashicorp/go-cleanhttp"
-	"github.com/mitchellh/go-homedir"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/google/externalaccount"
-	"golang.org/x/oauth2/jwt"
 	"google.golang.org/api/googleapi"
 )
 
 const (
 	defaultHomeCredentialsFile = ".gcp/credentials"
 
+	// serviceAccountTokenURL is the token endpoint for service account JWT
+	// assertions.
+	serviceAccountTokenURL = "https://accounts.google.com/o/oauth2/token"
+
 	// Default service endpoint for interaction with Google APIs
 	// https://cloud.google.com/apis/design/glossary#api_service_endpoint
 	defaultGoogleAPIsEndpoint = "https://www.googleapis.com"
@@ -50,39 +48,161 @@ const (
 
 	// defaultJWTSubjectTokenType is the token type expected by the STS API
 	// when requesting for STS Tokens
-	defaultJWTSubjectTokenType = "urn:ietf:params:oauth:token-type:jwt"
+	defaultJWTSubjectTokenType = SubjectTokenTypeJWT
 )
 
 var defaultTokenAuthScopes = []string{"https://www.googleapis.com/auth/cloud-platform"}
 
 // GcpCredentials represents a simplified version of the Google Cloud Platform credentials file format.
 type GcpCredentials struct {
+	Type         string `json:"type,omitempty" structs:"type" mapstructure:"type"`
 	ClientEmail  string `json:"client_email" structs:"client_email" mapstructure:"client_email"`
 	ClientId     string `json:"client_id" structs:"client_id" mapstructure:"client_id"`
 	PrivateKeyId string `json:"private_key_id" structs:"private_key_id" mapstructure:"private_key_id"`
 	PrivateKey   string `json:"private_key" structs:"private_key" mapstructure:"private_key"`
 	ProjectId    string `json:"project_id" structs:"project_id" mapstructure:"project_id"`
+
+	// UniverseDomain is the universe domain of the credentials, empty for
+	// public Google Cloud. See GetUniverseDomain and Endpoints.
+	UniverseDomain string `json:"universe_domain,omitempty" structs:"universe_domain" mapstructure:"universe_domain"`
+
+	// AssertionSigner, if set, signs JWT assertions in place of PrivateKey,
+	// which may then be empty.
+	AssertionSigner AssertionSigner `json:"-" structs:"-" mapstructure:"-"`
+
+	// PrivateKeyPassphrase, if set, provides the passphrase of an encrypted
+	// PrivateKey: PKCS#8 encrypted with PBES2, or legacy OpenSSL encryption.
+	PrivateKeyPassphrase PassphraseFunc `json:"-" structs:"-" mapstructure:"-"`
+
+	// Subject, if set, is the Google Workspace user to impersonate through
+	// domain-wide delegation. The service account must be granted
+	// domain-wide authority for the requested scopes.
+	Subject string `json:"-" structs:"-" mapstructure:"-"`
+
+	// TokenURL, if set, overrides the token endpoint JWT assertions are
+	// exchanged at, e.g. for private or test endpoints. Defaults to
+	// https://accounts.google.com/o/oauth2/token; outside the default
+	// universe, self-signed JWTs are used unless it is set.
+	TokenURL string `json:"-" structs:"-" mapstructure:"-"`
 }
 
+// Subject token types accepted by STS for ExternalAccountConfig.
+const (
+	SubjectTokenTypeJWT     = "urn:ietf:params:oauth:token-type:jwt"
+	SubjectTokenTypeIDToken = "urn:ietf:params:oauth:token-type:id_token"
+	SubjectTokenTypeSAML2   = "urn:ietf:params:oauth:token-type:saml2"
+
+	// SubjectTokenTypeAWS4Request is a serialized, signed AWS
+	// GetCallerIdentity request, as produced for AWS workload identity
+	// federation.
+	SubjectTokenTypeAWS4Request = "urn:ietf:params:aws:token-type:aws4_request"
+)
+
 type ExternalAccountConfig struct {
 	// External Account fields
-	Audience            string
-	TTL                 time.Duration
+	Audience string
+
+	// TTL is the lifetime of the access tokens of the impersonated service
+	// account, rounded down to whole seconds. Defaults to
+	// DefaultAccessTokenLifetime, as do TTLs under a second.
+	// Lifetimes of up to MaxExtendedAccessTokenLifetime require the service
+	// account to be listed in the
+	// constraints/iam.allowServiceAccountCredentialLifetimeExtension
+	// organization policy.
+	TTL time.Duration
+
+	// ServiceAccountEmail is the service account to impersonate. If empty,
+	// the federated access token is used directly, and TTL does not apply.
 	ServiceAccountEmail string
-	TokenSupplier       externalaccount.SubjectTokenSupplier
+
+	// Delegates is the chain of service accounts, as emails or resource
+	// names, through which ServiceAccountEmail is impersonated. The federated
+	// principal must be granted the Service Account Token Creator role on
+	// the first one, each delegate on the next one, and the last on
+	// ServiceAccountEmail.
+	Delegates []string
+
+	// TokenSupplier supplies the subject tokens exchanged at STS. See
+	// NewSubjectTokenSupplier for file and URL suppliers.
+	TokenSupplier externalaccount.SubjectTokenSupplier
+
+	// WorkforcePoolUserProject is the project used for quota and billing of
+	// workforce identity federation, which requires one. It is only valid
+	// with a workforce pool Audience, e.g.
+	// //iam.googleapis.com/locations/global/workforcePools/POOL/providers/PROVIDER.
+	WorkforcePoolUserProject string
+
+	// SubjectTokenType is the type of the supplied subject tokens, one of
+	// the SubjectTokenType constants, e.g. SubjectTokenTypeSAML2 for
+	// base64-encoded SAML 2.0 assertions. Defaults to SubjectTokenTypeJWT.
+	SubjectTokenType string
+
+	// IAMCredentialsEndpoint, if set, is the IAM Credentials API endpoint
+	// used to impersonate ServiceAccountEmail, e.g. a Private Service Connect
+	// or restricted VIP endpoint, or an emulator. It takes precedence over
+	// endpoint overrides and defaults.
+	IAMCredentialsEndpoint string
+
+	// OnRefreshSuccess, if set, is called after the token source fetched a
+	// new token, e.g. to emit audit events. Cached tokens are not reported.
+	OnRefreshSuccess func(*ExternalAccountRefreshEvent)
+
+	// OnRefreshFailure, if set, is called when the token source failed to
+	// fetch a new token, e.g. to alert on credential refresh degradation.
+	OnRefreshFailure func(*ExternalAccountRefreshEvent)
 }
 
-func (c *ExternalAccountConfig) GetExternalAccountCredentials(ctx context.Context) (*google.Credentials, error) {
-	config := externalaccount.Config{
-		Audience:                       strings.TrimPrefix(c.Audience, "https:"),
-		SubjectTokenType:               defaultJWTSubjectTokenType,
-		ServiceAccountImpersonationURL: fmt.Sprintf("%s/v1/projects/-/serviceAccounts/%s:generateAccessToken", iamCredentialsAPIsEndpoint, c.ServiceAccountEmail),
-		ServiceAccountImpersonationLifetimeSeconds: int(c.TTL.Seconds()),
-		SubjectTokenSupplier:                       c.TokenSupplier,
-		Scopes:                                     defaultTokenAuthScopes,
+// validateWorkforcePoolUserProject checks that WorkforcePoolUserProject is
+// only set for a workforce pool audience.
+func (c *ExternalAccountConfig) validateWorkforcePoolUserProject() error {
+	if c.WorkforcePoolUserProject == "" {
+		return nil
+	}
+	if !workforcePoolAudienceRegex.MatchString(strings.TrimPrefix(c.Audience, "https:")) {
+		return fmt.Errorf("a workforce pool user project requires a workforce pool audience, got %q", c.Audience)
 	}
+	return nil
+}
 
-	ts, err := externalaccount.NewTokenSource(ctx, config)
+// subjectTokenType returns the validated SubjectTokenType, or its default.
+func (c *ExternalAccountConfig) subjectTokenType() (string, error) {
+	switch c.SubjectTokenType {
+	case "":
+		return SubjectTokenTypeJWT, nil
+	case SubjectTokenTypeJWT, SubjectTokenTypeIDToken, SubjectTokenTypeSAML2, SubjectTokenTypeAWS4Request:
+		return c.SubjectTokenType, nil
+	}
+	return "", fmt.Errorf("unsupported subject token type %q", c.SubjectTokenType)
+}
+
+// lifetimeSeconds returns the validated TTL rounded down to whole seconds,
+// or 0 for the default lifetime, including for TTLs under a second.
+func (c *ExternalAccountConfig) lifetimeSeconds() (int, error) {
+	ttl := c.TTL
+	if ttl > 0 {
+		ttl = ttl.Truncate(time.Second)
+	}
+	lifetime, err := (&IAMTokenExchangeRequest{Lifetime: ttl}).lifetime(true)
+	if err != nil {
+		return 0, err
+	}
+	return int(lifetime / time.Second), nil
+}
+
+// endpoints returns the endpoints used for the configuration: those of ctx
+// with IAMCredentialsEndpoint applied.
+func (c *ExternalAccountConfig) endpoints(ctx context.Context) (*GCPEndpoints, error) {
+	override := &GCPEndpoints{IAMCredentials: c.IAMCredentialsEndpoint}
+	if err := override.Validate(); err != nil {
+		return nil, err
+	}
+	return resolveEndpoints(ctx, nil).merge(override), nil
+}
+
+// GetExternalAccountCredentials returns credentials whose token source is
+// c.TokenSource(ctx).
+func (c *ExternalAccountConfig) GetExternalAccountCredentials(ctx context.Context) (*google.Credentials, error) {
+	ts, err := c.TokenSource(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -95,89 +215,72 @@ func (c *ExternalAccountConfig) GetExternalAccountCredentials(ctx context.Contex
 // FindCredentials attempts to obtain GCP credentials in the
 // following ways:
 // * Parse JSON from provided credentialsJson
+// * A raw access token from the environment variable GOOGLE_OAUTH_ACCESS_TOKEN
 // * Parse JSON from the environment variables GOOGLE_CREDENTIALS or GOOGLE_CLOUD_KEYFILE_JSON
 // * Parse JSON file ~/.gcp/credentials
 // * Google Application Default Credentials (see https://developers.google.com/identity/protocols/application-default-credentials)
+// * The default service account from the GCE/GKE/App Engine metadata server
+//
+// Credential JSON may be a service account key, an external_account
+// (workload identity federation) configuration, impersonated_service_account
+// credentials, or authorized_user credentials, for which HasPrivateKey
+// reports false.
+//
+// When credentials are obtained from the metadata server, the returned
+// GcpCredentials only has ClientEmail and ProjectId set, and the returned
+// TokenSource is a *MetadataTokenSource. When an access token is obtained
+// from GOOGLE_OAUTH_ACCESS_TOKEN, the returned GcpCredentials is empty and
+// the token is used until it is rejected, as its expiry is unknown.
+//
+// See FindCredentialsWithOptions to restrict or reorder the lookup chain.
 func FindCredentials(credsJson string, ctx context.Context, scopes ...string) (*GcpCredentials, oauth2.TokenSource, error) {
-	var creds *GcpCredentials
-	var err error
-	// 1. Parse JSON from provided credentialsJson
-	if credsJson == "" {
-		// 2. JSON from env var GOOGLE_CREDENTIALS
-		credsJson = os.Getenv("GOOGLE_CREDENTIALS")
-	}
-
-	if credsJson == "" {
-		// 3. JSON from env var GOOGLE_CLOUD_KEYFILE_JSON
-		credsJson = os.Getenv("GOOGLE_CLOUD_KEYFILE_JSON")
-	}
-
-	if credsJson == "" {
-		// 4. JSON from ~/.gcp/credentials
-		home, err := homedir.Dir()
-		if err != nil {
-			return nil, nil, errors.New("could not find home directory")
-		}
-		credBytes, err := ioutil.ReadFile(filepath.Join(home, defaultHomeCredentialsFile))
-		if err == nil {
-			credsJson = string(credBytes)
-		}
-	}
-
-	// Parse JSON into credentials.
-	if credsJson != "" {
-		creds, err = Credentials(credsJson)
-		if err == nil {
-			conf := jwt.Config{
-				Email:      creds.ClientEmail,
-				PrivateKey: []byte(creds.PrivateKey),
-				Scopes:     scopes,
-				TokenURL:   "https://accounts.google.com/o/oauth2/token",
-			}
-			return creds, conf.TokenSource(ctx), nil
-		}
-	}
-
-	// 5. Use Application default credentials.
-	defaultCreds, err := google.FindDefaultCredentials(ctx, scopes...)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if defaultCreds.JSON != nil {
-		creds, err = Credentials(string(defaultCreds.JSON))
-		if err != nil {
-			return nil, nil, errors.New("could not read credentials from application default credential JSON")
-		}
-	}
+	return FindCredentialsWithOptions(ctx, &FindCredentialsOptions{
+		CredentialsJSON: credsJson,
+		Scopes:          scopes,
+	})
+}
 
-	return creds, defaultCreds.TokenSource, nil
+// HasPrivateKey reports whether the credentials hold a service account
+// private key. Credentials of other types, e.g. authorized_user credentials,
+// cannot sign JWTs or blobs locally.
+func (c *GcpCredentials) HasPrivateKey() bool {
+	return c.PrivateKey != ""
 }
 
-// Credentials attempts to parse GcpCredentials from a JSON string.
+// Credentials attempts to parse GcpCredentials from a JSON string. For
+// external_account (workload identity federation) and
+// impersonated_service_account credentials, the configuration is validated
+// and ClientEmail is set to the impersonated service account, if any.
 func Credentials(credentialsJson string) (*GcpCredentials, error) {
 	credentials := &GcpCredentials{}
 	if err := json.Unmarshal([]byte(credentialsJson), &credentials); err != nil {
 		return nil, err
 	}
+	switch credentials.Type {
+	case CredentialTypeExternalAccount:
+		if err := parseExternalAccount(credentials, credentialsJson); err != nil {
+			return nil, err
+		}
+	case CredentialTypeImpersonatedServiceAccount:
+		if _, _, err := parseImpersonatedServiceAccount(credentials, credentialsJson); err != nil {
+			return nil, err
+		}
+	case CredentialTypeAuthorizedUser:
+		if _, err := parseAuthorizedUser(credentialsJson); err != nil {
+			return nil, err
+		}
+	}
 	return credentials, nil
 }
 
 // GetHttpClient creates an HTTP client from the given Google credentials and scopes.
+// See GetHttpClientWithOptions to configure the client.
 func GetHttpClient(credentials *GcpCredentials, clientScopes ...string) (*http.Client, error) {
-	conf := jwt.Config{
-		Email:      credentials.ClientEmail,
-		PrivateKey: []byte(credentials.PrivateKey),
-		Scopes:     clientScopes,
-		TokenURL:   "https://accounts.google.com/o/oauth2/token",
-	}
-
-	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, cleanhttp.DefaultClient())
-	client := conf.Client(ctx)
-	return client, nil
+	return GetHttpClientWithOptions(context.Background(), credentials, &HTTPClientOptions{Scopes: clientScopes})
 }
 
 // PublicKey returns a public key from a Google PEM key file (type TYPE_X509_PEM_FILE).
+// In FIPS mode, keys that do not comply are rejected.
 func PublicKey(pemString string) (interface{}, error) {
 	// Attempt to base64 decode
 	pemBytes := []byte(pemString)
@@ -194,6 +297,9 @@ func PublicKey(pemString string) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkFIPSPublicKey(cert.PublicKey); err != nil {
+		return nil, err
+	}
 
 	return cert.PublicKey, nil
 }
@@ -208,11 +314,19 @@ func ServiceAccountPublicKey(serviceAccount string, keyId string) (interface{},
 // ServiceAccountPublicKeyWithEndpoint returns the public key with the given key
 // ID for the given service account if it exists. If endpoint is provided, it will
 // be used as the service endpoint for the request. If endpoint is not provided,
-// a default of "https://www.googleapis.com" will be used. If the key does not exist,
+// the APIs endpoint overridden by WithEndpointOverrides or a default of
+// "https://www.googleapis.com" will be used. If the key does not exist,
 // an error is returned.
 func ServiceAccountPublicKeyWithEndpoint(ctx context.Context, serviceAccount, keyID, endpoint string) (interface{}, error) {
+	return serviceAccountPublicKey(ctx, packageHTTPClient(), serviceAccount, keyID, endpoint)
+}
+
+func serviceAccountPublicKey(ctx context.Context, httpClient *http.Client, serviceAccount, keyID, endpoint string) (interface{}, error) {
+	if err := validateServiceAccountRef(serviceAccount); err != nil {
+		return nil, err
+	}
 	if endpoint == "" {
-		endpoint = defaultGoogleAPIsEndpoint
+		endpoint = resolveEndpoints(ctx, nil).APIs
 	}
 
 	keyURLPath := fmt.Sprintf(serviceAccountPublicKeyURLPathTemplate, url.PathEscape(serviceAccount))
@@ -221,7 +335,8 @@ func ServiceAccountPublicKeyWithEndpoint(ctx context.Context, serviceAccount, ke
 	if err != nil {
 		return nil, err
 	}
-	resp, err := cleanhttp.DefaultClient().Do(req)
+	setAPIClientHeader(req, "", "")
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -255,12 +370,17 @@ func OAuth2RSAPublicKey(ctx context.Context, keyID string) (interface{}, error)
 
 // OAuth2RSAPublicKeyWithEndpoint returns the public key with the given key ID from
 // Google's public set of OAuth 2.0 keys. If endpoint is provided, it will be used as
-// the service endpoint for the request. If endpoint is not provided, a default of
+// the service endpoint for the request. If endpoint is not provided, the OAuth certs
+// endpoint overridden by WithEndpointOverrides or a default of
 // "https://www.googleapis.com" will be used. If the key does not exist, an error is
 // returned.
 func OAuth2RSAPublicKeyWithEndpoint(ctx context.Context, keyID, endpoint string) (interface{}, error) {
+	return oauth2RSAPublicKey(ctx, packageHTTPClient(), keyID, endpoint)
+}
+
+func oauth2RSAPublicKey(ctx context.Context, httpClient *http.Client, keyID, endpoint string) (interface{}, error) {
 	if endpoint == "" {
-		endpoint = defaultGoogleAPIsEndpoint
+		endpoint = resolveEndpoints(ctx, nil).OAuthCerts
 	}
 
 	certUrl := strings.TrimSuffix(endpoint, "/") + googleOAuthProviderX509CertURLPath
@@ -268,7 +388,8 @@ func OAuth2RSAPublicKeyWithEndpoint(ctx context.Context, keyID, endpoint string)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := cleanhttp.DefaultClient().Do(req)
+	setAPIClientHeader(req, "", "")
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// maxCredentialsFileSize bounds the size of credential files that are read.
+// Credential files are a few kilobytes.
+const maxCredentialsFileSize = 1 << 20
+
+var (
+	// ErrCredentialsFileNotFound is returned when a credentials file does
+	// not exist.
+	ErrCredentialsFileNotFound = errors.New("credentials file not found")
+
+	// ErrCredentialsFileUnreadable is returned when a credentials file
+	// exists but cannot be read, or is larger than 1 MiB.
+	ErrCredentialsFileUnreadable = errors.New("credentials file is unreadable")
+
+	// ErrCredentialsFileMalformed is returned when a credentials file does
+	// not contain JSON.
+	ErrCredentialsFileMalformed = errors.New("credentials file is malformed")
+)
+
+// ReadCredentialsFile reads credential JSON from a file, stopping when ctx is
+// done. Errors wrap ErrCredentialsFileNotFound, ErrCredentialsFileUnreadable
+// or ErrCredentialsFileMalformed.
+func ReadCredentialsFile(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrCredentialsFileNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCredentialsFileUnreadable, err)
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(&contextReader{ctx: ctx, r: f}, maxCredentialsFileSize+1))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%w: %s: %v", ErrCredentialsFileUnreadable, path, err)
+	}
+	if len(b) > maxCredentialsFileSize {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrCredentialsFileUnreadable, path, maxCredentialsFileSize)
+	}
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("%w: %s does not contain valid JSON", ErrCredentialsFileMalformed, path)
+	}
+	return b, nil
+}
+
+// contextReader fails reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+func TestReadCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, b []byte, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, b, mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := map[string]struct {
+		Ctx  context.Context
+		Path string
+		Err  error
+	}{
+		"valid": {
+			Path: write("valid.json", []byte(`{"type":"service_account"}`), 0o600),
+		},
+		"missing": {
+			Path: filepath.Join(dir, "missing.json"),
+			Err:  ErrCredentialsFileNotFound,
+		},
+		"directory": {
+			Path: dir,
+			Err:  ErrCredentialsFileUnreadable,
+		},
+		"too large": {
+			Path: write("large.json", bytes.Repeat([]byte(" "), maxCredentialsFileSize+1), 0o600),
+			Err:  ErrCredentialsFileUnreadable,
+		},
+		"malformed": {
+			Path: write("malformed.json", []byte("not json"), 0o600),
+			Err:  ErrCredentialsFileMalformed,
+		},
+		"canceled": {
+			Ctx:  canceled,
+			Path: filepath.Join(dir, "valid.json"),
+			Err:  context.Canceled,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := test.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			_, err := ReadCredentialsFile(ctx, test.Path)
+			if test.Err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, test.Err) {
+				t.Fatalf("expected %v, got %v", test.Err, err)
+			}
+		})
+	}
+}
+
+func TestFindCredentials_malformedHomeFile(t *testing.T) {
+	t.Setenv(EnvOAuthAccessToken, "")
+	t.Setenv("GOOGLE_CREDENTIALS", "")
+	t.Setenv("GOOGLE_CLOUD_KEYFILE_JSON", "")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	homedir.Reset()
+	t.Cleanup(homedir.Reset)
+	path := filepath.Join(home, defaultHomeCredentialsFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := FindCredentialsWithOptions(context.Background(), &FindCredentialsOptions{
+		Sources: []CredentialSource{CredentialSourceHomeFile},
+	})
+	if !errors.Is(err, ErrCredentialsFileMalformed) {
+		t.Fatalf("expected %v, got %v", ErrCredentialsFileMalformed, err)
+	}
+}
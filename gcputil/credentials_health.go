@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// CredentialsStatus is the result of a credentials health check.
+type CredentialsStatus struct {
+	// Valid is true if an access token was obtained and Google accepted it.
+	Valid bool
+
+	// Principal is the email of the authenticated principal, or its unique
+	// ID if the token lacks the userinfo.email scope.
+	Principal string
+
+	// Expiry is when the access token obtained for the check expires.
+	Expiry time.Time
+
+	// Scopes are the scopes granted to the access token.
+	Scopes []string
+
+	// Error describes why the credentials are invalid.
+	Error string
+}
+
+// ValidateCredentials checks that the client's credentials work by
+// obtaining an access token and looking it up with Google's tokeninfo
+// endpoint, which needs no permissions. Credentials that are rejected are
+// reported with Valid false; an error is only returned if the check itself
+// fails, e.g. because tokeninfo is unreachable.
+func (c *Client) ValidateCredentials(ctx context.Context) (*CredentialsStatus, error) {
+	defer c.measure("validate_credentials", time.Now())
+	status, err := c.validateCredentials(ctx)
+	if err != nil {
+		c.incrError("validate_credentials")
+		return nil, err
+	}
+	return status, nil
+}
+
+func (c *Client) validateCredentials(ctx context.Context) (*CredentialsStatus, error) {
+	tok, err := c.tokenSource.Token()
+	if err != nil {
+		return &CredentialsStatus{Error: err.Error()}, nil
+	}
+
+	info, err := c.tokenInfo(ctx, tok.AccessToken)
+	if err != nil {
+		var gErr *googleapi.Error
+		if errors.As(err, &gErr) && (gErr.Code == http.StatusBadRequest || gErr.Code == http.StatusUnauthorized) {
+			return &CredentialsStatus{Error: err.Error()}, nil
+		}
+		return nil, err
+	}
+
+	status := &CredentialsStatus{
+		Valid:     true,
+		Principal: info.Email,
+		Expiry:    info.Expiry,
+		Scopes:    info.Scopes,
+	}
+	if status.Principal == "" {
+		status.Principal = info.Subject
+	}
+	return status, nil
+}
+
+// ValidateCredentials checks that the given credential JSON works, e.g.
+// before it is stored in a plugin's configuration. Application Default
+// Credentials are checked if credentialsJSON is empty. See
+// Client.ValidateCredentials.
+func ValidateCredentials(ctx context.Context, credentialsJSON string, scopes ...string) (*CredentialsStatus, error) {
+	if credentialsJSON != "" {
+		if _, err := Credentials(credentialsJSON); err != nil {
+			return &CredentialsStatus{Error: "unable to parse credentials: " + err.Error()}, nil
+		}
+	}
+	c, err := NewClient(ctx, &Options{CredentialsJSON: credentialsJSON, Scopes: scopes})
+	if err != nil {
+		return &CredentialsStatus{Error: err.Error()}, nil
+	}
+	return c.ValidateCredentials(ctx)
+}
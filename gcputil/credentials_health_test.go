@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+type failingTokenSource struct{}
+
+func (failingTokenSource) Token() (*oauth2.Token, error) {
+	return nil, errors.New("invalid_grant")
+}
+
+func TestClient_ValidateCredentials(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("access_token") {
+		case "sa-token":
+			fmt.Fprintf(w, `{"sub":"1234","email":"sa@p.iam.gserviceaccount.com","scope":"https://www.googleapis.com/auth/cloud-platform","exp":"%d"}`, exp)
+		case "no-email-token":
+			fmt.Fprintf(w, `{"sub":"1234","scope":"https://www.googleapis.com/auth/cloud-platform","exp":"%d"}`, exp)
+		case "broken-token":
+			w.WriteHeader(http.StatusNotImplemented)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_token"}`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := map[string]struct {
+		TokenSource oauth2.TokenSource
+		Valid       bool
+		Principal   string
+		ShouldError bool
+	}{
+		"valid": {
+			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "sa-token"}),
+			Valid:       true,
+			Principal:   "sa@p.iam.gserviceaccount.com",
+		},
+		"valid without email": {
+			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "no-email-token"}),
+			Valid:       true,
+			Principal:   "1234",
+		},
+		"rejected token": {
+			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "revoked-token"}),
+		},
+		"token error": {
+			TokenSource: failingTokenSource{},
+		},
+		"tokeninfo error": {
+			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "broken-token"}),
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newTestClient(t, &Options{TokenSource: test.TokenSource, Endpoints: &GCPEndpoints{APIs: srv.URL}})
+			status, err := c.ValidateCredentials(context.Background())
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Valid != test.Valid || status.Principal != test.Principal {
+				t.Fatalf("unexpected status %+v", status)
+			}
+			if status.Valid && (status.Expiry.Unix() != exp || len(status.Scopes) != 1) {
+				t.Fatalf("unexpected status %+v", status)
+			}
+			if !status.Valid && status.Error == "" {
+				t.Fatal("expected an error description for invalid credentials")
+			}
+		})
+	}
+}
+
+func TestValidateCredentials_malformed(t *testing.T) {
+	status, err := ValidateCredentials(context.Background(), `{"type":"authorized_user"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Valid || status.Error == "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// Environment variables that set the default project, in order of
+// precedence.
+const (
+	EnvProject      = "GOOGLE_PROJECT"
+	EnvCloudProject = "GOOGLE_CLOUD_PROJECT"
+)
+
+// ErrProjectNotFound is returned by GetDefaultProject if no source provides
+// a project.
+var ErrProjectNotFound = errors.New("unable to determine the default project")
+
+// GetDefaultProject returns the effective project, from the first of:
+//   - the project_id of the credentials found by FindCredentials
+//   - the GOOGLE_PROJECT or GOOGLE_CLOUD_PROJECT environment variable
+//   - Application Default Credentials
+//   - the project of the active gcloud configuration
+//   - the metadata server
+//
+// ErrProjectNotFound is returned if none provides a project.
+func GetDefaultProject(ctx context.Context) (string, error) {
+	found, err := FindCredentialsWithSource(ctx, &FindCredentialsOptions{
+		Sources: []CredentialSource{
+			CredentialSourceCredentialsEnv,
+			CredentialSourceKeyfileEnv,
+			CredentialSourceHomeFile,
+			CredentialSourceApplicationCredentialsEnv,
+		},
+	})
+	if err == nil && found.Credentials != nil && found.Credentials.ProjectId != "" {
+		logDebug("using project from credentials", "source", found.Source)
+		return found.Credentials.ProjectId, nil
+	}
+
+	for _, env := range []string{EnvProject, EnvCloudProject} {
+		if project := strings.TrimSpace(os.Getenv(env)); project != "" {
+			logDebug("using project from environment", "env", env)
+			return project, nil
+		}
+	}
+
+	if creds, err := google.FindDefaultCredentials(ctx); err == nil && creds.ProjectID != "" {
+		logDebug("using project from application default credentials")
+		return creds.ProjectID, nil
+	}
+
+	if config, err := ActiveGcloudConfig(); err == nil && config.Project != "" {
+		logDebug("using project from gcloud configuration", "configuration", config.Name)
+		return config.Project, nil
+	}
+
+	if project, err := metadataProbeClient(NewMetadataClient(nil)).ProjectID(ctx); err == nil && project != "" {
+		logDebug("using project from metadata server")
+		return project, nil
+	}
+
+	return "", ErrProjectNotFound
+}
@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+	"github.com/mitchellh/go-homedir"
+)
+
+func TestGetDefaultProject(t *testing.T) {
+	md := testutil.NewMetadataServer(t)
+
+	tests := map[string]struct {
+		Env     map[string]string
+		Project string
+	}{
+		"credentials": {
+			Env: map[string]string{
+				"GOOGLE_CREDENTIALS": `{"type":"authorized_user","client_id":"c","client_secret":"s","refresh_token":"r","project_id":"creds-project"}`,
+				EnvProject:           "env-project",
+			},
+			Project: "creds-project",
+		},
+		"credentials without project": {
+			Env: map[string]string{
+				"GOOGLE_CREDENTIALS": `{"type":"authorized_user","client_id":"c","client_secret":"s","refresh_token":"r"}`,
+				EnvCloudProject:      "cloud-project",
+			},
+			Project: "cloud-project",
+		},
+		"google project takes precedence": {
+			Env:     map[string]string{EnvProject: "env-project", EnvCloudProject: "cloud-project"},
+			Project: "env-project",
+		},
+		"metadata server": {
+			Project: testutil.DefaultMetadataProjectID,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			homedir.Reset()
+			t.Cleanup(homedir.Reset)
+			t.Setenv(EnvCloudSDKConfig, home)
+			for _, env := range []string{"GOOGLE_CREDENTIALS", "GOOGLE_CLOUD_KEYFILE_JSON", EnvApplicationCredentials, EnvProject, EnvCloudProject} {
+				t.Setenv(env, "")
+			}
+			for k, v := range test.Env {
+				t.Setenv(k, v)
+			}
+			md.SetEnv(t)
+
+			project, err := GetDefaultProject(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if project != test.Project {
+				t.Fatalf("expected project %q, got %q", test.Project, project)
+			}
+		})
+	}
+}
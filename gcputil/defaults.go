@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Process-wide defaults consulted by the package-level functions and by
+// Clients whose options leave the corresponding fields empty. They allow
+// applications embedding many integrations to configure gcputil once. They
+// are safe to set concurrently with their use, but only apply to Clients
+// created afterwards.
+var (
+	defaultsMu         sync.RWMutex
+	defaultEndpointsV  *GCPEndpoints
+	defaultUserAgentV  string
+	defaultHTTPClientV *http.Client
+	defaultLoggerV     Logger
+	defaultTracerV     *HTTPTracer
+)
+
+// SetDefaultEndpoints sets the endpoints used by the package-level functions
+// and new Clients. Empty fields take their public default. Endpoints
+// overridden with WithEndpointOverrides or Options.Endpoints take
+// precedence. Passing nil restores the public defaults.
+func SetDefaultEndpoints(endpoints *GCPEndpoints) error {
+	if endpoints != nil {
+		if err := endpoints.Validate(); err != nil {
+			return err
+		}
+		copied := *endpoints
+		endpoints = &copied
+	}
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultEndpointsV = endpoints
+	return nil
+}
+
+// SetDefaultUserAgent sets the User-Agent sent by the package-level functions
+// and new Clients without Options.UserAgent.
+func SetDefaultUserAgent(userAgent string) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultUserAgentV = userAgent
+}
+
+// SetDefaultHTTPClient sets the base HTTP client used by the package-level
+// functions and new Clients without Options.HTTPClient. Passing nil restores
+// clients of the package's shared pooled transport.
+func SetDefaultHTTPClient(httpClient *http.Client) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultHTTPClientV = httpClient
+}
+
+// SetDefaultLogger sets the logger used by the package-level functions and
+// new Clients without Options.Logger.
+func SetDefaultLogger(logger Logger) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultLoggerV = logger
+}
+
+// SetDefaultTracer sets the tracer of the HTTP requests made by the
+// package-level functions, including token sources they return, by
+// MetadataClients, refresh token sources and HTTP clients created without an
+// HTTP client, and by Clients without Options.Tracer. Unlike the other
+// defaults, it is consulted on every request, so tracing can be switched on
+// and off at runtime for existing clients too. Passing nil disables it.
+func SetDefaultTracer(tracer *HTTPTracer) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaultTracerV = tracer
+}
+
+// defaultEndpoints returns the public endpoints with those set with
+// SetDefaultEndpoints applied.
+func defaultEndpoints() *GCPEndpoints {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return DefaultGCPEndpoints().merge(defaultEndpointsV)
+}
+
+func defaultUserAgent() string {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaultUserAgentV
+}
+
+func defaultHTTPClient() *http.Client {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaultHTTPClientV
+}
+
+func defaultTracer() *HTTPTracer {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaultTracerV
+}
+
+func defaultLogger() Logger {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return defaultLoggerV
+}
+
+// packageHTTPClient returns the HTTP client used by the package-level
+// functions: the default HTTP client, or a client of the shared package
+// transport, sending the default User-Agent if one is set and the request
+// reason, and traced with the default tracer.
+func packageHTTPClient() *http.Client {
+	httpClient := defaultHTTPClient()
+	if httpClient == nil {
+		httpClient = newHTTPClient()
+	}
+	httpClient = withRequestReason(withDefaultTracer(httpClient))
+	if ua := defaultUserAgent(); ua != "" {
+		httpClient = withTransport(httpClient, &userAgentTransport{base: transportOrDefault(httpClient.Transport), userAgent: ua})
+	}
+	return httpClient
+}
+
+// logDebug logs a debug message from a package-level function to the
+// default logger, if any.
+func logDebug(msg string, args ...interface{}) {
+	if logger := defaultLogger(); logger != nil {
+		logger.Debug(msg, args...)
+	}
+}
+
+// logWarn logs a warning from a package-level function to the default
+// logger, if any.
+func logWarn(msg string, args ...interface{}) {
+	if logger := defaultLogger(); logger != nil {
+		logger.Warn(msg, args...)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSetDefaults(t *testing.T) {
+	var userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	if err := SetDefaultEndpoints(&GCPEndpoints{OAuthCerts: "not a url"}); err == nil {
+		t.Fatal("expected error for invalid endpoint")
+	}
+	if err := SetDefaultEndpoints(&GCPEndpoints{OAuthCerts: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	SetDefaultUserAgent("plugin/1.0")
+	t.Cleanup(func() {
+		SetDefaultEndpoints(nil)
+		SetDefaultUserAgent("")
+	})
+
+	// The key is not in the empty key set, but the request must have been
+	// made to the default endpoint with the default user agent.
+	if _, err := OAuth2RSAPublicKey(context.Background(), "kid"); err == nil {
+		t.Fatal("expected key not to be found")
+	}
+	if userAgent != "plugin/1.0" {
+		t.Fatalf("expected request with default user agent, got %q", userAgent)
+	}
+
+	if got := resolveEndpoints(context.Background(), nil); got.OAuthCerts != srv.URL || got.STS != defaultSTSEndpoint {
+		t.Fatalf("unexpected endpoints %+v", got)
+	}
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{OAuthCerts: "https://override"})
+	if got := resolveEndpoints(ctx, nil).OAuthCerts; got != "https://override" {
+		t.Fatalf("expected context override to take precedence, got %q", got)
+	}
+
+	// Setting defaults concurrently with their use is safe.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetDefaultLogger(nil)
+			SetDefaultHTTPClient(nil)
+		}()
+		go func() {
+			defer wg.Done()
+			packageHTTPClient()
+			logDebug("test")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,180 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// encryptedPKCS8BlockType is the PEM block type of PKCS#8 encrypted private
+// keys, e.g. written by `openssl pkcs8 -topk8 -v2 aes-256-cbc`.
+const encryptedPKCS8BlockType = "ENCRYPTED PRIVATE KEY"
+
+var (
+	// ErrPrivateKeyEncrypted is returned for an encrypted private key when no
+	// passphrase is configured.
+	ErrPrivateKeyEncrypted = errors.New("private key is encrypted but no passphrase was provided")
+
+	// ErrIncorrectPassphrase is returned when an encrypted private key cannot
+	// be decrypted with the provided passphrase.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase for encrypted private key")
+)
+
+// PassphraseFunc returns the passphrase of an encrypted private key. It is
+// called each time the key is decrypted, which allows fetching it from a
+// secret store rather than keeping it in memory.
+type PassphraseFunc func() ([]byte, error)
+
+// StaticPassphrase returns a PassphraseFunc returning a fixed passphrase.
+func StaticPassphrase(passphrase string) PassphraseFunc {
+	return func() ([]byte, error) {
+		return []byte(passphrase), nil
+	}
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the PKCS#8 EncryptedPrivateKeyInfo structure
+// (RFC 5208).
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the parameters of the PBES2 encryption scheme (RFC 8018).
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of the PBKDF2 key derivation function
+// (RFC 8018). The PRF defaults to HMAC-SHA1.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// isEncryptedPEMBlock reports whether the PEM block holds an encrypted
+// private key, either PKCS#8 or legacy OpenSSL (RFC 1423) encryption.
+func isEncryptedPEMBlock(block *pem.Block) bool {
+	// Legacy encryption is deprecated but still found in existing keys.
+	return block.Type == encryptedPKCS8BlockType || x509.IsEncryptedPEMBlock(block)
+}
+
+// decryptPEMBlock returns the DER-encoded private key of an encrypted PEM
+// block, decrypted with the passphrase from the given function.
+func decryptPEMBlock(block *pem.Block, passphraseFunc PassphraseFunc) ([]byte, error) {
+	if passphraseFunc == nil {
+		return nil, ErrPrivateKeyEncrypted
+	}
+	passphrase, err := passphraseFunc()
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain private key passphrase: %v", err)
+	}
+	defer zeroBytes(passphrase)
+
+	if block.Type != encryptedPKCS8BlockType {
+		der, err := x509.DecryptPEMBlock(block, passphrase)
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, ErrIncorrectPassphrase
+		}
+		return der, err
+	}
+	return decryptPKCS8(block.Bytes, passphrase)
+}
+
+// decryptPKCS8 decrypts a PKCS#8 EncryptedPrivateKeyInfo encrypted with
+// PBES2, using PBKDF2 with HMAC-SHA1 or HMAC-SHA256 and AES-CBC, the
+// algorithms used by OpenSSL.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption algorithm %s, must be PBES2", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("unable to parse PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s, must be PBKDF2", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("unable to parse PBKDF2 parameters: %v", err)
+	}
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", kdf.PRF.Algorithm)
+	}
+
+	var keyLen int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLen = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLen = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %s, must be AES-CBC", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid AES-CBC initialization vector")
+	}
+	if kdf.IterationCount <= 0 || (kdf.KeyLength != 0 && kdf.KeyLength != keyLen) {
+		return nil, errors.New("invalid PBKDF2 parameters")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("encrypted private key is not a multiple of the AES block size")
+	}
+
+	key := pbkdf2.Key(passphrase, kdf.Salt, kdf.IterationCount, keyLen, prf)
+	defer zeroBytes(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// An incorrect passphrase yields invalid padding with high probability.
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		zeroBytes(plaintext)
+		return nil, ErrIncorrectPassphrase
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// encryptTestPKCS8 encrypts a PKCS#8 key with PBES2, PBKDF2-HMAC-SHA256 and
+// AES-256-CBC, as `openssl pkcs8 -topk8 -v2 aes-256-cbc` does.
+func encryptTestPKCS8(t *testing.T, der []byte, passphrase string) *pem.Block {
+	t.Helper()
+	salt := make([]byte, 8)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	const iterations = 2048
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	plaintext := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	marshal := func(v interface{}) asn1.RawValue {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return asn1.RawValue{FullBytes: b}
+	}
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm: oidPBES2,
+			Parameters: marshal(pbes2Params{
+				KeyDerivationFunc: pkix.AlgorithmIdentifier{
+					Algorithm: oidPBKDF2,
+					Parameters: marshal(pbkdf2Params{
+						Salt:           salt,
+						IterationCount: iterations,
+						PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+					}),
+				},
+				EncryptionScheme: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: marshal(iv)},
+			}),
+		},
+		EncryptedData: ciphertext,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pem.Block{Type: encryptedPKCS8BlockType, Bytes: info}
+}
+
+func TestGcpCredentials_encryptedPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		Block       *pem.Block
+		Passphrase  PassphraseFunc
+		Expected    error
+		ShouldError bool
+	}{
+		"pkcs8": {
+			Block:      encryptTestPKCS8(t, pkcs8, "secret"),
+			Passphrase: StaticPassphrase("secret"),
+		},
+		"legacy": {
+			Block:      legacy,
+			Passphrase: StaticPassphrase("secret"),
+		},
+		"no passphrase": {
+			Block:       encryptTestPKCS8(t, pkcs8, "secret"),
+			Expected:    ErrPrivateKeyEncrypted,
+			ShouldError: true,
+		},
+		"incorrect passphrase": {
+			Block:       encryptTestPKCS8(t, pkcs8, "secret"),
+			Passphrase:  StaticPassphrase("wrong"),
+			Expected:    ErrIncorrectPassphrase,
+			ShouldError: true,
+		},
+		"passphrase error": {
+			Block:       legacy,
+			Passphrase:  func() ([]byte, error) { return nil, errors.New("vault sealed") },
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			creds := &GcpCredentials{
+				Type:                 CredentialTypeServiceAccount,
+				ClientEmail:          "sa@p.iam.gserviceaccount.com",
+				PrivateKeyId:         "key-id",
+				PrivateKey:           string(pem.EncodeToMemory(test.Block)),
+				PrivateKeyPassphrase: test.Passphrase,
+			}
+			signer, err := creds.Signer()
+			if test.ShouldError {
+				if err == nil || (test.Expected != nil && !errors.Is(err, test.Expected)) {
+					t.Fatalf("expected error %v, got %v", test.Expected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.PublicKey.Equal(signer.Public()) {
+				t.Fatal("decrypted key does not match")
+			}
+			if err := creds.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFindCredentialsWithOptions_encryptedPrivateKey(t *testing.T) {
+	srv, requested := newTestOAuth2Server(t)
+
+	var creds map[string]string
+	if err := json.Unmarshal(testServiceAccountJSON(t, srv.URL), &creds); err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(creds["private_key"]))
+	creds["private_key"] = string(pem.EncodeToMemory(encryptTestPKCS8(t, block.Bytes, "secret")))
+	credsJSON, err := json.Marshal(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ts, err := FindCredentialsWithOptions(context.Background(), &FindCredentialsOptions{
+		CredentialsJSON:      string(credsJSON),
+		Scopes:               []string{"scope"},
+		TokenURL:             srv.URL,
+		PrivateKeyPassphrase: StaticPassphrase("secret"),
+		Sources:              []CredentialSource{CredentialSourceJSON},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token:scope" || len(requested()) != 1 {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+}
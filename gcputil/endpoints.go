@@ -0,0 +1,175 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment variables that override the default endpoints in
+// GCPEndpointsFromEnv.
+const (
+	EnvAPIsEndpoint                 = "GOOGLE_APIS_ENDPOINT"
+	EnvIAMEndpoint                  = "GOOGLE_IAM_ENDPOINT"
+	EnvIAMCredentialsEndpoint       = "GOOGLE_IAM_CREDENTIALS_ENDPOINT"
+	EnvSTSEndpoint                  = "GOOGLE_STS_ENDPOINT"
+	EnvOAuthCertsEndpoint           = "GOOGLE_OAUTH_CERTS_ENDPOINT"
+	EnvComputeEndpoint              = "GOOGLE_COMPUTE_ENDPOINT"
+	EnvCloudResourceManagerEndpoint = "GOOGLE_CLOUD_RESOURCE_MANAGER_ENDPOINT"
+	EnvMonitoringEndpoint           = "GOOGLE_MONITORING_ENDPOINT"
+)
+
+const (
+	defaultIAMEndpoint                  = "https://iam.googleapis.com"
+	defaultSTSEndpoint                  = "https://sts.googleapis.com"
+	defaultComputeEndpoint              = "https://compute.googleapis.com/compute/v1/"
+	defaultCloudResourceManagerEndpoint = "https://cloudresourcemanager.googleapis.com/"
+	defaultMonitoringEndpoint           = "https://monitoring.googleapis.com/"
+)
+
+// GCPEndpoints holds the base URLs of the Google APIs used by this package.
+// Empty fields take their default value.
+type GCPEndpoints struct {
+	// APIs is the base URL for service account public key lookups.
+	APIs string
+
+	// IAM is the base URL of the IAM API.
+	IAM string
+
+	// IAMCredentials is the base URL of the IAM Service Account Credentials API.
+	IAMCredentials string
+
+	// STS is the base URL of the Security Token Service.
+	STS string
+
+	// OAuthCerts is the base URL for Google's OAuth 2.0 public keys.
+	OAuthCerts string
+
+	// Compute is the base path of the Compute Engine v1 API.
+	Compute string
+
+	// CloudResourceManager is the base path of the Cloud Resource Manager API.
+	CloudResourceManager string
+
+	// Monitoring is the base path of the Cloud Monitoring API.
+	Monitoring string
+}
+
+// DefaultGCPEndpoints returns the public Google API endpoints.
+func DefaultGCPEndpoints() *GCPEndpoints {
+	return &GCPEndpoints{
+		APIs:                 defaultGoogleAPIsEndpoint,
+		IAM:                  defaultIAMEndpoint,
+		IAMCredentials:       iamCredentialsAPIsEndpoint,
+		STS:                  defaultSTSEndpoint,
+		OAuthCerts:           defaultGoogleAPIsEndpoint,
+		Compute:              defaultComputeEndpoint,
+		CloudResourceManager: defaultCloudResourceManagerEndpoint,
+		Monitoring:           defaultMonitoringEndpoint,
+	}
+}
+
+// GCPEndpointsFromEnv returns the default endpoints, overridden by any of the
+// GOOGLE_*_ENDPOINT environment variables that are set. An error is returned
+// if an overridden endpoint is invalid.
+func GCPEndpointsFromEnv() (*GCPEndpoints, error) {
+	e := DefaultGCPEndpoints()
+	for _, f := range e.fields() {
+		if v := os.Getenv(f.env); v != "" {
+			*f.value = v
+		}
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Validate checks that every non-empty endpoint is an absolute http(s) URL.
+func (e *GCPEndpoints) Validate() error {
+	for _, f := range e.fields() {
+		if *f.value == "" {
+			continue
+		}
+		u, err := url.Parse(*f.value)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid %s endpoint %q, must be an absolute http(s) URL", f.name, *f.value)
+		}
+	}
+	return nil
+}
+
+// withDefaults returns a copy of the endpoints with empty fields set to
+// their defaults, including those set with SetDefaultEndpoints.
+func (e *GCPEndpoints) withDefaults() *GCPEndpoints {
+	return defaultEndpoints().merge(e)
+}
+
+// merge returns a copy of the endpoints with the non-empty fields of
+// override applied.
+func (e *GCPEndpoints) merge(override *GCPEndpoints) *GCPEndpoints {
+	merged := *e
+	if override == nil {
+		return &merged
+	}
+	mergedFields := merged.fields()
+	for i, f := range override.fields() {
+		if *f.value != "" {
+			*mergedFields[i].value = *f.value
+		}
+	}
+	return &merged
+}
+
+type endpointOverridesKey struct{}
+
+// WithEndpointOverrides returns a context that redirects calls made with it,
+// by a Client or the package-level functions, to the non-empty endpoints in
+// the given overrides. Overrides apply to the single call tree using the
+// context and take precedence over the endpoints a Client was created with.
+func WithEndpointOverrides(ctx context.Context, endpoints *GCPEndpoints) context.Context {
+	if prev, ok := ctx.Value(endpointOverridesKey{}).(*GCPEndpoints); ok {
+		endpoints = prev.merge(endpoints)
+	}
+	return context.WithValue(ctx, endpointOverridesKey{}, endpoints)
+}
+
+// resolveEndpoints returns base with any endpoint overrides from the context
+// applied. If base is nil, the default endpoints, including those set with
+// SetDefaultEndpoints, are used.
+func resolveEndpoints(ctx context.Context, base *GCPEndpoints) *GCPEndpoints {
+	if base == nil {
+		base = defaultEndpoints()
+	}
+	overrides, _ := ctx.Value(endpointOverridesKey{}).(*GCPEndpoints)
+	return base.merge(overrides)
+}
+
+type endpointField struct {
+	name  string
+	env   string
+	value *string
+}
+
+func (e *GCPEndpoints) fields() []endpointField {
+	return []endpointField{
+		{"APIs", EnvAPIsEndpoint, &e.APIs},
+		{"IAM", EnvIAMEndpoint, &e.IAM},
+		{"IAM Credentials", EnvIAMCredentialsEndpoint, &e.IAMCredentials},
+		{"STS", EnvSTSEndpoint, &e.STS},
+		{"OAuth certs", EnvOAuthCertsEndpoint, &e.OAuthCerts},
+		{"Compute", EnvComputeEndpoint, &e.Compute},
+		{"Cloud Resource Manager", EnvCloudResourceManagerEndpoint, &e.CloudResourceManager},
+		{"Monitoring", EnvMonitoringEndpoint, &e.Monitoring},
+	}
+}
+
+// joinEndpoint joins a base URL and a path with a single slash.
+func joinEndpoint(base, path string) string {
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
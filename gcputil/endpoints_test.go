@@ -0,0 +1,55 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGCPEndpointsFromEnv(t *testing.T) {
+	t.Setenv(EnvSTSEndpoint, "http://127.0.0.1:8080")
+	t.Setenv(EnvIAMCredentialsEndpoint, "https://iamcredentials.example.com")
+
+	e, err := GCPEndpointsFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.STS != "http://127.0.0.1:8080" || e.IAMCredentials != "https://iamcredentials.example.com" {
+		t.Errorf("expected overridden endpoints, got %+v", e)
+	}
+	if e.IAM != defaultIAMEndpoint {
+		t.Errorf("expected default IAM endpoint, got %s", e.IAM)
+	}
+
+	t.Setenv(EnvComputeEndpoint, "compute.example.com")
+	if _, err := GCPEndpointsFromEnv(); err == nil {
+		t.Errorf("expected error for endpoint without scheme")
+	}
+}
+
+func TestGCPEndpoints_withDefaults(t *testing.T) {
+	e := (&GCPEndpoints{STS: "https://sts.example.com"}).withDefaults()
+	if e.STS != "https://sts.example.com" {
+		t.Errorf("expected overridden STS endpoint, got %s", e.STS)
+	}
+	if e.APIs != defaultGoogleAPIsEndpoint || e.Compute != defaultComputeEndpoint {
+		t.Errorf("expected default endpoints, got %+v", e)
+	}
+}
+
+func TestWithEndpointOverrides(t *testing.T) {
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: "https://sts.example.com"})
+	ctx = WithEndpointOverrides(ctx, &GCPEndpoints{IAM: "https://iam.example.com"})
+
+	base := &GCPEndpoints{STS: "https://sts.base.com", APIs: "https://apis.base.com"}
+	e := resolveEndpoints(ctx, base)
+	if e.STS != "https://sts.example.com" || e.IAM != "https://iam.example.com" || e.APIs != "https://apis.base.com" {
+		t.Errorf("unexpected resolved endpoints %+v", e)
+	}
+
+	if e := resolveEndpoints(context.Background(), nil); *e != *DefaultGCPEndpoints() {
+		t.Errorf("expected default endpoints without overrides, got %+v", e)
+	}
+}
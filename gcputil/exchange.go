@@ -0,0 +1,421 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// stsTokenExchangeGrantType is the grant type of an RFC 8693 token exchange.
+	stsTokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// stsAccessTokenType is the requested token type for an access token.
+	stsAccessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+
+	stsTokenURLPath = "/v1/token"
+
+	// iamGenerateAccessTokenURLPathTemplate is the IAM Credentials API path
+	// for generating an access token for a service account.
+	iamGenerateAccessTokenURLPathTemplate = "/v1/projects/-/serviceAccounts/%s:generateAccessToken"
+
+	// DefaultAccessTokenLifetime is the lifetime of generated access tokens
+	// and the longest lifetime allowed without an organization policy.
+	DefaultAccessTokenLifetime = time.Hour
+
+	// MaxExtendedAccessTokenLifetime is the longest lifetime that can be
+	// requested for a service account listed in the
+	// constraints/iam.allowServiceAccountCredentialLifetimeExtension
+	// organization policy.
+	MaxExtendedAccessTokenLifetime = 12 * time.Hour
+
+	lifetimeExtensionConstraint = "constraints/iam.allowServiceAccountCredentialLifetimeExtension"
+)
+
+// STSTokenExchangeRequest is a request to exchange a subject token for a
+// Google access token through the Security Token Service.
+type STSTokenExchangeRequest struct {
+	// Audience is the full resource name of the workload identity pool
+	// provider.
+	Audience string
+
+	// Scope are the scopes to request. Defaults to cloud-platform.
+	Scope []string
+
+	// SubjectToken is the external credential being exchanged.
+	SubjectToken string
+
+	// SubjectTokenType is the type of SubjectToken. Defaults to
+	// urn:ietf:params:oauth:token-type:jwt.
+	SubjectTokenType string
+}
+
+// STSTokenResponse is the response of a successful STS token exchange.
+type STSTokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope"`
+}
+
+// Scopes returns the granted scopes, or nil if the response did not list
+// them.
+func (r *STSTokenResponse) Scopes() []string {
+	if strings.TrimSpace(r.Scope) == "" {
+		return nil
+	}
+	return strings.Fields(r.Scope)
+}
+
+// IAMTokenExchangeRequest is a request to generate an access token for a
+// service account through the IAM Credentials API.
+type IAMTokenExchangeRequest struct {
+	// ServiceAccountEmail is the service account to generate a token for.
+	ServiceAccountEmail string
+
+	// Scope are the scopes to request. Defaults to cloud-platform.
+	Scope []string
+
+	// Delegates is the chain of service accounts, as emails or resource
+	// names, through which the token is requested. Each service account
+	// must be granted the Service Account Token Creator role on the next
+	// one, and the last on ServiceAccountEmail.
+	Delegates []string
+
+	// Lifetime is the requested token lifetime, in whole seconds. Defaults
+	// to DefaultAccessTokenLifetime. Lifetimes of up to
+	// MaxExtendedAccessTokenLifetime require Options.ExtendedTokenLifetimes
+	// and the service account to be listed in the
+	// constraints/iam.allowServiceAccountCredentialLifetimeExtension
+	// organization policy.
+	Lifetime time.Duration
+
+	// LifetimeString is the requested token lifetime in the format of the
+	// IAM Credentials API, e.g. "3600s". It is used if Lifetime is not set.
+	//
+	// Deprecated: Use Lifetime.
+	LifetimeString string
+}
+
+// lifetime returns the requested lifetime, or zero for the default. Lifetimes
+// over DefaultAccessTokenLifetime are refused unless allowExtended is set, so
+// that they fail before a round trip to the IAM Credentials API.
+func (r *IAMTokenExchangeRequest) lifetime(allowExtended bool) (time.Duration, error) {
+	lifetime := r.Lifetime
+	if lifetime == 0 && r.LifetimeString != "" {
+		var err error
+		if lifetime, err = time.ParseDuration(r.LifetimeString); err != nil {
+			return 0, fmt.Errorf("invalid token lifetime %q: %v", r.LifetimeString, err)
+		}
+		if lifetime == 0 {
+			return 0, fmt.Errorf("invalid token lifetime %q: must be positive", r.LifetimeString)
+		}
+	}
+
+	switch {
+	case lifetime < 0:
+		return 0, fmt.Errorf("invalid token lifetime %v: must be positive", lifetime)
+	case lifetime%time.Second != 0:
+		return 0, fmt.Errorf("invalid token lifetime %v: must be a whole number of seconds", lifetime)
+	case lifetime > MaxExtendedAccessTokenLifetime:
+		return 0, fmt.Errorf("invalid token lifetime %v: must be at most %v", lifetime, MaxExtendedAccessTokenLifetime)
+	case lifetime > DefaultAccessTokenLifetime && !allowExtended:
+		return 0, fmt.Errorf("invalid token lifetime %v: lifetimes over %v must be enabled with ExtendedTokenLifetimes "+
+			"and require the service account to be listed in the %s organization policy",
+			lifetime, DefaultAccessTokenLifetime, lifetimeExtensionConstraint)
+	}
+	return lifetime, nil
+}
+
+// iamGenerateAccessTokenRequest is the body of a generateAccessToken call.
+type iamGenerateAccessTokenRequest struct {
+	Delegates []string `json:"delegates,omitempty"`
+	Scope     []string `json:"scope"`
+	Lifetime  string   `json:"lifetime,omitempty"`
+}
+
+// IAMTokenResponse is the response of a successful generateAccessToken call.
+type IAMTokenResponse struct {
+	AccessToken string    `json:"accessToken"`
+	ExpireTime  time.Time `json:"expireTime"`
+}
+
+// STSError is an OAuth 2.0 error returned by the Security Token Service.
+type STSError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *STSError) Error() string {
+	return fmt.Sprintf("STS token exchange failed with status %d: %s: %s", e.StatusCode, e.Code, e.Description)
+}
+
+// ExchangeToken exchanges a subject token for a federated Google access token
+// through the Security Token Service.
+func (c *Client) ExchangeToken(ctx context.Context, req *STSTokenExchangeRequest) (*STSTokenResponse, error) {
+	defer c.measure("sts_exchange", time.Now())
+	resp, err := c.makeSTSRequest(ctx, req)
+	if err != nil {
+		c.incrError("sts_exchange")
+		return nil, err
+	}
+	c.checkGrantedScopes("sts_exchange", req.Scope, resp.Scopes())
+	return resp, nil
+}
+
+// GenerateAccessToken generates an access token for a service account
+// through the IAM Credentials API, authenticated with the client's
+// credentials.
+func (c *Client) GenerateAccessToken(ctx context.Context, req *IAMTokenExchangeRequest) (*IAMTokenResponse, error) {
+	defer c.measure("generate_access_token", time.Now())
+	resp, err := c.makeIAMRequest(ctx, c.authClient, req)
+	if err != nil {
+		c.incrError("generate_access_token")
+		return nil, err
+	}
+	return resp, nil
+}
+
+// defaultGenerateAccessTokensConcurrency is the number of concurrent calls
+// made by GenerateAccessTokens when no concurrency is given.
+const defaultGenerateAccessTokensConcurrency = 8
+
+// AccessTokenResult is the outcome of generating an access token for one
+// service account with GenerateAccessTokens. Exactly one of Token and Err is
+// set.
+type AccessTokenResult struct {
+	ServiceAccountEmail string
+	Token               *IAMTokenResponse
+	Err                 error
+}
+
+// GenerateAccessTokens generates access tokens for many service accounts
+// with the given scopes and lifetime, making at most concurrency calls at
+// once (8 if not positive). The results are in the order of emails; a
+// failure for one service account does not affect the others. An error is
+// returned only if the request itself is invalid.
+func (c *Client) GenerateAccessTokens(ctx context.Context, emails []string, scopes []string, lifetime time.Duration, concurrency int) ([]*AccessTokenResult, error) {
+	if _, err := (&IAMTokenExchangeRequest{Lifetime: lifetime}).lifetime(c.opts.ExtendedTokenLifetimes); err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = defaultGenerateAccessTokensConcurrency
+	}
+
+	results := make([]*AccessTokenResult, len(emails))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, email := range emails {
+		results[i] = &AccessTokenResult{ServiceAccountEmail: email}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *AccessTokenResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result.Token, result.Err = c.GenerateAccessToken(ctx, &IAMTokenExchangeRequest{
+				ServiceAccountEmail: result.ServiceAccountEmail,
+				Scope:               scopes,
+				Lifetime:            lifetime,
+			})
+		}(results[i])
+	}
+	wg.Wait()
+	return results, nil
+}
+
+const (
+	// maxErrorBodySize bounds how much of an error response is read.
+	maxErrorBodySize = 64 << 10
+
+	// stsFormSizeHint is the approximate size of an STS request body
+	// without the audience and subject token.
+	stsFormSizeHint = 384
+)
+
+func (c *Client) makeSTSRequest(ctx context.Context, req *STSTokenExchangeRequest) (*STSTokenResponse, error) {
+	if req == nil || req.Audience == "" || req.SubjectToken == "" {
+		return nil, errors.New("audience and subject token are required for an STS token exchange")
+	}
+
+	// Request bodies are not pooled: the transport may still read a body
+	// after the response has been returned.
+	var buf bytes.Buffer
+	buf.Grow(stsFormSizeHint + len(req.Audience) + len(req.SubjectToken))
+	writeSTSForm(&buf, req)
+	body := buf.Bytes()
+	tokenURL := joinEndpoint(c.endpointsFor(ctx).STS, stsTokenURLPath)
+
+	resp, err := c.doWithRetry(ctx, "sts_exchange", c.httpClient, func() (*http.Request, error) {
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		setAPIClientHeader(r, apiClientAccessToken, apiClientCredExternal)
+		return r, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange token with STS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		stsErr := &STSError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(respBody, stsErr); err != nil || stsErr.Code == "" {
+			stsErr.Code = "unknown_error"
+			stsErr.Description = strings.TrimSpace(string(respBody))
+		}
+		return nil, stsErr
+	}
+
+	stsResp := &STSTokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(stsResp); err != nil {
+		return nil, fmt.Errorf("unable to decode STS response: %v", err)
+	}
+	if stsResp.AccessToken == "" {
+		return nil, errors.New("STS response did not contain an access token")
+	}
+	return stsResp, nil
+}
+
+// checkGrantedScopes warns if a token response lists granted scopes that do
+// not cover the requested ones. Responses that do not list scopes are not
+// checked.
+func (c *Client) checkGrantedScopes(op string, requested, granted []string) {
+	if len(granted) == 0 {
+		return
+	}
+	if len(requested) == 0 {
+		requested = defaultTokenAuthScopes
+	}
+	if missing := missingScopes(granted, requested); len(missing) > 0 {
+		c.warn("token was not granted all requested scopes", "op", op, "missing", missing)
+		c.incrCounter([]string{"gcputil", op, "missing_scopes"})
+	}
+}
+
+// writeSTSForm writes the form-encoded body of an STS token exchange to buf.
+// It is equivalent to url.Values.Encode without building the intermediate
+// map.
+func writeSTSForm(buf *bytes.Buffer, req *STSTokenExchangeRequest) {
+	subjectTokenType := req.SubjectTokenType
+	if subjectTokenType == "" {
+		subjectTokenType = defaultJWTSubjectTokenType
+	}
+
+	writeFormField(buf, "audience", req.Audience)
+	writeFormField(buf, "grant_type", stsTokenExchangeGrantType)
+	writeFormField(buf, "requested_token_type", stsAccessTokenType)
+
+	buf.WriteString("&scope=")
+	scopes := req.Scope
+	if len(scopes) == 0 {
+		scopes = defaultTokenAuthScopes
+	}
+	for i, scope := range scopes {
+		if i > 0 {
+			buf.WriteByte('+')
+		}
+		buf.WriteString(url.QueryEscape(scope))
+	}
+
+	writeFormField(buf, "subject_token", req.SubjectToken)
+	writeFormField(buf, "subject_token_type", subjectTokenType)
+}
+
+func writeFormField(buf *bytes.Buffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.WriteByte('&')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	buf.WriteString(url.QueryEscape(value))
+}
+
+func (c *Client) makeIAMRequest(ctx context.Context, httpClient *http.Client, req *IAMTokenExchangeRequest) (*IAMTokenResponse, error) {
+	if req == nil || req.ServiceAccountEmail == "" {
+		return nil, errors.New("service account email is required to generate an access token")
+	}
+	if err := validateServiceAccountRef(req.ServiceAccountEmail); err != nil {
+		return nil, err
+	}
+
+	lifetime, err := req.lifetime(c.opts.ExtendedTokenLifetimes)
+	if err != nil {
+		return nil, err
+	}
+	delegates, err := delegateResourceNames(req.Delegates)
+	if err != nil {
+		return nil, err
+	}
+	payload := iamGenerateAccessTokenRequest{Delegates: delegates, Scope: req.Scope}
+	if len(payload.Scope) == 0 {
+		payload.Scope = defaultTokenAuthScopes
+	}
+	if lifetime > 0 {
+		payload.Lifetime = fmt.Sprintf("%ds", lifetime/time.Second)
+	}
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		return nil, err
+	}
+	tokenURL := joinEndpoint(c.endpointsFor(ctx).IAMCredentials,
+		fmt.Sprintf(iamGenerateAccessTokenURLPathTemplate, url.PathEscape(req.ServiceAccountEmail)))
+
+	resp, err := c.doWithRetry(ctx, "generate_access_token", httpClient, func() (*http.Request, error) {
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", "application/json")
+		setAPIClientHeader(r, apiClientAccessToken, apiClientCredImpersonated)
+		return r, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate access token for service account %q: %v", req.ServiceAccountEmail, err)
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		if lifetime > DefaultAccessTokenLifetime && resp.StatusCode == http.StatusBadRequest {
+			return nil, fmt.Errorf("unable to generate access token for service account %q with lifetime %v; "+
+				"lifetimes over %v require the service account to be listed in the %s organization policy: %w",
+				req.ServiceAccountEmail, lifetime, DefaultAccessTokenLifetime, lifetimeExtensionConstraint, err)
+		}
+		return nil, fmt.Errorf("unable to generate access token for service account %q: %w", req.ServiceAccountEmail, err)
+	}
+
+	iamResp := &IAMTokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(iamResp); err != nil {
+		return nil, fmt.Errorf("unable to decode IAM Credentials response: %v", err)
+	}
+	if iamResp.AccessToken == "" {
+		return nil, errors.New("IAM Credentials response did not contain an access token")
+	}
+	return iamResp, nil
+}
@@ -0,0 +1,199 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultExecTimeout bounds how long a credential command may run.
+	defaultExecTimeout = 30 * time.Second
+
+	// maxExecOutputSize bounds the output read from a credential command.
+	maxExecOutputSize = 1 << 20
+
+	// execWaitDelay bounds how long output is read after a command exits
+	// or is killed.
+	execWaitDelay = time.Second
+)
+
+// limitedBuffer is a bytes.Buffer that fails writes beyond a limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("output exceeds %d bytes", b.limit)
+	}
+	return b.Buffer.Write(p)
+}
+
+// runCredentialCommand runs a credential command and returns its standard
+// output. The command is killed after timeout. env is added to the current
+// environment. Standard error is included in the returned error if the
+// command fails.
+func runCredentialCommand(ctx context.Context, timeout time.Duration, env []string, path string, args ...string) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(os.Environ(), env...)
+	stdout := &limitedBuffer{limit: maxExecOutputSize}
+	stderr := &limitedBuffer{limit: maxExecOutputSize}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Do not wait for children of a killed command that still hold its
+	// output open.
+	cmd.WaitDelay = execWaitDelay
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("command %q timed out after %s", path, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("command %q failed: %v: %s", path, err, msg)
+		}
+		return nil, fmt.Errorf("command %q failed: %v", path, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// ExecCredentialVersion is the version of the exec credential protocol.
+const ExecCredentialVersion = 1
+
+// execCredentialVersionEnv is set in the environment of exec credential
+// commands to the protocol version.
+const execCredentialVersionEnv = "GCPUTIL_EXEC_CREDENTIAL_VERSION"
+
+// defaultExecTokenLifetime is used for tokens without an expiry.
+const defaultExecTokenLifetime = 5 * time.Minute
+
+// ExecCredentialOptions configures a token source that obtains tokens from an
+// external command, e.g. a site-specific token broker.
+//
+// The command must print a single JSON object to standard output:
+//
+//	{
+//	  "version": 1,
+//	  "success": true,
+//	  "access_token": "ya29...",
+//	  "token_type": "Bearer",
+//	  "expires_at": 1700000000
+//	}
+//
+// expires_at is a Unix timestamp in seconds; expires_in, a lifetime in
+// seconds, may be given instead. On failure, the command prints
+// {"version": 1, "success": false, "code": "...", "message": "..."} or
+// exits with a non-zero status.
+type ExecCredentialOptions struct {
+	// Command is the executable to run. It is required.
+	Command string
+
+	// Args are the arguments passed to the command.
+	Args []string
+
+	// Env are additional environment variables, in KEY=value form, set for
+	// the command. GCPUTIL_EXEC_CREDENTIAL_VERSION is always set.
+	Env []string
+
+	// Timeout bounds each invocation. Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// DefaultLifetime is used for tokens returned without an expiry.
+	// Defaults to 5 minutes.
+	DefaultLifetime time.Duration
+}
+
+// ExecCredentialResponse is the output of an exec credential command.
+type ExecCredentialResponse struct {
+	Version     int    `json:"version"`
+	Success     *bool  `json:"success,omitempty"`
+	AccessToken string `json:"access_token,omitempty"`
+	TokenType   string `json:"token_type,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// NewExecTokenSource returns a token source that obtains access tokens by
+// running an external command. Tokens are reused until they expire.
+func NewExecTokenSource(opts *ExecCredentialOptions) (oauth2.TokenSource, error) {
+	if opts == nil || opts.Command == "" {
+		return nil, errors.New("exec credential command is required")
+	}
+	ts := &execTokenSource{opts: *opts}
+	if ts.opts.DefaultLifetime <= 0 {
+		ts.opts.DefaultLifetime = defaultExecTokenLifetime
+	}
+	return oauth2.ReuseTokenSource(nil, ts), nil
+}
+
+type execTokenSource struct {
+	opts ExecCredentialOptions
+}
+
+func (ts *execTokenSource) Token() (*oauth2.Token, error) {
+	env := append([]string{fmt.Sprintf("%s=%d", execCredentialVersionEnv, ExecCredentialVersion)}, ts.opts.Env...)
+	out, err := runCredentialCommand(context.Background(), ts.opts.Timeout, env, ts.opts.Command, ts.opts.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain token from exec credential command: %v", err)
+	}
+	return parseExecCredentialResponse(out, time.Now(), ts.opts.DefaultLifetime)
+}
+
+func parseExecCredentialResponse(out []byte, now time.Time, defaultLifetime time.Duration) (*oauth2.Token, error) {
+	var resp ExecCredentialResponse
+	// Unknown fields are ignored, so that commands can return additional
+	// fields without a new version.
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("unable to decode exec credential response: %v", err)
+	}
+
+	if resp.Version != ExecCredentialVersion {
+		return nil, fmt.Errorf("unsupported exec credential response version %d, expected %d", resp.Version, ExecCredentialVersion)
+	}
+	if resp.Success != nil && !*resp.Success {
+		return nil, fmt.Errorf("exec credential command failed: %s: %s", resp.Code, resp.Message)
+	}
+	if resp.AccessToken == "" || !accessTokenRegex.MatchString(resp.AccessToken) {
+		return nil, errors.New("exec credential response does not contain a valid access token")
+	}
+	if resp.TokenType != "" && !strings.EqualFold(resp.TokenType, "Bearer") {
+		return nil, fmt.Errorf("unsupported exec credential token type %q", resp.TokenType)
+	}
+
+	tok := &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   "Bearer",
+	}
+	switch {
+	case resp.ExpiresAt > 0:
+		tok.Expiry = time.Unix(resp.ExpiresAt, 0)
+	case resp.ExpiresIn > 0:
+		tok.Expiry = now.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	default:
+		tok.Expiry = now.Add(defaultLifetime)
+	}
+	if !tok.Expiry.After(now) {
+		return nil, errors.New("exec credential response contains an expired token")
+	}
+	return tok, nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExecCredentialResponse(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := map[string]struct {
+		Output      string
+		Expiry      time.Time
+		ShouldError bool
+	}{
+		"expires_at": {
+			Output: `{"version":1,"success":true,"access_token":"ya29.a","token_type":"Bearer","expires_at":1700003600}`,
+			Expiry: time.Unix(1700003600, 0),
+		},
+		"expires_in": {
+			Output: `{"version":1,"access_token":"ya29.a","expires_in":60}`,
+			Expiry: now.Add(time.Minute),
+		},
+		"default lifetime": {
+			Output: `{"version":1,"access_token":"ya29.a"}`,
+			Expiry: now.Add(defaultExecTokenLifetime),
+		},
+		"failure": {
+			Output:      `{"version":1,"success":false,"code":"denied","message":"not allowed"}`,
+			ShouldError: true,
+		},
+		"wrong version": {
+			Output:      `{"version":2,"access_token":"ya29.a"}`,
+			ShouldError: true,
+		},
+		"unknown fields": {
+			Output: `{"version":1,"access_token":"ya29.a","id_token":"x","diagnostics":{"cache":"hit"}}`,
+			Expiry: now.Add(defaultExecTokenLifetime),
+		},
+		"expired": {
+			Output:      `{"version":1,"access_token":"ya29.a","expires_at":1600000000}`,
+			ShouldError: true,
+		},
+		"invalid token": {
+			Output:      `{"version":1,"access_token":"not a token"}`,
+			ShouldError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tok, err := parseExecCredentialResponse([]byte(tc.Output), now, defaultExecTokenLifetime)
+			if tc.ShouldError {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tok.AccessToken != "ya29.a" || !tok.Expiry.Equal(tc.Expiry) {
+				t.Errorf("unexpected token %+v", tok)
+			}
+		})
+	}
+}
+
+func TestExecTokenSource(t *testing.T) {
+	path := writeTestScript(t, `echo "{\"version\":$GCPUTIL_EXEC_CREDENTIAL_VERSION,\"access_token\":\"$PREFIX.$1\",\"expires_in\":3600}"`)
+	ts, err := NewExecTokenSource(&ExecCredentialOptions{
+		Command: path,
+		Args:    []string{"arg"},
+		Env:     []string{"PREFIX=ya29"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok.AccessToken != "ya29.arg" {
+		t.Errorf("expected ya29.arg, got %q", tok.AccessToken)
+	}
+}
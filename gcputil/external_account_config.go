@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ExternalAccountCredentialSource is the credential_source of an
+// external_account credential configuration: where the SDKs and gcloud read
+// the subject token from. Exactly one of File and URL must be set.
+type ExternalAccountCredentialSource struct {
+	// File is the path of a file holding the subject token.
+	File string `json:"file,omitempty"`
+
+	// URL is an endpoint that returns the subject token, requested with the
+	// given Headers.
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Format describes the subject token's format. Defaults to plain text.
+	Format *ExternalAccountCredentialFormat `json:"format,omitempty"`
+}
+
+// ExternalAccountCredentialFormat is the format of the subject token read
+// from an ExternalAccountCredentialSource.
+type ExternalAccountCredentialFormat struct {
+	// Type is "text" or "json".
+	Type string `json:"type"`
+
+	// SubjectTokenFieldName is the field holding the subject token in JSON
+	// responses.
+	SubjectTokenFieldName string `json:"subject_token_field_name,omitempty"`
+}
+
+func (s *ExternalAccountCredentialSource) validate() error {
+	if (s.File == "") == (s.URL == "") {
+		return errors.New("exactly one of a credential source file or URL is required")
+	}
+	if s.Format == nil {
+		return nil
+	}
+	switch s.Format.Type {
+	case "", "text":
+	case "json":
+		if s.Format.SubjectTokenFieldName == "" {
+			return errors.New("a subject token field name is required for the json credential source format")
+		}
+	default:
+		return fmt.Errorf("unsupported credential source format %q", s.Format.Type)
+	}
+	return nil
+}
+
+// externalAccountCredentialConfig is the external_account credential
+// configuration file format.
+type externalAccountCredentialConfig struct {
+	Type                           string                           `json:"type"`
+	Audience                       string                           `json:"audience"`
+	SubjectTokenType               string                           `json:"subject_token_type"`
+	TokenURL                       string                           `json:"token_url"`
+	ServiceAccountImpersonationURL string                           `json:"service_account_impersonation_url,omitempty"`
+	ServiceAccountImpersonation    *serviceAccountImpersonationInfo `json:"service_account_impersonation,omitempty"`
+	CredentialSource               *ExternalAccountCredentialSource `json:"credential_source"`
+	WorkforcePoolUserProject       string                           `json:"workforce_pool_user_project,omitempty"`
+}
+
+type serviceAccountImpersonationInfo struct {
+	TokenLifetimeSeconds int `json:"token_lifetime_seconds"`
+}
+
+// CredentialConfigJSON returns an external_account credential configuration
+// for the workload identity federation setup of c, reading subject tokens
+// from source. The configuration can be used with gcloud, the Google Cloud
+// SDKs and FindCredentials, e.g. through GOOGLE_APPLICATION_CREDENTIALS.
+// Endpoint overrides from ctx and c.IAMCredentialsEndpoint are applied.
+func (c *ExternalAccountConfig) CredentialConfigJSON(ctx context.Context, source *ExternalAccountCredentialSource) ([]byte, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, errors.New("a credential source is required, token suppliers cannot be written to a configuration")
+	}
+	if len(c.Delegates) > 0 {
+		return nil, errors.New("delegates cannot be written to an external_account configuration")
+	}
+	if err := source.validate(); err != nil {
+		return nil, err
+	}
+
+	endpoints, err := c.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subjectTokenType, err := c.subjectTokenType()
+	if err != nil {
+		return nil, err
+	}
+	config := externalAccountCredentialConfig{
+		Type:             CredentialTypeExternalAccount,
+		Audience:         strings.TrimPrefix(c.Audience, "https:"),
+		SubjectTokenType: subjectTokenType,
+		TokenURL:         joinEndpoint(endpoints.STS, stsTokenURLPath),
+		CredentialSource: source,
+
+		WorkforcePoolUserProject: c.WorkforcePoolUserProject,
+	}
+	if c.ServiceAccountEmail != "" {
+		if err := validateServiceAccountRef(c.ServiceAccountEmail); err != nil {
+			return nil, err
+		}
+		config.ServiceAccountImpersonationURL = joinEndpoint(endpoints.IAMCredentials, fmt.Sprintf(iamGenerateAccessTokenURLPathTemplate, url.PathEscape(c.ServiceAccountEmail)))
+		lifetimeSeconds, err := c.lifetimeSeconds()
+		if err != nil {
+			return nil, err
+		}
+		if lifetimeSeconds > 0 {
+			config.ServiceAccountImpersonation = &serviceAccountImpersonationInfo{TokenLifetimeSeconds: lifetimeSeconds}
+		}
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
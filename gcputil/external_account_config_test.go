@@ -0,0 +1,93 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestExternalAccountConfig_CredentialConfigJSON(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	sts.ExpectSubjectToken("oidc-token")
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("oidc-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const audience = "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider"
+
+	tests := map[string]struct {
+		Config      ExternalAccountConfig
+		Source      *ExternalAccountCredentialSource
+		Token       string
+		ShouldError bool
+	}{
+		"federated token": {
+			Config: ExternalAccountConfig{Audience: audience},
+			Source: &ExternalAccountCredentialSource{File: tokenFile},
+			Token:  "federated-token",
+		},
+		"impersonation": {
+			Config: ExternalAccountConfig{Audience: audience, ServiceAccountEmail: "sa@p.iam.gserviceaccount.com", TTL: 30 * time.Minute},
+			Source: &ExternalAccountCredentialSource{File: tokenFile, Format: &ExternalAccountCredentialFormat{Type: "text"}},
+			Token:  "iam-access-token-sa@p.iam.gserviceaccount.com",
+		},
+		"no source": {
+			Config:      ExternalAccountConfig{Audience: audience},
+			ShouldError: true,
+		},
+		"file and url": {
+			Config:      ExternalAccountConfig{Audience: audience},
+			Source:      &ExternalAccountCredentialSource{File: tokenFile, URL: "http://127.0.0.1/token"},
+			ShouldError: true,
+		},
+		"json format without field": {
+			Config:      ExternalAccountConfig{Audience: audience},
+			Source:      &ExternalAccountCredentialSource{URL: "http://127.0.0.1/token", Format: &ExternalAccountCredentialFormat{Type: "json"}},
+			ShouldError: true,
+		},
+		"no audience": {
+			Source:      &ExternalAccountCredentialSource{File: tokenFile},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvOAuthAccessToken, "")
+			configJSON, err := test.Config.CredentialConfigJSON(ctx, test.Source)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The configuration is usable by FindCredentials.
+			_, ts, err := FindCredentials(string(configJSON), context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != test.Token {
+				t.Fatalf("expected token %q, got %q", test.Token, tok.AccessToken)
+			}
+		})
+	}
+}
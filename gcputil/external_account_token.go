@@ -0,0 +1,355 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google/externalaccount"
+)
+
+// ExternalAccountTokenSource is an oauth2.TokenSource for an
+// ExternalAccountConfig that exchanges subject tokens at STS and, if a
+// service account is configured, impersonates it, through its delegates if
+// any. Without a service account, the federated access token of STS is
+// returned, for workloads whose federated principal is granted IAM roles
+// directly. Tokens are cached until shortly before they expire. It is safe
+// for concurrent use.
+type ExternalAccountTokenSource struct {
+	config     externalaccount.Config
+	httpClient *http.Client
+	baseCtx    context.Context
+
+	// federated and impersonation are set if a service account is
+	// impersonated with the federated token.
+	federated     *ExternalAccountTokenSource
+	iamClient     *Client
+	iamEndpoint   string
+	impersonation *IAMTokenExchangeRequest
+
+	// idToken is set if the token source returns ID tokens rather than
+	// access tokens.
+	idToken *externalAccountIDTokenRequest
+
+	// onRefreshSuccess and onRefreshFailure are the refresh hooks of the
+	// configuration, to which audience is reported.
+	audience         string
+	onRefreshSuccess func(*ExternalAccountRefreshEvent)
+	onRefreshFailure func(*ExternalAccountRefreshEvent)
+
+	mu       sync.Mutex
+	token    *oauth2.Token
+	failures int
+	inflight *externalAccountFetch
+}
+
+// externalAccountFetch is a token fetch in progress, whose result is shared
+// with the callers that wait for it. done is closed once tok or err is set.
+type externalAccountFetch struct {
+	done     chan struct{}
+	tok      *oauth2.Token
+	err      error
+	canceled bool
+}
+
+// ExternalAccountRefreshEvent describes a token fetch of an
+// ExternalAccountTokenSource for the refresh hooks of ExternalAccountConfig.
+// It never includes the token itself.
+type ExternalAccountRefreshEvent struct {
+	// Audience is the STS audience of the configuration.
+	Audience string
+
+	// ServiceAccountEmail is the impersonated service account, or empty if
+	// the federated token is used directly.
+	ServiceAccountEmail string
+
+	// Expiry is when the new token expires. It is zero for failures.
+	Expiry time.Time
+
+	// Duration is how long the fetch took.
+	Duration time.Duration
+
+	// ConsecutiveFailures is the number of failed fetches since the last
+	// successful one, including this one. It is zero for successes.
+	ConsecutiveFailures int
+
+	// Err is why the fetch failed. It is nil for successes.
+	Err error
+}
+
+var _ oauth2.TokenSource = &ExternalAccountTokenSource{}
+
+// TokenSource returns an ExternalAccountTokenSource for the configuration,
+// which is checked with Validate. Endpoint overrides and the
+// oauth2.HTTPClient from ctx are applied, with c.IAMCredentialsEndpoint
+// taking precedence. Tokens fetched with Token keep the values of ctx but not
+// its deadline or cancellation; use TokenContext to bound a fetch by a
+// request's context.
+func (c *ExternalAccountConfig) TokenSource(ctx context.Context) (*ExternalAccountTokenSource, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	httpClient, ok := ctx.Value(oauth2.HTTPClient).(*http.Client)
+	if !ok {
+		httpClient = packageHTTPClient()
+	}
+	endpoints, err := c.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lifetimeSeconds, err := c.lifetimeSeconds()
+	if err != nil {
+		return nil, err
+	}
+	subjectTokenType, err := c.subjectTokenType()
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &ExternalAccountTokenSource{
+		config: externalaccount.Config{
+			Audience:             strings.TrimPrefix(c.Audience, "https:"),
+			SubjectTokenType:     subjectTokenType,
+			SubjectTokenSupplier: c.TokenSupplier,
+			Scopes:               defaultTokenAuthScopes,
+			TokenURL:             joinEndpoint(endpoints.STS, stsTokenURLPath),
+
+			WorkforcePoolUserProject: c.WorkforcePoolUserProject,
+		},
+		httpClient: httpClient,
+		baseCtx:    context.WithoutCancel(ctx),
+	}
+	// Validate the configuration up front, as externalaccount does when a
+	// token source is created.
+	if _, err := ts.newTokenSource(ctx); err != nil {
+		return nil, err
+	}
+	if c.ServiceAccountEmail == "" {
+		ts.setRefreshHooks(c)
+		return ts, nil
+	}
+
+	// The externalaccount package does not support delegates, so the
+	// federated token is exchanged for a service account token here.
+	federated := ts
+	iamClient, err := NewClient(ctx, &Options{
+		TokenSource:            federated,
+		HTTPClient:             httpClient,
+		Endpoints:              &GCPEndpoints{IAMCredentials: endpoints.IAMCredentials},
+		ExtendedTokenLifetimes: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	impersonated := &ExternalAccountTokenSource{
+		httpClient:  httpClient,
+		baseCtx:     federated.baseCtx,
+		federated:   federated,
+		iamClient:   iamClient,
+		iamEndpoint: endpoints.IAMCredentials,
+		impersonation: &IAMTokenExchangeRequest{
+			ServiceAccountEmail: c.ServiceAccountEmail,
+			Delegates:           c.Delegates,
+			Lifetime:            time.Duration(lifetimeSeconds) * time.Second,
+		},
+	}
+	impersonated.setRefreshHooks(c)
+	return impersonated, nil
+}
+
+// setRefreshHooks sets the refresh hooks of the configuration.
+func (ts *ExternalAccountTokenSource) setRefreshHooks(c *ExternalAccountConfig) {
+	ts.audience = c.Audience
+	ts.onRefreshSuccess = c.OnRefreshSuccess
+	ts.onRefreshFailure = c.OnRefreshFailure
+}
+
+// externalAccountIDTokenRequest are the parameters of the generateIdToken
+// calls of an ID token source.
+type externalAccountIDTokenRequest struct {
+	audience     string
+	includeEmail bool
+}
+
+// IDTokenSource returns an ExternalAccountTokenSource whose tokens are
+// Google-signed OIDC ID tokens of ServiceAccountEmail for the given audience,
+// obtained with the IAM Credentials generateIdToken method, e.g. for calling
+// services protected by Identity-Aware Proxy or Cloud Run. The ID token is
+// returned as the token's AccessToken, and expires with its exp claim. If
+// includeEmail is true, the tokens have email and email_verified claims. A
+// service account is required, as STS does not issue ID tokens; the
+// federated principal needs the iam.serviceAccounts.getOpenIdToken
+// permission on it.
+func (c *ExternalAccountConfig) IDTokenSource(ctx context.Context, audience string, includeEmail bool) (*ExternalAccountTokenSource, error) {
+	if audience == "" {
+		return nil, errors.New("audience is required to generate an ID token")
+	}
+	if c.ServiceAccountEmail == "" {
+		return nil, errors.New("a service account email is required to generate an ID token")
+	}
+	ts, err := c.TokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ts.idToken = &externalAccountIDTokenRequest{audience: audience, includeEmail: includeEmail}
+	return ts, nil
+}
+
+// Token returns a cached token if it is still valid, or fetches a new one.
+func (ts *ExternalAccountTokenSource) Token() (*oauth2.Token, error) {
+	return ts.TokenContext(ts.baseCtx)
+}
+
+// TokenContext is like Token, but the subject token supplier, the STS
+// exchange and the impersonation request use ctx, so a fetch is abandoned
+// when ctx is done. Concurrent callers share a single fetch, and stop waiting
+// for it when their own ctx is done. The refresh hooks of the configuration
+// are called after each fetch.
+func (ts *ExternalAccountTokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	for {
+		ts.mu.Lock()
+		if ts.token.Valid() {
+			defer ts.mu.Unlock()
+			return ts.token, nil
+		}
+		f := ts.inflight
+		if f == nil {
+			f = &externalAccountFetch{done: make(chan struct{})}
+			ts.inflight = f
+			ts.mu.Unlock()
+			ts.runFetch(ctx, f)
+			return f.tok, f.err
+		}
+		ts.mu.Unlock()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// A fetch abandoned because the context of the caller that started
+		// it is done is retried with this caller's context.
+		if f.err != nil && f.canceled {
+			continue
+		}
+		return f.tok, f.err
+	}
+}
+
+// runFetch fetches a new token with ctx for f, which it completes, and calls
+// the refresh hooks. The lock is not held during the fetch, so that callers
+// whose context is done need not wait for it.
+func (ts *ExternalAccountTokenSource) runFetch(ctx context.Context, f *externalAccountFetch) {
+	start := time.Now()
+	tok, err := ts.fetch(ctx)
+	event := &ExternalAccountRefreshEvent{
+		Audience: ts.audience,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if ts.impersonation != nil {
+		event.ServiceAccountEmail = ts.impersonation.ServiceAccountEmail
+	}
+
+	ts.mu.Lock()
+	if err != nil {
+		ts.failures++
+		event.ConsecutiveFailures = ts.failures
+	} else {
+		ts.token = tok
+		ts.failures = 0
+		event.Expiry = tok.Expiry
+	}
+	ts.inflight = nil
+	f.tok, f.err, f.canceled = tok, err, err != nil && ctx.Err() != nil
+	close(f.done)
+	ts.mu.Unlock()
+
+	// The hooks are called without holding the lock, so they may use the
+	// token source.
+	if err != nil {
+		if ts.onRefreshFailure != nil {
+			ts.onRefreshFailure(event)
+		}
+		return
+	}
+	if ts.onRefreshSuccess != nil {
+		ts.onRefreshSuccess(event)
+	}
+}
+
+// fetch fetches a new token.
+func (ts *ExternalAccountTokenSource) fetch(ctx context.Context) (*oauth2.Token, error) {
+	switch {
+	case ts.idToken != nil:
+		return ts.generateIDToken(ctx)
+	case ts.impersonation != nil:
+		return ts.impersonate(ctx)
+	}
+	src, err := ts.newTokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return src.Token()
+}
+
+// impersonate exchanges a federated token for an access token of the
+// impersonated service account.
+func (ts *ExternalAccountTokenSource) impersonate(ctx context.Context) (*oauth2.Token, error) {
+	ctx, authClient, err := ts.federatedClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ts.iamClient.makeIAMRequest(ctx, authClient, ts.impersonation)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      resp.ExpireTime,
+	}, nil
+}
+
+// generateIDToken exchanges a federated token for an ID token of the
+// impersonated service account.
+func (ts *ExternalAccountTokenSource) generateIDToken(ctx context.Context) (*oauth2.Token, error) {
+	ctx, authClient, err := ts.federatedClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := ts.iamClient.generateIDToken(ctx, authClient, ts.impersonation.ServiceAccountEmail, ts.impersonation.Delegates, ts.idToken.audience, ts.idToken.includeEmail)
+	if err != nil {
+		return nil, err
+	}
+	return idTokenFunc(func() (string, error) { return idToken, nil }).Token()
+}
+
+// federatedClient returns an HTTP client authenticated with a federated
+// token fetched with ctx, and ctx with the configured IAM Credentials
+// endpoint, which takes precedence over overrides from ctx.
+func (ts *ExternalAccountTokenSource) federatedClient(ctx context.Context) (context.Context, *http.Client, error) {
+	federatedToken, err := ts.federated.TokenContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	authClient := &http.Client{
+		Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(federatedToken), Base: transportOrDefault(ts.httpClient.Transport)},
+		Timeout:   ts.httpClient.Timeout,
+	}
+	return WithEndpointOverrides(ctx, &GCPEndpoints{IAMCredentials: ts.iamEndpoint}), authClient, nil
+}
+
+// newTokenSource returns an uncached externalaccount token source that
+// makes its requests with ctx.
+func (ts *ExternalAccountTokenSource) newTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, ts.httpClient)
+	return externalaccount.NewTokenSource(ctx, ts.config)
+}
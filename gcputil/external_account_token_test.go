@@ -0,0 +1,634 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+	"golang.org/x/oauth2/google/externalaccount"
+)
+
+// testSubjectTokenSupplier returns a fixed subject token or error, or blocks
+// until the context is done if block is set. If release is set, it waits for
+// release to be closed first.
+type testSubjectTokenSupplier struct {
+	token   string
+	err     error
+	block   bool
+	release chan struct{}
+	calls   int32
+}
+
+func (s *testSubjectTokenSupplier) SubjectToken(ctx context.Context, _ externalaccount.SupplierOptions) (string, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if s.block {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return s.token, s.err
+}
+
+func TestExternalAccountTokenSource(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	sts.ExpectSubjectToken("oidc-token")
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	const email = "sa@p.iam.gserviceaccount.com"
+	supplier := &testSubjectTokenSupplier{token: "oidc-token"}
+	config := &ExternalAccountConfig{
+		Audience:            "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+		ServiceAccountEmail: email,
+		TokenSupplier:       supplier,
+	}
+
+	// Cancelling the context the token source was created with does not
+	// affect later fetches.
+	createCtx, cancel := context.WithCancel(ctx)
+	ts, err := config.TokenSource(createCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "iam-access-token-"+email {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+	if _, err := ts.TokenContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&supplier.calls); calls != 1 {
+		t.Fatalf("expected the token to be cached, got %d subject token calls", calls)
+	}
+}
+
+func TestExternalAccountTokenSource_TokenContext(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	config := &ExternalAccountConfig{
+		Audience:            "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+		ServiceAccountEmail: "sa@p.iam.gserviceaccount.com",
+		TokenSupplier:       &testSubjectTokenSupplier{block: true},
+	}
+	ts, err := config.TokenSource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := ts.TokenContext(reqCtx); err == nil {
+		t.Fatal("expected error")
+	}
+	if time.Since(start) > 5*time.Second || !errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+		t.Fatal("expected the caller's deadline to abort the fetch")
+	}
+	if len(sts.Requests()) != 0 || len(iamCreds.Requests()) != 0 {
+		t.Fatal("expected no token exchange")
+	}
+}
+
+func TestExternalAccountTokenSource_sharedFetch(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL})
+
+	var successes int32
+	supplier := &testSubjectTokenSupplier{token: "oidc-token", release: make(chan struct{})}
+	config := &ExternalAccountConfig{
+		Audience:         "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+		TokenSupplier:    supplier,
+		OnRefreshSuccess: func(*ExternalAccountRefreshEvent) { atomic.AddInt32(&successes, 1) },
+	}
+	ts, err := config.TokenSource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first caller's fetch is canceled while a second caller waits for
+	// it, so the second caller fetches with its own context.
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := ts.TokenContext(firstCtx)
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&supplier.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A caller whose context is done does not wait for the fetch.
+	reqCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := ts.TokenContext(reqCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("expected the caller's deadline to stop waiting for the fetch")
+	}
+
+	const waiters = 5
+	results := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			tok, err := ts.TokenContext(context.Background())
+			if err == nil && tok.AccessToken != "federated-token" {
+				err = fmt.Errorf("unexpected token %+v", tok)
+			}
+			results <- err
+		}()
+	}
+	cancelFirst()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	close(supplier.release)
+	for i := 0; i < waiters; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls := atomic.LoadInt32(&supplier.calls); calls != 2 {
+		t.Fatalf("expected the waiters to share one fetch after the canceled one, got %d subject token calls", calls)
+	}
+	if len(sts.Requests()) != 1 || atomic.LoadInt32(&successes) != 1 {
+		t.Fatalf("expected one token exchange and success event, got %d and %d", len(sts.Requests()), successes)
+	}
+}
+
+func TestExternalAccountConfig_IAMCredentialsEndpoint(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: "https://ignored.example.com"})
+
+	const email = "sa@p.iam.gserviceaccount.com"
+	tests := map[string]struct {
+		Endpoint    string
+		ShouldError bool
+	}{
+		"endpoint": {
+			Endpoint: iamCreds.URL,
+		},
+		"invalid endpoint": {
+			Endpoint:    "iamcredentials.internal",
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &ExternalAccountConfig{
+				Audience:               "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+				ServiceAccountEmail:    email,
+				TokenSupplier:          &testSubjectTokenSupplier{token: "oidc-token"},
+				IAMCredentialsEndpoint: test.Endpoint,
+			}
+			ts, err := config.TokenSource(ctx)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != "iam-access-token-"+email {
+				t.Fatalf("unexpected token %+v", tok)
+			}
+		})
+	}
+}
+
+func TestExternalAccountConfig_TTL(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	const email = "sa@p.iam.gserviceaccount.com"
+	tests := map[string]struct {
+		TTL         time.Duration
+		Lifetime    string
+		ShouldError bool
+	}{
+		"default": {},
+		"ttl": {
+			TTL:      30 * time.Minute,
+			Lifetime: "1800s",
+		},
+		"extended": {
+			TTL:      4 * time.Hour,
+			Lifetime: "14400s",
+		},
+		"fractional seconds": {
+			TTL:      90*time.Second + 500*time.Millisecond,
+			Lifetime: "90s",
+		},
+		"under a second": {
+			TTL: 500 * time.Millisecond,
+		},
+		"maximum with a fraction of a second": {
+			TTL:      MaxExtendedAccessTokenLifetime + 500*time.Millisecond,
+			Lifetime: "43200s",
+		},
+		"too long": {
+			TTL:         13 * time.Hour,
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &ExternalAccountConfig{
+				Audience:            "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+				ServiceAccountEmail: email,
+				TokenSupplier:       &testSubjectTokenSupplier{token: "oidc-token"},
+				TTL:                 test.TTL,
+			}
+			ts, err := config.TokenSource(ctx)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := len(iamCreds.RequestsFor(testutil.MethodGenerateAccessToken))
+			if _, err := ts.Token(); err != nil {
+				t.Fatal(err)
+			}
+			reqs := iamCreds.RequestsFor(testutil.MethodGenerateAccessToken)
+			if len(reqs) != before+1 {
+				t.Fatalf("expected one request, got %+v", reqs)
+			}
+			if lifetime, _ := reqs[len(reqs)-1].Body["lifetime"].(string); lifetime != test.Lifetime {
+				t.Fatalf("expected lifetime %q, got requests %+v", test.Lifetime, reqs)
+			}
+		})
+	}
+}
+
+func TestExternalAccountTokenSource_federated(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	sts.ExpectSubjectToken("oidc-token")
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	config := &ExternalAccountConfig{
+		Audience:      "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+		TokenSupplier: &testSubjectTokenSupplier{token: "oidc-token"},
+	}
+	ts, err := config.TokenSource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "federated-token" {
+		t.Fatalf("expected the federated token, got %+v", tok)
+	}
+	if len(iamCreds.Requests()) != 0 {
+		t.Fatal("expected no impersonation request")
+	}
+}
+
+func TestExternalAccountConfig_Delegates(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	const email = "sa@p.iam.gserviceaccount.com"
+	tests := map[string]struct {
+		Delegates   []string
+		ShouldError bool
+	}{
+		"delegates": {
+			Delegates: []string{"hop1@p.iam.gserviceaccount.com", "projects/-/serviceAccounts/hop2@p.iam.gserviceaccount.com"},
+		},
+		"invalid delegate": {
+			Delegates:   []string{"not an email"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &ExternalAccountConfig{
+				Audience:            "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+				ServiceAccountEmail: email,
+				Delegates:           test.Delegates,
+				TokenSupplier:       &testSubjectTokenSupplier{token: "oidc-token"},
+			}
+			ts, err := config.TokenSource(ctx)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != "iam-access-token-"+email {
+				t.Fatalf("unexpected token %+v", tok)
+			}
+
+			reqs := iamCreds.RequestsFor(testutil.MethodGenerateAccessToken)
+			req := reqs[len(reqs)-1]
+			if req.Authorization != "Bearer federated-token" {
+				t.Fatalf("expected the federated token to authenticate impersonation, got %q", req.Authorization)
+			}
+			delegates, _ := req.Body["delegates"].([]interface{})
+			if len(delegates) != 2 || delegates[0] != "projects/-/serviceAccounts/hop1@p.iam.gserviceaccount.com" {
+				t.Fatalf("unexpected delegates %v", req.Body["delegates"])
+			}
+		})
+	}
+}
+
+func TestExternalAccountConfig_IDTokenSource(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	const email = "sa@p.iam.gserviceaccount.com"
+	const audience = "https://service-abc.a.run.app"
+	tests := map[string]struct {
+		ServiceAccountEmail string
+		Audience            string
+		IncludeEmail        bool
+		Delegates           []string
+		ShouldError         bool
+	}{
+		"id token": {
+			ServiceAccountEmail: email,
+			Audience:            audience,
+			IncludeEmail:        true,
+		},
+		"delegates": {
+			ServiceAccountEmail: email,
+			Audience:            audience,
+			Delegates:           []string{"hop@p.iam.gserviceaccount.com"},
+		},
+		"no service account": {
+			Audience:    audience,
+			ShouldError: true,
+		},
+		"no audience": {
+			ServiceAccountEmail: email,
+			ShouldError:         true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &ExternalAccountConfig{
+				Audience:            "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+				ServiceAccountEmail: test.ServiceAccountEmail,
+				Delegates:           test.Delegates,
+				TokenSupplier:       &testSubjectTokenSupplier{token: "oidc-token"},
+			}
+			ts, err := config.IDTokenSource(ctx, test.Audience, test.IncludeEmail)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.Expiry.IsZero() {
+				t.Fatal("expected the expiry of the ID token")
+			}
+			var claims map[string]interface{}
+			if err := decodeJWTSegment(strings.Split(tok.AccessToken, ".")[1], &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims["aud"] != test.Audience || claims["sub"] != email {
+				t.Fatalf("unexpected claims %v", claims)
+			}
+			if _, ok := claims["email"]; ok != test.IncludeEmail {
+				t.Fatalf("unexpected email claim in %v", claims)
+			}
+
+			reqs := iamCreds.RequestsFor(testutil.MethodGenerateIdToken)
+			req := reqs[len(reqs)-1]
+			if req.Authorization != "Bearer federated-token" {
+				t.Fatalf("expected the federated token to authenticate the request, got %q", req.Authorization)
+			}
+			if delegates, _ := req.Body["delegates"].([]interface{}); len(delegates) != len(test.Delegates) {
+				t.Fatalf("unexpected delegates %v", req.Body["delegates"])
+			}
+		})
+	}
+}
+
+func TestExternalAccountConfig_SubjectTokenType(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL})
+
+	tests := map[string]struct {
+		SubjectTokenType string
+		Expected         string
+		ShouldError      bool
+	}{
+		"default": {
+			Expected: SubjectTokenTypeJWT,
+		},
+		"saml": {
+			SubjectTokenType: SubjectTokenTypeSAML2,
+			Expected:         SubjectTokenTypeSAML2,
+		},
+		"aws": {
+			SubjectTokenType: SubjectTokenTypeAWS4Request,
+			Expected:         SubjectTokenTypeAWS4Request,
+		},
+		"unsupported": {
+			SubjectTokenType: "urn:example:token",
+			ShouldError:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &ExternalAccountConfig{
+				Audience:         "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+				TokenSupplier:    &testSubjectTokenSupplier{token: "subject-token"},
+				SubjectTokenType: test.SubjectTokenType,
+			}
+			ts, err := config.TokenSource(ctx)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ts.Token(); err != nil {
+				t.Fatal(err)
+			}
+			reqs := sts.Requests()
+			if got := reqs[len(reqs)-1].Get("subject_token_type"); got != test.Expected {
+				t.Fatalf("expected subject token type %q, got %q", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestExternalAccountConfig_WorkforcePoolUserProject(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL})
+
+	tests := map[string]struct {
+		Audience    string
+		UserProject string
+		Options     string
+		ShouldError bool
+	}{
+		"workforce pool": {
+			Audience:    "//iam.googleapis.com/locations/global/workforcePools/pool/providers/provider",
+			UserProject: "billing-project",
+			Options:     `{"userProject":"billing-project"}`,
+		},
+		"workforce pool without user project": {
+			Audience: "//iam.googleapis.com/locations/global/workforcePools/pool/providers/provider",
+		},
+		"workload identity pool": {
+			Audience:    "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+			UserProject: "billing-project",
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &ExternalAccountConfig{
+				Audience:                 test.Audience,
+				TokenSupplier:            &testSubjectTokenSupplier{token: "subject-token"},
+				WorkforcePoolUserProject: test.UserProject,
+			}
+			ts, err := config.TokenSource(ctx)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if _, err := config.CredentialConfigJSON(ctx, &ExternalAccountCredentialSource{File: "/var/run/token"}); err == nil {
+					t.Fatal("expected credential configuration error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ts.Token(); err != nil {
+				t.Fatal(err)
+			}
+			reqs := sts.Requests()
+			if got := reqs[len(reqs)-1].Get("options"); got != test.Options {
+				t.Fatalf("expected options %q, got %q", test.Options, got)
+			}
+		})
+	}
+}
+
+func TestExternalAccountConfig_RefreshHooks(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL, IAMCredentials: iamCreds.URL})
+
+	const email = "sa@p.iam.gserviceaccount.com"
+	var successes, failures []*ExternalAccountRefreshEvent
+	supplier := &testSubjectTokenSupplier{err: errors.New("token file not found")}
+	config := &ExternalAccountConfig{
+		Audience:            "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+		ServiceAccountEmail: email,
+		TokenSupplier:       supplier,
+		OnRefreshSuccess:    func(e *ExternalAccountRefreshEvent) { successes = append(successes, e) },
+		OnRefreshFailure:    func(e *ExternalAccountRefreshEvent) { failures = append(failures, e) },
+	}
+	ts, err := config.TokenSource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, err := ts.Token(); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(failures) != i || failures[i-1].ConsecutiveFailures != i || failures[i-1].Err == nil {
+			t.Fatalf("unexpected failure events %+v", failures)
+		}
+	}
+
+	supplier.err = nil
+	supplier.token = "oidc-token"
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cached tokens are not reported.
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if len(successes) != 1 || len(failures) != 2 {
+		t.Fatalf("expected one success event, got %+v", successes)
+	}
+	event := successes[0]
+	if event.Audience != config.Audience || event.ServiceAccountEmail != email {
+		t.Fatalf("unexpected success event %+v", event)
+	}
+	if !event.Expiry.Equal(tok.Expiry) || event.ConsecutiveFailures != 0 || event.Err != nil {
+		t.Fatalf("unexpected success event %+v", event)
+	}
+	if strings.Contains(fmt.Sprintf("%+v", event), tok.AccessToken) {
+		t.Fatal("expected the event not to include the token")
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidExternalAccountConfig is wrapped by all errors returned by
+	// ExternalAccountConfig.Validate.
+	ErrInvalidExternalAccountConfig = errors.New("invalid external account configuration")
+
+	// ErrInvalidAudience is wrapped by the errors for a missing or
+	// malformed Audience.
+	ErrInvalidAudience = errors.New("invalid audience")
+
+	// ErrMissingTokenSupplier is wrapped by the error for a missing
+	// TokenSupplier.
+	ErrMissingTokenSupplier = errors.New("missing token supplier")
+
+	// ErrInvalidServiceAccount is wrapped by the errors for a malformed
+	// ServiceAccountEmail or Delegates.
+	ErrInvalidServiceAccount = errors.New("invalid service account")
+
+	// ErrInvalidTTL is wrapped by the errors for a TTL that is negative or
+	// longer than MaxExtendedAccessTokenLifetime.
+	ErrInvalidTTL = errors.New("invalid TTL")
+)
+
+// ExternalAccountConfigError is returned by ExternalAccountConfig.Validate
+// for an invalid field. It wraps ErrInvalidExternalAccountConfig and, if
+// set, Err.
+type ExternalAccountConfigError struct {
+	// Field is the name of the invalid field, e.g. "Audience".
+	Field string
+
+	// Reason is why the field is invalid.
+	Reason string
+
+	// Err is ErrInvalidAudience, ErrMissingTokenSupplier,
+	// ErrInvalidServiceAccount or ErrInvalidTTL, or nil for other fields.
+	Err error
+}
+
+func (e *ExternalAccountConfigError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrInvalidExternalAccountConfig, e.Field, e.Reason)
+}
+
+func (e *ExternalAccountConfigError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrInvalidExternalAccountConfig}
+	}
+	return []error{ErrInvalidExternalAccountConfig, e.Err}
+}
+
+// Validate checks the configuration without making any requests, so that
+// misconfigurations are caught at setup time rather than by the first token
+// fetch. It returns an *ExternalAccountConfigError for the first invalid
+// field; Audience must be a workload identity pool or workforce pool
+// provider audience, as returned by BuildWorkloadIdentityPoolAudience and
+// BuildWorkforcePoolAudience, or a GKE or fleet workload identity audience,
+// as returned by GKEWorkloadIdentityAudience and
+// FleetWorkloadIdentityAudience. TokenSource calls Validate.
+func (c *ExternalAccountConfig) Validate() error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if c.TokenSupplier == nil {
+		return &ExternalAccountConfigError{Field: "TokenSupplier", Reason: "a subject token supplier is required", Err: ErrMissingTokenSupplier}
+	}
+	return nil
+}
+
+// validate checks all fields but TokenSupplier, which credential
+// configurations replace with a credential source.
+func (c *ExternalAccountConfig) validate() error {
+	audience := strings.TrimPrefix(c.Audience, "https:")
+	switch {
+	case audience == "":
+		return &ExternalAccountConfigError{Field: "Audience", Reason: "audience is required", Err: ErrInvalidAudience}
+	case !workloadIdentityPoolAudienceRegex.MatchString(audience) &&
+		!workforcePoolAudienceRegex.MatchString(audience) &&
+		!workloadIdentityAudienceRegex.MatchString(audience):
+		return &ExternalAccountConfigError{
+			Field:  "Audience",
+			Reason: fmt.Sprintf("%q is not a workload identity pool, workforce pool or GKE workload identity audience", c.Audience),
+			Err:    ErrInvalidAudience,
+		}
+	}
+	if c.ServiceAccountEmail != "" {
+		if err := validateServiceAccountRef(c.ServiceAccountEmail); err != nil {
+			return &ExternalAccountConfigError{Field: "ServiceAccountEmail", Reason: err.Error(), Err: ErrInvalidServiceAccount}
+		}
+	}
+	if _, err := delegateResourceNames(c.Delegates); err != nil {
+		return &ExternalAccountConfigError{Field: "Delegates", Reason: err.Error(), Err: ErrInvalidServiceAccount}
+	}
+	if len(c.Delegates) > 0 && c.ServiceAccountEmail == "" {
+		return &ExternalAccountConfigError{Field: "Delegates", Reason: "delegates require a service account email", Err: ErrInvalidServiceAccount}
+	}
+	if _, err := c.lifetimeSeconds(); err != nil {
+		return &ExternalAccountConfigError{Field: "TTL", Reason: err.Error(), Err: ErrInvalidTTL}
+	}
+	if _, err := c.subjectTokenType(); err != nil {
+		return &ExternalAccountConfigError{Field: "SubjectTokenType", Reason: err.Error()}
+	}
+	if err := c.validateWorkforcePoolUserProject(); err != nil {
+		return &ExternalAccountConfigError{Field: "WorkforcePoolUserProject", Reason: err.Error()}
+	}
+	if err := (&GCPEndpoints{IAMCredentials: c.IAMCredentialsEndpoint}).Validate(); err != nil {
+		return &ExternalAccountConfigError{Field: "IAMCredentialsEndpoint", Reason: err.Error()}
+	}
+	return nil
+}
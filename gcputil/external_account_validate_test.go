@@ -0,0 +1,157 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExternalAccountConfig_Validate(t *testing.T) {
+	const audience = "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider"
+	supplier := &testSubjectTokenSupplier{token: "subject-token"}
+
+	tests := map[string]struct {
+		Config ExternalAccountConfig
+		Field  string
+		Err    error
+	}{
+		"federated": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier},
+		},
+		"impersonation": {
+			Config: ExternalAccountConfig{
+				Audience:            "https:" + audience,
+				TokenSupplier:       supplier,
+				ServiceAccountEmail: "sa@p.iam.gserviceaccount.com",
+				Delegates:           []string{"delegate@p.iam.gserviceaccount.com"},
+				TTL:                 4 * time.Hour,
+			},
+		},
+		"fractional TTL": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, TTL: 1500 * time.Millisecond},
+		},
+		"workforce pool": {
+			Config: ExternalAccountConfig{
+				Audience:                 "//iam.googleapis.com/locations/global/workforcePools/pool/providers/provider",
+				TokenSupplier:            supplier,
+				WorkforcePoolUserProject: "billing-project",
+			},
+		},
+		"GKE workload identity": {
+			Config: ExternalAccountConfig{
+				Audience:      GKEWorkloadIdentityAudience("my-proj", "us-central1", "c1"),
+				TokenSupplier: supplier,
+			},
+		},
+		"fleet workload identity": {
+			Config: ExternalAccountConfig{
+				Audience:      FleetWorkloadIdentityAudience("fleet", "global", "m"),
+				TokenSupplier: supplier,
+			},
+		},
+		"missing audience": {
+			Config: ExternalAccountConfig{TokenSupplier: supplier},
+			Field:  "Audience",
+			Err:    ErrInvalidAudience,
+		},
+		"project ID in audience": {
+			Config: ExternalAccountConfig{
+				Audience:      "//iam.googleapis.com/projects/my-project/locations/global/workloadIdentityPools/pool/providers/provider",
+				TokenSupplier: supplier,
+			},
+			Field: "Audience",
+			Err:   ErrInvalidAudience,
+		},
+		"pool resource name as audience": {
+			Config: ExternalAccountConfig{
+				Audience:      "projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+				TokenSupplier: supplier,
+			},
+			Field: "Audience",
+			Err:   ErrInvalidAudience,
+		},
+		"missing token supplier": {
+			Config: ExternalAccountConfig{Audience: audience},
+			Field:  "TokenSupplier",
+			Err:    ErrMissingTokenSupplier,
+		},
+		"malformed service account email": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, ServiceAccountEmail: "sa@example.com"},
+			Field:  "ServiceAccountEmail",
+			Err:    ErrInvalidServiceAccount,
+		},
+		"malformed delegate": {
+			Config: ExternalAccountConfig{
+				Audience:            audience,
+				TokenSupplier:       supplier,
+				ServiceAccountEmail: "sa@p.iam.gserviceaccount.com",
+				Delegates:           []string{"delegate"},
+			},
+			Field: "Delegates",
+			Err:   ErrInvalidServiceAccount,
+		},
+		"delegates without service account": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, Delegates: []string{"delegate@p.iam.gserviceaccount.com"}},
+			Field:  "Delegates",
+			Err:    ErrInvalidServiceAccount,
+		},
+		"negative TTL": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, TTL: -time.Minute},
+			Field:  "TTL",
+			Err:    ErrInvalidTTL,
+		},
+		"negative fractional TTL": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, TTL: -500 * time.Millisecond},
+			Field:  "TTL",
+			Err:    ErrInvalidTTL,
+		},
+		"TTL too long": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, TTL: 13 * time.Hour},
+			Field:  "TTL",
+			Err:    ErrInvalidTTL,
+		},
+		"unsupported subject token type": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, SubjectTokenType: "urn:example:token"},
+			Field:  "SubjectTokenType",
+		},
+		"invalid IAM Credentials endpoint": {
+			Config: ExternalAccountConfig{Audience: audience, TokenSupplier: supplier, IAMCredentialsEndpoint: "iamcredentials.internal"},
+			Field:  "IAMCredentialsEndpoint",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.Config.Validate()
+			if test.Field == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := test.Config.TokenSource(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var configErr *ExternalAccountConfigError
+			if !errors.As(err, &configErr) || !errors.Is(err, ErrInvalidExternalAccountConfig) {
+				t.Fatalf("expected an ExternalAccountConfigError, got %v", err)
+			}
+			if configErr.Field != test.Field {
+				t.Fatalf("expected an error for %s, got %v", test.Field, err)
+			}
+			if test.Err != nil && !errors.Is(err, test.Err) {
+				t.Fatalf("expected %v, got %v", test.Err, err)
+			}
+
+			// TokenSource rejects the configuration before making any
+			// requests.
+			if _, err := test.Config.TokenSource(context.Background()); !errors.Is(err, ErrInvalidExternalAccountConfig) {
+				t.Fatalf("expected TokenSource to fail validation, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// federationAudiencePrefix is the prefix of the STS audiences of workload
+// identity and workforce pool providers.
+const federationAudiencePrefix = "//iam.googleapis.com/"
+
+var (
+	// workloadIdentityPoolIDRegex matches workload identity pool and
+	// provider IDs: 4 to 32 lower case letters, digits and dashes.
+	workloadIdentityPoolIDRegex = regexp.MustCompile(`^[a-z0-9-]{4,32}$`)
+	// workforcePoolIDRegex matches workforce pool IDs: 6 to 63 lower case
+	// letters, digits and dashes, starting with a letter and not ending
+	// with a dash.
+	workforcePoolIDRegex = regexp.MustCompile(`^[a-z][a-z0-9-]{4,61}[a-z0-9]$`)
+	// workforcePoolProviderIDRegex matches workforce pool provider IDs.
+	workforcePoolProviderIDRegex = regexp.MustCompile(`^[a-z0-9-]{4,32}$`)
+	// projectNumberRegex matches project numbers.
+	projectNumberRegex = regexp.MustCompile(`^[0-9]{1,30}$`)
+
+	// workloadIdentityPoolAudienceRegex matches the STS audiences of
+	// workload identity pool providers.
+	workloadIdentityPoolAudienceRegex = regexp.MustCompile(`^//iam\.googleapis\.com/projects/[0-9]+/locations/[^/]+/workloadIdentityPools/[^/]+/providers/[^/]+$`)
+	// workforcePoolAudienceRegex matches the STS audiences of workforce
+	// identity pool providers.
+	workforcePoolAudienceRegex = regexp.MustCompile(`^//iam\.googleapis\.com/locations/[^/]+/workforcePools/[^/]+/providers/[^/]+$`)
+)
+
+// BuildWorkloadIdentityPoolAudience returns the STS audience of a workload
+// identity pool provider, e.g.
+// //iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/my-pool/providers/my-provider,
+// for use as ExternalAccountConfig.Audience. The project must be given by
+// number, not ID, as STS does not accept project IDs in audiences.
+func BuildWorkloadIdentityPoolAudience(projectNumber, poolID, providerID string) (string, error) {
+	if !projectNumberRegex.MatchString(projectNumber) {
+		return "", fmt.Errorf("invalid project number %q, workload identity pool audiences require the project number rather than the project ID", projectNumber)
+	}
+	if err := validateFederationID("workload identity pool", poolID, workloadIdentityPoolIDRegex); err != nil {
+		return "", err
+	}
+	if err := validateFederationID("workload identity pool provider", providerID, workloadIdentityPoolIDRegex); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%sprojects/%s/locations/global/workloadIdentityPools/%s/providers/%s", federationAudiencePrefix, projectNumber, poolID, providerID), nil
+}
+
+// BuildWorkforcePoolAudience returns the STS audience of a workforce pool
+// provider, e.g.
+// //iam.googleapis.com/locations/global/workforcePools/my-pool/providers/my-provider,
+// for use as ExternalAccountConfig.Audience. Workforce pools belong to an
+// organization rather than a project, so ExternalAccountConfig also needs a
+// WorkforcePoolUserProject.
+func BuildWorkforcePoolAudience(poolID, providerID string) (string, error) {
+	if err := validateFederationID("workforce pool", poolID, workforcePoolIDRegex); err != nil {
+		return "", err
+	}
+	if err := validateFederationID("workforce pool provider", providerID, workforcePoolProviderIDRegex); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%slocations/global/workforcePools/%s/providers/%s", federationAudiencePrefix, poolID, providerID), nil
+}
+
+// validateFederationID validates a pool or provider ID. IDs starting with
+// "gcp-" are reserved by Google.
+func validateFederationID(kind, id string, re *regexp.Regexp) error {
+	if !re.MatchString(id) {
+		return fmt.Errorf("invalid %s ID %q", kind, id)
+	}
+	if strings.HasPrefix(id, "gcp-") {
+		return fmt.Errorf("invalid %s ID %q, the gcp- prefix is reserved", kind, id)
+	}
+	return nil
+}
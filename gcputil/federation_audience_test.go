@@ -0,0 +1,129 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"testing"
+)
+
+func TestBuildWorkloadIdentityPoolAudience(t *testing.T) {
+	tests := map[string]struct {
+		ProjectNumber string
+		PoolID        string
+		ProviderID    string
+		Expected      string
+		ShouldError   bool
+	}{
+		"valid": {
+			ProjectNumber: "123456789",
+			PoolID:        "my-pool",
+			ProviderID:    "github",
+			Expected:      "//iam.googleapis.com/projects/123456789/locations/global/workloadIdentityPools/my-pool/providers/github",
+		},
+		"project ID": {
+			ProjectNumber: "my-project",
+			PoolID:        "my-pool",
+			ProviderID:    "github",
+			ShouldError:   true,
+		},
+		"short pool ID": {
+			ProjectNumber: "123",
+			PoolID:        "abc",
+			ProviderID:    "github",
+			ShouldError:   true,
+		},
+		"upper case provider ID": {
+			ProjectNumber: "123",
+			PoolID:        "my-pool",
+			ProviderID:    "GitHub",
+			ShouldError:   true,
+		},
+		"reserved pool ID": {
+			ProjectNumber: "123",
+			PoolID:        "gcp-pool",
+			ProviderID:    "github",
+			ShouldError:   true,
+		},
+		"full resource name as ID": {
+			ProjectNumber: "123",
+			PoolID:        "projects/123/locations/global/workloadIdentityPools/my-pool",
+			ProviderID:    "github",
+			ShouldError:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			aud, err := BuildWorkloadIdentityPoolAudience(test.ProjectNumber, test.PoolID, test.ProviderID)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatalf("expected error, got %q", aud)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aud != test.Expected {
+				t.Fatalf("expected %q, got %q", test.Expected, aud)
+			}
+		})
+	}
+}
+
+func TestBuildWorkforcePoolAudience(t *testing.T) {
+	tests := map[string]struct {
+		PoolID      string
+		ProviderID  string
+		Expected    string
+		ShouldError bool
+	}{
+		"valid": {
+			PoolID:     "my-workforce-pool",
+			ProviderID: "okta",
+			Expected:   "//iam.googleapis.com/locations/global/workforcePools/my-workforce-pool/providers/okta",
+		},
+		"pool ID starting with a digit": {
+			PoolID:      "1-workforce",
+			ProviderID:  "okta",
+			ShouldError: true,
+		},
+		"pool ID ending with a dash": {
+			PoolID:      "workforce-",
+			ProviderID:  "okta",
+			ShouldError: true,
+		},
+		"short pool ID": {
+			PoolID:      "pool",
+			ProviderID:  "okta",
+			ShouldError: true,
+		},
+		"short provider ID": {
+			PoolID:      "my-workforce-pool",
+			ProviderID:  "ok",
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			aud, err := BuildWorkforcePoolAudience(test.PoolID, test.ProviderID)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatalf("expected error, got %q", aud)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aud != test.Expected {
+				t.Fatalf("expected %q, got %q", test.Expected, aud)
+			}
+			if !workforcePoolAudienceRegex.MatchString(aud) {
+				t.Fatalf("expected %q to be a workforce pool audience", aud)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// EnvApplicationCredentials is the environment variable with the path of the
+// Application Default Credentials file.
+const EnvApplicationCredentials = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// CredentialSource identifies a step of the credential lookup chain of
+// FindCredentialsWithOptions.
+type CredentialSource string
+
+const (
+	// CredentialSourceJSON is FindCredentialsOptions.CredentialsJSON.
+	CredentialSourceJSON CredentialSource = "json"
+
+	// CredentialSourceFile is the file at FindCredentialsOptions.CredentialsFile.
+	CredentialSourceFile CredentialSource = "file"
+
+	// CredentialSourceAccessToken is FindCredentialsOptions.AccessToken.
+	CredentialSourceAccessToken CredentialSource = "access_token"
+
+	// CredentialSourceAccessTokenEnv is an access token in
+	// GOOGLE_OAUTH_ACCESS_TOKEN.
+	CredentialSourceAccessTokenEnv CredentialSource = "access_token_env"
+
+	// CredentialSourceCredentialsEnv is credential JSON in
+	// GOOGLE_CREDENTIALS.
+	CredentialSourceCredentialsEnv CredentialSource = "credentials_env"
+
+	// CredentialSourceKeyfileEnv is credential JSON in
+	// GOOGLE_CLOUD_KEYFILE_JSON.
+	CredentialSourceKeyfileEnv CredentialSource = "keyfile_env"
+
+	// CredentialSourceHomeFile is the file ~/.gcp/credentials.
+	CredentialSourceHomeFile CredentialSource = "home_file"
+
+	// CredentialSourceApplicationCredentialsEnv is the credential file at the
+	// path in GOOGLE_APPLICATION_CREDENTIALS. Unlike CredentialSourceADC, it
+	// yields parsed credentials, e.g. with ClientEmail and ProjectId.
+	CredentialSourceApplicationCredentialsEnv CredentialSource = "application_credentials_env"
+
+	// CredentialSourceGcloud is the gcloud CLI configuration: the
+	// application_default_credentials.json file in the gcloud configuration
+	// directory, or else the active account of the active gcloud
+	// configuration, whose tokens are obtained by running gcloud. The
+	// directory is CLOUDSDK_CONFIG, or %APPDATA%\gcloud on Windows and
+	// ~/.config/gcloud elsewhere. It is not one of the default sources; add it
+	// to FindCredentialsOptions.Sources so developer workstations need no
+	// environment variables.
+	CredentialSourceGcloud CredentialSource = "gcloud"
+
+	// CredentialSourceADC is Google Application Default Credentials.
+	CredentialSourceADC CredentialSource = "adc"
+
+	// CredentialSourceMetadata is the default service account of the
+	// GCE/GKE/App Engine metadata server.
+	CredentialSourceMetadata CredentialSource = "metadata"
+)
+
+// DefaultCredentialSources returns the lookup chain used by FindCredentials.
+func DefaultCredentialSources() []CredentialSource {
+	return []CredentialSource{
+		CredentialSourceJSON,
+		CredentialSourceFile,
+		CredentialSourceAccessToken,
+		CredentialSourceAccessTokenEnv,
+		CredentialSourceCredentialsEnv,
+		CredentialSourceKeyfileEnv,
+		CredentialSourceHomeFile,
+		CredentialSourceApplicationCredentialsEnv,
+		CredentialSourceADC,
+		CredentialSourceMetadata,
+	}
+}
+
+// FindCredentialsOptions configures FindCredentialsWithOptions.
+type FindCredentialsOptions struct {
+	// CredentialsJSON is credential JSON for the CredentialSourceJSON step.
+	CredentialsJSON string
+
+	// CredentialsFile is the path of a credential file for the
+	// CredentialSourceFile step.
+	CredentialsFile string
+
+	// AccessToken is an OAuth 2.0 access token for the
+	// CredentialSourceAccessToken step. It is used as is, until
+	// AccessTokenExpiry if set. See NewStaticAccessTokenSource.
+	AccessToken       string
+	AccessTokenExpiry time.Time
+
+	// Scopes are requested for the returned token source.
+	Scopes []string
+
+	// AssertionSigner, if set, signs the JWT assertions of found service
+	// account credentials, whose JSON then needs no private_key.
+	AssertionSigner AssertionSigner
+
+	// PrivateKeyPassphrase, if set, decrypts the encrypted private key of
+	// found service account credentials. See StaticPassphrase.
+	PrivateKeyPassphrase PassphraseFunc
+
+	// SelfSignedJWT, if set, makes the token source of found service account
+	// credentials mint self-signed JWTs instead of exchanging assertions at
+	// the OAuth 2.0 token endpoint. See NewSelfSignedJWTTokenSource.
+	SelfSignedJWT bool
+
+	// Subject, if set, is the Google Workspace user that found service account
+	// credentials impersonate through domain-wide delegation. Credentials
+	// of other types are rejected, and the metadata server is not consulted.
+	Subject string
+
+	// TokenURL, if set, overrides the token endpoint of found service
+	// account credentials. See GcpCredentials.TokenURL.
+	TokenURL string
+
+	// GcloudPath is the gcloud executable run by the CredentialSourceGcloud
+	// step. Defaults to "gcloud" on the PATH.
+	GcloudPath string
+
+	// Sources are the lookup steps to try, in order. Steps that are not
+	// listed are never consulted, which allows enforcing which credential
+	// sources are acceptable. Defaults to DefaultCredentialSources.
+	Sources []CredentialSource
+}
+
+// FindCredentialsWithOptions obtains GCP credentials from the first of the
+// configured sources that provides them. See FindCredentials for the
+// returned values.
+//
+// Once a source provides credential JSON or an access token, the other
+// JSON and token sources are skipped. If the JSON cannot be parsed, lookup
+// continues with Application Default Credentials and the metadata server, if
+// configured.
+func FindCredentialsWithOptions(ctx context.Context, opts *FindCredentialsOptions) (*GcpCredentials, oauth2.TokenSource, error) {
+	found, err := FindCredentialsWithSource(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return found.Credentials, found.TokenSource, nil
+}
+
+// FoundCredentials are credentials found by FindCredentialsWithSource.
+type FoundCredentials struct {
+	// Credentials are the parsed credentials. They are empty for an access
+	// token and nil for Application Default Credentials without JSON.
+	Credentials *GcpCredentials
+
+	TokenSource oauth2.TokenSource
+
+	// Source is the lookup step that provided the credentials.
+	Source CredentialSource
+}
+
+// FindCredentialsWithSource is like FindCredentialsWithOptions, but also
+// reports which source provided the credentials, e.g. for audit logging.
+func FindCredentialsWithSource(ctx context.Context, opts *FindCredentialsOptions) (*FoundCredentials, error) {
+	if opts == nil {
+		opts = &FindCredentialsOptions{}
+	}
+	sources := opts.Sources
+	if sources == nil {
+		sources = DefaultCredentialSources()
+	}
+
+	var credsJSON string
+	var adcErr error
+	for _, source := range sources {
+		switch source {
+		case CredentialSourceJSON, CredentialSourceFile, CredentialSourceAccessToken, CredentialSourceAccessTokenEnv,
+			CredentialSourceCredentialsEnv, CredentialSourceKeyfileEnv, CredentialSourceHomeFile,
+			CredentialSourceApplicationCredentialsEnv, CredentialSourceGcloud:
+			if credsJSON != "" {
+				continue
+			}
+			if source == CredentialSourceAccessToken || source == CredentialSourceAccessTokenEnv {
+				ts, err := accessTokenFrom(source, opts)
+				if err != nil {
+					return nil, err
+				}
+				if ts != nil {
+					logDebug("using static access token", "source", source)
+					return &FoundCredentials{Credentials: &GcpCredentials{}, TokenSource: ts, Source: source}, nil
+				}
+				continue
+			}
+
+			var err error
+			if credsJSON, err = credentialsJSONFrom(ctx, source, opts); err != nil {
+				return nil, err
+			}
+			if credsJSON == "" && source == CredentialSourceGcloud {
+				creds, ts, err := gcloudCLICredentials(opts)
+				if err != nil {
+					return nil, err
+				}
+				if ts != nil {
+					logDebug("using gcloud CLI credentials", "client_email", creds.ClientEmail)
+					return &FoundCredentials{Credentials: creds, TokenSource: ts, Source: source}, nil
+				}
+				continue
+			}
+			if credsJSON == "" {
+				continue
+			}
+
+			creds, err := Credentials(credsJSON)
+			if err == nil && isServiceAccountType(creds.Type) {
+				if opts.AssertionSigner != nil {
+					creds.AssertionSigner = opts.AssertionSigner
+				}
+				creds.Subject = opts.Subject
+				creds.TokenURL = opts.TokenURL
+				creds.PrivateKeyPassphrase = opts.PrivateKeyPassphrase
+			}
+			if err == nil && (source == CredentialSourceApplicationCredentialsEnv || source == CredentialSourceGcloud) && !isSupportedCredentialType(creds.Type) {
+				// Leave credential types this package does not handle to
+				// Application Default Credentials.
+				continue
+			}
+			if err == nil {
+				if opts.Subject != "" && !isServiceAccountType(creds.Type) {
+					return nil, fmt.Errorf("domain-wide delegation requires service account credentials, got %s credentials", creds.Type)
+				}
+				var ts oauth2.TokenSource
+				if opts.SelfSignedJWT && isServiceAccountType(creds.Type) {
+					ts, err = NewSelfSignedJWTTokenSource(creds, opts.Scopes...)
+				} else {
+					ts, err = credentialsTokenSource(ctx, creds, credsJSON, opts.Scopes)
+				}
+				if err != nil {
+					return nil, err
+				}
+				logDebug("using credentials from JSON", "source", source, "type", creds.Type, "client_email", creds.ClientEmail)
+				return &FoundCredentials{Credentials: creds, TokenSource: ts, Source: source}, nil
+			}
+			// Typed credentials that fail validation are reported rather
+			// than falling back to Application Default Credentials.
+			var typed struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal([]byte(credsJSON), &typed) == nil && typed.Type != "" {
+				return nil, fmt.Errorf("invalid %s credentials: %v", typed.Type, err)
+			}
+
+		case CredentialSourceADC:
+			defaultCreds, err := google.FindDefaultCredentialsWithParams(ctx, google.CredentialsParams{
+				Scopes:  opts.Scopes,
+				Subject: opts.Subject,
+			})
+			if err != nil {
+				adcErr = err
+				continue
+			}
+			var creds *GcpCredentials
+			if defaultCreds.JSON != nil {
+				if creds, err = Credentials(string(defaultCreds.JSON)); err != nil {
+					return nil, errors.New("could not read credentials from application default credential JSON")
+				}
+			}
+			logDebug("using application default credentials")
+			return &FoundCredentials{Credentials: creds, TokenSource: defaultCreds.TokenSource, Source: source}, nil
+
+		case CredentialSourceMetadata:
+			if opts.Subject != "" {
+				logDebug("skipping metadata server credentials, which do not support domain-wide delegation")
+				continue
+			}
+			if mdCreds, mdTokenSource, err := metadataCredentials(ctx, opts.Scopes...); err == nil {
+				logDebug("using metadata server credentials", "client_email", mdCreds.ClientEmail)
+				return &FoundCredentials{Credentials: mdCreds, TokenSource: mdTokenSource, Source: source}, nil
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown credential source %q", source)
+		}
+	}
+
+	if adcErr != nil {
+		return nil, adcErr
+	}
+	return nil, errors.New("no credentials found in the configured sources")
+}
+
+// accessTokenFrom returns a token source for the access token provided by
+// an access token source, or nil if it provides none.
+func accessTokenFrom(source CredentialSource, opts *FindCredentialsOptions) (oauth2.TokenSource, error) {
+	if source == CredentialSourceAccessTokenEnv {
+		return accessTokenFromEnv()
+	}
+	if opts.AccessToken == "" {
+		return nil, nil
+	}
+	return newStaticAccessTokenSource(opts.AccessToken, opts.AccessTokenExpiry, "FindCredentialsOptions.AccessToken")
+}
+
+// credentialsJSONFrom returns the credential JSON provided by a JSON source,
+// or an empty string if it provides none. A missing ~/.gcp/credentials or
+// gcloud application default credentials file provides none, but other
+// errors reading them are reported.
+func credentialsJSONFrom(ctx context.Context, source CredentialSource, opts *FindCredentialsOptions) (string, error) {
+	switch source {
+	case CredentialSourceJSON:
+		return opts.CredentialsJSON, nil
+	case CredentialSourceFile:
+		if opts.CredentialsFile == "" {
+			return "", nil
+		}
+		b, err := ReadCredentialsFile(ctx, opts.CredentialsFile)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case CredentialSourceCredentialsEnv:
+		return os.Getenv("GOOGLE_CREDENTIALS"), nil
+	case CredentialSourceKeyfileEnv:
+		return os.Getenv("GOOGLE_CLOUD_KEYFILE_JSON"), nil
+	case CredentialSourceApplicationCredentialsEnv:
+		path := os.Getenv(EnvApplicationCredentials)
+		if path == "" {
+			return "", nil
+		}
+		b, err := ReadCredentialsFile(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read %s file: %w", EnvApplicationCredentials, err)
+		}
+		return string(b), nil
+	case CredentialSourceGcloud:
+		dir, err := gcloudConfigDir()
+		if errors.Is(err, ErrGcloudConfigNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		b, err := ReadCredentialsFile(ctx, filepath.Join(dir, gcloudADCFile))
+		if errors.Is(err, ErrCredentialsFileNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case CredentialSourceHomeFile:
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", errors.New("could not find home directory")
+		}
+		b, err := ReadCredentialsFile(ctx, filepath.Join(home, defaultHomeCredentialsFile))
+		if errors.Is(err, ErrCredentialsFileNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", nil
+}
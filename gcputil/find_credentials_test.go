@@ -0,0 +1,284 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindCredentialsWithOptions(t *testing.T) {
+	userJSON := func(clientID string) string {
+		return `{"type":"authorized_user","client_id":"` + clientID + `","client_secret":"secret","refresh_token":"refresh"}`
+	}
+	credsFile := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(credsFile, []byte(userJSON("from-file")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	adcFile := filepath.Join(t.TempDir(), "application_default_credentials.json")
+	if err := os.WriteFile(adcFile, []byte(userJSON("from-adc-file")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		Options     FindCredentialsOptions
+		ClientID    string
+		Source      CredentialSource
+		ShouldError bool
+	}{
+		"explicit JSON first": {
+			Options:  FindCredentialsOptions{CredentialsJSON: userJSON("from-json"), CredentialsFile: credsFile},
+			ClientID: "from-json",
+			Source:   CredentialSourceJSON,
+		},
+		"explicit file": {
+			Options:  FindCredentialsOptions{CredentialsFile: credsFile},
+			ClientID: "from-file",
+			Source:   CredentialSourceFile,
+		},
+		"env disabled": {
+			Options: FindCredentialsOptions{
+				CredentialsFile: credsFile,
+				Sources:         []CredentialSource{CredentialSourceHomeFile, CredentialSourceFile},
+			},
+			ClientID: "from-file",
+			Source:   CredentialSourceFile,
+		},
+		"reordered": {
+			Options: FindCredentialsOptions{
+				CredentialsFile: credsFile,
+				Sources:         []CredentialSource{CredentialSourceCredentialsEnv, CredentialSourceFile},
+			},
+			ClientID: "from-env",
+			Source:   CredentialSourceCredentialsEnv,
+		},
+		"application credentials file": {
+			Options:  FindCredentialsOptions{Sources: []CredentialSource{CredentialSourceApplicationCredentialsEnv}},
+			ClientID: "from-adc-file",
+			Source:   CredentialSourceApplicationCredentialsEnv,
+		},
+		"missing file": {
+			Options:     FindCredentialsOptions{CredentialsFile: filepath.Join(t.TempDir(), "missing.json")},
+			ShouldError: true,
+		},
+		"no source provides credentials": {
+			Options:     FindCredentialsOptions{Sources: []CredentialSource{CredentialSourceFile}},
+			ShouldError: true,
+		},
+		"unknown source": {
+			Options:     FindCredentialsOptions{Sources: []CredentialSource{"bogus"}},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvOAuthAccessToken, "")
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("GOOGLE_CREDENTIALS", userJSON("from-env"))
+			t.Setenv(EnvApplicationCredentials, adcFile)
+
+			found, err := FindCredentialsWithSource(context.Background(), &test.Options)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found.Credentials.ClientId != test.ClientID {
+				t.Fatalf("expected credentials from %q, got %q", test.ClientID, found.Credentials.ClientId)
+			}
+			if found.Source != test.Source {
+				t.Fatalf("expected source %q, got %q", test.Source, found.Source)
+			}
+		})
+	}
+}
+
+func TestFindCredentialsWithOptions_subject(t *testing.T) {
+	t.Setenv(EnvOAuthAccessToken, "")
+
+	tests := map[string]struct {
+		Options     FindCredentialsOptions
+		ShouldError bool
+	}{
+		"service account": {
+			Options: FindCredentialsOptions{CredentialsJSON: string(testServiceAccountJSON(t, "http://127.0.0.1:0"))},
+		},
+		"authorized user": {
+			Options:     FindCredentialsOptions{CredentialsJSON: `{"type":"authorized_user","client_id":"c","client_secret":"s","refresh_token":"r"}`},
+			ShouldError: true,
+		},
+		"self-signed JWT": {
+			Options: FindCredentialsOptions{
+				CredentialsJSON: string(testServiceAccountJSON(t, "http://127.0.0.1:0")),
+				SelfSignedJWT:   true,
+			},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.Options.Subject = "user@example.com"
+			creds, _, err := FindCredentialsWithOptions(context.Background(), &test.Options)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.Subject != "user@example.com" {
+				t.Fatalf("unexpected subject %q", creds.Subject)
+			}
+		})
+	}
+}
+
+func TestFindCredentialsWithOptions_tokenURL(t *testing.T) {
+	t.Setenv(EnvOAuthAccessToken, "")
+	tokenSrv, requested := newTestOAuth2Server(t)
+
+	creds, ts, err := FindCredentialsWithOptions(context.Background(), &FindCredentialsOptions{
+		CredentialsJSON: string(testServiceAccountJSON(t, "http://127.0.0.1:0")),
+		Scopes:          []string{"a"},
+		TokenURL:        tokenSrv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.TokenURL != tokenSrv.URL {
+		t.Fatalf("unexpected token URL %q", creds.TokenURL)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token:a" || len(requested()) != 1 {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+
+	// GetHttpClient honors the token URL too.
+	client, err := GetHttpClient(creds, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token:b" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer apiSrv.Close()
+	resp, err := client.Get(apiSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestFindCredentialsWithOptions_gcloud(t *testing.T) {
+	const config = `[core]
+account = dev@example.com
+project = dev-project
+`
+	gcloud := writeTestScript(t, `[ "$*" = "auth print-access-token --quiet --verbosity=error dev@example.com" ] && echo "ya29.gcloud"`)
+
+	tests := map[string]struct {
+		ADC         string
+		Config      string
+		Options     FindCredentialsOptions
+		ClientID    string
+		Token       string
+		ShouldError bool
+	}{
+		"application default credentials": {
+			ADC:      `{"type":"authorized_user","client_id":"from-gcloud","client_secret":"secret","refresh_token":"refresh"}`,
+			Config:   config,
+			ClientID: "from-gcloud",
+		},
+		"active account": {
+			Config: config,
+			Token:  "ya29.gcloud",
+		},
+		"no active account": {
+			Config:      "[core]\nproject = dev-project\n",
+			ShouldError: true,
+		},
+		"gcloud not installed": {
+			Config:      config,
+			Options:     FindCredentialsOptions{GcloudPath: filepath.Join(t.TempDir(), "missing")},
+			ShouldError: true,
+		},
+		"subject": {
+			Config:      config,
+			Options:     FindCredentialsOptions{Subject: "user@example.com"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv(EnvCloudSDKConfig, dir)
+			t.Setenv(EnvCloudSDKActiveConfigName, "")
+			if err := os.MkdirAll(filepath.Join(dir, "configurations"), 0o700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "configurations", "config_default"), []byte(test.Config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if test.ADC != "" {
+				if err := os.WriteFile(filepath.Join(dir, gcloudADCFile), []byte(test.ADC), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := test.Options
+			if opts.GcloudPath == "" {
+				opts.GcloudPath = gcloud
+			}
+			opts.Sources = []CredentialSource{CredentialSourceGcloud}
+			found, err := FindCredentialsWithSource(context.Background(), &opts)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found.Source != CredentialSourceGcloud || found.Credentials.ClientId != test.ClientID {
+				t.Fatalf("unexpected credentials %+v from %q", found.Credentials, found.Source)
+			}
+			if test.Token == "" {
+				return
+			}
+			if found.Credentials.ProjectId != "dev-project" {
+				t.Fatalf("expected project from gcloud configuration, got %q", found.Credentials.ProjectId)
+			}
+			tok, err := found.TokenSource.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != test.Token {
+				t.Fatalf("unexpected token %+v", tok)
+			}
+		})
+	}
+}
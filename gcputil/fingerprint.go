@@ -0,0 +1,60 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Fingerprint returns the SHA-256 fingerprint of the public key of the
+// credentials' private key, which identifies the key in logs without
+// revealing it. It equals the PublicKeyFingerprint of the public key of the
+// service account key's certificate.
+func (c *GcpCredentials) Fingerprint() (string, error) {
+	signer, err := c.Signer()
+	if err != nil {
+		return "", err
+	}
+	defer ZeroizeSigner(signer)
+	return PublicKeyFingerprint(signer.Public())
+}
+
+// PublicKeyFingerprint returns the lowercase hex SHA-256 digest of the
+// DER-encoded PKIX form of the public key, e.g. as returned by PublicKey or
+// KeyProvider.PublicKey.
+func PublicKeyFingerprint(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CertificateFingerprint returns the lowercase hex SHA-256 digest of the
+// DER-encoded certificate in a Google PEM key file (type TYPE_X509_PEM_FILE),
+// as printed by `openssl x509 -fingerprint -sha256` without colons.
+func CertificateFingerprint(pemString string) (string, error) {
+	pemBytes := []byte(pemString)
+	if b64decoded, err := base64.StdEncoding.DecodeString(pemString); err == nil {
+		pemBytes = b64decoded
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return "", errors.New("unable to find pem block in certificate")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
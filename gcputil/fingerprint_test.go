@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	creds := &GcpCredentials{
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+	credsFingerprint, err := creds.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := PublicKey(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubFingerprint, err := PublicKeyFingerprint(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credsFingerprint != pubFingerprint || len(credsFingerprint) != 64 {
+		t.Fatalf("expected matching SHA-256 fingerprints, got %q and %q", credsFingerprint, pubFingerprint)
+	}
+
+	sum := sha256.Sum256(der)
+	for name, encoded := range map[string]string{
+		"pem":    certPEM,
+		"base64": base64.StdEncoding.EncodeToString([]byte(certPEM)),
+	} {
+		certFingerprint, err := CertificateFingerprint(encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if certFingerprint != hex.EncodeToString(sum[:]) {
+			t.Fatalf("%s: unexpected certificate fingerprint %q", name, certFingerprint)
+		}
+	}
+
+	if _, err := (&GcpCredentials{}).Fingerprint(); err == nil {
+		t.Fatal("expected error for credentials without a private key")
+	}
+	if _, err := CertificateFingerprint("not a certificate"); err == nil {
+		t.Fatal("expected error for invalid certificate")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// fipsMinRSABits is the smallest RSA modulus accepted in FIPS mode, per
+// NIST SP 800-131A.
+const fipsMinRSABits = 2048
+
+// ErrNotFIPSCompliant is wrapped by the errors returned for keys that are not
+// accepted in FIPS mode.
+var ErrNotFIPSCompliant = errors.New("not FIPS compliant")
+
+// fipsMode is whether FIPS mode is enabled. It defaults to on in builds with
+// the fips build tag or the boringcrypto Go experiment.
+var fipsMode atomic.Bool
+
+func init() {
+	fipsMode.Store(fipsModeDefault)
+}
+
+// SetFIPSMode enables or disables FIPS mode. In FIPS mode, only RSA keys of
+// at least 2048 bits with a public exponent of at least 65537 and ECDSA keys
+// on the P-256, P-384 and P-521 curves are accepted: service account private
+// keys, AssertionSigners, and public keys fetched to verify signatures that
+// do not comply are rejected with a *FIPSError. It is enabled by default in
+// builds with the fips build tag or GOEXPERIMENT=boringcrypto.
+func SetFIPSMode(enabled bool) {
+	fipsMode.Store(enabled)
+}
+
+// FIPSMode reports whether FIPS mode is enabled.
+func FIPSMode() bool {
+	return fipsMode.Load()
+}
+
+// FIPSError is returned for a key that is not accepted in FIPS mode.
+type FIPSError struct {
+	// KeyType describes the rejected key, e.g. "RSA-1024" or "ECDSA P-224".
+	KeyType string
+
+	// Reason is why the key was rejected.
+	Reason string
+}
+
+func (e *FIPSError) Error() string {
+	return fmt.Sprintf("%s key is %s: %s", e.KeyType, ErrNotFIPSCompliant, e.Reason)
+}
+
+func (e *FIPSError) Unwrap() error {
+	return ErrNotFIPSCompliant
+}
+
+// CheckFIPSPublicKey returns a *FIPSError if the key is not accepted in FIPS
+// mode, regardless of whether FIPS mode is enabled.
+func CheckFIPSPublicKey(key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		keyType := fmt.Sprintf("RSA-%d", k.N.BitLen())
+		if k.N.BitLen() < fipsMinRSABits {
+			return &FIPSError{KeyType: keyType, Reason: fmt.Sprintf("modulus must be at least %d bits", fipsMinRSABits)}
+		}
+		if k.E < 65537 || k.E%2 == 0 {
+			return &FIPSError{KeyType: keyType, Reason: "public exponent must be odd and at least 65537"}
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return nil
+		}
+		return &FIPSError{KeyType: "ECDSA " + k.Curve.Params().Name, Reason: "curve must be P-256, P-384 or P-521"}
+	default:
+		return &FIPSError{KeyType: fmt.Sprintf("%T", key), Reason: "only RSA and ECDSA keys are approved"}
+	}
+}
+
+// checkFIPSPublicKey is CheckFIPSPublicKey if FIPS mode is enabled.
+func checkFIPSPublicKey(key crypto.PublicKey) error {
+	if !FIPSMode() {
+		return nil
+	}
+	return CheckFIPSPublicKey(key)
+}
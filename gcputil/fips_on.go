@@ -0,0 +1,8 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build fips || goexperiment.boringcrypto
+
+package gcputil
+
+const fipsModeDefault = true
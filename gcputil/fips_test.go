@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestCheckFIPSPublicKey(t *testing.T) {
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		Key         crypto.PublicKey
+		ShouldError bool
+	}{
+		"rsa 2048":       {Key: &rsa2048.PublicKey},
+		"ecdsa p256":     {Key: &p256.PublicKey},
+		"rsa 1024":       {Key: &rsa1024.PublicKey, ShouldError: true},
+		"small exponent": {Key: &rsa.PublicKey{N: rsa2048.N, E: 3}, ShouldError: true},
+		"ecdsa p224":     {Key: &p224.PublicKey, ShouldError: true},
+		"ed25519":        {Key: edPub, ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := CheckFIPSPublicKey(test.Key)
+			if test.ShouldError {
+				var fipsErr *FIPSError
+				if !errors.As(err, &fipsErr) || !errors.Is(err, ErrNotFIPSCompliant) {
+					t.Fatalf("expected FIPSError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFIPSMode_privateKey(t *testing.T) {
+	defer SetFIPSMode(FIPSMode())
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := &GcpCredentials{
+		Type:         CredentialTypeServiceAccount,
+		ClientEmail:  "sa@p.iam.gserviceaccount.com",
+		PrivateKeyId: "key-id",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+
+	SetFIPSMode(false)
+	if err := creds.Validate(); err != nil {
+		t.Fatalf("expected key to be accepted outside FIPS mode: %v", err)
+	}
+
+	SetFIPSMode(true)
+	if err := creds.Validate(); !errors.Is(err, ErrNotFIPSCompliant) {
+		t.Fatalf("expected ErrNotFIPSCompliant, got %v", err)
+	}
+	if _, err := creds.Signer(); !errors.Is(err, ErrNotFIPSCompliant) {
+		t.Fatalf("expected ErrNotFIPSCompliant, got %v", err)
+	}
+	if _, err := NewCryptoAssertionSigner("key-id", key); !errors.Is(err, ErrNotFIPSCompliant) {
+		t.Fatalf("expected ErrNotFIPSCompliant, got %v", err)
+	}
+}
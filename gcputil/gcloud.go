@@ -0,0 +1,109 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultGcloudPath          = "gcloud"
+	defaultGcloudTimeout       = 10 * time.Second
+	defaultGcloudTokenLifetime = 5 * time.Minute
+)
+
+// accessTokenRegex matches the characters allowed in an OAuth 2.0 bearer
+// token (RFC 6750).
+var accessTokenRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// GcloudTokenSourceOptions configures a token source that obtains tokens from
+// the gcloud CLI.
+type GcloudTokenSourceOptions struct {
+	// Path is the gcloud executable. Defaults to "gcloud" on the PATH.
+	Path string
+
+	// Account is the gcloud account to use. Defaults to gcloud's active
+	// account.
+	Account string
+
+	// ImpersonateServiceAccount, if set, obtains tokens for the given
+	// service account by impersonation.
+	ImpersonateServiceAccount string
+
+	// Timeout bounds each gcloud invocation. Defaults to 10 seconds.
+	Timeout time.Duration
+
+	// TokenLifetime is how long tokens are reused. gcloud does not report
+	// token expiry, and returns cached tokens that may be close to expiry,
+	// so this should be well below an hour. Defaults to 5 minutes.
+	TokenLifetime time.Duration
+}
+
+// NewGcloudTokenSource returns a token source that obtains access tokens by
+// running `gcloud auth print-access-token`. It is intended for developer
+// workstations where no credential file exists.
+func NewGcloudTokenSource(opts *GcloudTokenSourceOptions) oauth2.TokenSource {
+	ts := &gcloudTokenSource{}
+	if opts != nil {
+		ts.opts = *opts
+	}
+	if ts.opts.Path == "" {
+		ts.opts.Path = defaultGcloudPath
+	}
+	if ts.opts.Timeout <= 0 {
+		ts.opts.Timeout = defaultGcloudTimeout
+	}
+	if ts.opts.TokenLifetime <= 0 {
+		ts.opts.TokenLifetime = defaultGcloudTokenLifetime
+	}
+	return oauth2.ReuseTokenSource(nil, ts)
+}
+
+type gcloudTokenSource struct {
+	opts GcloudTokenSourceOptions
+}
+
+func (ts *gcloudTokenSource) Token() (*oauth2.Token, error) {
+	args := []string{"auth", "print-access-token", "--quiet", "--verbosity=error"}
+	if ts.opts.ImpersonateServiceAccount != "" {
+		args = append(args, "--impersonate-service-account="+ts.opts.ImpersonateServiceAccount)
+	}
+	if ts.opts.Account != "" {
+		args = append(args, ts.opts.Account)
+	}
+
+	out, err := runCredentialCommand(context.Background(), ts.opts.Timeout, []string{"CLOUDSDK_CORE_DISABLE_PROMPTS=1"}, ts.opts.Path, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain token from gcloud: %v", err)
+	}
+
+	token, err := parseGcloudAccessToken(string(out))
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(ts.opts.TokenLifetime),
+	}, nil
+}
+
+// parseGcloudAccessToken validates that gcloud printed a single access token.
+func parseGcloudAccessToken(out string) (string, error) {
+	token := strings.TrimSpace(out)
+	if token == "" {
+		return "", errors.New("gcloud returned an empty access token")
+	}
+	if strings.ContainsAny(token, "\r\n") || !accessTokenRegex.MatchString(token) {
+		return "", errors.New("gcloud returned output that is not an access token")
+	}
+	return token, nil
+}
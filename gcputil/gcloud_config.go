@@ -0,0 +1,239 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/oauth2"
+)
+
+// Environment variables read by ActiveGcloudConfig, as used by gcloud.
+const (
+	EnvCloudSDKConfig           = "CLOUDSDK_CONFIG"
+	EnvCloudSDKActiveConfigName = "CLOUDSDK_ACTIVE_CONFIG_NAME"
+)
+
+const defaultGcloudConfigName = "default"
+
+// gcloudADCFile is the file in the gcloud configuration directory written by
+// `gcloud auth application-default login`.
+const gcloudADCFile = "application_default_credentials.json"
+
+// ErrGcloudConfigNotFound is returned by ActiveGcloudConfig when gcloud has
+// no configuration directory.
+var ErrGcloudConfigNotFound = errors.New("gcloud configuration not found")
+
+var gcloudConfigNameRegex = regexp.MustCompile(`^[a-z][-a-z0-9]*$`)
+
+// GcloudConfig holds the properties of a gcloud configuration used as
+// defaults by this package.
+type GcloudConfig struct {
+	// Name is the name of the configuration.
+	Name string
+
+	// Project is the core/project property.
+	Project string
+
+	// Account is the core/account property.
+	Account string
+
+	// ImpersonateServiceAccount is the
+	// auth/impersonate_service_account property.
+	ImpersonateServiceAccount string
+
+	// Region and Zone are the compute/region and compute/zone properties.
+	Region string
+	Zone   string
+}
+
+// ActiveGcloudConfig reads the active gcloud configuration from the gcloud
+// configuration directory, CLOUDSDK_CONFIG or the platform default, without
+// running gcloud. The active configuration is CLOUDSDK_ACTIVE_CONFIG_NAME, or
+// the one selected with `gcloud config configurations activate`. As with
+// gcloud, CLOUDSDK_<SECTION>_<PROPERTY> environment variables, e.g.
+// CLOUDSDK_CORE_PROJECT, take precedence over the configuration file.
+// ErrGcloudConfigNotFound is returned if gcloud is not configured.
+func ActiveGcloudConfig() (*GcloudConfig, error) {
+	dir, err := gcloudConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrGcloudConfigNotFound
+		}
+		return nil, err
+	}
+
+	name := os.Getenv(EnvCloudSDKActiveConfigName)
+	if name == "" {
+		b, err := os.ReadFile(filepath.Join(dir, "active_config"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		name = strings.TrimSpace(string(b))
+	}
+	if name == "" {
+		name = defaultGcloudConfigName
+	}
+	if !gcloudConfigNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("invalid gcloud configuration name %q", name)
+	}
+
+	props := map[string]string{}
+	b, err := os.ReadFile(filepath.Join(dir, "configurations", "config_"+name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		props = parseGcloudProperties(b)
+	}
+
+	get := func(key string) string {
+		env := "CLOUDSDK_" + strings.ToUpper(strings.ReplaceAll(key, "/", "_"))
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+		return props[key]
+	}
+	return &GcloudConfig{
+		Name:                      name,
+		Project:                   get("core/project"),
+		Account:                   get("core/account"),
+		ImpersonateServiceAccount: get("auth/impersonate_service_account"),
+		Region:                    get("compute/region"),
+		Zone:                      get("compute/zone"),
+	}, nil
+}
+
+// ProjectOr returns project if it is set, or the configuration's project.
+// It can be called on a nil configuration.
+func (c *GcloudConfig) ProjectOr(project string) string {
+	if project != "" || c == nil {
+		return project
+	}
+	return c.Project
+}
+
+// ImpersonateServiceAccountOr returns serviceAccount if it is set, or the
+// configuration's impersonation target. gcloud allows a comma-separated
+// delegation chain; only the final target is returned. It can be called on a
+// nil configuration.
+func (c *GcloudConfig) ImpersonateServiceAccountOr(serviceAccount string) string {
+	if serviceAccount != "" || c == nil || c.ImpersonateServiceAccount == "" {
+		return serviceAccount
+	}
+	chain := strings.Split(c.ImpersonateServiceAccount, ",")
+	return strings.TrimSpace(chain[len(chain)-1])
+}
+
+// RegionOr returns region if it is set, or the configuration's region,
+// falling back to the region of its zone. It can be called on a nil
+// configuration.
+func (c *GcloudConfig) RegionOr(region string) string {
+	if region != "" || c == nil {
+		return region
+	}
+	if c.Region != "" {
+		return c.Region
+	}
+	if zoneRegion, err := ZoneToRegion(c.Zone); err == nil {
+		return zoneRegion
+	}
+	return ""
+}
+
+// gcloudCLICredentials returns a token source that runs gcloud for the active
+// account of the active gcloud configuration, impersonating its
+// auth/impersonate_service_account, if any. It returns a nil token source if
+// gcloud is not installed or has no active account, and when a domain-wide
+// delegation subject is set, which gcloud does not support. The credentials
+// hold the configuration's project and the impersonated service account.
+func gcloudCLICredentials(opts *FindCredentialsOptions) (*GcpCredentials, oauth2.TokenSource, error) {
+	if opts.Subject != "" {
+		logDebug("skipping gcloud CLI credentials, which do not support domain-wide delegation")
+		return nil, nil, nil
+	}
+	config, err := ActiveGcloudConfig()
+	if errors.Is(err, ErrGcloudConfigNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read gcloud configuration: %v", err)
+	}
+	if config.Account == "" {
+		return nil, nil, nil
+	}
+	path := opts.GcloudPath
+	if path == "" {
+		path = defaultGcloudPath
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		logDebug("skipping gcloud CLI credentials, gcloud not found", "path", path)
+		return nil, nil, nil
+	}
+
+	creds := &GcpCredentials{
+		ProjectId:   config.Project,
+		ClientEmail: config.ImpersonateServiceAccountOr(""),
+	}
+	ts := NewGcloudTokenSource(&GcloudTokenSourceOptions{
+		Path:                      path,
+		Account:                   config.Account,
+		ImpersonateServiceAccount: config.ImpersonateServiceAccount,
+	})
+	return creds, ts, nil
+}
+
+// gcloudConfigDir returns the gcloud configuration directory.
+func gcloudConfigDir() (string, error) {
+	if dir := os.Getenv(EnvCloudSDKConfig); dir != "" {
+		return dir, nil
+	}
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "gcloud"), nil
+		}
+		return "", ErrGcloudConfigNotFound
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", ErrGcloudConfigNotFound
+	}
+	return filepath.Join(home, ".config", "gcloud"), nil
+}
+
+// parseGcloudProperties parses a gcloud configuration file, in INI format,
+// into properties keyed by section/name.
+func parseGcloudProperties(b []byte) map[string]string {
+	props := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		default:
+			i := strings.IndexAny(line, "=:")
+			if i < 0 || section == "" {
+				continue
+			}
+			props[section+"/"+strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return props
+}
@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestActiveGcloudConfig(t *testing.T) {
+	const prodConfig = `[core]
+account = dev@example.com
+project = prod-project
+
+[auth]
+impersonate_service_account = hop@p.iam.gserviceaccount.com,deployer@p.iam.gserviceaccount.com
+
+[compute]
+zone = europe-west1-b
+`
+
+	tests := map[string]struct {
+		ActiveConfig string
+		Env          map[string]string
+		Expected     *GcloudConfig
+	}{
+		"active config file": {
+			ActiveConfig: "prod",
+			Expected: &GcloudConfig{
+				Name:                      "prod",
+				Project:                   "prod-project",
+				Account:                   "dev@example.com",
+				ImpersonateServiceAccount: "hop@p.iam.gserviceaccount.com,deployer@p.iam.gserviceaccount.com",
+				Zone:                      "europe-west1-b",
+			},
+		},
+		"default config": {
+			Expected: &GcloudConfig{Name: "default", Project: "default-project"},
+		},
+		"env overrides": {
+			ActiveConfig: "prod",
+			Env: map[string]string{
+				EnvCloudSDKActiveConfigName: "default",
+				"CLOUDSDK_COMPUTE_REGION":   "us-east1",
+			},
+			Expected: &GcloudConfig{Name: "default", Project: "default-project", Region: "us-east1"},
+		},
+		"missing config file": {
+			Env:      map[string]string{EnvCloudSDKActiveConfigName: "other"},
+			Expected: &GcloudConfig{Name: "other"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv(EnvCloudSDKConfig, dir)
+			t.Setenv(EnvCloudSDKActiveConfigName, "")
+			for k, v := range test.Env {
+				t.Setenv(k, v)
+			}
+
+			os.Mkdir(filepath.Join(dir, "configurations"), 0o700)
+			os.WriteFile(filepath.Join(dir, "configurations", "config_prod"), []byte(prodConfig), 0o600)
+			os.WriteFile(filepath.Join(dir, "configurations", "config_default"), []byte("[core]\nproject = default-project\n"), 0o600)
+			if test.ActiveConfig != "" {
+				os.WriteFile(filepath.Join(dir, "active_config"), []byte(test.ActiveConfig+"\n"), 0o600)
+			}
+
+			config, err := ActiveGcloudConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, test.Expected) {
+				t.Fatalf("expected %+v, got %+v", test.Expected, config)
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		t.Setenv(EnvCloudSDKConfig, filepath.Join(t.TempDir(), "missing"))
+		if _, err := ActiveGcloudConfig(); !errors.Is(err, ErrGcloudConfigNotFound) {
+			t.Fatalf("expected ErrGcloudConfigNotFound, got %v", err)
+		}
+	})
+}
+
+func TestGcloudConfig_defaults(t *testing.T) {
+	config := &GcloudConfig{
+		Project:                   "gcloud-project",
+		ImpersonateServiceAccount: "hop@p.iam.gserviceaccount.com, deployer@p.iam.gserviceaccount.com",
+		Zone:                      "europe-west1-b",
+	}
+	if got := config.ProjectOr(""); got != "gcloud-project" {
+		t.Errorf("expected gcloud project, got %q", got)
+	}
+	if got := config.ProjectOr("explicit"); got != "explicit" {
+		t.Errorf("expected explicit project, got %q", got)
+	}
+	if got := config.ImpersonateServiceAccountOr(""); got != "deployer@p.iam.gserviceaccount.com" {
+		t.Errorf("expected final impersonation target, got %q", got)
+	}
+	if got := config.RegionOr(""); got != "europe-west1" {
+		t.Errorf("expected region of zone, got %q", got)
+	}
+
+	var none *GcloudConfig
+	if got := none.ProjectOr(""); got != "" {
+		t.Errorf("expected empty project from nil config, got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// writeTestScript writes an executable shell script with the given body.
+func writeTestScript(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+	path := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGcloudTokenSource(t *testing.T) {
+	tests := map[string]struct {
+		Script      string
+		Options     GcloudTokenSourceOptions
+		Expected    string
+		ShouldError bool
+	}{
+		"token": {
+			Script:   `[ "$*" = "auth print-access-token --quiet --verbosity=error" ] && echo "ya29.token"`,
+			Expected: "ya29.token",
+		},
+		"impersonation": {
+			Script:   `[ "$5" = "--impersonate-service-account=sa@p.iam.gserviceaccount.com" ] && echo "ya29.impersonated"`,
+			Options:  GcloudTokenSourceOptions{ImpersonateServiceAccount: "sa@p.iam.gserviceaccount.com"},
+			Expected: "ya29.impersonated",
+		},
+		"invalid output": {
+			Script:      `echo "ERROR: (gcloud.auth) You do not currently have an active account selected."`,
+			ShouldError: true,
+		},
+		"failure": {
+			Script:      `echo "not logged in" >&2; exit 1`,
+			ShouldError: true,
+		},
+		"timeout": {
+			Script:      `sleep 5`,
+			Options:     GcloudTokenSourceOptions{Timeout: 100 * time.Millisecond},
+			ShouldError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := tc.Options
+			opts.Path = writeTestScript(t, tc.Script)
+			tok, err := NewGcloudTokenSource(&opts).Token()
+			if tc.ShouldError {
+				if err == nil {
+					t.Errorf("expected error, got token %q", tok.AccessToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tok.AccessToken != tc.Expected || tok.Expiry.IsZero() {
+				t.Errorf("expected %q, got %+v", tc.Expected, tok)
+			}
+		})
+	}
+}
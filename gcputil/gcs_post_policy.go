@@ -0,0 +1,174 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	defaultStorageEndpoint = "https://storage.googleapis.com"
+
+	// maxPostPolicyV4Expiry is the longest validity of a V4 signature.
+	maxPostPolicyV4Expiry = 7 * 24 * time.Hour
+
+	postPolicyV4Algorithm = "GOOG4-RSA-SHA256"
+)
+
+// PostPolicyV4Options configures a V4 signed POST policy for Cloud Storage.
+type PostPolicyV4Options struct {
+	// Bucket is the bucket uploads are made to. It is required.
+	Bucket string
+
+	// Object is the name of the uploaded object. It is required, unless
+	// ObjectPrefix is set.
+	Object string
+
+	// ObjectPrefix, if set, allows uploads of any object name with the
+	// given prefix; the browser form then sets the "key" field.
+	ObjectPrefix string
+
+	// ServiceAccountEmail is the service account whose Google-managed key
+	// signs the policy, through the IAM Credentials API. It is required.
+	ServiceAccountEmail string
+
+	// Expires is when the policy expires. It must be within 7 days.
+	Expires time.Time
+
+	// Fields are additional form fields, e.g. "Content-Type" or
+	// "success_action_status". Each must be submitted with exactly the
+	// given value.
+	Fields map[string]string
+
+	// Conditions are additional policy conditions, e.g. those returned by
+	// PostPolicyV4ContentLengthRange and PostPolicyV4StartsWith.
+	Conditions []PostPolicyV4Condition
+
+	// Endpoint is the Cloud Storage endpoint. Defaults to
+	// https://storage.googleapis.com.
+	Endpoint string
+}
+
+// PostPolicyV4Condition is a condition of a POST policy document.
+type PostPolicyV4Condition []interface{}
+
+// PostPolicyV4ContentLengthRange requires the uploaded object's size to be
+// between min and max bytes, inclusive.
+func PostPolicyV4ContentLengthRange(min, max int64) PostPolicyV4Condition {
+	return PostPolicyV4Condition{"content-length-range", min, max}
+}
+
+// PostPolicyV4StartsWith requires the value of the given form field to start
+// with prefix.
+func PostPolicyV4StartsWith(field, prefix string) PostPolicyV4Condition {
+	return PostPolicyV4Condition{"starts-with", "$" + field, prefix}
+}
+
+// PostPolicyV4 is a signed POST policy. Uploads are made with a
+// multipart/form-data POST to URL including Fields, followed by the "file"
+// field.
+type PostPolicyV4 struct {
+	URL    string
+	Fields map[string]string
+}
+
+// GeneratePostPolicyV4 returns a V4 signed POST policy for browser uploads to
+// Cloud Storage. The policy is signed remotely with the IAM Credentials API
+// signBlob method, so no private key is needed, e.g. when running with
+// workload identity.
+// See https://cloud.google.com/storage/docs/xml-api/post-object-forms
+func (c *Client) GeneratePostPolicyV4(ctx context.Context, opts *PostPolicyV4Options) (*PostPolicyV4, error) {
+	return c.generatePostPolicyV4(ctx, opts, time.Now())
+}
+
+func (c *Client) generatePostPolicyV4(ctx context.Context, opts *PostPolicyV4Options, now time.Time) (*PostPolicyV4, error) {
+	if opts == nil || opts.Bucket == "" || opts.ServiceAccountEmail == "" {
+		return nil, errors.New("bucket and service account email are required for a POST policy")
+	}
+	if !ServiceAccountEmail(opts.ServiceAccountEmail).Valid() {
+		// The email is part of the x-goog-credential field, so IDs cannot
+		// be used here.
+		return nil, fmt.Errorf("invalid service account email %q for a POST policy", opts.ServiceAccountEmail)
+	}
+	if (opts.Object == "") == (opts.ObjectPrefix == "") {
+		return nil, errors.New("exactly one of object and object prefix is required for a POST policy")
+	}
+	if !opts.Expires.After(now) || opts.Expires.Sub(now) > maxPostPolicyV4Expiry {
+		return nil, fmt.Errorf("POST policy expiry must be in the future and within %s", maxPostPolicyV4Expiry)
+	}
+
+	now = now.UTC()
+	fields := map[string]string{}
+	for k, v := range opts.Fields {
+		fields[k] = v
+	}
+	fields["x-goog-date"] = now.Format("20060102T150405Z")
+	fields["x-goog-credential"] = fmt.Sprintf("%s/%s/auto/storage/goog4_request", opts.ServiceAccountEmail, now.Format("20060102"))
+	fields["x-goog-algorithm"] = postPolicyV4Algorithm
+
+	conditions := []interface{}{map[string]string{"bucket": opts.Bucket}}
+	if opts.Object != "" {
+		fields["key"] = opts.Object
+	} else {
+		conditions = append(conditions, PostPolicyV4StartsWith("key", opts.ObjectPrefix))
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		conditions = append(conditions, map[string]string{k: fields[k]})
+	}
+	for _, cond := range opts.Conditions {
+		conditions = append(conditions, cond)
+	}
+
+	policy, err := marshalPostPolicy(map[string]interface{}{
+		"conditions": conditions,
+		"expiration": opts.Expires.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode POST policy: %v", err)
+	}
+	encodedPolicy := base64.StdEncoding.EncodeToString(policy)
+
+	_, sig, err := c.SignBlob(ctx, opts.ServiceAccountEmail, []byte(encodedPolicy))
+	if err != nil {
+		return nil, err
+	}
+	fields["policy"] = encodedPolicy
+	fields["x-goog-signature"] = hex.EncodeToString(sig)
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = defaultStorageEndpoint
+	}
+	return &PostPolicyV4{
+		URL:    joinEndpoint(endpoint, url.PathEscape(opts.Bucket)) + "/",
+		Fields: fields,
+	}, nil
+}
+
+// marshalPostPolicy encodes a policy document without escaping HTML
+// characters, which Cloud Storage would otherwise decode before verifying the
+// signature.
+func marshalPostPolicy(policy interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(policy); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestClient_GeneratePostPolicyV4(t *testing.T) {
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{IAMCredentials: iamCreds.URL}})
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	policy, err := c.generatePostPolicyV4(context.Background(), &PostPolicyV4Options{
+		Bucket:              "my-bucket",
+		ObjectPrefix:        "uploads/",
+		ServiceAccountEmail: "signer@p.iam.gserviceaccount.com",
+		Expires:             now.Add(time.Hour),
+		Fields:              map[string]string{"success_action_status": "201"},
+		Conditions:          []PostPolicyV4Condition{PostPolicyV4ContentLengthRange(0, 1<<20)},
+	}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if policy.URL != "https://storage.googleapis.com/my-bucket/" {
+		t.Errorf("unexpected URL %q", policy.URL)
+	}
+	if cred := policy.Fields["x-goog-credential"]; cred != "signer@p.iam.gserviceaccount.com/20240301/auto/storage/goog4_request" {
+		t.Errorf("unexpected credential %q", cred)
+	}
+	if date := policy.Fields["x-goog-date"]; date != "20240301T123000Z" {
+		t.Errorf("unexpected date %q", date)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(policy.Fields["policy"])
+	if err != nil {
+		t.Fatalf("policy is not base64: %v", err)
+	}
+	var doc struct {
+		Conditions []interface{} `json:"conditions"`
+		Expiration string        `json:"expiration"`
+	}
+	if err := json.Unmarshal(decoded, &doc); err != nil {
+		t.Fatalf("policy is not JSON: %v", err)
+	}
+	if doc.Expiration != "2024-03-01T13:30:00Z" || len(doc.Conditions) != 7 {
+		t.Errorf("unexpected policy document %s", decoded)
+	}
+
+	sig, err := hex.DecodeString(policy.Fields["x-goog-signature"])
+	if err != nil {
+		t.Fatalf("signature is not hex: %v", err)
+	}
+	digest := sha256.Sum256([]byte(policy.Fields["policy"]))
+	if err := rsa.VerifyPKCS1v15(&iamCreds.SigningKey.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+}
+
+func TestClient_GeneratePostPolicyV4_Validation(t *testing.T) {
+	c := newTestClient(t, &Options{})
+	now := time.Now()
+
+	tests := map[string]*PostPolicyV4Options{
+		"missing bucket":          {Object: "o", ServiceAccountEmail: "sa", Expires: now.Add(time.Hour)},
+		"object and prefix":       {Bucket: "b", Object: "o", ObjectPrefix: "p", ServiceAccountEmail: "sa", Expires: now.Add(time.Hour)},
+		"expired":                 {Bucket: "b", Object: "o", ServiceAccountEmail: "sa", Expires: now.Add(-time.Hour)},
+		"expiry beyond 7 days":    {Bucket: "b", Object: "o", ServiceAccountEmail: "sa", Expires: now.Add(8 * 24 * time.Hour)},
+		"missing service account": {Bucket: "b", Object: "o", Expires: now.Add(time.Hour)},
+		"invalid service account": {Bucket: "b", Object: "o", ServiceAccountEmail: "sa@p.iam.gserviceaccount.com/../x", Expires: now.Add(time.Hour)},
+		"service account ID":      {Bucket: "b", Object: "o", ServiceAccountEmail: "123456789", Expires: now.Add(time.Hour)},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.generatePostPolicyV4(context.Background(), opts, now); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// GKE sets these instance metadata attributes on the nodes of a cluster.
+const (
+	gkeClusterNameAttribute     = "instance/attributes/cluster-name"
+	gkeClusterLocationAttribute = "instance/attributes/cluster-location"
+	gkeClusterUIDAttribute      = "instance/attributes/cluster-uid"
+)
+
+// ErrNotGKE is returned by GKECluster when the instance is not a GKE node.
+var ErrNotGKE = errors.New("not running on a GKE node")
+
+// GKECluster identifies the GKE cluster a workload runs in.
+type GKECluster struct {
+	// ProjectID is the ID of the project the cluster is in.
+	ProjectID string
+
+	// Name is the name of the cluster.
+	Name string
+
+	// Location is the zone of a zonal cluster or the region of a regional
+	// cluster.
+	Location string
+
+	// UID is the unique ID of the cluster, if the metadata server exposes
+	// it.
+	UID string
+}
+
+// Regional reports whether the cluster is a regional cluster.
+func (c *GKECluster) Regional() bool {
+	return IsRegion(c.Location)
+}
+
+// ResourceName returns the relative resource name of the cluster, e.g.
+// projects/my-project/locations/us-central1/clusters/my-cluster.
+func (c *GKECluster) ResourceName() string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", c.ProjectID, c.Location, c.Name)
+}
+
+// FullResourceName returns the full resource name of the cluster, as used in
+// Cloud Audit Logs and IAM conditions, e.g.
+// //container.googleapis.com/projects/my-project/locations/us-central1/clusters/my-cluster.
+func (c *GKECluster) FullResourceName() string {
+	return "//container.googleapis.com/" + c.ResourceName()
+}
+
+// GetGKECluster returns the GKE cluster the instance belongs to, from the
+// metadata server. See MetadataClient.GKECluster.
+func GetGKECluster(ctx context.Context) (*GKECluster, error) {
+	return NewMetadataClient(nil).GKECluster(ctx)
+}
+
+// GKECluster returns the GKE cluster the instance belongs to, from the
+// cluster-name, cluster-location and cluster-uid attributes GKE sets on its
+// nodes. ErrNotGKE is returned if the instance is not a GKE node. Pods
+// using Workload Identity only see these attributes with the GKE metadata
+// server, which exposes them as well.
+func (c *MetadataClient) GKECluster(ctx context.Context) (*GKECluster, error) {
+	name, err := c.getTrimmed(ctx, gkeClusterNameAttribute)
+	if err != nil {
+		var mdErr *MetadataError
+		if errors.As(err, &mdErr) && mdErr.NotFound() {
+			return nil, ErrNotGKE
+		}
+		return nil, fmt.Errorf("unable to get GKE cluster name: %v", err)
+	}
+	location, err := c.getTrimmed(ctx, gkeClusterLocationAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get GKE cluster location: %v", err)
+	}
+	if !IsZone(location) && !IsRegion(location) {
+		return nil, fmt.Errorf("invalid GKE cluster location %q", location)
+	}
+	projectID, err := c.ProjectID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get GKE cluster project: %v", err)
+	}
+
+	cluster := &GKECluster{
+		ProjectID: projectID,
+		Name:      name,
+		Location:  location,
+	}
+	// Older clusters and the GKE metadata server may not expose the UID.
+	if uid, err := c.getTrimmed(ctx, gkeClusterUIDAttribute); err == nil {
+		cluster.UID = uid
+	}
+	return cluster, nil
+}
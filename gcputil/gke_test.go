@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestMetadataClient_GKECluster(t *testing.T) {
+	tests := map[string]struct {
+		Attributes  map[string]string
+		Expected    *GKECluster
+		ExpectedErr error
+		ShouldError bool
+	}{
+		"regional": {
+			Attributes: map[string]string{"cluster-name": "prod", "cluster-location": "us-central1", "cluster-uid": "abc123"},
+			Expected:   &GKECluster{ProjectID: testutil.DefaultMetadataProjectID, Name: "prod", Location: "us-central1", UID: "abc123"},
+		},
+		"zonal without uid": {
+			Attributes: map[string]string{"cluster-name": "dev", "cluster-location": "us-central1-a"},
+			Expected:   &GKECluster{ProjectID: testutil.DefaultMetadataProjectID, Name: "dev", Location: "us-central1-a"},
+		},
+		"not gke": {
+			ExpectedErr: ErrNotGKE,
+			ShouldError: true,
+		},
+		"invalid location": {
+			Attributes:  map[string]string{"cluster-name": "prod", "cluster-location": "nowhere"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			md := testutil.NewMetadataServer(t)
+			for k, v := range test.Attributes {
+				md.SetAttribute(k, v)
+			}
+			c := NewMetadataClientWithOptions(&MetadataClientOptions{Host: md.Host(), MaxRetries: -1})
+
+			cluster, err := c.GKECluster(context.Background())
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if test.ExpectedErr != nil && !errors.Is(err, test.ExpectedErr) {
+					t.Fatalf("expected %v, got %v", test.ExpectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cluster, test.Expected) {
+				t.Fatalf("expected %+v, got %+v", test.Expected, cluster)
+			}
+		})
+	}
+}
+
+func TestGKECluster_names(t *testing.T) {
+	c := &GKECluster{ProjectID: "p", Name: "n", Location: "europe-west1"}
+	if !c.Regional() {
+		t.Error("expected regional cluster")
+	}
+	if got := c.FullResourceName(); got != "//container.googleapis.com/projects/p/locations/europe-west1/clusters/n" {
+		t.Errorf("unexpected full resource name %q", got)
+	}
+}
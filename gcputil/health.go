@@ -0,0 +1,131 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Health check step names.
+const (
+	HealthCheckStepToken     = "token"
+	HealthCheckStepTokenInfo = "token_info"
+	HealthCheckStepAPICall   = "api_call"
+)
+
+// HealthCheckOptions configures a health check.
+type HealthCheckOptions struct {
+	// APICall, if true, additionally reads the principal's service account
+	// from the IAM API to verify that authenticated calls succeed. It is
+	// skipped if the principal is not a service account.
+	APICall bool
+}
+
+// HealthCheckStep is the outcome of a single step of a health check.
+type HealthCheckStep struct {
+	Name     string        `json:"name"`
+	Healthy  bool          `json:"healthy"`
+	Skipped  bool          `json:"skipped,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// HealthCheckResult is the outcome of a health check.
+type HealthCheckResult struct {
+	// Healthy is true if no step failed.
+	Healthy bool `json:"healthy"`
+
+	// Principal is the email of the authenticated principal, if known.
+	Principal string `json:"principal,omitempty"`
+
+	// Scopes are the scopes granted to the token.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// TokenExpiry is when the token expires.
+	TokenExpiry time.Time `json:"token_expiry,omitempty"`
+
+	// Steps are the steps performed, in order.
+	Steps []*HealthCheckStep `json:"steps"`
+}
+
+// HealthCheck verifies the client's credentials end to end. It is
+// equivalent to HealthCheckWithOptions with default options.
+func (c *Client) HealthCheck(ctx context.Context) (*HealthCheckResult, error) {
+	return c.HealthCheckWithOptions(ctx, nil)
+}
+
+// HealthCheckWithOptions verifies the client's credentials end to end: it
+// obtains a token from the configured credentials, verifies it with the
+// tokeninfo endpoint and, if requested, makes an authenticated API call. The
+// result describes each step and is always returned; the error is that of the
+// first failed step. Steps after a failed step are not performed.
+func (c *Client) HealthCheckWithOptions(ctx context.Context, opts *HealthCheckOptions) (*HealthCheckResult, error) {
+	defer c.measure("health_check", time.Now())
+	if opts == nil {
+		opts = &HealthCheckOptions{}
+	}
+
+	result := &HealthCheckResult{}
+	step := func(name string, fn func() error) error {
+		s := &HealthCheckStep{Name: name}
+		start := time.Now()
+		err := fn()
+		s.Duration = time.Since(start)
+		if err != nil {
+			s.Error = err.Error()
+		} else {
+			s.Healthy = true
+		}
+		result.Steps = append(result.Steps, s)
+		return err
+	}
+	fail := func(name string, err error) (*HealthCheckResult, error) {
+		c.incrError("health_check")
+		return result, fmt.Errorf("health check step %q failed: %v", name, err)
+	}
+
+	var accessToken string
+	if err := step(HealthCheckStepToken, func() error {
+		tok, err := c.tokenSource.Token()
+		if err != nil {
+			return err
+		}
+		accessToken = tok.AccessToken
+		result.TokenExpiry = tok.Expiry
+		return nil
+	}); err != nil {
+		return fail(HealthCheckStepToken, err)
+	}
+
+	if err := step(HealthCheckStepTokenInfo, func() error {
+		info, err := c.tokenInfo(ctx, accessToken)
+		if err != nil {
+			return err
+		}
+		result.Principal = info.Email
+		result.Scopes = info.Scopes
+		if !info.Expiry.IsZero() {
+			result.TokenExpiry = info.Expiry
+		}
+		return nil
+	}); err != nil {
+		return fail(HealthCheckStepTokenInfo, err)
+	}
+
+	if opts.APICall {
+		if !ServiceAccountEmail(result.Principal).Valid() {
+			result.Steps = append(result.Steps, &HealthCheckStep{Name: HealthCheckStepAPICall, Healthy: true, Skipped: true})
+		} else if err := step(HealthCheckStepAPICall, func() error {
+			_, err := c.ServiceAccount(ctx, &ServiceAccountId{Project: "-", EmailOrId: result.Principal})
+			return err
+		}); err != nil {
+			return fail(HealthCheckStepAPICall, err)
+		}
+	}
+
+	result.Healthy = true
+	return result, nil
+}
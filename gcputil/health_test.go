@@ -0,0 +1,84 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func newTestTokenInfoServer(t *testing.T, email string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tokenInfoURLPath || r.FormValue("access_token") != "fake-token-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_token"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"aud":"123","sub":"456","email":%q,"scope":"https://www.googleapis.com/auth/cloud-platform","exp":"%d"}`,
+			email, time.Now().Add(time.Hour).Unix())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient_HealthCheck(t *testing.T) {
+	iamSrv := testutil.NewIAMServer(t)
+	sa := iamSrv.AddServiceAccount("p", "sa")
+
+	tests := map[string]struct {
+		Email       string
+		Options     *HealthCheckOptions
+		Steps       []string
+		ShouldError bool
+	}{
+		"token only": {
+			Email: sa.Email,
+			Steps: []string{HealthCheckStepToken, HealthCheckStepTokenInfo},
+		},
+		"api call": {
+			Email:   sa.Email,
+			Options: &HealthCheckOptions{APICall: true},
+			Steps:   []string{HealthCheckStepToken, HealthCheckStepTokenInfo, HealthCheckStepAPICall},
+		},
+		"api call for unknown account": {
+			Email:       "missing@p.iam.gserviceaccount.com",
+			Options:     &HealthCheckOptions{APICall: true},
+			Steps:       []string{HealthCheckStepToken, HealthCheckStepTokenInfo, HealthCheckStepAPICall},
+			ShouldError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tokenInfo := newTestTokenInfoServer(t, tc.Email)
+			c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{APIs: tokenInfo.URL, IAM: iamSrv.URL}})
+
+			result, err := c.HealthCheckWithOptions(context.Background(), tc.Options)
+			if tc.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", tc.ShouldError, err)
+			}
+			if result.Healthy == tc.ShouldError {
+				t.Errorf("expected healthy: %t", !tc.ShouldError)
+			}
+			if len(result.Steps) != len(tc.Steps) {
+				t.Fatalf("expected steps %v, got %d steps", tc.Steps, len(result.Steps))
+			}
+			for i, s := range result.Steps {
+				if s.Name != tc.Steps[i] {
+					t.Errorf("expected step %d to be %q, got %q", i, tc.Steps[i], s.Name)
+				}
+			}
+			if result.Principal != tc.Email || len(result.Scopes) != 1 {
+				t.Errorf("unexpected result %+v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// HTTPClientOptions configures GetHttpClientWithOptions.
+type HTTPClientOptions struct {
+	// Scopes are requested for access tokens.
+	Scopes []string
+
+	// Timeout bounds requests made with the client, including token
+	// requests. Defaults to the timeout of the client set with
+	// SetDefaultHTTPClient, if its transport is used.
+	Timeout time.Duration
+
+	// Transport is the base transport. Defaults to the transport of the
+	// client set with SetDefaultHTTPClient, or the package's shared pooled
+	// transport.
+	Transport http.RoundTripper
+
+	// UserAgent is set on requests. Defaults to the User-Agent set with
+	// SetDefaultUserAgent.
+	UserAgent string
+
+	// Proxy selects the proxy for requests, as http.Transport.Proxy does. It
+	// requires an *http.Transport base transport.
+	Proxy func(*http.Request) (*url.URL, error)
+}
+
+// GetHttpClientWithOptions creates an HTTP client from the given Google
+// credentials, configured by opts. Tokens are fetched with ctx, so once ctx
+// is canceled the client can no longer refresh its token.
+func GetHttpClientWithOptions(ctx context.Context, credentials *GcpCredentials, opts *HTTPClientOptions) (*http.Client, error) {
+	if opts == nil {
+		opts = &HTTPClientOptions{}
+	}
+
+	transport, timeout := opts.Transport, opts.Timeout
+	if transport == nil {
+		if httpClient := defaultHTTPClient(); httpClient != nil {
+			transport = transportOrDefault(httpClient.Transport)
+			if timeout == 0 {
+				timeout = httpClient.Timeout
+			}
+		} else {
+			transport = newHTTPClient().Transport
+		}
+	}
+	if opts.Proxy != nil {
+		t, ok := transport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("a proxy requires an *http.Transport, got %T", transport)
+		}
+		t = t.Clone()
+		t.Proxy = opts.Proxy
+		transport = t
+	}
+	transport = &defaultTracingTransport{base: transport}
+	transport = &requestReasonTransport{base: transport, reason: os.Getenv(EnvRequestReason)}
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	if userAgent != "" {
+		transport = &userAgentTransport{base: transport, userAgent: userAgent}
+	}
+
+	httpClient := &http.Client{Transport: transport, Timeout: timeout}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	ts, err := serviceAccountTokenSource(ctx, credentials, opts.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	client := oauth2.NewClient(ctx, ts)
+	client.Timeout = timeout
+	return client, nil
+}
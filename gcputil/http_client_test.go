@@ -0,0 +1,70 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetHttpClientWithOptions(t *testing.T) {
+	tokenSrv, _ := newTestOAuth2Server(t)
+	creds, err := Credentials(string(testServiceAccountJSON(t, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.TokenURL = tokenSrv.URL
+
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token:a" || r.Header.Get("User-Agent") != "my-plugin/1.0" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer apiSrv.Close()
+
+	var proxied int32
+	client, err := GetHttpClientWithOptions(context.Background(), creds, &HTTPClientOptions{
+		Scopes:    []string{"a"},
+		Timeout:   10 * time.Second,
+		UserAgent: "my-plugin/1.0",
+		Proxy: func(*http.Request) (*url.URL, error) {
+			atomic.AddInt32(&proxied, 1)
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 10*time.Second {
+		t.Fatalf("unexpected timeout %v", client.Timeout)
+	}
+	resp, err := client.Get(apiSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	// Both the token request and the API request go through the proxy
+	// function.
+	if got := atomic.LoadInt32(&proxied); got != 2 {
+		t.Fatalf("expected 2 proxied requests, got %d", got)
+	}
+}
+
+func TestGetHttpClientWithOptions_proxyRequiresTransport(t *testing.T) {
+	_, err := GetHttpClientWithOptions(context.Background(), &GcpCredentials{}, &HTTPClientOptions{
+		Transport: &userAgentTransport{base: http.DefaultTransport, userAgent: "test"},
+		Proxy:     http.ProxyFromEnvironment,
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -5,6 +5,7 @@ package gcputil
 
 import (
 	"fmt"
+	"time"
 
 	"google.golang.org/api/iam/v1"
 )
@@ -63,3 +64,61 @@ func ServiceAccountKey(iamClient *iam.Service, keyId *ServiceAccountKeyId) (*iam
 	}
 	return key, nil
 }
+
+// KeyValidity is the validity window of a service account key. Keys created
+// under an iam.serviceAccountKeyExpiryHours organization policy, or uploaded
+// with an expiring certificate, have a ValidBefore time.
+type KeyValidity struct {
+	ValidAfter time.Time
+
+	// ValidBefore is zero if the key does not expire.
+	ValidBefore time.Time
+}
+
+// ServiceAccountKeyValidity returns the validity window of the given key.
+func ServiceAccountKeyValidity(key *iam.ServiceAccountKey) (*KeyValidity, error) {
+	v := &KeyValidity{}
+	if key.ValidAfterTime != "" {
+		t, err := time.Parse(time.RFC3339, key.ValidAfterTime)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse key validAfterTime %q: %v", key.ValidAfterTime, err)
+		}
+		v.ValidAfter = t
+	}
+	// Keys that do not expire have a validBeforeTime of 9999-12-31.
+	if key.ValidBeforeTime != "" {
+		t, err := time.Parse(time.RFC3339, key.ValidBeforeTime)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse key validBeforeTime %q: %v", key.ValidBeforeTime, err)
+		}
+		if t.Year() < 9999 {
+			v.ValidBefore = t
+		}
+	}
+	return v, nil
+}
+
+// Expires reports whether the key has an expiry time.
+func (v *KeyValidity) Expires() bool {
+	return !v.ValidBefore.IsZero()
+}
+
+// ExpiringWithin reports whether the key expires within d from now,
+// including keys that have already expired.
+func (v *KeyValidity) ExpiringWithin(d time.Duration) bool {
+	return v.expiringWithin(time.Now(), d)
+}
+
+func (v *KeyValidity) expiringWithin(now time.Time, d time.Duration) bool {
+	return v.Expires() && v.ValidBefore.Sub(now) < d
+}
+
+// IsKeyExpiringWithin reports whether the given key expires within d from
+// now, e.g. to decide whether it should be rotated.
+func IsKeyExpiringWithin(key *iam.ServiceAccountKey, d time.Duration) (bool, error) {
+	v, err := ServiceAccountKeyValidity(key)
+	if err != nil {
+		return false, err
+	}
+	return v.ExpiringWithin(d), nil
+}
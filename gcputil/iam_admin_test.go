@@ -0,0 +1,69 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/iam/v1"
+)
+
+func TestServiceAccountKeyValidity(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		Key         *iam.ServiceAccountKey
+		Expires     bool
+		Expiring    bool
+		ShouldError bool
+	}{
+		"never expires": {
+			Key: &iam.ServiceAccountKey{ValidAfterTime: "2024-01-01T00:00:00Z", ValidBeforeTime: "9999-12-31T23:59:59Z"},
+		},
+		"no times": {
+			Key: &iam.ServiceAccountKey{},
+		},
+		"expires later": {
+			Key:     &iam.ServiceAccountKey{ValidAfterTime: "2024-01-01T00:00:00Z", ValidBeforeTime: "2024-06-01T00:00:00Z"},
+			Expires: true,
+		},
+		"expiring soon": {
+			Key:      &iam.ServiceAccountKey{ValidBeforeTime: "2024-05-03T00:00:00Z"},
+			Expires:  true,
+			Expiring: true,
+		},
+		"expired": {
+			Key:      &iam.ServiceAccountKey{ValidBeforeTime: "2024-04-01T00:00:00Z"},
+			Expires:  true,
+			Expiring: true,
+		},
+		"invalid": {
+			Key:         &iam.ServiceAccountKey{ValidBeforeTime: "tomorrow"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			v, err := ServiceAccountKeyValidity(test.Key)
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			if v.Expires() != test.Expires {
+				t.Errorf("expected expires: %t", test.Expires)
+			}
+			if v.expiringWithin(now, 7*24*time.Hour) != test.Expiring {
+				t.Errorf("expected expiring: %t", test.Expiring)
+			}
+		})
+	}
+
+	if _, err := IsKeyExpiringWithin(&iam.ServiceAccountKey{ValidAfterTime: "bad"}, time.Hour); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	crmv3 "google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const (
+	// iamConditionsPolicyVersion is the IAM policy version required to read
+	// and write conditional bindings.
+	iamConditionsPolicyVersion = 3
+
+	// iamPolicyConflictRetries is the number of times a policy update is
+	// retried when the policy changed concurrently.
+	iamPolicyConflictRetries = 5
+)
+
+var iamPolicyParentIDRegex = regexp.MustCompile(`^[0-9]+$`)
+
+// IAMCondition is the condition of a conditional IAM role binding.
+type IAMCondition struct {
+	Title       string
+	Description string
+
+	// Expression is the CEL expression of the condition, e.g.
+	// `request.time < timestamp("2030-01-01T00:00:00Z")`.
+	Expression string
+}
+
+// IAMBinding grants a role to members, optionally under a condition.
+type IAMBinding struct {
+	// Role is the role to grant, e.g. roles/iam.serviceAccountTokenCreator.
+	Role string
+
+	// Members are the principals to grant the role to, e.g.
+	// serviceAccount:sa@p.iam.gserviceaccount.com.
+	Members []string
+
+	// Condition, if set, restricts the binding.
+	Condition *IAMCondition
+}
+
+func (b *IAMBinding) validate() error {
+	if b == nil || b.Role == "" {
+		return errors.New("IAM binding role is required")
+	}
+	if len(b.Members) == 0 {
+		return errors.New("IAM binding members are required")
+	}
+	for _, m := range b.Members {
+		if i := strings.Index(m, ":"); i <= 0 || i == len(m)-1 {
+			return fmt.Errorf("invalid IAM member %q, must be of the form type:id, e.g. serviceAccount:EMAIL", m)
+		}
+	}
+	if b.Condition != nil && b.Condition.Expression == "" {
+		return errors.New("IAM condition expression is required")
+	}
+	return nil
+}
+
+// AddOrganizationIAMBinding grants the binding's role to its members on the
+// organization with the given ID, e.g. "123" or "organizations/123". Members
+// that already have the role under the same condition are left as is.
+// Concurrent policy changes are retried.
+func (c *Client) AddOrganizationIAMBinding(ctx context.Context, organizationID string, binding *IAMBinding) error {
+	return c.updateIAMPolicy(ctx, "add_organization_iam_binding", "organizations", organizationID, binding, addIAMBinding)
+}
+
+// RemoveOrganizationIAMBinding revokes the binding's role from its members on
+// the organization with the given ID. Only the binding with the same
+// condition is changed.
+func (c *Client) RemoveOrganizationIAMBinding(ctx context.Context, organizationID string, binding *IAMBinding) error {
+	return c.updateIAMPolicy(ctx, "remove_organization_iam_binding", "organizations", organizationID, binding, removeIAMBinding)
+}
+
+// AddFolderIAMBinding grants the binding's role to its members on the folder
+// with the given ID, e.g. "123" or "folders/123". Members that already have
+// the role under the same condition are left as is. Concurrent policy changes
+// are retried.
+func (c *Client) AddFolderIAMBinding(ctx context.Context, folderID string, binding *IAMBinding) error {
+	return c.updateIAMPolicy(ctx, "add_folder_iam_binding", "folders", folderID, binding, addIAMBinding)
+}
+
+// RemoveFolderIAMBinding revokes the binding's role from its members on the
+// folder with the given ID. Only the binding with the same condition is
+// changed.
+func (c *Client) RemoveFolderIAMBinding(ctx context.Context, folderID string, binding *IAMBinding) error {
+	return c.updateIAMPolicy(ctx, "remove_folder_iam_binding", "folders", folderID, binding, removeIAMBinding)
+}
+
+// updateIAMPolicy applies modify to the IAM policy of the given organization
+// or folder with a read-modify-write cycle, retried when the policy's etag
+// changed concurrently. The policy is not written if modify reports no
+// change.
+func (c *Client) updateIAMPolicy(ctx context.Context, op, collection, id string, binding *IAMBinding, modify func(*crmv3.Policy, *IAMBinding) bool) error {
+	defer c.measure(op, time.Now())
+	err := c.updateIAMPolicyWithRetry(ctx, op, collection, id, binding, modify)
+	if err != nil {
+		c.incrError(op)
+	}
+	return err
+}
+
+func (c *Client) updateIAMPolicyWithRetry(ctx context.Context, op, collection, id string, binding *IAMBinding, modify func(*crmv3.Policy, *IAMBinding) bool) error {
+	id = strings.TrimPrefix(id, collection+"/")
+	if !iamPolicyParentIDRegex.MatchString(id) {
+		return fmt.Errorf("invalid %s ID %q, must be numeric", strings.TrimSuffix(collection, "s"), id)
+	}
+	if err := binding.validate(); err != nil {
+		return err
+	}
+	resource := collection + "/" + id
+
+	svc, err := crmv3.NewService(ctx, option.WithHTTPClient(c.authClient), option.WithEndpoint(c.endpointsFor(ctx).CloudResourceManager))
+	if err != nil {
+		return fmt.Errorf("unable to create Cloud Resource Manager client: %v", err)
+	}
+	getPolicy := func() (*crmv3.Policy, error) {
+		req := &crmv3.GetIamPolicyRequest{Options: &crmv3.GetPolicyOptions{RequestedPolicyVersion: iamConditionsPolicyVersion}}
+		if collection == "folders" {
+			return svc.Folders.GetIamPolicy(resource, req).Context(ctx).Do()
+		}
+		return svc.Organizations.GetIamPolicy(resource, req).Context(ctx).Do()
+	}
+	setPolicy := func(policy *crmv3.Policy) error {
+		req := &crmv3.SetIamPolicyRequest{Policy: policy}
+		if collection == "folders" {
+			_, err := svc.Folders.SetIamPolicy(resource, req).Context(ctx).Do()
+			return err
+		}
+		_, err := svc.Organizations.SetIamPolicy(resource, req).Context(ctx).Do()
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		policy, err := getPolicy()
+		if err != nil {
+			return fmt.Errorf("unable to get IAM policy of %s: %w", resource, err)
+		}
+		if !modify(policy, binding) {
+			return nil
+		}
+		for _, b := range policy.Bindings {
+			if b.Condition != nil {
+				policy.Version = iamConditionsPolicyVersion
+			}
+		}
+
+		err = setPolicy(policy)
+		if err == nil {
+			return nil
+		}
+		var gerr *googleapi.Error
+		if !errors.As(err, &gerr) || gerr.Code != http.StatusConflict || attempt >= iamPolicyConflictRetries {
+			return fmt.Errorf("unable to set IAM policy of %s: %w", resource, err)
+		}
+
+		c.debug("retrying IAM policy update after concurrent change", "op", op, "resource", resource, "attempt", attempt+1)
+		c.incrRetry(op)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.opts.Retry.backoff(attempt + 1)):
+		}
+	}
+}
+
+// addIAMBinding adds the binding's members to the policy, reporting whether
+// the policy changed.
+func addIAMBinding(policy *crmv3.Policy, binding *IAMBinding) bool {
+	target := findIAMBinding(policy, binding)
+	if target == nil {
+		target = &crmv3.Binding{Role: binding.Role}
+		if binding.Condition != nil {
+			target.Condition = &crmv3.Expr{
+				Title:       binding.Condition.Title,
+				Description: binding.Condition.Description,
+				Expression:  binding.Condition.Expression,
+			}
+		}
+		policy.Bindings = append(policy.Bindings, target)
+	}
+
+	changed := false
+	for _, m := range binding.Members {
+		if !containsString(target.Members, m) {
+			target.Members = append(target.Members, m)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// removeIAMBinding removes the binding's members from the policy, dropping
+// the binding if it has no members left, and reports whether the policy
+// changed.
+func removeIAMBinding(policy *crmv3.Policy, binding *IAMBinding) bool {
+	target := findIAMBinding(policy, binding)
+	if target == nil {
+		return false
+	}
+
+	members := target.Members[:0]
+	for _, m := range target.Members {
+		if !containsString(binding.Members, m) {
+			members = append(members, m)
+		}
+	}
+	if len(members) == len(target.Members) {
+		return false
+	}
+	target.Members = members
+
+	if len(members) == 0 {
+		bindings := policy.Bindings[:0]
+		for _, b := range policy.Bindings {
+			if b != target {
+				bindings = append(bindings, b)
+			}
+		}
+		policy.Bindings = bindings
+	}
+	return true
+}
+
+// findIAMBinding returns the policy binding with the binding's role and
+// condition expression, if any.
+func findIAMBinding(policy *crmv3.Policy, binding *IAMBinding) *crmv3.Binding {
+	expression := ""
+	if binding.Condition != nil {
+		expression = binding.Condition.Expression
+	}
+	for _, b := range policy.Bindings {
+		if b.Role != binding.Role {
+			continue
+		}
+		if (b.Condition == nil && expression == "") || (b.Condition != nil && b.Condition.Expression == expression && expression != "") {
+			return b
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	crmv3 "google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// fakeIAMPolicyServer serves getIamPolicy and setIamPolicy for a single
+// resource, rejecting writes with a stale etag.
+type fakeIAMPolicyServer struct {
+	mu        sync.Mutex
+	resource  string
+	policy    *crmv3.Policy
+	conflicts int
+	sets      int
+}
+
+func (s *fakeIAMPolicyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v3/" + s.resource + ":getIamPolicy":
+		json.NewEncoder(w).Encode(s.policy)
+	case "/v3/" + s.resource + ":setIamPolicy":
+		var req crmv3.SetIamPolicyRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if s.conflicts > 0 || req.Policy.Etag != s.policy.Etag {
+			s.conflicts--
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":{"code":409,"message":"etag mismatch","status":"ABORTED"}}`))
+			return
+		}
+		s.sets++
+		s.policy = req.Policy
+		s.policy.Etag += "x"
+		json.NewEncoder(w).Encode(s.policy)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"not found"}}`))
+	}
+}
+
+func TestClient_IAMBindings(t *testing.T) {
+	const sa = "serviceAccount:sa@p.iam.gserviceaccount.com"
+	condition := &IAMCondition{Title: "expiry", Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`}
+
+	tests := map[string]struct {
+		Folder      bool
+		Initial     []*crmv3.Binding
+		Remove      bool
+		Binding     *IAMBinding
+		Conflicts   int
+		Expected    []*crmv3.Binding
+		Version     int64
+		Sets        int
+		ShouldError bool
+	}{
+		"add to existing role": {
+			Initial:  []*crmv3.Binding{{Role: "roles/viewer", Members: []string{"user:a@example.com"}}},
+			Binding:  &IAMBinding{Role: "roles/viewer", Members: []string{sa}},
+			Expected: []*crmv3.Binding{{Role: "roles/viewer", Members: []string{"user:a@example.com", sa}}},
+			Sets:     1,
+		},
+		"add existing member": {
+			Initial:  []*crmv3.Binding{{Role: "roles/viewer", Members: []string{sa}}},
+			Binding:  &IAMBinding{Role: "roles/viewer", Members: []string{sa}},
+			Expected: []*crmv3.Binding{{Role: "roles/viewer", Members: []string{sa}}},
+		},
+		"add conditional to folder": {
+			Folder:  true,
+			Initial: []*crmv3.Binding{{Role: "roles/viewer", Members: []string{sa}}},
+			Binding: &IAMBinding{Role: "roles/viewer", Members: []string{sa}, Condition: condition},
+			Expected: []*crmv3.Binding{
+				{Role: "roles/viewer", Members: []string{sa}},
+				{Role: "roles/viewer", Members: []string{sa}, Condition: &crmv3.Expr{Title: "expiry", Expression: condition.Expression}},
+			},
+			Version: 3,
+			Sets:    1,
+		},
+		"retry on conflict": {
+			Binding:   &IAMBinding{Role: "roles/viewer", Members: []string{sa}},
+			Conflicts: 2,
+			Expected:  []*crmv3.Binding{{Role: "roles/viewer", Members: []string{sa}}},
+			Sets:      1,
+		},
+		"too many conflicts": {
+			Binding:     &IAMBinding{Role: "roles/viewer", Members: []string{sa}},
+			Conflicts:   iamPolicyConflictRetries + 1,
+			ShouldError: true,
+		},
+		"remove last member": {
+			Folder:   true,
+			Initial:  []*crmv3.Binding{{Role: "roles/viewer", Members: []string{sa}}, {Role: "roles/owner", Members: []string{"user:a@example.com"}}},
+			Remove:   true,
+			Binding:  &IAMBinding{Role: "roles/viewer", Members: []string{sa}},
+			Expected: []*crmv3.Binding{{Role: "roles/owner", Members: []string{"user:a@example.com"}}},
+			Sets:     1,
+		},
+		"remove keeps other condition": {
+			Initial:  []*crmv3.Binding{{Role: "roles/viewer", Members: []string{sa}, Condition: &crmv3.Expr{Expression: condition.Expression}}},
+			Remove:   true,
+			Binding:  &IAMBinding{Role: "roles/viewer", Members: []string{sa}},
+			Expected: []*crmv3.Binding{{Role: "roles/viewer", Members: []string{sa}, Condition: &crmv3.Expr{Expression: condition.Expression}}},
+		},
+		"invalid member": {
+			Binding:     &IAMBinding{Role: "roles/viewer", Members: []string{"sa@p.iam.gserviceaccount.com"}},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			resource := "organizations/123"
+			if test.Folder {
+				resource = "folders/456"
+			}
+			fake := &fakeIAMPolicyServer{
+				resource:  resource,
+				policy:    &crmv3.Policy{Bindings: test.Initial, Etag: "BwE=", Version: 1},
+				conflicts: test.Conflicts,
+			}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{CloudResourceManager: srv.URL}, Retry: &RetryOptions{}})
+
+			ctx := context.Background()
+			id := strings.Split(resource, "/")[1]
+			var err error
+			switch {
+			case test.Folder && test.Remove:
+				err = c.RemoveFolderIAMBinding(ctx, id, test.Binding)
+			case test.Folder:
+				err = c.AddFolderIAMBinding(ctx, id, test.Binding)
+			case test.Remove:
+				err = c.RemoveOrganizationIAMBinding(ctx, resource, test.Binding)
+			default:
+				err = c.AddOrganizationIAMBinding(ctx, resource, test.Binding)
+			}
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fake.sets != test.Sets {
+				t.Fatalf("expected %d policy writes, got %d", test.Sets, fake.sets)
+			}
+			if !reflect.DeepEqual(fake.policy.Bindings, test.Expected) {
+				got, _ := json.Marshal(fake.policy.Bindings)
+				t.Fatalf("unexpected bindings %s", got)
+			}
+			if test.Version != 0 && fake.policy.Version != test.Version {
+				t.Fatalf("expected policy version %d, got %d", test.Version, fake.policy.Version)
+			}
+		})
+	}
+}
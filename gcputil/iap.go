@@ -0,0 +1,253 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+)
+
+// iamGenerateIDTokenURLPathTemplate is the IAM Credentials API path for
+// generating an ID token for a service account.
+const iamGenerateIDTokenURLPathTemplate = "/v1/projects/-/serviceAccounts/%s:generateIdToken"
+
+// idTokenSources caches ID token sources by audience. The zero value is
+// ready to use.
+type idTokenSources struct {
+	mu      sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+// GenerateIDToken generates a Google-signed ID token with the given audience
+// for a service account through the IAM Credentials API, authenticated with
+// the client's credentials. If includeEmail is true, the token has email
+// and email_verified claims.
+func (c *Client) GenerateIDToken(ctx context.Context, serviceAccountEmail, audience string, includeEmail bool) (string, error) {
+	defer c.measure("generate_id_token", time.Now())
+	token, err := c.generateIDToken(ctx, c.authClient, serviceAccountEmail, nil, audience, includeEmail)
+	if err != nil {
+		c.incrError("generate_id_token")
+		return "", err
+	}
+	return token, nil
+}
+
+// IAPIDToken returns an ID token for calling a backend protected by
+// Identity-Aware Proxy, whose audience is the OAuth client ID of the IAP
+// resource. Tokens are cached until shortly before they expire. The token
+// is obtained, depending on the client's credentials:
+//
+//   - for a service account key, from Google's token endpoint with a JWT
+//     signed by the key;
+//   - for a MetadataTokenSource, from the metadata server;
+//   - otherwise, if the credentials belong to a service account, with the
+//     IAM Credentials generateIdToken method, which requires the
+//     iam.serviceAccounts.getOpenIdToken permission on the account itself.
+//
+// User credentials cannot obtain tokens for IAP through this method.
+func (c *Client) IAPIDToken(ctx context.Context, clientID string) (string, error) {
+	defer c.measure("iap_id_token", time.Now())
+	if clientID == "" {
+		return "", errors.New("IAP OAuth client ID is required")
+	}
+
+	ts, err := c.idTokenSource(ctx, clientID)
+	if err == nil {
+		var tok *oauth2.Token
+		if tok, err = ts.Token(); err == nil {
+			return tok.AccessToken, nil
+		}
+	}
+	c.incrError("iap_id_token")
+	return "", fmt.Errorf("unable to obtain IAP ID token: %v", err)
+}
+
+// idTokenSource returns the cached ID token source for the audience,
+// creating one for the client's credentials if needed. The principal is
+// resolved without holding the cache lock, so that callers for other
+// audiences are not blocked by its network calls.
+func (c *Client) idTokenSource(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+	c.idTokens.mu.Lock()
+	ts, ok := c.idTokens.sources[audience]
+	c.idTokens.mu.Unlock()
+	c.incrCache("id_token_source", ok)
+	if ok {
+		return ts, nil
+	}
+
+	ts, err := c.newIDTokenSource(ctx, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	c.idTokens.mu.Lock()
+	defer c.idTokens.mu.Unlock()
+	// Another caller may have created a source for the audience meanwhile,
+	// whose cached token is kept.
+	if existing, ok := c.idTokens.sources[audience]; ok {
+		return existing, nil
+	}
+	if c.idTokens.sources == nil {
+		c.idTokens.sources = map[string]oauth2.TokenSource{}
+	}
+	c.idTokens.sources[audience] = ts
+	return ts, nil
+}
+
+// newIDTokenSource returns a new ID token source for the audience and the
+// client's credentials.
+func (c *Client) newIDTokenSource(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+	// Tokens outlive the call that first requested them.
+	bgCtx := context.WithValue(context.Background(), oauth2.HTTPClient, c.httpClient)
+
+	var ts oauth2.TokenSource
+	switch mts, isMetadata := c.opts.TokenSource.(*MetadataTokenSource); {
+	case c.opts.TokenSource == nil && isServiceAccountKeyJSON(c.opts.CredentialsJSON):
+		keyJSON, err := withServiceAccountType(c.opts.CredentialsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse service account key: %v", err)
+		}
+		conf, err := google.JWTConfigFromJSON(keyJSON)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse service account key: %v", err)
+		}
+		conf.Scopes = nil
+		conf.PrivateClaims = map[string]interface{}{"target_audience": audience}
+		conf.UseIDToken = true
+		ts = conf.TokenSource(bgCtx)
+
+	case isMetadata:
+		ts = idTokenFunc(func() (string, error) {
+			return mts.client.InstanceIdentityToken(bgCtx, mts.account, audience, IdentityTokenFormatStandard, false)
+		})
+
+	default:
+		tok, err := c.tokenSource.Token()
+		if err != nil {
+			return nil, err
+		}
+		info, err := c.TokenInfo(ctx, tok.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		email := info.Email
+		if !ServiceAccountEmail(email).Valid() {
+			return nil, fmt.Errorf("credentials of principal %q are not a service account key, metadata server or service account credentials", email)
+		}
+		ts = idTokenFunc(func() (string, error) {
+			return c.GenerateIDToken(bgCtx, email, audience, true)
+		})
+	}
+	return oauth2.ReuseTokenSource(nil, ts), nil
+}
+
+// generateIDToken calls generateIdToken with the given authenticated HTTP
+// client, through the given delegates, if any.
+func (c *Client) generateIDToken(ctx context.Context, httpClient *http.Client, serviceAccountEmail string, delegates []string, audience string, includeEmail bool) (string, error) {
+	if audience == "" {
+		return "", errors.New("audience is required to generate an ID token")
+	}
+	if err := validateServiceAccountRef(serviceAccountEmail); err != nil {
+		return "", err
+	}
+	delegates, err := delegateResourceNames(delegates)
+	if err != nil {
+		return "", err
+	}
+
+	payload := map[string]interface{}{"audience": audience, "includeEmail": includeEmail}
+	if len(delegates) > 0 {
+		payload["delegates"] = delegates
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	tokenURL := joinEndpoint(c.endpointsFor(ctx).IAMCredentials,
+		fmt.Sprintf(iamGenerateIDTokenURLPathTemplate, url.PathEscape(serviceAccountEmail)))
+
+	resp, err := c.doWithRetry(ctx, "generate_id_token", httpClient, func() (*http.Request, error) {
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", "application/json")
+		setAPIClientHeader(r, apiClientIDToken, apiClientCredImpersonated)
+		return r, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to generate ID token for service account %q: %v", serviceAccountEmail, err)
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return "", fmt.Errorf("unable to generate ID token for service account %q: %w", serviceAccountEmail, err)
+	}
+
+	var idResp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&idResp); err != nil {
+		return "", fmt.Errorf("unable to decode IAM Credentials response: %v", err)
+	}
+	if idResp.Token == "" {
+		return "", errors.New("IAM Credentials response did not contain an ID token")
+	}
+	return idResp.Token, nil
+}
+
+// idTokenFunc is a token source that returns the ID token from a function
+// as the access token, with the expiry of its exp claim.
+type idTokenFunc func() (string, error)
+
+func (f idTokenFunc) Token() (*oauth2.Token, error) {
+	idToken, err := f()
+	if err != nil {
+		return nil, err
+	}
+	tok := &oauth2.Token{AccessToken: idToken, TokenType: "Bearer"}
+	if exp, err := jwtExpiry(idToken); err == nil {
+		tok.Expiry = exp
+	}
+	return tok, nil
+}
+
+// jwtExpiry returns the exp claim of a JWT without verifying it.
+func jwtExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("malformed JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed JWT payload: %v", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, errors.New("JWT has no exp claim")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// isServiceAccountKeyJSON reports whether credentialsJSON is a service
+// account key file. Keys without a type are service account keys.
+func isServiceAccountKeyJSON(credentialsJSON string) bool {
+	creds, err := Credentials(credentialsJSON)
+	return err == nil && isServiceAccountType(creds.Type)
+}
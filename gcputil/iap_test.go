@@ -0,0 +1,222 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+// testIDToken returns an unsigned JWT with the given audience and expiry.
+func testIDToken(audience string, exp time.Time) string {
+	claims, _ := json.Marshal(map[string]interface{}{"aud": audience, "exp": exp.Unix()})
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".sig"
+}
+
+// jwtClaims decodes the payload of a JWT without verifying it.
+func jwtClaims(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed JWT %q", token)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestClient_IAPIDToken_serviceAccountKey(t *testing.T) {
+	tests := map[string]struct {
+		Untyped bool
+	}{
+		"typed key":   {},
+		"untyped key": {Untyped: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				claims := jwtClaims(t, r.FormValue("assertion"))
+				if claims["scope"] != nil || claims["target_audience"] != "client-id.apps.googleusercontent.com" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]string{
+					"id_token": testIDToken(claims["target_audience"].(string), time.Now().Add(time.Hour)),
+				})
+			}))
+			defer srv.Close()
+
+			keyJSON := testServiceAccountJSON(t, srv.URL)
+			if test.Untyped {
+				var key map[string]string
+				if err := json.Unmarshal(keyJSON, &key); err != nil {
+					t.Fatal(err)
+				}
+				delete(key, "type")
+				keyJSON, _ = json.Marshal(key)
+			}
+			c, err := NewClient(context.Background(), &Options{CredentialsJSON: string(keyJSON)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				token, err := c.IAPIDToken(context.Background(), "client-id.apps.googleusercontent.com")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if aud := jwtClaims(t, token)["aud"]; aud != "client-id.apps.googleusercontent.com" {
+					t.Fatalf("unexpected audience %v", aud)
+				}
+			}
+			if calls != 1 {
+				t.Errorf("expected the ID token to be cached, got %d calls", calls)
+			}
+		})
+	}
+}
+
+func TestClient_IAPIDToken_metadata(t *testing.T) {
+	md := testutil.NewMetadataServer(t)
+	mdClient := NewMetadataClientWithOptions(&MetadataClientOptions{Host: md.Host()})
+	c := newTestClient(t, &Options{TokenSource: NewMetadataTokenSource(mdClient, "")})
+
+	token, err := c.IAPIDToken(context.Background(), "client-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aud := jwtClaims(t, token)["aud"]; aud != "client-id" {
+		t.Fatalf("unexpected audience %v", aud)
+	}
+}
+
+func TestClient_IAPIDToken_generateIdToken(t *testing.T) {
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+
+	tests := map[string]struct {
+		Email       string
+		ShouldError bool
+	}{
+		"service account": {Email: "sa@p.iam.gserviceaccount.com"},
+		"user":            {Email: "user@example.com", ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tokenInfo := newTestTokenInfoServer(t, test.Email)
+			c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{APIs: tokenInfo.URL, IAMCredentials: iamCreds.URL}})
+
+			token, err := c.IAPIDToken(context.Background(), "client-id")
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			claims := jwtClaims(t, token)
+			if claims["aud"] != "client-id" || claims["email"] != test.Email {
+				t.Fatalf("unexpected claims %v", claims)
+			}
+		})
+	}
+}
+
+func TestJWTExpiry(t *testing.T) {
+	exp := time.Unix(1700000000, 0)
+	if got, err := jwtExpiry(testIDToken("a", exp)); err != nil || !got.Equal(exp) {
+		t.Fatalf("expected %v, got %v (%v)", exp, got, err)
+	}
+	for _, token := range []string{"", "a.b", fmt.Sprintf("a.%s.c", base64.RawURLEncoding.EncodeToString([]byte(`{}`)))} {
+		if _, err := jwtExpiry(token); err == nil {
+			t.Errorf("expected error for %q", token)
+		}
+	}
+}
+
+func TestClient_IAPIDToken_concurrentAudiences(t *testing.T) {
+	iamCreds := testutil.NewIAMCredentialsServer(t)
+	tokenInfo := newTestTokenInfoServer(t, "sa@p.iam.gserviceaccount.com")
+
+	// The first token info request blocks until released.
+	var requests int32
+	release := make(chan struct{})
+	gated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-release
+		}
+		resp, err := http.Post(tokenInfo.URL+r.URL.Path, r.Header.Get("Content-Type"), r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(gated.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{APIs: gated.URL, IAMCredentials: iamCreds.URL}})
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.IAPIDToken(context.Background(), "first")
+		first <- err
+	}()
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Resolving the principal for the first audience does not block other
+	// audiences.
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.IAPIDToken(context.Background(), "second")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ID token for another audience was blocked")
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.IAPIDToken(context.Background(), "first"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected the ID token sources to be cached, got %d token info requests", n)
+	}
+}
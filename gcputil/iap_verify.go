@@ -0,0 +1,238 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// IAPJWTAssertionHeader is the header in which Identity-Aware Proxy
+	// passes its signed JWT to backends.
+	IAPJWTAssertionHeader = "X-Goog-IAP-JWT-Assertion"
+
+	// IAPIssuer is the issuer of IAP JWTs.
+	IAPIssuer = "https://cloud.google.com/iap"
+
+	// defaultIAPPublicKeyURL serves IAP's ES256 public keys as a JSON object
+	// of PEM-encoded keys by key ID.
+	defaultIAPPublicKeyURL = "https://www.gstatic.com/iap/verify/public_key"
+
+	// iapClockSkew is the clock skew tolerated when checking iat and exp.
+	iapClockSkew = 30 * time.Second
+)
+
+var iapAudienceRegex = regexp.MustCompile(`^/projects/[0-9]+/(apps/[a-z][a-z0-9.:-]*|global/backendServices/[0-9]+)$`)
+
+// IAPAppEngineAudience returns the audience of IAP JWTs for an App Engine
+// application.
+func IAPAppEngineAudience(projectNumber, projectID string) string {
+	return fmt.Sprintf("/projects/%s/apps/%s", projectNumber, projectID)
+}
+
+// IAPBackendServiceAudience returns the audience of IAP JWTs for a Compute
+// Engine or GKE backend service.
+func IAPBackendServiceAudience(projectNumber, backendServiceID string) string {
+	return fmt.Sprintf("/projects/%s/global/backendServices/%s", projectNumber, backendServiceID)
+}
+
+// IAPClaims are the claims of a verified IAP JWT.
+type IAPClaims struct {
+	// Subject is the unique ID of the user.
+	Subject string `json:"sub"`
+
+	// Email is the email of the user.
+	Email string `json:"email"`
+
+	// HostedDomain is the Google Workspace domain of the user, if any.
+	HostedDomain string `json:"hd"`
+
+	// Audience is the accepted audience the token was issued for.
+	Audience string `json:"-"`
+
+	IssuedAt time.Time `json:"-"`
+	Expiry   time.Time `json:"-"`
+
+	// AccessLevels are the Access Context Manager access levels that apply
+	// to the request, if any.
+	AccessLevels []string `json:"-"`
+}
+
+// IAPVerifierOptions configures an IAPVerifier.
+type IAPVerifierOptions struct {
+	// Audiences are the accepted audiences, as returned by
+	// IAPAppEngineAudience or IAPBackendServiceAudience. At least one is
+	// required.
+	Audiences []string
+
+	// KeyURL serves IAP's public keys. Defaults to
+	// https://www.gstatic.com/iap/verify/public_key.
+	KeyURL string
+
+	// HTTPClient is used to fetch keys. Defaults to the HTTP client of the
+	// package-level functions.
+	HTTPClient *http.Client
+
+	// KeyProvider provides IAP's public keys. It takes precedence over
+	// KeyURL and HTTPClient. Defaults to the shared provider for the "iap"
+	// key endpoint, unless KeyURL or HTTPClient is set.
+	KeyProvider *KeyProvider
+}
+
+// IAPVerifier verifies the JWTs Identity-Aware Proxy adds to requests it
+// forwards to backends. Keys are cached. It is safe for concurrent use.
+type IAPVerifier struct {
+	audiences *AudienceMatcher
+	keys      *KeyProvider
+	now       func() time.Time
+}
+
+// NewIAPVerifier returns an IAPVerifier for the given options.
+func NewIAPVerifier(opts *IAPVerifierOptions) (*IAPVerifier, error) {
+	if opts == nil || len(opts.Audiences) == 0 {
+		return nil, errors.New("at least one IAP audience is required")
+	}
+	for _, aud := range opts.Audiences {
+		if !iapAudienceRegex.MatchString(aud) {
+			return nil, fmt.Errorf("invalid IAP audience %q, must be of the form /projects/NUMBER/apps/PROJECT or /projects/NUMBER/global/backendServices/ID", aud)
+		}
+	}
+	audiences, err := NewAudienceMatcher(opts.Audiences...)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := opts.KeyProvider
+	switch {
+	case keys != nil:
+	case opts.KeyURL != "" || opts.HTTPClient != nil:
+		endpoint, _ := LookupKeyEndpoint(KeyEndpointIAP)
+		if opts.KeyURL != "" {
+			endpoint = KeyEndpoint{URL: opts.KeyURL, Format: KeyFormatPEM}
+		}
+		keys = NewKeyProvider(endpoint, opts.HTTPClient)
+	default:
+		if keys, err = SharedKeyProvider(KeyEndpointIAP); err != nil {
+			return nil, err
+		}
+	}
+
+	return &IAPVerifier{
+		audiences: audiences,
+		keys:      keys,
+		now:       time.Now,
+	}, nil
+}
+
+// VerifyRequest verifies the IAP JWT in the request's
+// X-Goog-IAP-JWT-Assertion header.
+func (v *IAPVerifier) VerifyRequest(r *http.Request) (*IAPClaims, error) {
+	assertion := r.Header.Get(IAPJWTAssertionHeader)
+	if assertion == "" {
+		return nil, fmt.Errorf("request has no %s header", IAPJWTAssertionHeader)
+	}
+	return v.Verify(r.Context(), assertion)
+}
+
+// Verify verifies an IAP JWT: its ES256 signature with IAP's public keys,
+// its issuer, audience and validity period.
+func (v *IAPVerifier) Verify(ctx context.Context, assertion string) (*IAPClaims, error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed IAP JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed IAP JWT header: %v", err)
+	}
+	if header.Alg != "ES256" {
+		return nil, fmt.Errorf("unexpected IAP JWT algorithm %q", header.Alg)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return nil, errors.New("malformed IAP JWT signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, errors.New("invalid IAP JWT signature")
+	}
+
+	var raw struct {
+		IAPClaims
+		Iss    string    `json:"iss"`
+		Aud    Audiences `json:"aud"`
+		Iat    int64     `json:"iat"`
+		Exp    int64     `json:"exp"`
+		Google struct {
+			AccessLevels []string `json:"access_levels"`
+		} `json:"google"`
+	}
+	if err := decodeJWTSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("malformed IAP JWT claims: %v", err)
+	}
+
+	now := v.now()
+	switch {
+	case raw.Iss != IAPIssuer:
+		return nil, fmt.Errorf("unexpected IAP JWT issuer %q", raw.Iss)
+	case raw.Exp == 0 || now.After(time.Unix(raw.Exp, 0).Add(iapClockSkew)):
+		return nil, errors.New("IAP JWT has expired")
+	case raw.Iat == 0 || now.Before(time.Unix(raw.Iat, 0).Add(-iapClockSkew)):
+		return nil, errors.New("IAP JWT is not valid yet")
+	case raw.Subject == "":
+		return nil, errors.New("IAP JWT has no subject")
+	}
+	if err := v.audiences.Validate(raw.Aud...); err != nil {
+		return nil, err
+	}
+
+	claims := raw.IAPClaims
+	claims.Audience, _ = v.audiences.Match(raw.Aud...)
+	claims.IssuedAt = time.Unix(raw.Iat, 0)
+	claims.Expiry = time.Unix(raw.Exp, 0)
+	claims.AccessLevels = raw.Google.AccessLevels
+	return &claims, nil
+}
+
+// key returns the IAP public key with the given ID.
+func (v *IAPVerifier) key(ctx context.Context, kid string) (*ecdsa.PublicKey, error) {
+	pub, err := v.keys.PublicKey(ctx, kid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get IAP public key: %v", err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("IAP key %q is not an ECDSA key", kid)
+	}
+	return key, nil
+}
+
+// decodeJWTSegment decodes a base64url-encoded JSON segment of a JWT.
+func decodeJWTSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signTestES256 returns a JWT with the given header and claims signed with
+// key.
+func signTestES256(t *testing.T, key *ecdsa.PrivateKey, header, claims map[string]interface{}) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestIAPVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]string{
+			"iap-key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		})
+	}))
+	defer srv.Close()
+
+	aud := IAPBackendServiceAudience("123", "456")
+	v, err := NewIAPVerifier(&IAPVerifierOptions{Audiences: []string{aud, IAPAppEngineAudience("123", "my-app")}, KeyURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    IAPIssuer,
+			"aud":    aud,
+			"sub":    "accounts.google.com:1",
+			"email":  "user@example.com",
+			"hd":     "example.com",
+			"iat":    now.Unix(),
+			"exp":    now.Add(10 * time.Minute).Unix(),
+			"google": map[string]interface{}{"access_levels": []string{"accessPolicies/1/accessLevels/corp"}},
+		}
+	}
+	header := map[string]interface{}{"alg": "ES256", "kid": "iap-key"}
+
+	tests := map[string]struct {
+		Modify      func(header, claims map[string]interface{})
+		Key         *ecdsa.PrivateKey
+		Audience    string
+		ShouldError bool
+	}{
+		"valid": {
+			Audience: aud,
+		},
+		"app engine audience": {
+			Modify:   func(h, c map[string]interface{}) { c["aud"] = IAPAppEngineAudience("123", "my-app") },
+			Audience: IAPAppEngineAudience("123", "my-app"),
+		},
+		"accepted audience after another": {
+			Modify:   func(h, c map[string]interface{}) { c["aud"] = []string{IAPBackendServiceAudience("123", "789"), aud} },
+			Audience: aud,
+		},
+		"wrong signer": {
+			Key:         otherKey,
+			ShouldError: true,
+		},
+		"wrong algorithm": {
+			Modify:      func(h, c map[string]interface{}) { h["alg"] = "RS256" },
+			ShouldError: true,
+		},
+		"unknown key": {
+			Modify:      func(h, c map[string]interface{}) { h["kid"] = "other" },
+			ShouldError: true,
+		},
+		"wrong issuer": {
+			Modify:      func(h, c map[string]interface{}) { c["iss"] = "https://accounts.google.com" },
+			ShouldError: true,
+		},
+		"wrong audience": {
+			Modify:      func(h, c map[string]interface{}) { c["aud"] = IAPBackendServiceAudience("123", "789") },
+			ShouldError: true,
+		},
+		"expired": {
+			Modify:      func(h, c map[string]interface{}) { c["exp"] = now.Add(-time.Minute).Unix() },
+			ShouldError: true,
+		},
+		"issued in the future": {
+			Modify:      func(h, c map[string]interface{}) { c["iat"] = now.Add(time.Minute).Unix() },
+			ShouldError: true,
+		},
+		"no subject": {
+			Modify:      func(h, c map[string]interface{}) { delete(c, "sub") },
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := map[string]interface{}{}
+			for k, val := range header {
+				h[k] = val
+			}
+			c := validClaims()
+			if test.Modify != nil {
+				test.Modify(h, c)
+			}
+			signer := key
+			if test.Key != nil {
+				signer = test.Key
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(IAPJWTAssertionHeader, signTestES256(t, signer, h, c))
+			claims, err := v.VerifyRequest(req)
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			if claims.Audience != test.Audience {
+				t.Fatalf("expected audience %q, got %q", test.Audience, claims.Audience)
+			}
+			if claims.Email != "user@example.com" || claims.HostedDomain != "example.com" || len(claims.AccessLevels) != 1 {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+		})
+	}
+
+	// Keys are cached, and an unknown key ID only triggers a refetch once
+	// per refresh interval.
+	if fetches != 1 {
+		t.Errorf("expected a single key fetch, got %d", fetches)
+	}
+
+	if _, err := v.VerifyRequest(httptest.NewRequest(http.MethodGet, "/", nil)); err == nil {
+		t.Error("expected error for a request without an assertion")
+	}
+	if _, err := NewIAPVerifier(&IAPVerifierOptions{Audiences: []string{"client-id"}}); err == nil {
+		t.Error("expected error for an invalid audience")
+	}
+	if _, err := v.Verify(context.Background(), "a.b"); err == nil {
+		t.Error("expected error for a malformed JWT")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+	"golang.org/x/oauth2"
+)
+
+func TestClient_ImpersonatedTokenSource(t *testing.T) {
+	const target = "target@p.iam.gserviceaccount.com"
+
+	tests := map[string]struct {
+		Base          oauth2.TokenSource
+		Delegates     []string
+		Lifetime      time.Duration
+		Authorization string
+		BodyDelegates []interface{}
+		ShouldError   bool
+	}{
+		"client credentials": {
+			Authorization: "Bearer fake-token-1",
+		},
+		"base token source": {
+			Base:          oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "base-token"}),
+			Authorization: "Bearer base-token",
+		},
+		"delegates": {
+			Delegates:     []string{"hop@p.iam.gserviceaccount.com", "projects/-/serviceAccounts/123456789012345678901"},
+			Authorization: "Bearer fake-token-1",
+			BodyDelegates: []interface{}{"projects/-/serviceAccounts/hop@p.iam.gserviceaccount.com", "projects/-/serviceAccounts/123456789012345678901"},
+		},
+		"invalid delegate": {
+			Delegates:   []string{"not-an-email"},
+			ShouldError: true,
+		},
+		"invalid lifetime": {
+			Lifetime:    13 * time.Hour,
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			iamCreds := testutil.NewIAMCredentialsServer(t)
+			c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{IAMCredentials: iamCreds.URL}})
+
+			ts, err := c.ImpersonatedTokenSource(test.Base, target, test.Delegates, []string{"scope-a"}, test.Lifetime)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				tok, err := ts.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tok.AccessToken != "iam-access-token-"+target || tok.Expiry.IsZero() {
+					t.Fatalf("unexpected token %+v", tok)
+				}
+			}
+
+			reqs := iamCreds.RequestsFor(testutil.MethodGenerateAccessToken)
+			if len(reqs) != 1 {
+				t.Fatalf("expected token to be reused, got %d requests", len(reqs))
+			}
+			if reqs[0].Authorization != test.Authorization {
+				t.Errorf("expected authorization %q, got %q", test.Authorization, reqs[0].Authorization)
+			}
+			delegates, _ := reqs[0].Body["delegates"].([]interface{})
+			if !reflect.DeepEqual(delegates, test.BodyDelegates) {
+				t.Errorf("expected delegates %v, got %v", test.BodyDelegates, delegates)
+			}
+		})
+	}
+}
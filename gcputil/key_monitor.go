@@ -0,0 +1,217 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	defaultKeyMonitorInterval      = time.Hour
+	defaultKeyMonitorExpiryWarning = 7 * 24 * time.Hour
+)
+
+// KeyStatus is the state of a service account key observed by a KeyMonitor.
+type KeyStatus struct {
+	Key *ServiceAccountKeyId
+
+	// ValidAfter and ValidBefore are the key's validity window. ValidBefore
+	// is zero for keys that do not expire.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+
+	// Disabled is true if the key has been disabled.
+	Disabled bool
+
+	// Deleted is true if the key no longer exists.
+	Deleted bool
+
+	// Expiring is true if the key expires within the monitor's expiry
+	// warning window, or has expired.
+	Expiring bool
+}
+
+// Healthy reports whether the key can be used and is not about to expire.
+func (s *KeyStatus) Healthy() bool {
+	return !s.Disabled && !s.Deleted && !s.Expiring
+}
+
+func (s *KeyStatus) alertState() string {
+	switch {
+	case s.Deleted:
+		return "deleted"
+	case s.Disabled:
+		return "disabled"
+	case s.Expiring:
+		return "expiring"
+	}
+	return ""
+}
+
+// KeyMonitorOptions configures a KeyMonitor.
+type KeyMonitorOptions struct {
+	// Key is the key to monitor. Defaults to the key of the client's
+	// service account credentials.
+	Key *ServiceAccountKeyId
+
+	// Interval is the time between checks. Defaults to one hour.
+	Interval time.Duration
+
+	// ExpiryWarning is how long before the key expires OnAlert is called.
+	// Defaults to seven days.
+	ExpiryWarning time.Duration
+
+	// OnAlert is called when the key is first found to be disabled,
+	// deleted or nearing expiry, and again if its state changes. It is
+	// required.
+	OnAlert func(*KeyStatus)
+
+	// OnError, if set, is called when a check fails.
+	OnError func(error)
+}
+
+// KeyMonitor periodically checks a service account key's validity window
+// and disabled status with the IAM API, so operators are warned before
+// authentication starts failing.
+type KeyMonitor struct {
+	client *Client
+	opts   KeyMonitorOptions
+
+	mu        sync.Mutex
+	lastState string
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewKeyMonitor returns a KeyMonitor for the given options. The monitor does
+// not run until Start is called.
+func (c *Client) NewKeyMonitor(opts *KeyMonitorOptions) (*KeyMonitor, error) {
+	if opts == nil || opts.OnAlert == nil {
+		return nil, errors.New("an OnAlert callback is required")
+	}
+
+	m := &KeyMonitor{client: c, opts: *opts}
+	if m.opts.Key == nil {
+		if c.opts.CredentialsJSON == "" {
+			return nil, errors.New("a key is required when the client is not configured with service account credentials")
+		}
+		creds, err := Credentials(c.opts.CredentialsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse credentials: %v", err)
+		}
+		if creds.ClientEmail == "" || creds.PrivateKeyId == "" {
+			return nil, errors.New("client credentials are not a service account key")
+		}
+		m.opts.Key = &ServiceAccountKeyId{Project: "-", EmailOrId: creds.ClientEmail, Key: creds.PrivateKeyId}
+	}
+	if m.opts.Interval <= 0 {
+		m.opts.Interval = defaultKeyMonitorInterval
+	}
+	if m.opts.ExpiryWarning <= 0 {
+		m.opts.ExpiryWarning = defaultKeyMonitorExpiryWarning
+	}
+	return m, nil
+}
+
+// Start checks the key immediately and then every interval until Stop is
+// called or ctx is done.
+func (m *KeyMonitor) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return
+	}
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	go m.run(ctx, m.done)
+}
+
+// Stop stops the monitor and waits for a running check to finish.
+func (m *KeyMonitor) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel, m.done = nil, nil
+	m.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (m *KeyMonitor) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Check(ctx); err != nil && ctx.Err() == nil && m.opts.OnError != nil {
+			m.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check checks the key once, calling OnAlert if its state changed to an
+// alerting one, and returns its status.
+func (m *KeyMonitor) Check(ctx context.Context) (*KeyStatus, error) {
+	status, err := m.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state := status.alertState()
+	m.mu.Lock()
+	changed := state != m.lastState
+	m.lastState = state
+	m.mu.Unlock()
+
+	if changed && state != "" {
+		m.client.warn("service account key needs attention", "key", status.Key.ResourceName(), "state", state)
+		m.opts.OnAlert(status)
+	}
+	return status, nil
+}
+
+func (m *KeyMonitor) status(ctx context.Context) (*KeyStatus, error) {
+	defer m.client.measure("key_monitor_check", time.Now())
+
+	iamService, err := m.client.iamServiceFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &KeyStatus{Key: m.opts.Key}
+	key, err := iamService.Projects.ServiceAccounts.Keys.Get(m.opts.Key.ResourceName()).Context(ctx).Do()
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+			status.Deleted = true
+			return status, nil
+		}
+		m.client.incrError("key_monitor_check")
+		return nil, fmt.Errorf("unable to get service account key '%s': %v", m.opts.Key.ResourceName(), err)
+	}
+
+	validity, err := ServiceAccountKeyValidity(key)
+	if err != nil {
+		return nil, err
+	}
+	status.Disabled = key.Disabled
+	status.ValidAfter = validity.ValidAfter
+	status.ValidBefore = validity.ValidBefore
+	status.Expiring = validity.ExpiringWithin(m.opts.ExpiryWarning)
+	return status, nil
+}
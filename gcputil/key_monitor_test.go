@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+	"google.golang.org/api/iam/v1"
+)
+
+func TestKeyMonitor_Check(t *testing.T) {
+	iamSrv := testutil.NewIAMServer(t)
+	sa := iamSrv.AddServiceAccount("p", "sa")
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{IAM: iamSrv.URL}})
+
+	key, err := c.iamService.Projects.ServiceAccounts.Keys.Create(sa.Name, &iam.CreateServiceAccountKeyRequest{}).Do()
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	keyID := &ServiceAccountKeyId{Project: "p", EmailOrId: sa.Email, Key: path.Base(key.Name)}
+
+	var alerts []*KeyStatus
+	newMonitor := func(expiryWarning time.Duration) *KeyMonitor {
+		m, err := c.NewKeyMonitor(&KeyMonitorOptions{
+			Key:           keyID,
+			ExpiryWarning: expiryWarning,
+			OnAlert:       func(s *KeyStatus) { alerts = append(alerts, s) },
+		})
+		if err != nil {
+			t.Fatalf("unable to create monitor: %v", err)
+		}
+		return m
+	}
+
+	m := newMonitor(0)
+	status, err := m.Check(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.Healthy() || status.ValidBefore.IsZero() || len(alerts) != 0 {
+		t.Errorf("expected healthy key without alerts, got %+v (%d alerts)", status, len(alerts))
+	}
+
+	// The fake's keys are valid for ten years.
+	if _, err := newMonitor(20 * 365 * 24 * time.Hour).Check(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 1 || !alerts[0].Expiring {
+		t.Errorf("expected an expiring alert, got %+v", alerts)
+	}
+
+	iamSrv.DisableKey(sa.Email, keyID.Key)
+	for i := 0; i < 2; i++ {
+		if _, err := m.Check(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(alerts) != 2 || !alerts[1].Disabled {
+		t.Errorf("expected a single disabled alert, got %+v", alerts)
+	}
+
+	keyID.Key = "missing"
+	status, err = m.Check(context.Background())
+	if err != nil || !status.Deleted || len(alerts) != 3 {
+		t.Errorf("expected a deleted alert, got %+v (err: %v)", status, err)
+	}
+}
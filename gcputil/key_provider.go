@@ -0,0 +1,317 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// KeyFormat is the format in which a key endpoint serves public keys.
+type KeyFormat int
+
+const (
+	// KeyFormatX509 is a JSON object of PEM-encoded X.509 certificates by
+	// key ID.
+	KeyFormatX509 KeyFormat = iota
+
+	// KeyFormatPEM is a JSON object of PEM-encoded public keys by key ID.
+	KeyFormatPEM
+
+	// KeyFormatJWKS is a JSON Web Key Set.
+	KeyFormatJWKS
+)
+
+// Names of the well-known Google key endpoints.
+const (
+	// KeyEndpointOAuth2V1 serves the keys signing Google ID tokens as X.509
+	// certificates.
+	KeyEndpointOAuth2V1 = "oauth2-v1"
+
+	// KeyEndpointOAuth2V3 serves the keys signing Google ID tokens as a JWKS.
+	KeyEndpointOAuth2V3 = "oauth2-v3"
+
+	// KeyEndpointIAP serves the ES256 keys signing Identity-Aware Proxy JWTs.
+	KeyEndpointIAP = "iap"
+
+	// KeyEndpointIAPJWK serves the IAP keys as a JWKS.
+	KeyEndpointIAPJWK = "iap-jwk"
+
+	// KeyEndpointIdentityToolkit serves the keys signing Identity Platform
+	// and Firebase Authentication ID tokens.
+	KeyEndpointIdentityToolkit = "identitytoolkit"
+)
+
+const (
+	// defaultKeyCacheTTL is how long keys are cached if the endpoint does
+	// not set a Cache-Control max-age.
+	defaultKeyCacheTTL = time.Hour
+
+	// keyMinRefresh is how often keys may be refetched because of an unknown
+	// key ID.
+	keyMinRefresh = time.Minute
+)
+
+var cacheControlMaxAgeRegex = regexp.MustCompile(`(?:^|[,\s])max-age=([0-9]+)`)
+
+// KeyEndpoint is a URL serving public keys in a given format.
+type KeyEndpoint struct {
+	URL    string
+	Format KeyFormat
+}
+
+var (
+	keyEndpointsMu sync.RWMutex
+	keyEndpoints   = map[string]KeyEndpoint{
+		KeyEndpointOAuth2V1:        {URL: defaultGoogleAPIsEndpoint + googleOAuthProviderX509CertURLPath, Format: KeyFormatX509},
+		KeyEndpointOAuth2V3:        {URL: defaultGoogleAPIsEndpoint + "/oauth2/v3/certs", Format: KeyFormatJWKS},
+		KeyEndpointIAP:             {URL: defaultIAPPublicKeyURL, Format: KeyFormatPEM},
+		KeyEndpointIAPJWK:          {URL: defaultIAPPublicKeyURL + "-jwk", Format: KeyFormatJWKS},
+		KeyEndpointIdentityToolkit: {URL: defaultGoogleAPIsEndpoint + "/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com", Format: KeyFormatX509},
+	}
+	sharedKeyProviders = map[string]*KeyProvider{}
+)
+
+// RegisterKeyEndpoint registers a key endpoint under the given name, or
+// replaces a registered one, e.g. to point a well-known endpoint at a
+// private mirror. Shared providers created for the name before are
+// discarded.
+func RegisterKeyEndpoint(name string, endpoint KeyEndpoint) error {
+	if name == "" || endpoint.URL == "" {
+		return errors.New("key endpoint name and URL are required")
+	}
+	if endpoint.Format < KeyFormatX509 || endpoint.Format > KeyFormatJWKS {
+		return fmt.Errorf("invalid key format %d", endpoint.Format)
+	}
+	keyEndpointsMu.Lock()
+	defer keyEndpointsMu.Unlock()
+	keyEndpoints[name] = endpoint
+	delete(sharedKeyProviders, name)
+	return nil
+}
+
+// LookupKeyEndpoint returns the key endpoint registered under the given name.
+func LookupKeyEndpoint(name string) (KeyEndpoint, bool) {
+	keyEndpointsMu.RLock()
+	defer keyEndpointsMu.RUnlock()
+	e, ok := keyEndpoints[name]
+	return e, ok
+}
+
+// SharedKeyProvider returns the process-wide KeyProvider for the key
+// endpoint registered under the given name, so that its keys are fetched
+// and cached once for all users.
+func SharedKeyProvider(name string) (*KeyProvider, error) {
+	keyEndpointsMu.Lock()
+	defer keyEndpointsMu.Unlock()
+	if p, ok := sharedKeyProviders[name]; ok {
+		return p, nil
+	}
+	e, ok := keyEndpoints[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown key endpoint %q", name)
+	}
+	p := NewKeyProvider(e, nil)
+	sharedKeyProviders[name] = p
+	return p, nil
+}
+
+// KeyProvider fetches and caches the public keys served by a key endpoint.
+// Keys are cached for the endpoint's Cache-Control max-age, or an hour, and
+// refetched at most once a minute when an unknown key ID is requested, so
+// that rotated keys are picked up. It is safe for concurrent use.
+type KeyProvider struct {
+	endpoint   KeyEndpoint
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	ttl       time.Duration
+	metrics   MetricsSink
+}
+
+// NewKeyProvider returns a KeyProvider for the given endpoint. If httpClient
+// is nil, the package default HTTP client is used.
+func NewKeyProvider(endpoint KeyEndpoint, httpClient *http.Client) *KeyProvider {
+	if httpClient == nil {
+		httpClient = packageHTTPClient()
+	}
+	return &KeyProvider{
+		endpoint:   endpoint,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+}
+
+// SetMetrics sets the sink that receives the hits and misses of the key
+// cache, counted as gcputil/public_key/cache_hit and
+// gcputil/public_key/cache_miss, e.g. a MonitoringExporter, which publishes
+// the hit rate. Passing nil stops reporting.
+func (p *KeyProvider) SetMetrics(sink MetricsSink) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.metrics = sink
+}
+
+// PublicKey returns the public key with the given key ID: an *rsa.PublicKey
+// or *ecdsa.PublicKey. In FIPS mode, keys that do not comply are rejected.
+func (p *KeyProvider) PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	age := p.now().Sub(p.fetchedAt)
+	key, ok := p.keys[keyID]
+	hit := ok && age < p.ttl
+	if p.metrics != nil {
+		p.metrics.IncrCounter(cacheLookupKey("public_key", hit), 1)
+	}
+	if hit {
+		if err := checkFIPSPublicKey(key); err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyID, err)
+		}
+		return key, nil
+	}
+	if p.keys == nil || age >= p.ttl || age >= keyMinRefresh {
+		keys, ttl, err := p.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.keys, p.ttl, p.fetchedAt = keys, ttl, p.now()
+	}
+	if key, ok := p.keys[keyID]; ok {
+		if err := checkFIPSPublicKey(key); err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyID, err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("key %q not found (GET %q)", keyID, p.endpoint.URL)
+}
+
+func (p *KeyProvider) fetch(ctx context.Context) (map[string]crypto.PublicKey, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint.URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	setAPIClientHeader(req, "", "")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to fetch public keys: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, 0, fmt.Errorf("unable to fetch public keys: %w", err)
+	}
+
+	ttl := defaultKeyCacheTTL
+	if m := cacheControlMaxAgeRegex.FindStringSubmatch(resp.Header.Get("Cache-Control")); m != nil {
+		if seconds, err := strconv.Atoi(m[1]); err == nil {
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+
+	var keys map[string]crypto.PublicKey
+	if p.endpoint.Format == KeyFormatJWKS {
+		keys, err = parseJWKS(resp)
+	} else {
+		keys, err = parsePEMKeys(resp, p.endpoint.Format)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, ttl, nil
+}
+
+func parsePEMKeys(resp *http.Response, format KeyFormat) (map[string]crypto.PublicKey, error) {
+	var pems map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&pems); err != nil {
+		return nil, fmt.Errorf("unable to decode JSON response: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(pems))
+	for kid, p := range pems {
+		if format == KeyFormatX509 {
+			key, err := PublicKey(p)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse certificate for key %q: %v", kid, err)
+			}
+			keys[kid] = key
+			continue
+		}
+
+		block, _ := pem.Decode([]byte(p))
+		if block == nil {
+			return nil, fmt.Errorf("unable to find pem block in key %q", kid)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse key %q: %v", kid, err)
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+func parseJWKS(resp *http.Response) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("unable to decode JSON response: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, nErr := base64.RawURLEncoding.DecodeString(k.N)
+			e, eErr := base64.RawURLEncoding.DecodeString(k.E)
+			if nErr != nil || eErr != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("invalid RSA key %q", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			x, xErr := base64.RawURLEncoding.DecodeString(k.X)
+			y, yErr := base64.RawURLEncoding.DecodeString(k.Y)
+			if k.Crv != "P-256" || xErr != nil || yErr != nil {
+				return nil, fmt.Errorf("invalid or unsupported EC key %q", k.Kid)
+			}
+			key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !key.Curve.IsOnCurve(key.X, key.Y) {
+				return nil, fmt.Errorf("invalid EC key %q", k.Kid)
+			}
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,201 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyProvider_formats(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &rsaKey.PublicKey, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkixDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	tests := map[string]struct {
+		Format      KeyFormat
+		Body        interface{}
+		KeyID       string
+		Want        interface{}
+		ShouldError bool
+	}{
+		"x509": {
+			Format: KeyFormatX509,
+			Body:   map[string]string{"k1": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))},
+			KeyID:  "k1",
+			Want:   &rsaKey.PublicKey,
+		},
+		"pem": {
+			Format: KeyFormatPEM,
+			Body:   map[string]string{"k1": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixDER}))},
+			KeyID:  "k1",
+			Want:   &ecKey.PublicKey,
+		},
+		"jwks rsa": {
+			Format: KeyFormatJWKS,
+			Body: map[string]interface{}{"keys": []map[string]string{{
+				"kid": "k1", "kty": "RSA",
+				"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			}}},
+			KeyID: "k1",
+			Want:  &rsaKey.PublicKey,
+		},
+		"jwks ec": {
+			Format: KeyFormatJWKS,
+			Body: map[string]interface{}{"keys": []map[string]string{{
+				"kid": "k1", "kty": "EC", "crv": "P-256",
+				"x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes()),
+			}}},
+			KeyID: "k1",
+			Want:  &ecKey.PublicKey,
+		},
+		"unknown key": {
+			Format:      KeyFormatPEM,
+			Body:        map[string]string{},
+			KeyID:       "k2",
+			ShouldError: true,
+		},
+		"invalid pem": {
+			Format:      KeyFormatPEM,
+			Body:        map[string]string{"k1": "not a key"},
+			KeyID:       "k1",
+			ShouldError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(tc.Body)
+			}))
+			defer srv.Close()
+
+			p := NewKeyProvider(KeyEndpoint{URL: srv.URL, Format: tc.Format}, nil)
+			key, err := p.PublicKey(context.Background(), tc.KeyID)
+			if tc.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.(interface{ Equal(crypto.PublicKey) bool }).Equal(tc.Want) {
+				t.Fatalf("unexpected key %#v", key)
+			}
+		})
+	}
+}
+
+func TestKeyProvider_caching(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		json.NewEncoder(w).Encode(map[string]string{"k1": keyPEM})
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	metrics := &countingMetrics{}
+	p := NewKeyProvider(KeyEndpoint{URL: srv.URL, Format: KeyFormatPEM}, nil)
+	p.now = func() time.Time { return now }
+	p.SetMetrics(metrics)
+
+	ctx := context.Background()
+	steps := []struct {
+		Advance time.Duration
+		KeyID   string
+		Fetches int32
+	}{
+		{0, "k1", 1},
+		{time.Minute, "k1", 1},
+		{0, "k2", 2},
+		{30 * time.Second, "k2", 2},
+		{11 * time.Minute, "k1", 3},
+	}
+	for i, s := range steps {
+		now = now.Add(s.Advance)
+		p.PublicKey(ctx, s.KeyID)
+		if got := atomic.LoadInt32(&fetches); got != s.Fetches {
+			t.Fatalf("step %d: expected %d fetches, got %d", i, s.Fetches, got)
+		}
+	}
+	if hits, misses := metrics.count("gcputil.public_key.cache_hit"), metrics.count("gcputil.public_key.cache_miss"); hits != 1 || misses != 4 {
+		t.Fatalf("expected 1 cache hit and 4 misses, got %d and %d", hits, misses)
+	}
+}
+
+func TestKeyEndpointRegistry(t *testing.T) {
+	for _, name := range []string{KeyEndpointOAuth2V1, KeyEndpointOAuth2V3, KeyEndpointIAP, KeyEndpointIAPJWK, KeyEndpointIdentityToolkit} {
+		if _, ok := LookupKeyEndpoint(name); !ok {
+			t.Fatalf("missing well-known key endpoint %q", name)
+		}
+	}
+
+	if _, err := SharedKeyProvider("nope"); err == nil {
+		t.Fatal("expected error for unknown key endpoint")
+	}
+	if err := RegisterKeyEndpoint("test-endpoint", KeyEndpoint{}); err == nil {
+		t.Fatal("expected error for missing URL")
+	}
+	if err := RegisterKeyEndpoint("test-endpoint", KeyEndpoint{URL: "https://example.com/keys", Format: KeyFormatJWKS}); err != nil {
+		t.Fatal(err)
+	}
+	p1, err := SharedKeyProvider("test-endpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, _ := SharedKeyProvider("test-endpoint")
+	if p1 != p2 {
+		t.Fatal("expected shared provider to be reused")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SelectorOperator is the operator of a LabelRequirement.
+type SelectorOperator string
+
+const (
+	SelectorEquals       SelectorOperator = "="
+	SelectorNotEquals    SelectorOperator = "!="
+	SelectorIn           SelectorOperator = "in"
+	SelectorNotIn        SelectorOperator = "notin"
+	SelectorExists       SelectorOperator = "exists"
+	SelectorDoesNotExist SelectorOperator = "!"
+)
+
+var (
+	// GCP label keys start with a lowercase letter and, like values, contain
+	// at most 63 lowercase letters, digits, underscores and dashes.
+	labelKeyRegex   = regexp.MustCompile(`^[\p{Ll}\p{Lo}][\p{Ll}\p{Lo}\p{N}_-]{0,62}$`)
+	labelValueRegex = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_-]{0,63}$`)
+
+	selectorSetRegex = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// LabelRequirement is a single condition on a label map.
+type LabelRequirement struct {
+	Key      string
+	Operator SelectorOperator
+	Values   []string
+}
+
+// Matches reports whether labels, which must be normalized as returned by
+// InstanceLabels, satisfy the requirement.
+func (r *LabelRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorExists:
+		return ok
+	case SelectorDoesNotExist:
+		return !ok
+	case SelectorEquals, SelectorIn:
+		return ok && r.hasValue(value)
+	case SelectorNotEquals, SelectorNotIn:
+		return !ok || !r.hasValue(value)
+	}
+	return false
+}
+
+func (r *LabelRequirement) hasValue(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the requirement in selector syntax.
+func (r *LabelRequirement) String() string {
+	switch r.Operator {
+	case SelectorExists:
+		return r.Key
+	case SelectorDoesNotExist:
+		return "!" + r.Key
+	case SelectorIn, SelectorNotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	}
+	return fmt.Sprintf("%s%s%s", r.Key, r.Operator, r.Values[0])
+}
+
+// LabelSelector is a set of requirements that must all be satisfied by a
+// label map. The zero value matches everything.
+type LabelSelector []LabelRequirement
+
+// ParseLabelSelector parses a comma-separated list of requirements, each of
+// which is one of:
+//
+//	key=value, key:value or key==value   the label has the given value
+//	key!=value                           the label is absent or has another value
+//	key in (v1,v2)                       the label has one of the values
+//	key notin (v1,v2)                    the label is absent or has none of the values
+//	key                                  the label is present
+//	!key                                 the label is absent
+//
+// Keys and values are normalized to lower case and must be valid GCP label
+// keys and values.
+func ParseLabelSelector(selector string) (LabelSelector, error) {
+	var parsed LabelSelector
+	for _, expr := range splitSelector(selector) {
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		r, err := parseLabelRequirement(expr)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, *r)
+	}
+	return parsed, nil
+}
+
+// Matches reports whether labels satisfy every requirement of the selector.
+// Label keys and values are compared case-insensitively.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	return len(s.Unmatched(labels)) == 0
+}
+
+// Unmatched returns, in sorted selector syntax, the requirements that labels
+// do not satisfy. Label keys and values are compared case-insensitively.
+func (s LabelSelector) Unmatched(labels map[string]string) []string {
+	normalized := make(map[string]string, len(labels))
+	for k, v := range labels {
+		normalized[normalizeLabel(k)] = normalizeLabel(v)
+	}
+
+	var unmatched []string
+	for i := range s {
+		if !s[i].Matches(normalized) {
+			unmatched = append(unmatched, s[i].String())
+		}
+	}
+	sort.Strings(unmatched)
+	return unmatched
+}
+
+// String returns the selector in the syntax accepted by ParseLabelSelector.
+func (s LabelSelector) String() string {
+	exprs := make([]string, 0, len(s))
+	for i := range s {
+		exprs = append(exprs, s[i].String())
+	}
+	return strings.Join(exprs, ",")
+}
+
+// splitSelector splits a selector on the commas that are not inside a set.
+func splitSelector(selector string) []string {
+	var exprs []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				exprs = append(exprs, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(exprs, selector[start:])
+}
+
+func parseLabelRequirement(expr string) (*LabelRequirement, error) {
+	r := &LabelRequirement{}
+	var values []string
+
+	if m := selectorSetRegex.FindStringSubmatch(expr); m != nil {
+		if strings.TrimSpace(m[3]) == "" {
+			return nil, fmt.Errorf("empty value set in selector %q", expr)
+		}
+		r.Key, r.Operator, values = m[1], SelectorOperator(m[2]), strings.Split(m[3], ",")
+	} else if strings.HasPrefix(expr, "!") && !strings.ContainsAny(expr, "=:") {
+		r.Key, r.Operator = expr[1:], SelectorDoesNotExist
+	} else if idx := strings.Index(expr, "!="); idx >= 0 {
+		r.Key, r.Operator, values = expr[:idx], SelectorNotEquals, []string{expr[idx+2:]}
+	} else if idx := strings.Index(expr, "=="); idx >= 0 {
+		r.Key, r.Operator, values = expr[:idx], SelectorEquals, []string{expr[idx+2:]}
+	} else if idx := strings.IndexAny(expr, "=:"); idx >= 0 {
+		r.Key, r.Operator, values = expr[:idx], SelectorEquals, []string{expr[idx+1:]}
+	} else {
+		r.Key, r.Operator = expr, SelectorExists
+	}
+
+	r.Key = normalizeLabel(r.Key)
+	if !labelKeyRegex.MatchString(r.Key) {
+		return nil, fmt.Errorf("invalid label key %q in selector %q", r.Key, expr)
+	}
+	for _, v := range values {
+		v = normalizeLabel(v)
+		if !labelValueRegex.MatchString(v) {
+			return nil, fmt.Errorf("invalid label value %q in selector %q", v, expr)
+		}
+		r.Values = append(r.Values, v)
+	}
+	return r, nil
+}
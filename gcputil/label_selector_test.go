@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabelSelector(t *testing.T) {
+	labels := map[string]string{
+		"Env":  "Prod",
+		"tier": "web",
+		"team": "",
+	}
+
+	tests := map[string]struct {
+		Selector    string
+		Unmatched   []string
+		ShouldError bool
+	}{
+		"empty":              {Selector: ""},
+		"equals":             {Selector: "env=prod"},
+		"colon":              {Selector: "env:PROD"},
+		"double equals":      {Selector: "env==prod"},
+		"equals mismatch":    {Selector: "env=dev", Unmatched: []string{"env=dev"}},
+		"not equals":         {Selector: "env!=dev,missing!=x"},
+		"not equals match":   {Selector: "env!=prod", Unmatched: []string{"env!=prod"}},
+		"in":                 {Selector: "tier in (api, web)"},
+		"in mismatch":        {Selector: "tier in (api,db)", Unmatched: []string{"tier in (api,db)"}},
+		"notin":              {Selector: "tier notin (api,db),missing notin (x)"},
+		"exists":             {Selector: "team,env"},
+		"exists mismatch":    {Selector: "owner", Unmatched: []string{"owner"}},
+		"does not exist":     {Selector: "!owner"},
+		"does not exist bad": {Selector: "!team", Unmatched: []string{"!team"}},
+		"combined": {
+			Selector:  "env=prod, tier in (db), !team, owner",
+			Unmatched: []string{"!team", "owner", "tier in (db)"},
+		},
+		"invalid key":       {Selector: "1env=prod", ShouldError: true},
+		"invalid value":     {Selector: "env=prod.1", ShouldError: true},
+		"empty set":         {Selector: "tier in ()", ShouldError: true},
+		"key too long":      {Selector: "a123456789012345678901234567890123456789012345678901234567890123", ShouldError: true},
+		"invalid set value": {Selector: "tier in (web,a b)", ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			selector, err := ParseLabelSelector(test.Selector)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatalf("expected error parsing %q", test.Selector)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unmatched := selector.Unmatched(labels)
+			if !reflect.DeepEqual(unmatched, test.Unmatched) {
+				t.Fatalf("expected unmatched %v, got %v", test.Unmatched, unmatched)
+			}
+			if selector.Matches(labels) != (len(test.Unmatched) == 0) {
+				t.Fatal("Matches disagrees with Unmatched")
+			}
+
+			reparsed, err := ParseLabelSelector(selector.String())
+			if err != nil || !reflect.DeepEqual(reparsed, selector) {
+				t.Fatalf("round trip of %q failed: %v", selector.String(), err)
+			}
+		})
+	}
+}
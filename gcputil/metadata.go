@@ -0,0 +1,305 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMetadataHost is the documented address of the GCE metadata server.
+	// See https://cloud.google.com/compute/docs/metadata/overview
+	defaultMetadataHost = "169.254.169.254"
+
+	// metadataHostEnv overrides the metadata server host (and optional port),
+	// matching cloud.google.com/go/compute/metadata.
+	metadataHostEnv = "GCE_METADATA_HOST"
+
+	// metadataFlavorHeader is the header required on every request to the
+	// metadata server. Responses from the metadata server echo it back.
+	metadataFlavorHeader = "Metadata-Flavor"
+	metadataFlavorValue  = "Google"
+
+	// metadataURLPathPrefix is the path prefix for v1 metadata server requests.
+	metadataURLPathPrefix = "/computeMetadata/v1/"
+
+	// defaultMetadataServiceAccount is the alias of the default service account
+	// attached to the instance.
+	defaultMetadataServiceAccount = "default"
+
+	defaultMetadataMaxRetries   = 3
+	defaultMetadataRetryBackoff = 100 * time.Millisecond
+	defaultMetadataCallTimeout  = 5 * time.Second
+)
+
+var (
+	metadataTransportOnce sync.Once
+	metadataTransportV    *http.Transport
+)
+
+// metadataTransport returns the transport shared by the default metadata
+// clients. The metadata server is link-local, so requests to it must never be
+// sent through a proxy.
+func metadataTransport() *http.Transport {
+	metadataTransportOnce.Do(func() {
+		metadataTransportV = &http.Transport{
+			Proxy: nil,
+			DialContext: (&net.Dialer{
+				Timeout:   2 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			IdleConnTimeout: 60 * time.Second,
+		}
+	})
+	return metadataTransportV
+}
+
+// MetadataError is returned when the metadata server cannot be reached or
+// responds with an unexpected status.
+type MetadataError struct {
+	// Path is the metadata path that was requested.
+	Path string
+
+	// StatusCode is the HTTP status returned by the metadata server, or 0 if
+	// no response was received.
+	StatusCode int
+
+	// Attempts is the number of requests made before giving up.
+	Attempts int
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *MetadataError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("metadata server returned status %d for %q after %d attempt(s): %v", e.StatusCode, e.Path, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("unable to reach metadata server for %q after %d attempt(s): %v", e.Path, e.Attempts, e.Err)
+}
+
+func (e *MetadataError) Unwrap() error {
+	return e.Err
+}
+
+// NotFound reports whether the metadata server responded that the path does
+// not exist.
+func (e *MetadataError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+// MetadataClientOptions configures a MetadataClient.
+type MetadataClientOptions struct {
+	// HTTPClient is the client used for requests. Defaults to a client of a
+	// dedicated transport that, like cloud.google.com/go/compute/metadata,
+	// ignores proxy environment variables and dials the metadata server
+	// directly, without the package's default dialer, private access preset
+	// or transport options.
+	HTTPClient *http.Client
+
+	// Host is the metadata server host and optional port. Defaults to the
+	// GCE_METADATA_HOST environment variable, or 169.254.169.254.
+	Host string
+
+	// MaxRetries is the number of times a request failing with a network
+	// error or 5xx status is retried. Defaults to 3. A negative value
+	// disables retries.
+	MaxRetries int
+
+	// RetryNotFound, if set, also retries requests failing with a 404
+	// status, for values that only appear some time after the instance
+	// starts, e.g. attributes set by a startup script. Otherwise a missing
+	// path fails immediately.
+	RetryNotFound bool
+
+	// Timeout bounds each individual request to the metadata server.
+	// Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// MetadataClient is a client for the GCE metadata server. It is safe for
+// concurrent use.
+type MetadataClient struct {
+	httpClient    *http.Client
+	host          string
+	maxRetries    int
+	retryNotFound bool
+	backoff       time.Duration
+	timeout       time.Duration
+}
+
+// NewMetadataClient returns a MetadataClient that uses the given HTTP client.
+// If httpClient is nil, a default client is used.
+func NewMetadataClient(httpClient *http.Client) *MetadataClient {
+	return NewMetadataClientWithOptions(&MetadataClientOptions{
+		HTTPClient: httpClient,
+	})
+}
+
+// NewMetadataClientWithOptions returns a MetadataClient configured with the
+// given options. If opts is nil, defaults are used.
+func NewMetadataClientWithOptions(opts *MetadataClientOptions) *MetadataClient {
+	if opts == nil {
+		opts = &MetadataClientOptions{}
+	}
+
+	c := &MetadataClient{
+		httpClient:    opts.HTTPClient,
+		host:          opts.Host,
+		maxRetries:    opts.MaxRetries,
+		retryNotFound: opts.RetryNotFound,
+		backoff:       defaultMetadataRetryBackoff,
+		timeout:       opts.Timeout,
+	}
+	if c.httpClient == nil {
+		c.httpClient = withDefaultTracer(&http.Client{Transport: metadataTransport()})
+	}
+	if c.host == "" {
+		c.host = os.Getenv(metadataHostEnv)
+	}
+	if c.host == "" {
+		c.host = defaultMetadataHost
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = defaultMetadataMaxRetries
+	} else if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultMetadataCallTimeout
+	}
+	return c
+}
+
+// ProjectID returns the ID of the project the instance is running in.
+func (c *MetadataClient) ProjectID(ctx context.Context) (string, error) {
+	return c.getTrimmed(ctx, "project/project-id")
+}
+
+// NumericProjectID returns the numeric ID of the project the instance is running in.
+func (c *MetadataClient) NumericProjectID(ctx context.Context) (string, error) {
+	return c.getTrimmed(ctx, "project/numeric-project-id")
+}
+
+// ServiceAccountEmail returns the email of the service account with the given
+// alias attached to the instance. If account is empty, the default service
+// account is used.
+func (c *MetadataClient) ServiceAccountEmail(ctx context.Context, account string) (string, error) {
+	return c.getTrimmed(ctx, serviceAccountMetadataPath(account, "email"))
+}
+
+// Scopes returns the OAuth 2.0 scopes granted to the service account with the
+// given alias attached to the instance. If account is empty, the default
+// service account is used.
+func (c *MetadataClient) Scopes(ctx context.Context, account string) ([]string, error) {
+	body, err := c.Get(ctx, serviceAccountMetadataPath(account, "scopes"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(body), nil
+}
+
+// Hostname returns the fully qualified hostname of the instance.
+func (c *MetadataClient) Hostname(ctx context.Context) (string, error) {
+	return c.getTrimmed(ctx, "instance/hostname")
+}
+
+// Get returns the value of the given metadata path, relative to
+// /computeMetadata/v1/ (e.g. "instance/zone"). Network errors and 5xx
+// responses, and 404 responses if RetryNotFound is set, are retried a
+// bounded number of times, since the metadata server may be flaky during
+// instance startup. Failures are returned as a *MetadataError.
+func (c *MetadataClient) Get(ctx context.Context, path string) (string, error) {
+	metadataURL := c.url(path)
+
+	mdErr := &MetadataError{Path: path}
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				mdErr.Err = ctx.Err()
+				return "", mdErr
+			case <-time.After(c.backoff * time.Duration(attempt)):
+			}
+		}
+
+		mdErr.Attempts++
+		body, status, retry, err := c.get(ctx, metadataURL)
+		if err == nil {
+			return body, nil
+		}
+		mdErr.StatusCode = status
+		mdErr.Err = err
+		if !retry {
+			break
+		}
+	}
+	return "", mdErr
+}
+
+// get makes a single request to the metadata server, bounded by the client's
+// per-call timeout. It returns the response status and reports whether a
+// failed request may be retried.
+func (c *MetadataClient) get(ctx context.Context, metadataURL string) (string, int, bool, error) {
+	callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(callCtx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return "", 0, false, err
+	}
+	req.Header.Set(metadataFlavorHeader, metadataFlavorValue)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", 0, false, ctx.Err()
+		}
+		return "", 0, true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", resp.StatusCode, true, fmt.Errorf("unable to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= http.StatusInternalServerError || (resp.StatusCode == http.StatusNotFound && c.retryNotFound)
+		return "", resp.StatusCode, retry, errors.New(strings.TrimSpace(string(body)))
+	}
+	if resp.Header.Get(metadataFlavorHeader) != metadataFlavorValue {
+		return "", resp.StatusCode, false, errors.New("response is not from the metadata server (missing Metadata-Flavor header)")
+	}
+	return string(body), resp.StatusCode, false, nil
+}
+
+func (c *MetadataClient) getTrimmed(ctx context.Context, path string) (string, error) {
+	body, err := c.Get(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body), nil
+}
+
+func (c *MetadataClient) url(path string) string {
+	return "http://" + c.host + metadataURLPathPrefix + strings.TrimPrefix(path, "/")
+}
+
+func serviceAccountMetadataPath(account, suffix string) string {
+	if account == "" {
+		account = defaultMetadataServiceAccount
+	}
+	return fmt.Sprintf("instance/service-accounts/%s/%s", url.PathEscape(account), suffix)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// IdentityTokenFormatStandard requests an instance identity token without
+	// the google.compute_engine claims.
+	IdentityTokenFormatStandard = "standard"
+
+	// IdentityTokenFormatFull requests an instance identity token that
+	// includes the google.compute_engine claims (project, zone, instance),
+	// as required by the Vault GCE auth method.
+	IdentityTokenFormatFull = "full"
+)
+
+// GetInstanceIdentityToken returns a signed instance identity token for the
+// default service account from the metadata server. See
+// InstanceIdentityToken for details on the parameters.
+func GetInstanceIdentityToken(ctx context.Context, audience, format string, licenses bool) (string, error) {
+	return NewMetadataClient(nil).InstanceIdentityToken(ctx, "", audience, format, licenses)
+}
+
+// InstanceIdentityToken returns a signed instance identity token (a JWT) for
+// the service account with the given alias, or the default service account if
+// account is empty. The audience is required. Format is either
+// IdentityTokenFormatStandard or IdentityTokenFormatFull, defaulting to
+// standard if empty. Licenses may only be requested with the full format.
+//
+// See https://cloud.google.com/compute/docs/instances/verifying-instance-identity
+func (c *MetadataClient) InstanceIdentityToken(ctx context.Context, account, audience, format string, licenses bool) (string, error) {
+	if audience == "" {
+		return "", errors.New("audience is required to obtain an instance identity token")
+	}
+	if format == "" {
+		format = IdentityTokenFormatStandard
+	}
+	if format != IdentityTokenFormatStandard && format != IdentityTokenFormatFull {
+		return "", fmt.Errorf("invalid identity token format %q, must be %q or %q", format, IdentityTokenFormatStandard, IdentityTokenFormatFull)
+	}
+	if licenses && format != IdentityTokenFormatFull {
+		return "", fmt.Errorf("licenses can only be included in identity tokens with format %q", IdentityTokenFormatFull)
+	}
+
+	params := url.Values{
+		"audience": {audience},
+		"format":   {format},
+	}
+	if licenses {
+		params.Set("licenses", "TRUE")
+	}
+
+	token, err := c.Get(ctx, serviceAccountMetadataPath(account, "identity")+"?"+params.Encode())
+	if err != nil {
+		return "", fmt.Errorf("unable to obtain instance identity token: %v", err)
+	}
+	return strings.TrimSpace(token), nil
+}
@@ -0,0 +1,132 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestMetadataClient_InstanceIdentityToken(t *testing.T) {
+	type params struct {
+		audience, format string
+		licenses         bool
+	}
+
+	tests := map[string]struct {
+		Account     string
+		Audience    string
+		Format      string
+		Licenses    bool
+		TokenErr    error
+		Expected    params
+		ShouldError bool
+	}{
+		"default format": {
+			Audience: "https://vault.example.com",
+			Expected: params{audience: "https://vault.example.com", format: IdentityTokenFormatStandard},
+		},
+		"full format": {
+			Audience: "vault/role",
+			Format:   IdentityTokenFormatFull,
+			Expected: params{audience: "vault/role", format: IdentityTokenFormatFull},
+		},
+		"full format with licenses": {
+			Audience: "vault/role",
+			Format:   IdentityTokenFormatFull,
+			Licenses: true,
+			Expected: params{audience: "vault/role", format: IdentityTokenFormatFull, licenses: true},
+		},
+		"service account alias": {
+			Account:  testutil.DefaultMetadataServiceAccount,
+			Audience: "vault/role",
+			Expected: params{audience: "vault/role", format: IdentityTokenFormatStandard},
+		},
+		"missing audience": {
+			ShouldError: true,
+		},
+		"invalid format": {
+			Audience:    "vault/role",
+			Format:      "compact",
+			ShouldError: true,
+		},
+		"licenses with standard format": {
+			Audience:    "vault/role",
+			Licenses:    true,
+			ShouldError: true,
+		},
+		"unknown service account": {
+			Account:     "other@test-project.iam.gserviceaccount.com",
+			Audience:    "vault/role",
+			ShouldError: true,
+		},
+		"metadata server error": {
+			Audience:    "vault/role",
+			TokenErr:    errors.New("identity unavailable"),
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			md := testutil.NewMetadataServer(t)
+			var got *params
+			md.SetIdentityTokenFunc(func(audience, format string, licenses bool) (string, error) {
+				got = &params{audience: audience, format: format, licenses: licenses}
+				return "identity-token\n", test.TokenErr
+			})
+			c := NewMetadataClientWithOptions(&MetadataClientOptions{Host: md.Host(), MaxRetries: -1})
+
+			token, err := c.InstanceIdentityToken(context.Background(), test.Account, test.Audience, test.Format, test.Licenses)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if test.TokenErr == nil && got != nil {
+					t.Fatalf("expected no identity token request, got %+v", *got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != "identity-token" {
+				t.Fatalf("expected trimmed token, got %q", token)
+			}
+			if got == nil || *got != test.Expected {
+				t.Fatalf("expected parameters %+v, got %+v", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestGetInstanceIdentityToken(t *testing.T) {
+	md := testutil.NewMetadataServer(t)
+	md.SetEnv(t)
+
+	token, err := GetInstanceIdentityToken(context.Background(), "vault/role", IdentityTokenFormatFull, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == "" {
+		t.Fatal("expected an identity token")
+	}
+
+	reqs := md.Requests()
+	req := reqs[len(reqs)-1]
+	query := req.URL.Query()
+	if req.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/identity" {
+		t.Fatalf("unexpected path %q", req.URL.Path)
+	}
+	if query.Get("audience") != "vault/role" || query.Get("format") != IdentityTokenFormatFull || query.Get("licenses") != "TRUE" {
+		t.Fatalf("unexpected query %q", req.URL.RawQuery)
+	}
+
+	if _, err := GetInstanceIdentityToken(context.Background(), "", "", false); err == nil {
+		t.Fatal("expected error without audience")
+	}
+}
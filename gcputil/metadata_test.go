@@ -0,0 +1,221 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMetadataClient(t *testing.T, handler http.HandlerFunc) *MetadataClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	t.Setenv(metadataHostEnv, strings.TrimPrefix(srv.URL, "http://"))
+	c := NewMetadataClient(srv.Client())
+	c.backoff = 0
+	return c
+}
+
+func TestMetadataClient_Get(t *testing.T) {
+	values := map[string]string{
+		"project/project-id":                          "my-project",
+		"project/numeric-project-id":                  "1234567890\n",
+		"instance/hostname":                           "vm.c.my-project.internal",
+		"instance/service-accounts/default/email":     "sa@my-project.iam.gserviceaccount.com",
+		"instance/service-accounts/default/scopes":    "https://www.googleapis.com/auth/cloud-platform\nhttps://www.googleapis.com/auth/userinfo.email\n",
+		"instance/service-accounts/other@x.com/email": "other@x.com",
+	}
+
+	c := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(metadataFlavorHeader) != metadataFlavorValue {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		v, ok := values[strings.TrimPrefix(r.URL.Path, metadataURLPathPrefix)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(metadataFlavorHeader, metadataFlavorValue)
+		w.Write([]byte(v))
+	})
+
+	ctx := context.Background()
+	if v, err := c.ProjectID(ctx); err != nil || v != "my-project" {
+		t.Errorf("ProjectID: expected my-project, got %q (err: %v)", v, err)
+	}
+	if v, err := c.NumericProjectID(ctx); err != nil || v != "1234567890" {
+		t.Errorf("NumericProjectID: expected 1234567890, got %q (err: %v)", v, err)
+	}
+	if v, err := c.Hostname(ctx); err != nil || v != "vm.c.my-project.internal" {
+		t.Errorf("Hostname: expected vm.c.my-project.internal, got %q (err: %v)", v, err)
+	}
+	if v, err := c.ServiceAccountEmail(ctx, ""); err != nil || v != "sa@my-project.iam.gserviceaccount.com" {
+		t.Errorf("ServiceAccountEmail: unexpected %q (err: %v)", v, err)
+	}
+	if v, err := c.ServiceAccountEmail(ctx, "other@x.com"); err != nil || v != "other@x.com" {
+		t.Errorf("ServiceAccountEmail(other@x.com): unexpected %q (err: %v)", v, err)
+	}
+	scopes, err := c.Scopes(ctx, "")
+	if err != nil || len(scopes) != 2 {
+		t.Errorf("Scopes: expected 2 scopes, got %v (err: %v)", scopes, err)
+	}
+	if _, err := c.Get(ctx, "instance/missing"); err == nil {
+		t.Errorf("expected error for missing path")
+	}
+}
+
+func TestMetadataClient_GetRetries(t *testing.T) {
+	calls := 0
+	c := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(metadataFlavorHeader, metadataFlavorValue)
+		w.Write([]byte("my-project"))
+	})
+
+	v, err := c.ProjectID(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != "my-project" || calls != 3 {
+		t.Errorf("expected my-project after 3 calls, got %q after %d calls", v, calls)
+	}
+}
+
+func TestMetadataClient_GetError(t *testing.T) {
+	tests := map[string]struct {
+		Status        int
+		RetryNotFound bool
+		Attempts      int
+	}{
+		"not found": {
+			Status:   http.StatusNotFound,
+			Attempts: 1,
+		},
+		"not found retried": {
+			Status:        http.StatusNotFound,
+			RetryNotFound: true,
+			Attempts:      defaultMetadataMaxRetries + 1,
+		},
+		"server error": {
+			Status:   http.StatusInternalServerError,
+			Attempts: defaultMetadataMaxRetries + 1,
+		},
+		"forbidden": {
+			Status:   http.StatusForbidden,
+			Attempts: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(test.Status)
+			}))
+			t.Cleanup(srv.Close)
+			c := NewMetadataClientWithOptions(&MetadataClientOptions{
+				HTTPClient:    srv.Client(),
+				Host:          strings.TrimPrefix(srv.URL, "http://"),
+				RetryNotFound: test.RetryNotFound,
+			})
+			c.backoff = 0
+
+			_, err := c.Get(context.Background(), "instance/attributes/missing")
+			var mdErr *MetadataError
+			if !errors.As(err, &mdErr) {
+				t.Fatalf("expected *MetadataError, got %T: %v", err, err)
+			}
+			if mdErr.StatusCode != test.Status || mdErr.NotFound() != (test.Status == http.StatusNotFound) {
+				t.Errorf("expected status %d, got %d", test.Status, mdErr.StatusCode)
+			}
+			if mdErr.Attempts != test.Attempts || calls != mdErr.Attempts {
+				t.Errorf("expected %d attempts, got %d (%d calls)", test.Attempts, mdErr.Attempts, calls)
+			}
+		})
+	}
+}
+
+func TestMetadataClient_RejectsMissingFlavorHeader(t *testing.T) {
+	c := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not-metadata"))
+	})
+
+	if _, err := c.ProjectID(context.Background()); err == nil {
+		t.Errorf("expected error for response without Metadata-Flavor header")
+	}
+}
+
+func TestMetadataClient_IgnoresProxyEnvironment(t *testing.T) {
+	proxied := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		w.Header().Set(metadataFlavorHeader, metadataFlavorValue)
+		w.Write([]byte("proxied-project"))
+	}))
+	t.Cleanup(proxy.Close)
+	for _, env := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		t.Setenv(env, proxy.URL)
+	}
+	for _, env := range []string{"NO_PROXY", "no_proxy"} {
+		t.Setenv(env, "")
+	}
+
+	c := NewMetadataClientWithOptions(&MetadataClientOptions{
+		Host:       "metadata.invalid",
+		MaxRetries: -1,
+		Timeout:    time.Second,
+	})
+	if transport := c.httpClient.Transport.(*defaultTracingTransport).base.(*http.Transport); transport.Proxy != nil {
+		t.Fatal("expected the metadata transport not to use a proxy")
+	}
+	if _, err := c.ProjectID(context.Background()); err == nil {
+		t.Error("expected error for an unreachable metadata server")
+	}
+	if proxied != 0 {
+		t.Errorf("expected no requests through the proxy, got %d", proxied)
+	}
+}
+
+func TestMetadataTokenSource(t *testing.T) {
+	calls := 0
+	c := newTestMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != metadataURLPathPrefix+"instance/service-accounts/sa@x.com/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if scopes := r.URL.Query().Get("scopes"); scopes != "a,b" {
+			t.Errorf("expected scopes a,b, got %q", scopes)
+		}
+		w.Header().Set(metadataFlavorHeader, metadataFlavorValue)
+		w.Write([]byte(`{"access_token":"tok","expires_in":3599,"token_type":"Bearer"}`))
+	})
+
+	ts := NewMetadataTokenSource(c, "sa@x.com", "a", "b")
+	for i := 0; i < 2; i++ {
+		tok, err := ts.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tok.AccessToken != "tok" || tok.Expiry.IsZero() {
+			t.Errorf("unexpected token: %+v", tok)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected token to be cached, got %d calls", calls)
+	}
+}
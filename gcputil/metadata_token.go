@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// metadataProbeTimeout bounds how long FindCredentials waits for the
+// metadata server before concluding it is not running on GCP.
+const metadataProbeTimeout = 2 * time.Second
+
+// MetadataTokenSource is an oauth2.TokenSource that obtains access tokens for
+// a service account attached to a GCE instance or GKE node from the metadata
+// server. Tokens are cached until shortly before they expire.
+type MetadataTokenSource struct {
+	client  *MetadataClient
+	account string
+	scopes  []string
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+var _ oauth2.TokenSource = &MetadataTokenSource{}
+
+// NewMetadataTokenSource returns a MetadataTokenSource for the service
+// account with the given alias (an email, or "default" if empty). If scopes
+// are given, they are requested from the metadata server; otherwise the
+// scopes the instance was granted are used. If client is nil, a default
+// MetadataClient is used.
+func NewMetadataTokenSource(client *MetadataClient, account string, scopes ...string) *MetadataTokenSource {
+	if client == nil {
+		client = NewMetadataClient(nil)
+	}
+	if account == "" {
+		account = defaultMetadataServiceAccount
+	}
+	return &MetadataTokenSource{
+		client:  client,
+		account: account,
+		scopes:  scopes,
+	}
+}
+
+// Account returns the service account alias the token source was created for.
+func (ts *MetadataTokenSource) Account() string {
+	return ts.account
+}
+
+// Token returns a cached token if it is still valid, or fetches a new one
+// from the metadata server.
+func (ts *MetadataTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token.Valid() {
+		return ts.token, nil
+	}
+
+	tok, err := ts.fetch(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	ts.token = tok
+	return tok, nil
+}
+
+func (ts *MetadataTokenSource) fetch(ctx context.Context) (*oauth2.Token, error) {
+	path := serviceAccountMetadataPath(ts.account, "token")
+	if len(ts.scopes) > 0 {
+		path += "?" + url.Values{"scopes": {strings.Join(ts.scopes, ",")}}.Encode()
+	}
+
+	body, err := ts.client.Get(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain token for service account %q from metadata server: %v", ts.account, err)
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil, fmt.Errorf("unable to decode metadata server token response: %v", err)
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("metadata server returned an empty access token for service account %q", ts.account)
+	}
+
+	tok := &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   resp.TokenType,
+	}
+	if resp.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+// metadataCredentials returns credentials for the default service account
+// from the metadata server, or an error if the metadata server is not
+// reachable within metadataProbeTimeout. On App Engine, the metadata server
+// is used without probing.
+func metadataCredentials(ctx context.Context, scopes ...string) (*GcpCredentials, *MetadataTokenSource, error) {
+	client := NewMetadataClient(nil)
+	email, err := metadataProbeClient(client).ServiceAccountEmail(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	creds := &GcpCredentials{
+		ClientEmail: email,
+	}
+	if project, err := client.ProjectID(ctx); err == nil {
+		creds.ProjectId = project
+	}
+	return creds, NewMetadataTokenSource(client, "", scopes...), nil
+}
+
+// metadataProbeClient returns a client that fails fast if no metadata server
+// is available. App Engine always provides the metadata server, so it does
+// not need to be probed for and client is returned.
+func metadataProbeClient(client *MetadataClient) *MetadataClient {
+	if _, ok := DetectAppEngine(); ok {
+		return client
+	}
+	return NewMetadataClientWithOptions(&MetadataClientOptions{
+		MaxRetries: -1,
+		Timeout:    metadataProbeTimeout,
+	})
+}
@@ -0,0 +1,290 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+)
+
+const (
+	defaultMonitoringExportInterval = time.Minute
+	defaultMonitoringMetricPrefix   = "custom.googleapis.com"
+
+	// maxTimeSeriesPerRequest is the limit of timeSeries.create.
+	maxTimeSeriesPerRequest = 200
+)
+
+// MonitoringExporterOptions configures a MonitoringExporter.
+type MonitoringExporterOptions struct {
+	// Project is the project metrics are written to. It is required.
+	Project string
+
+	// Interval is the time between exports. Cloud Monitoring accepts at
+	// most one point per time series every 5 seconds. Defaults to one
+	// minute.
+	Interval time.Duration
+
+	// MetricPrefix is prepended to metric names. Defaults to
+	// "custom.googleapis.com".
+	MetricPrefix string
+
+	// Resource is the monitored resource metrics are attributed to.
+	// Defaults to the "global" resource of Project.
+	Resource *monitoring.MonitoredResource
+
+	// OnError, if set, is called when a background export fails.
+	OnError func(error)
+}
+
+// MonitoringExporter is a MetricsSink that publishes the client's metrics as
+// Cloud Monitoring custom metrics, using the client's credentials. Counters
+// are written as cumulative INT64 metrics, and latencies as GAUGE DOUBLE
+// metrics of the mean latency in milliseconds over each export interval.
+// Metric names are the metric key joined with "/", e.g.
+// custom.googleapis.com/gcputil/sts_exchange/retry. For each cache with
+// cache_hit and cache_miss counters, e.g. gcputil/scoped_token, the hit
+// rate since the exporter was created is also written as a GAUGE DOUBLE
+// cache_hit_rate metric between 0 and 1.
+type MonitoringExporter struct {
+	opts    MonitoringExporterOptions
+	service *monitoring.Service
+	start   time.Time
+
+	mu        sync.Mutex
+	counters  map[string]int64
+	latencies map[string]*latencyStats
+
+	runMu  sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type latencyStats struct {
+	count int64
+	total time.Duration
+}
+
+var _ MetricsSink = &MonitoringExporter{}
+
+// ExportMetrics returns a MonitoringExporter for the client's metrics, and
+// registers it with the client in addition to Options.Metrics. Exports run
+// in the background once Start is called.
+func (c *Client) ExportMetrics(ctx context.Context, opts *MonitoringExporterOptions) (*MonitoringExporter, error) {
+	if opts == nil || opts.Project == "" {
+		return nil, errors.New("project is required to export metrics")
+	}
+
+	e := &MonitoringExporter{
+		opts:      *opts,
+		start:     time.Now(),
+		counters:  map[string]int64{},
+		latencies: map[string]*latencyStats{},
+	}
+	if e.opts.Interval <= 0 {
+		e.opts.Interval = defaultMonitoringExportInterval
+	}
+	if e.opts.MetricPrefix == "" {
+		e.opts.MetricPrefix = defaultMonitoringMetricPrefix
+	}
+	if e.opts.Resource == nil {
+		e.opts.Resource = &monitoring.MonitoredResource{
+			Type:   "global",
+			Labels: map[string]string{"project_id": e.opts.Project},
+		}
+	}
+
+	var err error
+	e.service, err = monitoring.NewService(ctx, option.WithHTTPClient(c.authClient), option.WithEndpoint(c.endpointsFor(ctx).Monitoring))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Cloud Monitoring client: %v", err)
+	}
+	c.exporter.Store(e)
+	return e, nil
+}
+
+// IncrCounter adds val to the counter with the given key.
+func (e *MonitoringExporter) IncrCounter(key []string, val float32) {
+	name := e.metricType(key)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counters[name] += int64(val)
+}
+
+// MeasureSince records the time elapsed since start for the given key.
+func (e *MonitoringExporter) MeasureSince(key []string, start time.Time) {
+	name := e.metricType(append(key[:len(key):len(key)], "latency_ms"))
+	elapsed := time.Since(start)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.latencies[name]
+	if !ok {
+		s = &latencyStats{}
+		e.latencies[name] = s
+	}
+	s.count++
+	s.total += elapsed
+}
+
+// Flush writes the current metrics to Cloud Monitoring. Latencies that were
+// not written because of an error are kept for the next flush.
+func (e *MonitoringExporter) Flush(ctx context.Context) error {
+	series, latencies := e.collect(time.Now())
+	for len(series) > 0 {
+		n := len(series)
+		if n > maxTimeSeriesPerRequest {
+			n = maxTimeSeriesPerRequest
+		}
+		req := &monitoring.CreateTimeSeriesRequest{TimeSeries: series[:n]}
+		if _, err := e.service.Projects.TimeSeries.Create("projects/"+e.opts.Project, req).Context(ctx).Do(); err != nil {
+			e.restoreLatencies(series, latencies)
+			return fmt.Errorf("unable to write metrics to Cloud Monitoring: %v", err)
+		}
+		series = series[n:]
+	}
+	return nil
+}
+
+// restoreLatencies merges the latencies of the unsent series back into the
+// exporter, so that they are included in the next collection.
+func (e *MonitoringExporter) restoreLatencies(unsent []*monitoring.TimeSeries, latencies map[string]*latencyStats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, series := range unsent {
+		name := series.Metric.Type
+		collected, ok := latencies[name]
+		if !ok {
+			continue
+		}
+		if s, ok := e.latencies[name]; ok {
+			s.count += collected.count
+			s.total += collected.total
+		} else {
+			e.latencies[name] = collected
+		}
+	}
+}
+
+// collect returns a time series for each counter and for each latency
+// measured since the previous collection, and resets the latencies. The
+// collected latencies are returned, to be restored if the export fails.
+func (e *MonitoringExporter) collect(now time.Time) ([]*monitoring.TimeSeries, map[string]*latencyStats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	end := now.UTC().Format(time.RFC3339Nano)
+	start := e.start.UTC().Format(time.RFC3339Nano)
+
+	var series []*monitoring.TimeSeries
+	for name, count := range e.counters {
+		v := count
+		series = append(series, &monitoring.TimeSeries{
+			Metric:     &monitoring.Metric{Type: name},
+			Resource:   e.opts.Resource,
+			MetricKind: "CUMULATIVE",
+			ValueType:  "INT64",
+			Points: []*monitoring.Point{{
+				Interval: &monitoring.TimeInterval{StartTime: start, EndTime: end},
+				Value:    &monitoring.TypedValue{Int64Value: &v},
+			}},
+		})
+	}
+	for name, s := range e.latencies {
+		mean := float64(s.total) / float64(s.count) / float64(time.Millisecond)
+		series = append(series, &monitoring.TimeSeries{
+			Metric:     &monitoring.Metric{Type: name},
+			Resource:   e.opts.Resource,
+			MetricKind: "GAUGE",
+			ValueType:  "DOUBLE",
+			Unit:       "ms",
+			Points: []*monitoring.Point{{
+				Interval: &monitoring.TimeInterval{EndTime: end},
+				Value:    &monitoring.TypedValue{DoubleValue: &mean},
+			}},
+		})
+	}
+	latencies := e.latencies
+	e.latencies = map[string]*latencyStats{}
+
+	caches := map[string]bool{}
+	for name := range e.counters {
+		if base := strings.TrimSuffix(name, "/cache_hit"); base != name {
+			caches[base] = true
+		} else if base := strings.TrimSuffix(name, "/cache_miss"); base != name {
+			caches[base] = true
+		}
+	}
+	for base := range caches {
+		hits, misses := e.counters[base+"/cache_hit"], e.counters[base+"/cache_miss"]
+		if hits+misses == 0 {
+			continue
+		}
+		rate := float64(hits) / float64(hits+misses)
+		series = append(series, &monitoring.TimeSeries{
+			Metric:     &monitoring.Metric{Type: base + "/cache_hit_rate"},
+			Resource:   e.opts.Resource,
+			MetricKind: "GAUGE",
+			ValueType:  "DOUBLE",
+			Points: []*monitoring.Point{{
+				Interval: &monitoring.TimeInterval{EndTime: end},
+				Value:    &monitoring.TypedValue{DoubleValue: &rate},
+			}},
+		})
+	}
+
+	sort.Slice(series, func(i, j int) bool { return series[i].Metric.Type < series[j].Metric.Type })
+	return series, latencies
+}
+
+func (e *MonitoringExporter) metricType(key []string) string {
+	return e.opts.MetricPrefix + "/" + strings.Join(key, "/")
+}
+
+// Start exports metrics every interval until Stop is called or ctx is done.
+func (e *MonitoringExporter) Start(ctx context.Context) {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+	if e.cancel != nil {
+		return
+	}
+
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(e.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := e.Flush(ctx); err != nil && ctx.Err() == nil && e.opts.OnError != nil {
+				e.opts.OnError(err)
+			}
+		}
+	}(e.done)
+}
+
+// Stop stops background exports and waits for a running export to finish.
+func (e *MonitoringExporter) Stop() {
+	e.runMu.Lock()
+	cancel, done := e.cancel, e.done
+	e.cancel, e.done = nil, nil
+	e.runMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+)
+
+func TestMonitoringExporter(t *testing.T) {
+	var written []*monitoring.TimeSeries
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/projects/p/timeSeries" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req monitoring.CreateTimeSeriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		written = append(written, req.TimeSeries...)
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{Monitoring: srv.URL}})
+	e, err := c.ExportMetrics(context.Background(), &MonitoringExporterOptions{Project: "p"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.measure("sts_exchange", time.Now().Add(-10*time.Millisecond))
+	c.incrRetry("sts_exchange")
+	c.incrRetry("sts_exchange")
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("expected 2 time series, got %d", len(written))
+	}
+	latency, retries := written[0], written[1]
+	if latency.Metric.Type != "custom.googleapis.com/gcputil/sts_exchange/latency_ms" || latency.MetricKind != "GAUGE" || *latency.Points[0].Value.DoubleValue < 10 {
+		t.Errorf("unexpected latency series %+v", latency)
+	}
+	if retries.Metric.Type != "custom.googleapis.com/gcputil/sts_exchange/retry" || retries.MetricKind != "CUMULATIVE" || *retries.Points[0].Value.Int64Value != 2 {
+		t.Errorf("unexpected retry series %+v", retries)
+	}
+	if retries.Resource.Type != "global" || retries.Resource.Labels["project_id"] != "p" {
+		t.Errorf("unexpected resource %+v", retries.Resource)
+	}
+
+	// Latencies are reset after each export; counters are cumulative.
+	written = nil
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(written) != 1 || *written[0].Points[0].Value.Int64Value != 2 {
+		t.Errorf("expected only the cumulative counter, got %+v", written)
+	}
+}
+
+func TestMonitoringExporter_failedExportKeepsLatencies(t *testing.T) {
+	var requests int
+	var written []*monitoring.TimeSeries
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The second batch of the first flush fails.
+		if requests == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var req monitoring.CreateTimeSeriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		written = append(written, req.TimeSeries...)
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{Monitoring: srv.URL}})
+	e, err := c.ExportMetrics(context.Background(), &MonitoringExporterOptions{Project: "p"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	total := maxTimeSeriesPerRequest + 50
+	for i := 0; i < total; i++ {
+		c.measure(fmt.Sprintf("op%03d", i), time.Now())
+	}
+	if err := e.Flush(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(written) != maxTimeSeriesPerRequest {
+		t.Fatalf("expected %d time series to be written, got %d", maxTimeSeriesPerRequest, len(written))
+	}
+
+	// Only the latencies of the failed batch are exported again.
+	written = nil
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(written) != total-maxTimeSeriesPerRequest {
+		t.Fatalf("expected %d time series to be written, got %d", total-maxTimeSeriesPerRequest, len(written))
+	}
+	if name := written[0].Metric.Type; name != fmt.Sprintf("custom.googleapis.com/gcputil/op%03d/latency_ms", maxTimeSeriesPerRequest) {
+		t.Errorf("unexpected first restored series %q", name)
+	}
+}
+
+func TestMonitoringExporter_cacheHitRate(t *testing.T) {
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{Monitoring: "http://127.0.0.1:0"}})
+	e, err := c.ExportMetrics(context.Background(), &MonitoringExporterOptions{Project: "p"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, hit := range []bool{true, true, true, false} {
+		c.incrCache("token_info", hit)
+	}
+	c.incrCache("id_token_source", false)
+
+	rates := map[string]float64{}
+	collected, _ := e.collect(time.Now())
+	for _, series := range collected {
+		if series.MetricKind == "GAUGE" {
+			rates[series.Metric.Type] = *series.Points[0].Value.DoubleValue
+		}
+	}
+	expected := map[string]float64{
+		"custom.googleapis.com/gcputil/token_info/cache_hit_rate":      0.75,
+		"custom.googleapis.com/gcputil/id_token_source/cache_hit_rate": 0,
+	}
+	if !reflect.DeepEqual(rates, expected) {
+		t.Fatalf("expected hit rates %v, got %v", expected, rates)
+	}
+}
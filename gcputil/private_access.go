@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PrivateAccessPreset routes all Google API traffic through one of the
+// Private Google Access virtual IP ranges, as used with VPC Service Controls.
+// The preset keeps the standard *.googleapis.com endpoints, so TLS server
+// names are unchanged, and dials the VIP addresses in place of resolving the
+// hostnames, equivalent to the documented DNS configuration. A preset is
+// used by a single Client with Options.PrivateAccess, or process-wide with
+// SetDefaultPrivateAccess.
+//
+// See https://cloud.google.com/vpc/docs/configure-private-google-access#domain-options
+type PrivateAccessPreset string
+
+const (
+	// PrivateGoogleAccess routes traffic through private.googleapis.com
+	// (199.36.153.8/30), which supports most Google APIs.
+	PrivateGoogleAccess PrivateAccessPreset = "private.googleapis.com"
+
+	// RestrictedGoogleAccess routes traffic through restricted.googleapis.com
+	// (199.36.153.4/30), which only supports APIs covered by VPC Service
+	// Controls.
+	RestrictedGoogleAccess PrivateAccessPreset = "restricted.googleapis.com"
+)
+
+var privateAccessVIPs = map[PrivateAccessPreset][]string{
+	PrivateGoogleAccess:    {"199.36.153.8", "199.36.153.9", "199.36.153.10", "199.36.153.11"},
+	RestrictedGoogleAccess: {"199.36.153.4", "199.36.153.5", "199.36.153.6", "199.36.153.7"},
+}
+
+// SetDefaultPrivateAccess routes the *.googleapis.com traffic of the HTTP
+// clients this package creates through the preset's VIPs: that of the
+// package-level functions, including token sources they return, of
+// MetadataClients, and of Clients created without Options.HTTPClient. It
+// does not apply to clients set with SetDefaultHTTPClient. An empty preset
+// restores direct connections. It is safe for concurrent use. The
+// package-level functions use the preset from their next call; Clients only
+// if created afterwards.
+func SetDefaultPrivateAccess(p PrivateAccessPreset) error {
+	if p != "" {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	defaultDialerMu.Lock()
+	defaultPrivateAccessV = p
+	defaultDialerMu.Unlock()
+	resetPackageTransport()
+	return nil
+}
+
+func defaultPrivateAccess() PrivateAccessPreset {
+	defaultDialerMu.RLock()
+	defer defaultDialerMu.RUnlock()
+	return defaultPrivateAccessV
+}
+
+// Validate checks that the preset is known.
+func (p PrivateAccessPreset) Validate() error {
+	if _, ok := privateAccessVIPs[p]; !ok {
+		return fmt.Errorf("unknown private access preset %q, must be %q or %q", p, PrivateGoogleAccess, RestrictedGoogleAccess)
+	}
+	return nil
+}
+
+// DialContext returns a dial function that connects to the preset's VIPs
+// for *.googleapis.com hosts, trying each VIP in turn, and uses dial for all
+// other addresses. If dial is nil, a default net.Dialer is used.
+func (p PrivateAccessPreset) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		dial = dialer.DialContext
+	}
+	vips := privateAccessVIPs[p]
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || !isGoogleAPIsHost(host) {
+			return dial(ctx, network, addr)
+		}
+
+		var lastErr error
+		for _, vip := range vips {
+			conn, err := dial(ctx, network, net.JoinHostPort(vip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, fmt.Errorf("unable to connect to %s through %s: %v", host, p, lastErr)
+	}
+}
+
+// Transport returns a copy of base that routes *.googleapis.com traffic
+// through the preset's VIPs. Base must be an *http.Transport; if nil,
+// http.DefaultTransport is used.
+func (p PrivateAccessPreset) Transport(base http.RoundTripper) (http.RoundTripper, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	t, ok := transportOrDefault(base).(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("private access preset requires an *http.Transport, got %T", base)
+	}
+	t = t.Clone()
+	t.DialContext = p.DialContext(t.DialContext)
+	return t, nil
+}
+
+func isGoogleAPIsHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host == "googleapis.com" || strings.HasSuffix(host, ".googleapis.com")
+}
@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestPrivateAccessPreset_DialContext(t *testing.T) {
+	tests := map[string]struct {
+		Preset   PrivateAccessPreset
+		Addr     string
+		Expected []string
+	}{
+		"private googleapis host": {
+			Preset:   PrivateGoogleAccess,
+			Addr:     "iam.googleapis.com:443",
+			Expected: []string{"199.36.153.8:443", "199.36.153.9:443", "199.36.153.10:443", "199.36.153.11:443"},
+		},
+		"restricted googleapis host": {
+			Preset:   RestrictedGoogleAccess,
+			Addr:     "STS.googleapis.com.:443",
+			Expected: []string{"199.36.153.4:443", "199.36.153.5:443", "199.36.153.6:443", "199.36.153.7:443"},
+		},
+		"other host": {
+			Preset:   PrivateGoogleAccess,
+			Addr:     "example.com:443",
+			Expected: []string{"example.com:443"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var dialed []string
+			dial := tc.Preset.DialContext(func(_ context.Context, _, addr string) (net.Conn, error) {
+				dialed = append(dialed, addr)
+				return nil, errors.New("refused")
+			})
+			if _, err := dial(context.Background(), "tcp", tc.Addr); err == nil {
+				t.Fatalf("expected error")
+			}
+			if !reflect.DeepEqual(dialed, tc.Expected) {
+				t.Errorf("expected dials to %v, got %v", tc.Expected, dialed)
+			}
+		})
+	}
+}
+
+func TestPrivateAccessPreset_Validate(t *testing.T) {
+	if err := PrivateGoogleAccess.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := PrivateAccessPreset("public").Validate(); err == nil {
+		t.Errorf("expected error for unknown preset")
+	}
+}
+
+func TestSetDefaultPrivateAccess(t *testing.T) {
+	var mu sync.Mutex
+	var dialed []string
+	SetDefaultDialer(func(_ context.Context, _, addr string) (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dialed = append(dialed, addr)
+		return nil, errors.New("refused")
+	}, nil)
+	defer SetDefaultDialer(nil, nil)
+	if err := SetDefaultPrivateAccess(RestrictedGoogleAccess); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDefaultPrivateAccess("")
+
+	// Package-level calls are routed through the VIPs.
+	if _, err := packageHTTPClient().Get("https://sts.googleapis.com/v1/token"); err == nil {
+		t.Fatal("expected error")
+	}
+	mu.Lock()
+	got := dialed
+	mu.Unlock()
+	if len(got) == 0 || got[0] != "199.36.153.4:443" {
+		t.Fatalf("expected a dial to a restricted VIP, got %v", got)
+	}
+
+	// So are those of Clients with their own dialer.
+	c, err := NewClient(context.Background(), &Options{
+		TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+		DialContext: (&net.Dialer{}).DialContext,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.opts.PrivateAccess != RestrictedGoogleAccess {
+		t.Fatalf("expected the default preset, got %q", c.opts.PrivateAccess)
+	}
+
+	if err := SetDefaultPrivateAccess("public"); err == nil {
+		t.Fatal("expected error for unknown preset")
+	}
+}
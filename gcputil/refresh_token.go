@@ -0,0 +1,180 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// defaultOAuth2TokenURL is Google's OAuth 2.0 token endpoint.
+const defaultOAuth2TokenURL = "https://oauth2.googleapis.com/token"
+
+// ErrRefreshTokenRevoked is returned by refresh token sources when Google
+// rejects the refresh token, e.g. because it was revoked, expired, or the
+// user changed their password. A new refresh token is required.
+var ErrRefreshTokenRevoked = errors.New("refresh token has been revoked or has expired")
+
+// RefreshTokenOptions configures a token source that exchanges an OAuth 2.0
+// refresh token for access tokens, as stored in authorized_user credentials
+// (e.g. from `gcloud auth application-default login`).
+type RefreshTokenOptions struct {
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+
+	// TokenURL is the token endpoint. Defaults to
+	// https://oauth2.googleapis.com/token.
+	TokenURL string
+
+	// Scopes, if set, narrow the scopes of issued access tokens. They must be
+	// a subset of the scopes the refresh token was granted.
+	Scopes []string
+
+	// HTTPClient is used for token requests. Defaults to a client of the
+	// package's shared pooled transport.
+	HTTPClient *http.Client
+
+	// Retry configures retries of failed token requests. Defaults to
+	// DefaultRetryOptions.
+	Retry *RetryOptions
+}
+
+// refreshTokenSource exchanges a refresh token for access tokens. Once the
+// refresh token is rejected, it fails without further requests.
+type refreshTokenSource struct {
+	opts RefreshTokenOptions
+
+	mu      sync.Mutex
+	revoked error
+}
+
+// NewRefreshTokenSource returns a token source that exchanges the given
+// refresh token for access tokens, caching them until they expire. Failed
+// requests are retried; if Google rejects the refresh token, an error
+// wrapping ErrRefreshTokenRevoked is returned for every subsequent call.
+func NewRefreshTokenSource(opts *RefreshTokenOptions) (oauth2.TokenSource, error) {
+	if opts == nil || opts.ClientID == "" || opts.ClientSecret == "" || opts.RefreshToken == "" {
+		return nil, errors.New("client ID, client secret and refresh token are required")
+	}
+
+	ts := &refreshTokenSource{opts: *opts}
+	if ts.opts.TokenURL == "" {
+		ts.opts.TokenURL = defaultOAuth2TokenURL
+	}
+	if ts.opts.HTTPClient == nil {
+		ts.opts.HTTPClient = withDefaultTracer(newHTTPClient())
+	}
+	if ts.opts.Retry == nil {
+		ts.opts.Retry = DefaultRetryOptions()
+	}
+	return oauth2.ReuseTokenSource(nil, ts), nil
+}
+
+func (ts *refreshTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.revoked != nil {
+		return nil, ts.revoked
+	}
+
+	tok, err := ts.refresh(context.Background())
+	if errors.Is(err, ErrRefreshTokenRevoked) {
+		ts.revoked = err
+	}
+	return tok, err
+}
+
+func (ts *refreshTokenSource) refresh(ctx context.Context) (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {ts.opts.ClientID},
+		"client_secret": {ts.opts.ClientSecret},
+		"refresh_token": {ts.opts.RefreshToken},
+	}
+	if len(ts.opts.Scopes) > 0 {
+		form.Set("scope", strings.Join(ts.opts.Scopes, " "))
+	}
+	body := form.Encode()
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.opts.TokenURL, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err = ts.opts.HTTPClient.Do(req)
+		if attempt >= ts.opts.Retry.MaxRetries || !shouldRetry(resp, err) {
+			if err != nil {
+				return nil, fmt.Errorf("unable to refresh access token: %v", err)
+			}
+			break
+		}
+		if err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(ts.opts.Retry.backoff(attempt + 1))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Code        string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.Unmarshal(respBody, &oauthErr)
+		if oauthErr.Code == "invalid_grant" {
+			return nil, fmt.Errorf("%w: %s", ErrRefreshTokenRevoked, oauthErr.Description)
+		}
+		if oauthErr.Code == "" {
+			oauthErr.Description = strings.TrimSpace(string(respBody))
+		}
+		return nil, fmt.Errorf("unable to refresh access token: status %d: %s %s", resp.StatusCode, oauthErr.Code, oauthErr.Description)
+	}
+
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(respBody, &tokenResp); err != nil {
+		return nil, fmt.Errorf("unable to decode token response: %v", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response did not contain an access token")
+	}
+
+	// The refresh token may be rotated.
+	if tokenResp.RefreshToken != "" {
+		ts.opts.RefreshToken = tokenResp.RefreshToken
+	}
+	tok := &oauth2.Token{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+	}
+	if tokenResp.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRefreshTokenSource(t *testing.T) {
+	tests := map[string]struct {
+		Failures    int32
+		Status      int
+		Body        string
+		Calls       int32
+		Revoked     bool
+		ShouldError bool
+	}{
+		"success": {
+			Status: http.StatusOK,
+			Body:   `{"access_token":"user-token","token_type":"Bearer","expires_in":3600}`,
+			Calls:  1,
+		},
+		"retried": {
+			Failures: 2,
+			Status:   http.StatusOK,
+			Body:     `{"access_token":"user-token","token_type":"Bearer","expires_in":3600}`,
+			Calls:    3,
+		},
+		"revoked": {
+			Status:      http.StatusBadRequest,
+			Body:        `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`,
+			Calls:       1,
+			Revoked:     true,
+			ShouldError: true,
+		},
+		"invalid client": {
+			Status:      http.StatusUnauthorized,
+			Body:        `{"error":"invalid_client","error_description":"The OAuth client was not found."}`,
+			Calls:       2,
+			ShouldError: true,
+		},
+		"no access token": {
+			Status:      http.StatusOK,
+			Body:        `{}`,
+			Calls:       2,
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh" || r.FormValue("client_secret") != "secret" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if n <= test.Failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(test.Status)
+				w.Write([]byte(test.Body))
+			}))
+			defer srv.Close()
+
+			ts, err := NewRefreshTokenSource(&RefreshTokenOptions{
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RefreshToken: "refresh",
+				TokenURL:     srv.URL,
+				Retry:        &RetryOptions{MaxRetries: 2},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The second call is served from the cache on success, and
+			// without a request once the refresh token is revoked.
+			for i := 0; i < 2; i++ {
+				tok, err := ts.Token()
+				if test.ShouldError != (err != nil) {
+					t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+				}
+				if test.Revoked != errors.Is(err, ErrRefreshTokenRevoked) {
+					t.Fatalf("expected revoked: %t, got %v", test.Revoked, err)
+				}
+				if err == nil && tok.AccessToken != "user-token" {
+					t.Fatalf("unexpected token %+v", tok)
+				}
+			}
+			if got := atomic.LoadInt32(&calls); got != test.Calls {
+				t.Fatalf("expected %d calls, got %d", test.Calls, got)
+			}
+		})
+	}
+
+	if _, err := NewRefreshTokenSource(&RefreshTokenOptions{ClientID: "client"}); err == nil {
+		t.Fatal("expected error for missing fields")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// ReloadingCredentialsOptions configures ReloadingCredentials.
+type ReloadingCredentialsOptions struct {
+	// Path is the credentials file to watch. Either Path or Load is
+	// required.
+	Path string
+
+	// Load, if set, returns the current credential JSON, e.g. from a secret
+	// store. It takes precedence over Path.
+	Load func(ctx context.Context) ([]byte, error)
+
+	// Scopes are requested for access tokens.
+	Scopes []string
+
+	// Interval is the time between checks for changed credentials. Defaults
+	// to 30 seconds.
+	Interval time.Duration
+
+	// OnReload, if set, is called with the new credentials after they have
+	// been swapped in.
+	OnReload func(*GcpCredentials)
+
+	// OnError, if set, is called when reloading fails. The previous
+	// credentials remain in use.
+	OnError func(error)
+}
+
+// ReloadingCredentials holds credentials loaded from a file or callback and
+// swaps in new credentials when the source changes, so long-running
+// processes pick up rotated service account keys without a restart. It is
+// safe for concurrent use.
+type ReloadingCredentials struct {
+	opts ReloadingCredentialsOptions
+
+	// reloadMu serializes reloads, so that credentials are swapped in and
+	// OnReload is called in the order they were loaded.
+	reloadMu sync.Mutex
+
+	mu    sync.RWMutex
+	json  []byte
+	creds *GcpCredentials
+	ts    oauth2.TokenSource
+
+	runMu  sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReloadingCredentials loads the credentials and returns
+// ReloadingCredentials for them. Changes are not picked up until Start is
+// called or Reload is called explicitly.
+func NewReloadingCredentials(ctx context.Context, opts *ReloadingCredentialsOptions) (*ReloadingCredentials, error) {
+	if opts == nil || (opts.Path == "" && opts.Load == nil) {
+		return nil, errors.New("a credentials path or load function is required")
+	}
+
+	r := &ReloadingCredentials{opts: *opts}
+	if r.opts.Interval <= 0 {
+		r.opts.Interval = defaultReloadInterval
+	}
+	if _, err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Credentials returns the current credentials.
+func (r *ReloadingCredentials) Credentials() *GcpCredentials {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.creds
+}
+
+// TokenSource returns a token source that always uses the current
+// credentials.
+func (r *ReloadingCredentials) TokenSource() oauth2.TokenSource {
+	return reloadingTokenSource{r}
+}
+
+type reloadingTokenSource struct {
+	r *ReloadingCredentials
+}
+
+func (ts reloadingTokenSource) Token() (*oauth2.Token, error) {
+	ts.r.mu.RLock()
+	source := ts.r.ts
+	ts.r.mu.RUnlock()
+	return source.Token()
+}
+
+// Reload loads the credentials and, if they changed, swaps them in. It
+// reports whether the credentials changed. Invalid credentials, including
+// service account keys with a missing or malformed private key, are not
+// swapped in. Concurrent reloads run one at a time, so OnReload must not call
+// Reload.
+func (r *ReloadingCredentials) Reload(ctx context.Context) (bool, error) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	credsJSON, err := r.load(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(credsJSON, r.json)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	creds, err := Credentials(string(credsJSON))
+	if err != nil {
+		return false, fmt.Errorf("unable to parse reloaded credentials: %v", err)
+	}
+	if creds.Type == "" || creds.Type == CredentialTypeServiceAccount {
+		// Keys without a type are used as service account keys, so they
+		// must be complete too.
+		validated := *creds
+		validated.Type = CredentialTypeServiceAccount
+		if err := validated.Validate(); err != nil {
+			return false, fmt.Errorf("invalid reloaded credentials: %w", err)
+		}
+	}
+	tsCtx := context.WithValue(context.Background(), oauth2.HTTPClient, packageHTTPClient())
+	ts, err := credentialsTokenSource(tsCtx, creds, string(credsJSON), r.opts.Scopes)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	first := r.creds == nil
+	r.json, r.creds, r.ts = credsJSON, creds, oauth2.ReuseTokenSource(nil, ts)
+	r.mu.Unlock()
+
+	if !first {
+		logDebug("reloaded credentials", "client_email", creds.ClientEmail, "private_key_id", creds.PrivateKeyId)
+		if r.opts.OnReload != nil {
+			r.opts.OnReload(creds)
+		}
+	}
+	return true, nil
+}
+
+func (r *ReloadingCredentials) load(ctx context.Context) ([]byte, error) {
+	if r.opts.Load != nil {
+		b, err := r.opts.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load credentials: %v", err)
+		}
+		return b, nil
+	}
+	return ReadCredentialsFile(ctx, r.opts.Path)
+}
+
+// Start checks for changed credentials every interval until Stop is called
+// or ctx is done.
+func (r *ReloadingCredentials) Start(ctx context.Context) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(r.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := r.Reload(ctx); err != nil && ctx.Err() == nil && r.opts.OnError != nil {
+				r.opts.OnError(err)
+			}
+		}
+	}(r.done)
+}
+
+// Stop stops checking for changes and waits for a running reload to finish.
+func (r *ReloadingCredentials) Stop() {
+	r.runMu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.runMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net/http"
+	"os"
+)
+
+// EnvRequestReason is the environment variable providing the default
+// request reason of Clients, the package-level functions and the HTTP
+// clients returned by GetHttpClient.
+const EnvRequestReason = "GOOGLE_CLOUD_REQUEST_REASON"
+
+// RequestReasonHeader is the header carrying the justification of a request,
+// which is recorded in Access Transparency logs and may be required by
+// Access Approval.
+const RequestReasonHeader = "X-Goog-Request-Reason"
+
+type requestReasonKey struct{}
+
+// WithRequestReason returns a context that sets the request reason of calls
+// made with it, by a Client or the package-level functions, in place of the
+// configured reason.
+func WithRequestReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, requestReasonKey{}, reason)
+}
+
+// requestReasonTransport sets the X-Goog-Request-Reason header on every
+// request, from the request context or the configured reason.
+type requestReasonTransport struct {
+	base   http.RoundTripper
+	reason string
+}
+
+func (t *requestReasonTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reason := t.reason
+	if r, ok := req.Context().Value(requestReasonKey{}).(string); ok {
+		reason = r
+	}
+	if reason == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(RequestReasonHeader, reason)
+	return t.base.RoundTrip(req)
+}
+
+// withRequestReason returns a copy of httpClient that sends the request
+// reason from GOOGLE_CLOUD_REQUEST_REASON or the request context.
+func withRequestReason(httpClient *http.Client) *http.Client {
+	return withTransport(httpClient, &requestReasonTransport{base: transportOrDefault(httpClient.Transport), reason: os.Getenv(EnvRequestReason)})
+}
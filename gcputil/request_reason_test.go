@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_requestReason(t *testing.T) {
+	tests := map[string]struct {
+		Env     string
+		Option  string
+		Context string
+		Want    string
+	}{
+		"none":            {},
+		"env":             {Env: "ticket-1", Want: "ticket-1"},
+		"option over env": {Env: "ticket-1", Option: "ticket-2", Want: "ticket-2"},
+		"context":         {Option: "ticket-2", Context: "ticket-3", Want: "ticket-3"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvRequestReason, test.Env)
+
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get(RequestReasonHeader)
+				json.NewEncoder(w).Encode(map[string]string{
+					"accessToken": "token",
+					"expireTime":  time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				})
+			}))
+			defer srv.Close()
+
+			c := newTestClient(t, &Options{
+				Endpoints:     &GCPEndpoints{IAMCredentials: srv.URL},
+				RequestReason: test.Option,
+			})
+			ctx := context.Background()
+			if test.Context != "" {
+				ctx = WithRequestReason(ctx, test.Context)
+			}
+			if _, err := c.GenerateAccessToken(ctx, &IAMTokenExchangeRequest{ServiceAccountEmail: "sa@p.iam.gserviceaccount.com"}); err != nil {
+				t.Fatal(err)
+			}
+			if got != test.Want {
+				t.Fatalf("expected request reason %q, got %q", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestPackageRequestReason(t *testing.T) {
+	t.Setenv(EnvRequestReason, "ticket-1")
+
+	var mu sync.Mutex
+	reasons := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reasons[r.URL.Path] = r.Header.Get(RequestReasonHeader)
+		mu.Unlock()
+		if r.URL.Path == "/token" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+		}
+	}))
+	defer srv.Close()
+
+	get := func(client *http.Client, ctx context.Context, path string) {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	get(packageHTTPClient(), context.Background(), "/package")
+	get(packageHTTPClient(), WithRequestReason(context.Background(), "ticket-2"), "/context")
+
+	creds, err := Credentials(string(testServiceAccountJSON(t, srv.URL+"/token")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.TokenURL = srv.URL + "/token"
+	client, err := GetHttpClient(creds, "scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	get(client, context.Background(), "/api")
+
+	expected := map[string]string{
+		"/package": "ticket-1",
+		"/context": "ticket-2",
+		"/token":   "ticket-1",
+		"/api":     "ticket-1",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for path, want := range expected {
+		if reasons[path] != want {
+			t.Errorf("expected request reason %q for %s, got %q", want, path, reasons[path])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/option"
+)
+
+// ProjectStateActive is the lifecycle state of a project that is not being
+// deleted.
+const ProjectStateActive = "ACTIVE"
+
+// Project describes a GCP project as returned by the Cloud Resource Manager
+// API.
+type Project struct {
+	// ID is the user-assigned project ID.
+	ID string
+
+	// Number is the unique project number.
+	Number int64
+
+	// DisplayName is the optional user-assigned project name.
+	DisplayName string
+
+	// State is the lifecycle state, e.g. ACTIVE or DELETE_REQUESTED.
+	State string
+
+	// Labels are the project labels.
+	Labels map[string]string
+
+	// Parent is the resource name of the parent folder or organization, e.g.
+	// "folders/123", or empty if the project has no parent.
+	Parent string
+
+	// CreateTime is when the project was created.
+	CreateTime time.Time
+}
+
+// Active reports whether the project is active, i.e. not pending deletion.
+func (p *Project) Active() bool {
+	return p.State == ProjectStateActive
+}
+
+// GetProject returns the project with the given ID or number.
+func (c *Client) GetProject(ctx context.Context, projectID string) (*Project, error) {
+	defer c.measure("get_project", time.Now())
+	if projectID == "" {
+		return nil, errors.New("project ID is required")
+	}
+	crm, err := c.resourceManagerService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	project, err := crm.Projects.Get(projectID).Context(ctx).Do()
+	if err != nil {
+		c.incrError("get_project")
+		return nil, fmt.Errorf("could not find project %q: %v", projectID, err)
+	}
+	return newProject(project), nil
+}
+
+// SearchProjects returns the active projects visible to the client's
+// credentials whose labels match the selector, sorted by project ID. Equality
+// and presence requirements are filtered on by the API; the whole selector is
+// then evaluated locally.
+func (c *Client) SearchProjects(ctx context.Context, selector LabelSelector) ([]*Project, error) {
+	defer c.measure("search_projects", time.Now())
+	crm, err := c.resourceManagerService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []*Project
+	err = crm.Projects.List().Filter(projectFilter(selector)).Pages(ctx, func(resp *cloudresourcemanager.ListProjectsResponse) error {
+		for _, project := range resp.Projects {
+			p := newProject(project)
+			if p.Active() && selector.Matches(p.Labels) {
+				projects = append(projects, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.incrError("search_projects")
+		return nil, fmt.Errorf("unable to search projects: %v", err)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+	return projects, nil
+}
+
+func (c *Client) resourceManagerService(ctx context.Context) (*cloudresourcemanager.Service, error) {
+	svc, err := cloudresourcemanager.NewService(ctx, option.WithHTTPClient(c.authClient), option.WithEndpoint(c.endpointsFor(ctx).CloudResourceManager))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Cloud Resource Manager client: %v", err)
+	}
+	return svc, nil
+}
+
+// projectFilter returns a projects.list filter for the requirements of the
+// selector that the API can evaluate.
+func projectFilter(selector LabelSelector) string {
+	terms := []string{"lifecycleState:" + ProjectStateActive}
+	for _, r := range selector {
+		switch r.Operator {
+		case SelectorEquals:
+			terms = append(terms, fmt.Sprintf("labels.%s:%s", r.Key, r.Values[0]))
+		case SelectorExists:
+			terms = append(terms, fmt.Sprintf("labels.%s:*", r.Key))
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+func newProject(project *cloudresourcemanager.Project) *Project {
+	p := &Project{
+		ID:          project.ProjectId,
+		Number:      project.ProjectNumber,
+		DisplayName: project.Name,
+		State:       project.LifecycleState,
+		Labels:      project.Labels,
+	}
+	if p.Labels == nil {
+		p.Labels = map[string]string{}
+	}
+	if project.Parent != nil && project.Parent.Id != "" {
+		// Parent types are singular, e.g. "folder".
+		p.Parent = fmt.Sprintf("%ss/%s", project.Parent.Type, project.Parent.Id)
+	}
+	if t, err := time.Parse(time.RFC3339Nano, project.CreateTime); err == nil {
+		p.CreateTime = t
+	}
+	return p
+}
@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+func newTestResourceManagerServer(t *testing.T, filters *[]string) *httptest.Server {
+	t.Helper()
+	projects := []*cloudresourcemanager.Project{
+		{ProjectId: "web-prod", ProjectNumber: 1, LifecycleState: "ACTIVE", Labels: map[string]string{"env": "prod", "tier": "web"},
+			Parent: &cloudresourcemanager.ResourceId{Type: "folder", Id: "10"}, CreateTime: "2020-01-02T03:04:05.000Z"},
+		{ProjectId: "api-prod", ProjectNumber: 2, LifecycleState: "ACTIVE", Labels: map[string]string{"env": "prod", "tier": "api"}},
+		{ProjectId: "db-prod", ProjectNumber: 3, LifecycleState: "ACTIVE", Labels: map[string]string{"env": "prod", "tier": "db"}},
+		{ProjectId: "old-prod", ProjectNumber: 4, LifecycleState: "DELETE_REQUESTED", Labels: map[string]string{"env": "prod"}},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/projects" {
+			*filters = append(*filters, r.URL.Query().Get("filter"))
+			// Serve one project per page to exercise paging.
+			i := 0
+			if token := r.URL.Query().Get("pageToken"); token != "" {
+				i = int(token[0] - '0')
+			}
+			resp := &cloudresourcemanager.ListProjectsResponse{Projects: projects[i : i+1]}
+			if i+1 < len(projects) {
+				resp.NextPageToken = string(rune('0' + i + 1))
+			}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		for _, p := range projects {
+			if r.URL.Path == "/v1/projects/"+p.ProjectId {
+				json.NewEncoder(w).Encode(p)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"not found"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient_GetProject(t *testing.T) {
+	var filters []string
+	srv := newTestResourceManagerServer(t, &filters)
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{CloudResourceManager: srv.URL}})
+
+	tests := map[string]struct {
+		ProjectID   string
+		Parent      string
+		Active      bool
+		ShouldError bool
+	}{
+		"active with parent": {ProjectID: "web-prod", Parent: "folders/10", Active: true},
+		"no parent":          {ProjectID: "api-prod", Active: true},
+		"pending deletion":   {ProjectID: "old-prod"},
+		"not found":          {ProjectID: "missing", ShouldError: true},
+		"empty":              {ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := c.GetProject(context.Background(), test.ProjectID)
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			if p.ID != test.ProjectID || p.Parent != test.Parent || p.Active() != test.Active || p.Labels["env"] != "prod" {
+				t.Fatalf("unexpected project: %+v", p)
+			}
+		})
+	}
+}
+
+func TestClient_SearchProjects(t *testing.T) {
+	var filters []string
+	srv := newTestResourceManagerServer(t, &filters)
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{CloudResourceManager: srv.URL}})
+
+	selector, err := ParseLabelSelector("env=prod,tier notin (db),tier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects, err := c.SearchProjects(context.Background(), selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, p := range projects {
+		ids = append(ids, p.ID)
+	}
+	if expected := []string{"api-prod", "web-prod"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected projects %v, got %v", expected, ids)
+	}
+	if len(filters) != 4 {
+		t.Fatalf("expected 4 pages, got %d", len(filters))
+	}
+	for _, filter := range filters {
+		if filter != "lifecycleState:ACTIVE labels.env:prod labels.tier:*" {
+			t.Fatalf("unexpected filter %q", filter)
+		}
+	}
+}
@@ -27,6 +27,62 @@ type RelativeResourceName struct {
 	TypeKey              string
 	IdTuples             map[string]string
 	OrderedCollectionIds []string
+
+	// Segments holds the parsed collection/ID pairs in order, including
+	// singleton collections such as "global" (which have an empty ID).
+	Segments []ResourceNameSegment
+}
+
+// ResourceNameSegment is a single collection ID and resource ID pair of a
+// resource name, e.g. {"projects", "my-project"}. Singleton collections
+// like "global" have an empty ID.
+type ResourceNameSegment struct {
+	Collection string
+	ID         string
+}
+
+// Project returns the project ID of the resource name, if any.
+func (n *RelativeResourceName) Project() string {
+	return n.IdTuples["projects"]
+}
+
+// Location returns the location, zone or region of the resource name, if any.
+func (n *RelativeResourceName) Location() string {
+	for _, collection := range []string{"locations", "zones", "regions"} {
+		if id, ok := n.IdTuples[collection]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// String returns the relative resource name, e.g. projects/P/locations/L/keyRings/K.
+func (n *RelativeResourceName) String() string {
+	tokens := make([]string, 0, 2*len(n.Segments))
+	for _, segment := range n.Segments {
+		tokens = append(tokens, segment.Collection)
+		if segment.ID != "" {
+			tokens = append(tokens, segment.ID)
+		}
+	}
+	return strings.Join(tokens, "/")
+}
+
+// BuildRelativeResourceName builds and validates a relative resource name
+// from the given segments. It is the inverse of ParseRelativeName.
+func BuildRelativeResourceName(segments ...ResourceNameSegment) (*RelativeResourceName, error) {
+	tokens := make([]string, 0, 2*len(segments))
+	for _, segment := range segments {
+		_, single := singleCollectionIds[segment.Collection]
+		if single != (segment.ID == "") {
+			return nil, fmt.Errorf("invalid segment %s/%s", segment.Collection, segment.ID)
+		}
+		tokens = append(tokens, segment.Collection)
+		if segment.ID != "" {
+			tokens = append(tokens, segment.ID)
+		}
+	}
+	return ParseRelativeName(strings.Join(tokens, "/"))
 }
 
 func ParseRelativeName(resource string) (*RelativeResourceName, error) {
@@ -39,6 +95,7 @@ func ParseRelativeName(resource string) (*RelativeResourceName, error) {
 	}
 
 	ids := map[string]string{}
+	segments := []ResourceNameSegment{}
 	typeKey := ""
 	currColId := ""
 	for idx, v := range tokens {
@@ -48,6 +105,7 @@ func ParseRelativeName(resource string) (*RelativeResourceName, error) {
 				if idx == len(tokens)-1 {
 					return nil, fmt.Errorf("invalid relative resource name %s (last collection '%s' has no ID)", resource, currColId)
 				}
+				segments = append(segments, ResourceNameSegment{Collection: v})
 				continue
 			}
 			if len(collectionRe.FindAllString(v, 1)) == 0 {
@@ -60,6 +118,7 @@ func ParseRelativeName(resource string) (*RelativeResourceName, error) {
 				return nil, fmt.Errorf("invalid relative resource name %s (invalid resource sub-ID %s)", resource, v)
 			}
 			ids[currColId] = v
+			segments = append(segments, ResourceNameSegment{Collection: currColId, ID: v})
 			currColId = ""
 		}
 	}
@@ -72,6 +131,7 @@ func ParseRelativeName(resource string) (*RelativeResourceName, error) {
 		TypeKey:              typeKey,
 		OrderedCollectionIds: collectionIds,
 		IdTuples:             ids,
+		Segments:             segments,
 	}, nil
 }
 
@@ -80,6 +140,22 @@ type FullResourceName struct {
 	*RelativeResourceName
 }
 
+// String returns the full resource name, e.g. //iam.googleapis.com/projects/P/serviceAccounts/S.
+func (n *FullResourceName) String() string {
+	return fmt.Sprintf("//%s.googleapis.com/%s", n.Service, n.RelativeResourceName.String())
+}
+
+// BuildFullResourceName builds and validates a full resource name for the
+// given service (e.g. "iam") from the given segments. It is the inverse of
+// ParseFullResourceName.
+func BuildFullResourceName(service string, segments ...ResourceNameSegment) (*FullResourceName, error) {
+	relName, err := BuildRelativeResourceName(segments...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFullResourceName(fmt.Sprintf("//%s.googleapis.com/%s", service, relName))
+}
+
 func ParseFullResourceName(name string) (*FullResourceName, error) {
 	fullRe := regexp.MustCompile(fullResourceNameRegex)
 	matches := fullRe.FindAllStringSubmatch(name, 1)
@@ -200,3 +200,52 @@ func TestParseRelativeName_shouldError(t *testing.T) {
 		}
 	}
 }
+
+func TestResourceName_RoundTrip(t *testing.T) {
+	testCases := []string{
+		"//iam.googleapis.com/projects/p/serviceAccounts/sa@p.iam.gserviceaccount.com",
+		"//cloudkms.googleapis.com/projects/p/locations/us-east1/keyRings/k/cryptoKeys/c",
+		"//compute.googleapis.com/projects/p/global/networks/n",
+	}
+
+	for _, k := range testCases {
+		parsed, err := ParseFullResourceName(k)
+		if err != nil {
+			t.Errorf("input '%s' returned error: %s", k, err)
+			continue
+		}
+		if parsed.String() != k {
+			t.Errorf("input '%s': String() returned '%s'", k, parsed.String())
+		}
+
+		built, err := BuildFullResourceName(parsed.Service, parsed.Segments...)
+		if err != nil {
+			t.Errorf("input '%s': build returned error: %s", k, err)
+			continue
+		}
+		if built.String() != k {
+			t.Errorf("input '%s': built name '%s'", k, built.String())
+		}
+	}
+}
+
+func TestBuildRelativeResourceName(t *testing.T) {
+	name, err := BuildRelativeResourceName(
+		ResourceNameSegment{Collection: "projects", ID: "p"},
+		ResourceNameSegment{Collection: "locations", ID: "global"},
+		ResourceNameSegment{Collection: "workloadIdentityPools", ID: "pool"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name.Project() != "p" || name.Location() != "global" {
+		t.Errorf("unexpected project %q or location %q", name.Project(), name.Location())
+	}
+
+	if _, err := BuildRelativeResourceName(ResourceNameSegment{Collection: "projects"}); err == nil {
+		t.Errorf("expected error for segment without ID")
+	}
+	if _, err := BuildRelativeResourceName(ResourceNameSegment{Collection: "Bad Collection", ID: "x"}); err == nil {
+		t.Errorf("expected error for invalid collection")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// RetryOptions configures retries of requests that fail with a network error,
+// a 429 or a 5xx response.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of retries after the first attempt.
+	// Zero disables retries.
+	MaxRetries int
+
+	// MinBackoff is the wait before the first retry. It doubles on each
+	// subsequent retry, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryOptions returns the retry options used when none are given.
+func DefaultRetryOptions() *RetryOptions {
+	return &RetryOptions{
+		MaxRetries: 3,
+		MinBackoff: 200 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+	}
+}
+
+// backoff returns the wait before the given retry (starting at 1).
+func (o *RetryOptions) backoff(retry int) time.Duration {
+	d := o.MinBackoff
+	for i := 1; i < retry && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if o.MaxBackoff > 0 && d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+// shouldRetry reports whether a request that returned resp and err should be
+// retried.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// doWithRetry sends the request built by newReq, retrying according to the
+// client's retry options. newReq is called for every attempt so that request
+// bodies can be replayed.
+func (c *Client) doWithRetry(ctx context.Context, op string, httpClient *http.Client, newReq func() (*http.Request, error)) (*http.Response, error) {
+	retry := c.opts.Retry
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := httpClient.Do(req)
+		if attempt >= retry.MaxRetries || !shouldRetry(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		if err != nil {
+			c.debug("retrying request after error", "op", op, "attempt", attempt+1, "error", err)
+		} else {
+			c.debug("retrying request after error status", "op", op, "attempt", attempt+1, "status", resp.StatusCode)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		c.incrRetry(op)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retry.backoff(attempt + 1)):
+		}
+	}
+}
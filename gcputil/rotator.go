@@ -0,0 +1,428 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iam/v1"
+)
+
+const (
+	defaultRotatorMaxKeys        = 2
+	defaultRotatorRotationPeriod = 30 * 24 * time.Hour
+	defaultRotatorOverlap        = time.Hour
+	minRotatorCheckInterval      = time.Minute
+)
+
+// RotatorKey is a service account key managed by a CredentialsRotator.
+type RotatorKey struct {
+	ID              string    `json:"id"`
+	CredentialsJSON string    `json:"credentials_json"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// RotatorState is the persisted state of a CredentialsRotator. Keys are
+// ordered from oldest to newest; the newest key is the active one.
+type RotatorState struct {
+	ServiceAccount string        `json:"service_account"`
+	Keys           []*RotatorKey `json:"keys"`
+}
+
+func (s *RotatorState) active() *RotatorKey {
+	if s == nil || len(s.Keys) == 0 {
+		return nil
+	}
+	return s.Keys[len(s.Keys)-1]
+}
+
+func (s *RotatorState) clone() *RotatorState {
+	c := &RotatorState{ServiceAccount: s.ServiceAccount}
+	for _, k := range s.Keys {
+		kc := *k
+		c.Keys = append(c.Keys, &kc)
+	}
+	return c
+}
+
+// RotatorStore persists the state of a CredentialsRotator, e.g. in Vault
+// storage. State contains private keys and must be stored securely.
+type RotatorStore interface {
+	// Load returns the stored state, or nil if there is none.
+	Load(ctx context.Context) (*RotatorState, error)
+
+	// Save stores the state.
+	Save(ctx context.Context, state *RotatorState) error
+}
+
+// MemoryRotatorStore is a RotatorStore that keeps state in memory.
+type MemoryRotatorStore struct {
+	mu    sync.Mutex
+	state *RotatorState
+}
+
+var _ RotatorStore = &MemoryRotatorStore{}
+
+func (s *MemoryRotatorStore) Load(_ context.Context) (*RotatorState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		return nil, nil
+	}
+	return s.state.clone(), nil
+}
+
+func (s *MemoryRotatorStore) Save(_ context.Context, state *RotatorState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state.clone()
+	return nil
+}
+
+// CredentialsRotatorOptions configures a CredentialsRotator.
+type CredentialsRotatorOptions struct {
+	// ServiceAccount is the service account whose keys are managed. It is
+	// required.
+	ServiceAccount *ServiceAccountId
+
+	// Store persists the rotator's state. It is required.
+	Store RotatorStore
+
+	// MaxKeys is the maximum number of keys kept for the service account,
+	// including the active key. Defaults to 2.
+	MaxKeys int
+
+	// RotationPeriod is the age at which the active key is replaced.
+	// Defaults to 30 days.
+	RotationPeriod time.Duration
+
+	// Overlap is how long a replaced key is kept after rotation, so that
+	// consumers of the previous key can switch over. Defaults to one hour.
+	Overlap time.Duration
+
+	// Scopes are requested for tokens from TokenSource. Defaults to
+	// cloud-platform.
+	Scopes []string
+
+	// OnRotate, if set, is called with the new active key after each
+	// rotation.
+	OnRotate func(key *RotatorKey)
+
+	// OnError, if set, is called when a background rotation fails.
+	OnError func(error)
+}
+
+// CredentialsRotator manages the keys of a service account: it keeps an
+// active key, rotates it on a schedule, keeps replaced keys for an overlap
+// period, and deletes keys beyond a maximum. State is persisted with a
+// RotatorStore so that rotation survives restarts. Its TokenSource always
+// uses the active key.
+type CredentialsRotator struct {
+	client *Client
+	opts   CredentialsRotatorOptions
+	now    func() time.Time
+
+	mu    sync.Mutex
+	state *RotatorState
+
+	tsMu     sync.Mutex
+	tsKeyID  string
+	tsSource oauth2.TokenSource
+
+	runMu  sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCredentialsRotator returns a CredentialsRotator that manages keys with
+// the client's credentials. Init must be called before it is used.
+func (c *Client) NewCredentialsRotator(opts *CredentialsRotatorOptions) (*CredentialsRotator, error) {
+	if opts == nil || opts.ServiceAccount == nil {
+		return nil, errors.New("service account is required")
+	}
+	if opts.Store == nil {
+		return nil, errors.New("store is required")
+	}
+
+	r := &CredentialsRotator{client: c, opts: *opts, now: time.Now}
+	if r.opts.MaxKeys <= 0 {
+		r.opts.MaxKeys = defaultRotatorMaxKeys
+	}
+	if r.opts.RotationPeriod <= 0 {
+		r.opts.RotationPeriod = defaultRotatorRotationPeriod
+	}
+	if r.opts.Overlap <= 0 {
+		r.opts.Overlap = defaultRotatorOverlap
+	}
+	if len(r.opts.Scopes) == 0 {
+		r.opts.Scopes = defaultTokenAuthScopes
+	}
+	return r, nil
+}
+
+// Init loads the rotator's state from the store, creating the first key if
+// there is none, and performs any overdue rotation.
+func (r *CredentialsRotator) Init(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, err := r.opts.Store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load rotator state: %v", err)
+	}
+	if state == nil {
+		state = &RotatorState{}
+	}
+	if state.ServiceAccount != "" && state.ServiceAccount != r.opts.ServiceAccount.ResourceName() {
+		return fmt.Errorf("stored state is for service account %q, not %q", state.ServiceAccount, r.opts.ServiceAccount.ResourceName())
+	}
+	state.ServiceAccount = r.opts.ServiceAccount.ResourceName()
+	r.state = state
+
+	return r.maintain(ctx, false)
+}
+
+// Rotate creates a new active key immediately, regardless of the age of the
+// current one.
+func (r *CredentialsRotator) Rotate(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == nil {
+		return errors.New("rotator is not initialized")
+	}
+	return r.maintain(ctx, true)
+}
+
+// Maintain rotates the active key if it is older than the rotation period,
+// and deletes replaced keys whose overlap period has passed.
+func (r *CredentialsRotator) Maintain(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == nil {
+		return errors.New("rotator is not initialized")
+	}
+	return r.maintain(ctx, false)
+}
+
+// ActiveKey returns the active key, or nil if the rotator is not
+// initialized.
+func (r *CredentialsRotator) ActiveKey() *RotatorKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if k := r.state.active(); k != nil {
+		kc := *k
+		return &kc
+	}
+	return nil
+}
+
+// Keys returns the IDs of the managed keys, from oldest to newest.
+func (r *CredentialsRotator) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(r.state.Keys))
+	for _, k := range r.state.Keys {
+		ids = append(ids, k.ID)
+	}
+	return ids
+}
+
+// TokenSource returns a token source that uses the active key, switching to
+// the new key after each rotation.
+func (r *CredentialsRotator) TokenSource() oauth2.TokenSource {
+	return rotatorTokenSource{r}
+}
+
+type rotatorTokenSource struct {
+	r *CredentialsRotator
+}
+
+func (ts rotatorTokenSource) Token() (*oauth2.Token, error) {
+	return ts.r.token()
+}
+
+func (r *CredentialsRotator) token() (*oauth2.Token, error) {
+	key := r.ActiveKey()
+	if key == nil {
+		return nil, errors.New("rotator has no active key")
+	}
+
+	r.tsMu.Lock()
+	if r.tsKeyID != key.ID {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, r.client.httpClient)
+		creds, err := google.CredentialsFromJSON(ctx, []byte(key.CredentialsJSON), r.opts.Scopes...)
+		if err != nil {
+			r.tsMu.Unlock()
+			return nil, fmt.Errorf("unable to parse credentials for key %q: %v", key.ID, err)
+		}
+		r.tsKeyID = key.ID
+		r.tsSource = oauth2.ReuseTokenSource(nil, creds.TokenSource)
+	}
+	ts := r.tsSource
+	r.tsMu.Unlock()
+
+	return ts.Token()
+}
+
+// Start runs Maintain periodically until Stop is called or ctx is done.
+func (r *CredentialsRotator) Start(ctx context.Context) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+	if r.cancel != nil {
+		return
+	}
+
+	interval := r.opts.Overlap
+	if r.opts.RotationPeriod < interval {
+		interval = r.opts.RotationPeriod
+	}
+	if interval < minRotatorCheckInterval {
+		interval = minRotatorCheckInterval
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := r.Maintain(ctx); err != nil && ctx.Err() == nil {
+				r.client.warn("credential rotation failed", "service_account", r.opts.ServiceAccount.ResourceName(), "error", err)
+				if r.opts.OnError != nil {
+					r.opts.OnError(err)
+				}
+			}
+		}
+	}(r.done)
+}
+
+// Stop stops background rotation and waits for a running rotation to finish.
+func (r *CredentialsRotator) Stop() {
+	r.runMu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.runMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// maintain must be called with r.mu held.
+func (r *CredentialsRotator) maintain(ctx context.Context, force bool) error {
+	now := r.now()
+	active := r.state.active()
+	if force || active == nil || now.Sub(active.CreatedAt) >= r.opts.RotationPeriod {
+		// Make room for the new key. The active key is kept so that
+		// credentials are never missing; with MaxKeys of 1 it is deleted
+		// below, once its replacement exists.
+		for len(r.state.Keys) > 1 && len(r.state.Keys) >= r.opts.MaxKeys {
+			if err := r.deleteOldest(ctx); err != nil {
+				return err
+			}
+		}
+		if err := r.createKey(ctx, now); err != nil {
+			return err
+		}
+	}
+
+	// Delete replaced keys once the overlap since their replacement has
+	// passed, and any keys beyond the maximum. Keys[0] was replaced when
+	// Keys[1] was created.
+	for len(r.state.Keys) > 1 && (len(r.state.Keys) > r.opts.MaxKeys || now.Sub(r.state.Keys[1].CreatedAt) >= r.opts.Overlap) {
+		if err := r.deleteOldest(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *CredentialsRotator) createKey(ctx context.Context, now time.Time) error {
+	defer r.client.measure("rotator_create_key", now)
+
+	iamService, err := r.client.iamServiceFor(ctx)
+	if err != nil {
+		return err
+	}
+	key, err := iamService.Projects.ServiceAccounts.Keys.Create(r.opts.ServiceAccount.ResourceName(), &iam.CreateServiceAccountKeyRequest{}).Context(ctx).Do()
+	if err != nil {
+		r.client.incrError("rotator_create_key")
+		return fmt.Errorf("unable to create key for service account '%s': %v", r.opts.ServiceAccount.ResourceName(), err)
+	}
+	credsJSON, err := base64.StdEncoding.DecodeString(key.PrivateKeyData)
+	if err != nil {
+		return fmt.Errorf("unable to decode private key data: %v", err)
+	}
+
+	k := &RotatorKey{
+		ID:              path.Base(key.Name),
+		CredentialsJSON: string(credsJSON),
+		CreatedAt:       now,
+	}
+	state := r.state.clone()
+	state.Keys = append(state.Keys, k)
+	if err := r.opts.Store.Save(ctx, state); err != nil {
+		// Do not leave an untracked key behind.
+		r.deleteKey(ctx, k.ID)
+		return fmt.Errorf("unable to save rotator state: %v", err)
+	}
+	r.state = state
+
+	r.client.debug("rotated service account key", "service_account", r.opts.ServiceAccount.ResourceName(), "key", k.ID)
+	if r.opts.OnRotate != nil {
+		kc := *k
+		r.opts.OnRotate(&kc)
+	}
+	return nil
+}
+
+func (r *CredentialsRotator) deleteOldest(ctx context.Context) error {
+	oldest := r.state.Keys[0]
+	if err := r.deleteKey(ctx, oldest.ID); err != nil {
+		return err
+	}
+	state := r.state.clone()
+	state.Keys = state.Keys[1:]
+	if err := r.opts.Store.Save(ctx, state); err != nil {
+		return fmt.Errorf("unable to save rotator state: %v", err)
+	}
+	r.state = state
+	return nil
+}
+
+func (r *CredentialsRotator) deleteKey(ctx context.Context, keyID string) error {
+	iamService, err := r.client.iamServiceFor(ctx)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s/keys/%s", r.opts.ServiceAccount.ResourceName(), keyID)
+	if _, err := iamService.Projects.ServiceAccounts.Keys.Delete(name).Context(ctx).Do(); err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+			return nil
+		}
+		r.client.incrError("rotator_delete_key")
+		return fmt.Errorf("unable to delete key '%s': %v", name, err)
+	}
+	return nil
+}
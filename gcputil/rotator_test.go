@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestCredentialsRotator(t *testing.T) {
+	iamSrv := testutil.NewIAMServer(t)
+	sa := iamSrv.AddServiceAccount("p", "sa")
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{IAM: iamSrv.URL}})
+
+	store := &MemoryRotatorStore{}
+	var rotated []string
+	r, err := c.NewCredentialsRotator(&CredentialsRotatorOptions{
+		ServiceAccount: &ServiceAccountId{Project: "p", EmailOrId: sa.Email},
+		Store:          store,
+		MaxKeys:        2,
+		RotationPeriod: 24 * time.Hour,
+		Overlap:        time.Hour,
+		OnRotate:       func(k *RotatorKey) { rotated = append(rotated, k.ID) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if err := r.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := r.ActiveKey()
+	if first == nil || len(iamSrv.Keys(sa.Email)) != 1 || len(rotated) != 1 {
+		t.Fatalf("expected an initial key, got %v", r.Keys())
+	}
+	if creds, err := Credentials(first.CredentialsJSON); err != nil || creds.PrivateKeyId != first.ID {
+		t.Errorf("expected credentials for key %q, got %+v (err: %v)", first.ID, creds, err)
+	}
+
+	// Not yet due.
+	now = now.Add(23 * time.Hour)
+	if err := r.Maintain(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.Keys()) != 1 {
+		t.Errorf("expected no rotation, got keys %v", r.Keys())
+	}
+
+	// Due: a new key is created and the old one kept for the overlap.
+	now = now.Add(time.Hour)
+	if err := r.Maintain(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := r.Keys(); len(keys) != 2 || keys[0] != first.ID || r.ActiveKey().ID == first.ID {
+		t.Errorf("expected rotation with overlap, got keys %v", keys)
+	}
+
+	// Overlap passed: the old key is deleted.
+	now = now.Add(time.Hour)
+	if err := r.Maintain(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := r.Keys(); len(keys) != 1 || len(iamSrv.Keys(sa.Email)) != 1 {
+		t.Errorf("expected old key to be deleted, got keys %v", keys)
+	}
+
+	// Forced rotations never exceed MaxKeys.
+	for i := 0; i < 3; i++ {
+		if err := r.Rotate(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if keys := r.Keys(); len(keys) != 2 || len(iamSrv.Keys(sa.Email)) != 2 {
+		t.Errorf("expected at most 2 keys, got keys %v", keys)
+	}
+
+	// A new rotator resumes from the stored state.
+	r2, err := c.NewCredentialsRotator(&CredentialsRotatorOptions{
+		ServiceAccount: &ServiceAccountId{Project: "p", EmailOrId: sa.Email},
+		Store:          store,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r2.now = r.now
+	if err := r2.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r2.ActiveKey().ID != r.ActiveKey().ID {
+		t.Errorf("expected active key %q, got %q", r.ActiveKey().ID, r2.ActiveKey().ID)
+	}
+}
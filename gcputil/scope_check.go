@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"sync"
+	"time"
+)
+
+// tokenInfoCacheTTL bounds how long token info is cached by HasScopes.
+const tokenInfoCacheTTL = time.Minute
+
+// tokenInfoCache caches token info by a hash of the access token. The zero
+// value is ready to use.
+type tokenInfoCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*tokenInfoCacheEntry
+}
+
+type tokenInfoCacheEntry struct {
+	info    *TokenInfo
+	expires time.Time
+}
+
+func (c *tokenInfoCache) get(key [sha256.Size]byte, now time.Time) *TokenInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		return e.info
+	}
+	return nil
+}
+
+func (c *tokenInfoCache) put(key [sha256.Size]byte, info *TokenInfo, now time.Time) {
+	expires := now.Add(tokenInfoCacheTTL)
+	if !info.Expiry.IsZero() && info.Expiry.Before(expires) {
+		expires = info.Expiry
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[[sha256.Size]byte]*tokenInfoCacheEntry{}
+	}
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = &tokenInfoCacheEntry{info: info, expires: expires}
+}
+
+// HasScopes reports whether the given access token was granted all of the
+// required scopes, and returns the missing ones in sorted order. Token info
+// is cached for up to a minute, so that the check can precede every call
+// made with a token. An error is returned if the token is invalid or
+// expired.
+func (c *Client) HasScopes(ctx context.Context, accessToken string, required ...string) (bool, []string, error) {
+	key := sha256.Sum256([]byte(accessToken))
+	info := c.tokenInfos.get(key, time.Now())
+	c.incrCache("token_info", info != nil)
+	if info == nil {
+		var err error
+		if info, err = c.TokenInfo(ctx, accessToken); err != nil {
+			return false, nil, err
+		}
+		c.tokenInfos.put(key, info, time.Now())
+	}
+
+	missing := missingScopes(info.Scopes, required)
+	return len(missing) == 0, missing, nil
+}
+
+// missingScopes returns, in sorted order, the required scopes not in granted.
+func missingScopes(granted, required []string) []string {
+	have := make(map[string]struct{}, len(granted))
+	for _, scope := range granted {
+		have[scope] = struct{}{}
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if _, ok := have[scope]; !ok {
+			missing = append(missing, scope)
+			have[scope] = struct{}{}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
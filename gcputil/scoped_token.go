@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+type tokenScopesKey struct{}
+
+// WithTokenScopes returns a context that requests tokens with the given
+// scopes, in place of the client's configured scopes, for authenticated calls
+// made by a Client with it. This allows individual calls to use narrower
+// scopes without creating another Client.
+func WithTokenScopes(ctx context.Context, scopes ...string) context.Context {
+	return context.WithValue(ctx, tokenScopesKey{}, scopes)
+}
+
+func tokenScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(tokenScopesKey{}).([]string)
+	return scopes, ok && len(scopes) > 0
+}
+
+// ScopedTokenSource mints tokens with different scopes from a single set of
+// credentials. Token sources are created on first use of each scope
+// combination and cached, so tokens are reused across calls. It is safe for
+// concurrent use.
+type ScopedTokenSource struct {
+	defaultScopes []string
+	newSource     func(scopes []string) (oauth2.TokenSource, error)
+
+	// onLookup, if set, is called with whether a token source was cached.
+	onLookup func(hit bool)
+
+	mu      sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+var _ oauth2.TokenSource = &ScopedTokenSource{}
+
+// NewScopedTokenSource returns a ScopedTokenSource for the given credentials
+// JSON, e.g. a service account key. Tokens from Token use defaultScopes,
+// which default to cloud-platform.
+func NewScopedTokenSource(ctx context.Context, credentialsJSON []byte, defaultScopes ...string) (*ScopedTokenSource, error) {
+	if len(defaultScopes) == 0 {
+		defaultScopes = defaultTokenAuthScopes
+	}
+	if parsed, err := Credentials(string(credentialsJSON)); err == nil && parsed.Type == "" {
+		// Keys without a type are service account keys.
+		if credentialsJSON, err = withServiceAccountType(string(credentialsJSON)); err != nil {
+			return nil, fmt.Errorf("unable to parse credentials: %v", err)
+		}
+	}
+	creds, err := google.CredentialsFromJSON(ctx, credentialsJSON, defaultScopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+	}
+	return newScopedTokenSource(jsonTokenSourceFunc(ctx, credentialsJSON), defaultScopes, creds.TokenSource), nil
+}
+
+// newDefaultScopedTokenSource returns a ScopedTokenSource for Application
+// Default Credentials. Credentials from a file are re-read with each scope
+// combination; otherwise tokens come from the metadata server.
+func newDefaultScopedTokenSource(ctx context.Context, defaultScopes ...string) (*ScopedTokenSource, error) {
+	if len(defaultScopes) == 0 {
+		defaultScopes = defaultTokenAuthScopes
+	}
+	creds, err := google.FindDefaultCredentials(ctx, defaultScopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find default credentials: %v", err)
+	}
+	newSource := jsonTokenSourceFunc(ctx, creds.JSON)
+	if len(creds.JSON) == 0 {
+		newSource = func(scopes []string) (oauth2.TokenSource, error) {
+			return NewMetadataTokenSource(nil, "", scopes...), nil
+		}
+	}
+	return newScopedTokenSource(newSource, defaultScopes, creds.TokenSource), nil
+}
+
+// newScopedTokenSource returns a ScopedTokenSource that creates token sources
+// with newSource, seeded with the token source for the default scopes.
+func newScopedTokenSource(newSource func([]string) (oauth2.TokenSource, error), defaultScopes []string, defaultSource oauth2.TokenSource) *ScopedTokenSource {
+	return &ScopedTokenSource{
+		defaultScopes: defaultScopes,
+		newSource:     newSource,
+		sources: map[string]oauth2.TokenSource{
+			scopesKey(defaultScopes): oauth2.ReuseTokenSource(nil, defaultSource),
+		},
+	}
+}
+
+func jsonTokenSourceFunc(ctx context.Context, credentialsJSON []byte) func([]string) (oauth2.TokenSource, error) {
+	return func(scopes []string) (oauth2.TokenSource, error) {
+		creds, err := google.CredentialsFromJSON(ctx, credentialsJSON, scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse credentials: %v", err)
+		}
+		return creds.TokenSource, nil
+	}
+}
+
+// Token returns a token with the default scopes.
+func (s *ScopedTokenSource) Token() (*oauth2.Token, error) {
+	ts, err := s.WithScopes(s.defaultScopes...)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Token()
+}
+
+// WithScopes returns a token source for the given scopes that shares the
+// underlying credentials. If no scopes are given, the default scopes are
+// used.
+func (s *ScopedTokenSource) WithScopes(scopes ...string) (oauth2.TokenSource, error) {
+	if len(scopes) == 0 {
+		scopes = s.defaultScopes
+	}
+	key := scopesKey(scopes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts, ok := s.sources[key]
+	if s.onLookup != nil {
+		s.onLookup(ok)
+	}
+	if ok {
+		return ts, nil
+	}
+	src, err := s.newSource(scopes)
+	if err != nil {
+		return nil, err
+	}
+	ts = oauth2.ReuseTokenSource(nil, src)
+	s.sources[key] = ts
+	return ts, nil
+}
+
+// scopesKey returns a key identifying a combination of scopes regardless of
+// order.
+func scopesKey(scopes []string) string {
+	sorted := append([]string(nil), scopes...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, " ")
+}
+
+// scopedTransport authenticates requests with a token for the scopes in the
+// request context, if any, or with the default token source otherwise.
+type scopedTransport struct {
+	base   http.RoundTripper
+	source oauth2.TokenSource
+	scoped *ScopedTokenSource
+}
+
+func (t *scopedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ts := t.source
+	if scopes, ok := tokenScopesFromContext(req.Context()); ok {
+		if t.scoped == nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, errors.New("per-request scopes are not supported with a configured token source")
+		}
+		var err error
+		if ts, err = t.scoped.WithScopes(scopes...); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return (&oauth2.Transport{Source: ts, Base: t.base}).RoundTrip(req)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testServiceAccountJSON returns service account key JSON for a new RSA key
+// that obtains tokens from tokenURL.
+func testServiceAccountJSON(t *testing.T, tokenURL string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "p",
+		"private_key_id": "key-id",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})),
+		"client_email":   "sa@p.iam.gserviceaccount.com",
+		"client_id":      "123",
+		"token_uri":      tokenURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newTestOAuth2Server returns a token endpoint for JWT bearer grants that
+// issues access tokens of the form "token:<scope>" and records the scopes
+// requested.
+func newTestOAuth2Server(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var claims struct {
+			Scope string `json:"scope"`
+		}
+		json.Unmarshal(payload, &claims)
+
+		mu.Lock()
+		requested = append(requested, claims.Scope)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token:" + claims.Scope,
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requested...)
+	}
+}
+
+func TestScopedTokenSource(t *testing.T) {
+	tokenSrv, requested := newTestOAuth2Server(t)
+	ts, err := NewScopedTokenSource(context.Background(), testServiceAccountJSON(t, tokenSrv.URL), "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tok, err := ts.Token()
+	if err != nil || tok.AccessToken != "token:a" {
+		t.Fatalf("expected token:a, got %v (err: %v)", tok, err)
+	}
+
+	for _, scopes := range [][]string{{"b", "c"}, {"c", "b"}} {
+		scoped, err := ts.WithScopes(scopes...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tok, err := scoped.Token()
+		if err != nil || tok.AccessToken != "token:b c" {
+			t.Fatalf("expected token:b c, got %v (err: %v)", tok, err)
+		}
+	}
+
+	if r := requested(); len(r) != 2 {
+		t.Errorf("expected one token fetch per scope combination, got %v", r)
+	}
+
+	// Keys without a type are service account keys.
+	var key map[string]string
+	if err := json.Unmarshal(testServiceAccountJSON(t, tokenSrv.URL), &key); err != nil {
+		t.Fatal(err)
+	}
+	delete(key, "type")
+	untyped, _ := json.Marshal(key)
+	ts, err = NewScopedTokenSource(context.Background(), untyped, "a")
+	if err != nil {
+		t.Fatalf("unexpected error for an untyped key: %v", err)
+	}
+	scoped, err := ts.WithScopes("d")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok, err := scoped.Token(); err != nil || tok.AccessToken != "token:d" {
+		t.Fatalf("expected token:d, got %v (err: %v)", tok, err)
+	}
+}
+
+func TestClient_WithTokenScopes(t *testing.T) {
+	tokenSrv, _ := newTestOAuth2Server(t)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	metrics := &countingMetrics{}
+	c, err := NewClient(context.Background(), &Options{
+		CredentialsJSON: string(testServiceAccountJSON(t, tokenSrv.URL)),
+		Scopes:          []string{"default"},
+		Metrics:         metrics,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		Context  context.Context
+		Expected string
+	}{
+		"default scopes":    {Context: context.Background(), Expected: "Bearer token:default"},
+		"overridden scopes": {Context: WithTokenScopes(context.Background(), "narrow"), Expected: "Bearer token:narrow"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(tc.Context, http.MethodGet, api.URL, nil)
+			resp, err := c.HTTPClient().Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if string(body) != tc.Expected {
+				t.Errorf("expected %q, got %q", tc.Expected, body)
+			}
+		})
+	}
+
+	// The narrow scopes missed the token source cache once.
+	if misses := metrics.count("gcputil.scoped_token.cache_miss"); misses != 1 {
+		t.Errorf("expected 1 scoped token cache miss, got %d", misses)
+	}
+	if hits := metrics.count("gcputil.scoped_token.cache_hit"); hits == 0 {
+		t.Error("expected scoped token cache hits")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+var secretVersionRegex = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+(/versions/[^/]+)?$`)
+
+// SecretManagerCredentialSource reads a service account key file or an
+// external_account credential configuration from a Secret Manager secret
+// version, so that keys never need to be written to local disk.
+type SecretManagerCredentialSource struct {
+	// SecretVersion is the resource name of the secret version, e.g.
+	// projects/P/secrets/S/versions/3, or of the secret, e.g.
+	// projects/P/secrets/S, to read its latest version.
+	SecretVersion string
+
+	// RefreshInterval, if set, causes TokenSource to re-read the secret
+	// after the interval has elapsed, picking up rotated keys.
+	RefreshInterval time.Duration
+
+	// Client is the Secret Manager client used to read the secret. If nil,
+	// a client using Application Default Credentials (including the
+	// metadata server identity) is created.
+	Client *secretmanager.Service
+}
+
+// CredentialsJSON returns the credential JSON stored in the secret version.
+// If the secret or version does not exist, the returned error wraps
+// ErrCredentialsNotFound.
+func (s *SecretManagerCredentialSource) CredentialsJSON(ctx context.Context) ([]byte, error) {
+	matches := secretVersionRegex.FindStringSubmatch(s.SecretVersion)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid secret version '%s', must be of the form projects/P/secrets/S or projects/P/secrets/S/versions/V", s.SecretVersion)
+	}
+	version := s.SecretVersion
+	if matches[1] == "" {
+		version += "/versions/latest"
+	}
+
+	client := s.Client
+	if client == nil {
+		var err error
+		client, err = secretmanager.NewService(ctx, option.WithScopes(defaultTokenAuthScopes...))
+		if err != nil {
+			return nil, fmt.Errorf("unable to create Secret Manager client: %v", err)
+		}
+	}
+
+	resp, err := client.Projects.Secrets.Versions.Access(version).Context(ctx).Do()
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: secret version '%s' does not exist", ErrCredentialsNotFound, version)
+		}
+		return nil, fmt.Errorf("unable to access secret version '%s': %v", version, err)
+	}
+	if resp.Payload == nil || resp.Payload.Data == "" {
+		return nil, fmt.Errorf("secret version '%s' is empty", version)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode secret version '%s' payload: %v", version, err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("secret version '%s' does not contain credential JSON", version)
+	}
+	return data, nil
+}
+
+// Credentials returns the service account credentials stored in the secret
+// version. For external_account configurations, only the fields shared with
+// the service account key format are populated.
+func (s *SecretManagerCredentialSource) Credentials(ctx context.Context) (*GcpCredentials, error) {
+	data, err := s.CredentialsJSON(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Credentials(string(data))
+}
+
+// TokenSource returns a token source for the credentials stored in the secret
+// version. If RefreshInterval is set, the secret is re-read once the interval
+// has elapsed; if re-reading fails, the previous credentials continue to be
+// used and the secret is re-read on the next call.
+func (s *SecretManagerCredentialSource) TokenSource(ctx context.Context, scopes ...string) (oauth2.TokenSource, error) {
+	ts := &secretManagerTokenSource{
+		ctx:    ctx,
+		source: s,
+		scopes: scopes,
+	}
+	if err := ts.refresh(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+type secretManagerTokenSource struct {
+	ctx    context.Context
+	source *SecretManagerCredentialSource
+	scopes []string
+
+	mu        sync.Mutex
+	ts        oauth2.TokenSource
+	fetchedAt time.Time
+}
+
+func (ts *secretManagerTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.source.RefreshInterval > 0 && time.Since(ts.fetchedAt) >= ts.source.RefreshInterval {
+		if err := ts.refresh(); err != nil && ts.ts == nil {
+			return nil, err
+		}
+	}
+	if ts.ts == nil {
+		return nil, errors.New("no credentials have been read from Secret Manager")
+	}
+	return ts.ts.Token()
+}
+
+// refresh re-reads the secret and replaces the underlying token source.
+func (ts *secretManagerTokenSource) refresh() error {
+	data, err := ts.source.CredentialsJSON(ts.ctx)
+	if err != nil {
+		return err
+	}
+
+	scopes := ts.scopes
+	if len(scopes) == 0 {
+		scopes = defaultTokenAuthScopes
+	}
+	creds, err := google.CredentialsFromJSON(ts.ctx, data, scopes...)
+	if err != nil {
+		return fmt.Errorf("unable to parse credentials from secret version '%s': %v", ts.source.SecretVersion, err)
+	}
+
+	ts.ts = oauth2.ReuseTokenSource(nil, creds.TokenSource)
+	ts.fetchedAt = time.Now()
+	return nil
+}
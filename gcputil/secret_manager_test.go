@@ -0,0 +1,171 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+// fakeSecretManagerServer serves secret version payloads by resource name.
+type fakeSecretManagerServer struct {
+	mu       sync.Mutex
+	versions map[string]string
+	accessed []string
+}
+
+func (s *fakeSecretManagerServer) set(version, payload string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[version] = payload
+}
+
+func (s *fakeSecretManagerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), ":access")
+	s.accessed = append(s.accessed, name)
+	payload, ok := s.versions[name]
+	if !ok || !strings.HasSuffix(r.URL.Path, ":access") {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"Secret Version not found","status":"NOT_FOUND"}}`))
+		return
+	}
+	json.NewEncoder(w).Encode(&secretmanager.AccessSecretVersionResponse{
+		Name:    name,
+		Payload: &secretmanager.SecretPayload{Data: base64.StdEncoding.EncodeToString([]byte(payload))},
+	})
+}
+
+func newTestSecretManager(t *testing.T) (*fakeSecretManagerServer, *secretmanager.Service) {
+	t.Helper()
+	fake := &fakeSecretManagerServer{versions: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	client, err := secretmanager.NewService(context.Background(), option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, client
+}
+
+func TestSecretManagerCredentialSource_CredentialsJSON(t *testing.T) {
+	fake, client := newTestSecretManager(t)
+	fake.set("projects/p/secrets/key/versions/latest", `{"type":"service_account","client_email":"latest@p.iam.gserviceaccount.com"}`)
+	fake.set("projects/p/secrets/key/versions/2", `{"type":"service_account","client_email":"v2@p.iam.gserviceaccount.com"}`)
+	fake.set("projects/p/secrets/text/versions/latest", "not json")
+	fake.set("projects/p/secrets/empty/versions/latest", "")
+
+	tests := map[string]struct {
+		SecretVersion string
+		Accessed      string
+		Email         string
+		ExpectedErr   error
+		ShouldError   bool
+	}{
+		"version": {
+			SecretVersion: "projects/p/secrets/key/versions/2",
+			Accessed:      "projects/p/secrets/key/versions/2",
+			Email:         "v2@p.iam.gserviceaccount.com",
+		},
+		"secret defaults to latest version": {
+			SecretVersion: "projects/p/secrets/key",
+			Accessed:      "projects/p/secrets/key/versions/latest",
+			Email:         "latest@p.iam.gserviceaccount.com",
+		},
+		"version not found": {
+			SecretVersion: "projects/p/secrets/key/versions/3",
+			Accessed:      "projects/p/secrets/key/versions/3",
+			ExpectedErr:   ErrCredentialsNotFound,
+			ShouldError:   true,
+		},
+		"secret not found": {
+			SecretVersion: "projects/p/secrets/missing",
+			Accessed:      "projects/p/secrets/missing/versions/latest",
+			ExpectedErr:   ErrCredentialsNotFound,
+			ShouldError:   true,
+		},
+		"not json": {
+			SecretVersion: "projects/p/secrets/text",
+			Accessed:      "projects/p/secrets/text/versions/latest",
+			ShouldError:   true,
+		},
+		"empty": {
+			SecretVersion: "projects/p/secrets/empty",
+			Accessed:      "projects/p/secrets/empty/versions/latest",
+			ShouldError:   true,
+		},
+		"invalid name": {
+			SecretVersion: "secrets/key",
+			ShouldError:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake.mu.Lock()
+			fake.accessed = nil
+			fake.mu.Unlock()
+
+			source := &SecretManagerCredentialSource{SecretVersion: test.SecretVersion, Client: client}
+			creds, err := source.Credentials(context.Background())
+
+			fake.mu.Lock()
+			accessed := strings.Join(fake.accessed, ",")
+			fake.mu.Unlock()
+			if accessed != test.Accessed {
+				t.Fatalf("expected %q to be accessed, got %q", test.Accessed, accessed)
+			}
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if test.ExpectedErr != nil && !errors.Is(err, test.ExpectedErr) {
+					t.Fatalf("expected %v, got %v", test.ExpectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.ClientEmail != test.Email {
+				t.Fatalf("expected client email %q, got %q", test.Email, creds.ClientEmail)
+			}
+		})
+	}
+}
+
+func TestSecretManagerCredentialSource_TokenSource(t *testing.T) {
+	oauth2Srv, requested := newTestOAuth2Server(t)
+	fake, client := newTestSecretManager(t)
+	fake.set("projects/p/secrets/key/versions/latest", string(testServiceAccountJSON(t, oauth2Srv.URL)))
+
+	source := &SecretManagerCredentialSource{SecretVersion: "projects/p/secrets/key", Client: client}
+	ts, err := source.TokenSource(context.Background(), "https://www.googleapis.com/auth/devstorage.read_only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if scopes := requested(); len(scopes) != 1 || scopes[0] != "https://www.googleapis.com/auth/devstorage.read_only" {
+		t.Fatalf("unexpected requested scopes %v", scopes)
+	}
+
+	source.SecretVersion = "projects/p/secrets/missing"
+	if _, err := source.TokenSource(context.Background()); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("expected %v, got %v", ErrCredentialsNotFound, err)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+const (
+	// secureConnectMetadataFile is the path, relative to the home directory,
+	// of the Endpoint Verification context aware metadata file.
+	secureConnectMetadataFile = ".secureConnect/context_aware_metadata.json"
+
+	// EnvUseClientCertificate enables client certificates from
+	// SecureConnect when set to "true", as in google-api-go-client.
+	EnvUseClientCertificate = "GOOGLE_API_USE_CLIENT_CERTIFICATE"
+
+	// EnvUseMTLSEndpoint selects when mTLS endpoints are used: "auto" (the
+	// default, when a client certificate is available), "always" or
+	// "never", as in google-api-go-client.
+	EnvUseMTLSEndpoint = "GOOGLE_API_USE_MTLS_ENDPOINT"
+
+	secureConnectCommandTimeout = 30 * time.Second
+)
+
+// ErrSecureConnectUnavailable is returned by NewSecureConnectCertificateSource
+// when Endpoint Verification is not configured on the machine.
+var ErrSecureConnectUnavailable = errors.New("secure connect is not configured")
+
+// ClientCertificateSource returns a client certificate for a TLS handshake.
+// It has the signature of tls.Config.GetClientCertificate.
+type ClientCertificateSource func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+
+// NewSecureConnectCertificateSource returns a ClientCertificateSource that
+// obtains device certificates for context-aware access from the
+// Endpoint Verification (SecureConnect) native helper, configured in
+// ~/.secureConnect/context_aware_metadata.json, or configPath if set.
+// Certificates are cached until they expire. ErrSecureConnectUnavailable is
+// returned if the helper is not configured.
+func NewSecureConnectCertificateSource(configPath string) (ClientCertificateSource, error) {
+	if configPath == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, ErrSecureConnectUnavailable
+		}
+		configPath = filepath.Join(home, secureConnectMetadataFile)
+	}
+
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrSecureConnectUnavailable
+		}
+		return nil, err
+	}
+
+	var metadata struct {
+		Cmd []string `json:"cert_provider_command"`
+	}
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return nil, fmt.Errorf("unable to parse secure connect metadata %q: %v", configPath, err)
+	}
+	if len(metadata.Cmd) == 0 {
+		return nil, fmt.Errorf("secure connect metadata %q has an empty cert_provider_command", configPath)
+	}
+
+	// Expand environment variables such as $HOME, as the helper's own
+	// configuration does.
+	cmd := make([]string, len(metadata.Cmd))
+	for i, arg := range metadata.Cmd {
+		cmd[i] = os.ExpandEnv(arg)
+	}
+	s := &secureConnectSource{cmd: cmd}
+	return s.getClientCertificate, nil
+}
+
+type secureConnectSource struct {
+	cmd []string
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+func (s *secureConnectSource) getClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cert != nil && !certificateExpired(s.cert) {
+		return s.cert, nil
+	}
+
+	out, err := runCredentialCommand(context.Background(), secureConnectCommandTimeout, nil, s.cmd[0], s.cmd[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain secure connect certificate: %v", err)
+	}
+	// The helper prints the certificate and private key as PEM.
+	cert, err := tls.X509KeyPair(out, out)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse secure connect certificate: %v", err)
+	}
+	s.cert = &cert
+	return s.cert, nil
+}
+
+func certificateExpired(cert *tls.Certificate) bool {
+	if len(cert.Certificate) == 0 {
+		return true
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return true
+	}
+	return time.Now().After(parsed.NotAfter)
+}
+
+// defaultClientCertificateSource returns the SecureConnect certificate source
+// if enabled with GOOGLE_API_USE_CLIENT_CERTIFICATE, or nil.
+func defaultClientCertificateSource() (ClientCertificateSource, error) {
+	if !strings.EqualFold(os.Getenv(EnvUseClientCertificate), "true") {
+		return nil, nil
+	}
+	source, err := NewSecureConnectCertificateSource("")
+	if err == ErrSecureConnectUnavailable {
+		return nil, nil
+	}
+	return source, err
+}
+
+// useMTLSEndpoints reports whether mTLS endpoints should be used, according
+// to GOOGLE_API_USE_MTLS_ENDPOINT.
+func useMTLSEndpoints(haveClientCert bool) bool {
+	switch strings.ToLower(os.Getenv(EnvUseMTLSEndpoint)) {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return haveClientCert
+	}
+}
+
+// mtls returns a copy of the endpoints with *.googleapis.com hosts replaced
+// by their *.mtls.googleapis.com counterparts.
+func (e *GCPEndpoints) mtls() *GCPEndpoints {
+	c := *e
+	for _, f := range c.fields() {
+		*f.value = mtlsEndpoint(*f.value)
+	}
+	return &c
+}
+
+// mtlsEndpoint returns the mTLS variant of a googleapis.com endpoint, e.g.
+// https://iam.mtls.googleapis.com for https://iam.googleapis.com. Other
+// endpoints are returned unchanged.
+func mtlsEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	host := u.Hostname()
+	if !strings.HasSuffix(host, ".googleapis.com") || strings.HasSuffix(host, ".mtls.googleapis.com") {
+		return endpoint
+	}
+	port := u.Port()
+	u.Host = strings.TrimSuffix(host, ".googleapis.com") + ".mtls.googleapis.com"
+	if port != "" {
+		u.Host += ":" + port
+	}
+	return u.String()
+}
+
+// withClientCertificate returns a copy of base that presents client
+// certificates from source. Base must be an *http.Transport.
+func withClientCertificate(base http.RoundTripper, source ClientCertificateSource) (http.RoundTripper, error) {
+	t, ok := transportOrDefault(base).(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("client certificates require an *http.Transport, got %T", base)
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.GetClientCertificate = source
+	return t, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMTLSEndpoint(t *testing.T) {
+	tests := map[string]struct {
+		Endpoint string
+		Expected string
+	}{
+		"service":       {"https://iam.googleapis.com", "https://iam.mtls.googleapis.com"},
+		"with path":     {"https://compute.googleapis.com/compute/v1/", "https://compute.mtls.googleapis.com/compute/v1/"},
+		"with port":     {"https://sts.googleapis.com:443", "https://sts.mtls.googleapis.com:443"},
+		"already mtls":  {"https://iam.mtls.googleapis.com", "https://iam.mtls.googleapis.com"},
+		"other domain":  {"https://iam.example.com", "https://iam.example.com"},
+		"private vip":   {"https://private.googleapis.com", "https://private.mtls.googleapis.com"},
+		"lookalike tld": {"https://iam.googleapis.com.evil.com", "https://iam.googleapis.com.evil.com"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := mtlsEndpoint(tc.Endpoint); actual != tc.Expected {
+				t.Errorf("expected %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestSecureConnectCertificateSource(t *testing.T) {
+	if _, err := NewSecureConnectCertificateSource(filepath.Join(t.TempDir(), "missing.json")); err != ErrSecureConnectUnavailable {
+		t.Errorf("expected ErrSecureConnectUnavailable, got %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "device"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	pemPath := filepath.Join(dir, "cert.pem")
+	pemBytes := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	if err := os.WriteFile(pemPath, pemBytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	helper := writeTestScript(t, `cat "$1"`)
+	configPath := filepath.Join(dir, "context_aware_metadata.json")
+	config, _ := json.Marshal(map[string][]string{"cert_provider_command": {helper, pemPath}})
+	if err := os.WriteFile(configPath, config, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := NewSecureConnectCertificateSource(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, err := source(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cert.Certificate) != 1 {
+		t.Errorf("expected a certificate, got %d", len(cert.Certificate))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFindCredentialsWithOptions_selfSignedJWT(t *testing.T) {
+	t.Setenv(EnvOAuthAccessToken, "")
+	creds, ts, err := FindCredentialsWithOptions(context.Background(), &FindCredentialsOptions{
+		CredentialsJSON: string(testServiceAccountJSON(t, "http://127.0.0.1:0")),
+		Scopes:          []string{"a", "b"},
+		SelfSignedJWT:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(tok.AccessToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected a JWT, got %q", tok.AccessToken)
+	}
+	var header struct {
+		Kid string `json:"kid"`
+	}
+	var claims struct {
+		Iss   string `json:"iss"`
+		Sub   string `json:"sub"`
+		Scope string `json:"scope"`
+		Exp   int64  `json:"exp"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		t.Fatal(err)
+	}
+	if header.Kid != creds.PrivateKeyId {
+		t.Fatalf("unexpected kid %q", header.Kid)
+	}
+	if claims.Iss != creds.ClientEmail || claims.Sub != creds.ClientEmail || claims.Scope != "a b" || claims.Exp != tok.Expiry.Unix() {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestNewSelfSignedJWTTokenSource_invalid(t *testing.T) {
+	tests := map[string]*GcpCredentials{
+		"nil":         nil,
+		"no email":    {PrivateKey: "key"},
+		"no key":      {ClientEmail: "sa@p.iam.gserviceaccount.com"},
+		"invalid key": {ClientEmail: "sa@p.iam.gserviceaccount.com", PrivateKey: "not a key"},
+	}
+	for name, creds := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewSelfSignedJWTTokenSource(creds); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
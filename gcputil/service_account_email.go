@@ -0,0 +1,129 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	serviceAccountDomainSuffix = ".gserviceaccount.com"
+	iamServiceAccountDomain    = ".iam" + serviceAccountDomainSuffix
+	appSpotServiceAccountHost  = "appspot" + serviceAccountDomainSuffix
+	computeServiceAccountHost  = "developer" + serviceAccountDomainSuffix
+	computeServiceAccountLocal = "-compute"
+	serviceAgentDomainPrefix   = "gcp-sa-"
+)
+
+var (
+	serviceAccountEmailRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}@(?:[a-z0-9-]+\.)+gserviceaccount\.com$`)
+	serviceAccountIDRegex    = regexp.MustCompile(`^[0-9]{1,30}$`)
+)
+
+// ServiceAccountEmail is the email of a service account, e.g.
+// my-sa@my-project.iam.gserviceaccount.com. Values returned by
+// ParseServiceAccountEmail are valid and lower case.
+type ServiceAccountEmail string
+
+// ParseServiceAccountEmail validates a service account email. Emails are
+// case-insensitive and normalized to lower case.
+func ParseServiceAccountEmail(email string) (ServiceAccountEmail, error) {
+	normalized := strings.ToLower(strings.TrimSpace(email))
+	if !serviceAccountEmailRegex.MatchString(normalized) {
+		return "", fmt.Errorf("invalid service account email %q", email)
+	}
+	return ServiceAccountEmail(normalized), nil
+}
+
+// String returns the email.
+func (e ServiceAccountEmail) String() string {
+	return string(e)
+}
+
+// Valid reports whether the email is a syntactically valid service account
+// email.
+func (e ServiceAccountEmail) Valid() bool {
+	return serviceAccountEmailRegex.MatchString(string(e))
+}
+
+// Project returns the ID of the project that owns the service account, if it
+// can be derived from the email: for user-managed service accounts
+// (NAME@PROJECT.iam.gserviceaccount.com, including domain-scoped projects)
+// and App Engine default service accounts (PROJECT@appspot.gserviceaccount.com).
+// It returns an empty string otherwise, e.g. for the Compute Engine default
+// service account, whose email only contains the project number.
+func (e ServiceAccountEmail) Project() string {
+	local, host := e.split()
+	switch {
+	case host == appSpotServiceAccountHost:
+		return local
+	case strings.HasSuffix(host, iamServiceAccountDomain) && !strings.HasPrefix(host, serviceAgentDomainPrefix):
+		project := strings.TrimSuffix(host, iamServiceAccountDomain)
+		// Domain-scoped projects, e.g. example.com:my-project, have emails
+		// of the form NAME@my-project.example.com.iam.gserviceaccount.com.
+		if idx := strings.Index(project, "."); idx >= 0 {
+			return project[idx+1:] + ":" + project[:idx]
+		}
+		return project
+	}
+	return ""
+}
+
+// ProjectNumber returns the project number of a Compute Engine default
+// service account (NUMBER-compute@developer.gserviceaccount.com), or an
+// empty string for other service accounts.
+func (e ServiceAccountEmail) ProjectNumber() string {
+	if !e.IsDefaultComputeSA() {
+		return ""
+	}
+	local, _ := e.split()
+	return strings.TrimSuffix(local, computeServiceAccountLocal)
+}
+
+// IsDefaultComputeSA reports whether the email is that of a project's
+// Compute Engine default service account.
+func (e ServiceAccountEmail) IsDefaultComputeSA() bool {
+	local, host := e.split()
+	return host == computeServiceAccountHost &&
+		serviceAccountIDRegex.MatchString(strings.TrimSuffix(local, computeServiceAccountLocal)) &&
+		strings.HasSuffix(local, computeServiceAccountLocal)
+}
+
+// IsAppSpotSA reports whether the email is that of a project's App Engine
+// default service account.
+func (e ServiceAccountEmail) IsAppSpotSA() bool {
+	_, host := e.split()
+	return host == appSpotServiceAccountHost
+}
+
+// ServiceAccountId returns the ID of the service account for use with the
+// IAM API. The project is "-" if it cannot be derived from the email.
+func (e ServiceAccountEmail) ServiceAccountId() *ServiceAccountId {
+	project := e.Project()
+	if project == "" {
+		project = "-"
+	}
+	return &ServiceAccountId{Project: project, EmailOrId: string(e)}
+}
+
+// split returns the local part and host of a valid email, or empty strings.
+func (e ServiceAccountEmail) split() (string, string) {
+	if !e.Valid() {
+		return "", ""
+	}
+	idx := strings.LastIndex(string(e), "@")
+	return string(e[:idx]), string(e[idx+1:])
+}
+
+// validateServiceAccountRef checks that s is a service account email or
+// numeric unique ID, which are used interchangeably in IAM resource names.
+func validateServiceAccountRef(s string) error {
+	if serviceAccountIDRegex.MatchString(s) {
+		return nil
+	}
+	_, err := ParseServiceAccountEmail(s)
+	return err
+}
@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseServiceAccountEmail(t *testing.T) {
+	tests := map[string]struct {
+		Email         string
+		Project       string
+		ProjectNumber string
+		Compute       bool
+		AppSpot       bool
+		ShouldError   bool
+	}{
+		"user managed": {
+			Email:   "my-sa@my-project.iam.gserviceaccount.com",
+			Project: "my-project",
+		},
+		"mixed case": {
+			Email:   " My-SA@My-Project.iam.gserviceaccount.com ",
+			Project: "my-project",
+		},
+		"domain scoped": {
+			Email:   "my-sa@my-project.example.com.iam.gserviceaccount.com",
+			Project: "example.com:my-project",
+		},
+		"compute default": {
+			Email:         "123456789-compute@developer.gserviceaccount.com",
+			ProjectNumber: "123456789",
+			Compute:       true,
+		},
+		"app engine default": {
+			Email:   "my-project@appspot.gserviceaccount.com",
+			Project: "my-project",
+			AppSpot: true,
+		},
+		"service agent": {
+			Email: "service-123@gcp-sa-pubsub.iam.gserviceaccount.com",
+		},
+		"not a service account": {
+			Email:       "user@example.com",
+			ShouldError: true,
+		},
+		"suffix only": {
+			Email:       "sa@.gserviceaccount.com",
+			ShouldError: true,
+		},
+		"path injection": {
+			Email:       "sa@p.iam.gserviceaccount.com/keys/1",
+			ShouldError: true,
+		},
+		"empty": {
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			email, err := ParseServiceAccountEmail(test.Email)
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			if email.Project() != test.Project || email.ProjectNumber() != test.ProjectNumber {
+				t.Errorf("expected project %q (%q), got %q (%q)", test.Project, test.ProjectNumber, email.Project(), email.ProjectNumber())
+			}
+			if email.IsDefaultComputeSA() != test.Compute || email.IsAppSpotSA() != test.AppSpot {
+				t.Errorf("unexpected predicates for %s", email)
+			}
+		})
+	}
+
+	var zero ServiceAccountEmail
+	if zero.String() != "" || zero.Valid() || zero.Project() != "" || zero.ServiceAccountId().Project != "-" {
+		t.Error("unexpected zero value behavior")
+	}
+}
+
+func TestValidateServiceAccountRef(t *testing.T) {
+	for ref, valid := range map[string]bool{
+		"sa@p.iam.gserviceaccount.com":      true,
+		"123456789012345678901":             true,
+		"sa@p.iam.gserviceaccount.com/../x": false,
+		"user@example.com":                  false,
+	} {
+		if err := validateServiceAccountRef(ref); valid != (err == nil) {
+			t.Errorf("%q: expected valid: %t, got %v", ref, valid, err)
+		}
+	}
+}
+
+func TestServiceAccountPublicKey_invalidServiceAccount(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := ServiceAccountPublicKeyWithEndpoint(context.Background(), "sa@p.iam.gserviceaccount.com/../x", "kid", srv.URL); err == nil {
+		t.Error("expected error for an invalid service account")
+	}
+	if calls != 0 {
+		t.Errorf("expected no request for an invalid service account, got %d", calls)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// redactedPrivateKey replaces the private key in redacted credentials.
+const redactedPrivateKey = "<redacted>"
+
+// Redacted returns a copy of the credentials with the private key masked,
+// which is safe to log or return from diagnostic endpoints.
+func (c GcpCredentials) Redacted() GcpCredentials {
+	if c.PrivateKey != "" {
+		c.PrivateKey = redactedPrivateKey
+	}
+	return c
+}
+
+// MarshalJSON marshals the credentials with the private key masked, so key
+// material is not leaked when credentials are logged. Use Credentials to
+// parse credential JSON and keep the original JSON to persist a key.
+func (c GcpCredentials) MarshalJSON() ([]byte, error) {
+	type credentials GcpCredentials
+	return json.Marshal(credentials(c.Redacted()))
+}
+
+// Validate checks that the credentials are a usable service account key:
+// the type is service_account, client_email, private_key_id and private_key
+// are set, and the private key parses. Credentials parses JSON leniently, so
+// call Validate to surface malformed keys before they are used for tokens.
+// With an AssertionSigner, private_key_id and private_key are not required.
+func (c *GcpCredentials) Validate() error {
+	if c.Type != CredentialTypeServiceAccount {
+		return fmt.Errorf("credentials type must be %q, got %q", CredentialTypeServiceAccount, c.Type)
+	}
+	var missing []string
+	if c.ClientEmail == "" {
+		missing = append(missing, "client_email")
+	}
+	if c.AssertionSigner == nil && c.PrivateKeyId == "" {
+		missing = append(missing, "private_key_id")
+	}
+	if c.AssertionSigner == nil && c.PrivateKey == "" {
+		missing = append(missing, "private_key")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("credentials are missing required fields: %v", missing)
+	}
+	if c.AssertionSigner != nil {
+		return nil
+	}
+	if _, err := parsePrivateKey(c.PrivateKey, c.PrivateKeyPassphrase); err != nil {
+		return fmt.Errorf("invalid private_key: %w", err)
+	}
+	return nil
+}
+
+// Signer returns a crypto.Signer for the private key of the credentials.
+// The key may be PEM-encoded as PKCS#8, PKCS#1 (RSA) or SEC 1 (EC).
+func (c *GcpCredentials) Signer() (crypto.Signer, error) {
+	if c.PrivateKey == "" {
+		return nil, errors.New("credentials have no private key")
+	}
+	return parsePrivateKey(c.PrivateKey, c.PrivateKeyPassphrase)
+}
+
+// parsePrivateKey parses a PEM-encoded PKCS#8, PKCS#1 or SEC 1 private key,
+// which is decrypted with the passphrase from passphraseFunc if encrypted.
+// In FIPS mode, keys that do not comply are rejected.
+func parsePrivateKey(pemKey string, passphraseFunc PassphraseFunc) (crypto.Signer, error) {
+	key, err := decodePrivateKey(pemKey, passphraseFunc)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFIPSPublicKey(key.Public()); err != nil {
+		ZeroizeSigner(key)
+		return nil, err
+	}
+	return key, nil
+}
+
+// decodePrivateKey decodes a private key for parsePrivateKey. The
+// intermediate copies of the key material are wiped once it is parsed.
+func decodePrivateKey(pemKey string, passphraseFunc PassphraseFunc) (crypto.Signer, error) {
+	pemBytes := []byte(pemKey)
+	defer zeroBytes(pemBytes)
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("unable to find pem block in key")
+	}
+	defer zeroBytes(block.Bytes)
+	der := block.Bytes
+	if isEncryptedPEMBlock(block) {
+		var err error
+		if der, err = decryptPEMBlock(block, passphraseFunc); err != nil {
+			return nil, err
+		}
+		defer zeroBytes(der)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case *ecdsa.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("private key is not a PKCS#8, PKCS#1 or SEC 1 key")
+}
+
+// Zeroize removes the private key from the credentials, e.g. once a Signer
+// has been constructed from it. Go strings cannot be overwritten, so the key
+// string is released rather than wiped; use ZeroizeSigner to wipe the key
+// material of a Signer when it is no longer needed.
+func (c *GcpCredentials) Zeroize() {
+	c.PrivateKey = ""
+}
+
+// ZeroizeSigner overwrites the private key material of an RSA or ECDSA
+// signer returned by GcpCredentials.Signer. The signer must not be used
+// afterwards. Other signers are left unchanged.
+func ZeroizeSigner(signer crypto.Signer) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		zeroBigInt(key.D)
+		for _, p := range key.Primes {
+			zeroBigInt(p)
+		}
+		zeroBigInt(key.Precomputed.Dp)
+		zeroBigInt(key.Precomputed.Dq)
+		zeroBigInt(key.Precomputed.Qinv)
+		for _, v := range key.Precomputed.CRTValues {
+			zeroBigInt(v.Exp)
+			zeroBigInt(v.Coeff)
+			zeroBigInt(v.R)
+		}
+	case *ecdsa.PrivateKey:
+		zeroBigInt(key.D)
+	}
+}
+
+func zeroBigInt(n *big.Int) {
+	if n == nil {
+		return
+	}
+	words := n.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	n.SetInt64(0)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
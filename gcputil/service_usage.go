@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/serviceusage/v1"
+)
+
+const (
+	// Service names of the APIs used by this package.
+	IAMServiceName                  = "iam.googleapis.com"
+	IAMCredentialsServiceName       = "iamcredentials.googleapis.com"
+	STSServiceName                  = "sts.googleapis.com"
+	CloudResourceManagerServiceName = "cloudresourcemanager.googleapis.com"
+
+	// serviceUsageBatchGetLimit is the maximum number of services accepted
+	// by a single services.batchGet call.
+	serviceUsageBatchGetLimit = 30
+)
+
+// DefaultRequiredServices are the APIs used by the Vault GCP integrations.
+var DefaultRequiredServices = []string{
+	IAMServiceName,
+	IAMCredentialsServiceName,
+	STSServiceName,
+	CloudResourceManagerServiceName,
+}
+
+// DisabledServicesError is returned by CheckRequiredServices when required
+// APIs are not enabled in a project.
+type DisabledServicesError struct {
+	Project  string
+	Services []string
+}
+
+func (e *DisabledServicesError) Error() string {
+	return fmt.Sprintf("required APIs are not enabled in project %q: %s; enable them with "+
+		"`gcloud services enable %s --project %s` or at https://console.cloud.google.com/apis/library?project=%s",
+		e.Project, strings.Join(e.Services, ", "), strings.Join(e.Services, " "), e.Project, e.Project)
+}
+
+// CheckRequiredServices uses the Service Usage API to check that the given
+// services (e.g. "iam.googleapis.com", or "iam" for short) are enabled in the
+// project. If no services are given, DefaultRequiredServices are checked. It
+// returns the sorted list of disabled services and, if any are disabled, a
+// *DisabledServicesError with guidance on enabling them.
+func CheckRequiredServices(ctx context.Context, suClient *serviceusage.Service, project string, services ...string) ([]string, error) {
+	if len(services) == 0 {
+		services = DefaultRequiredServices
+	}
+
+	required := map[string]struct{}{}
+	names := make([]string, 0, len(services))
+	for _, svc := range services {
+		if !strings.Contains(svc, ".") {
+			svc += ".googleapis.com"
+		}
+		if _, ok := required[svc]; ok {
+			continue
+		}
+		required[svc] = struct{}{}
+		names = append(names, fmt.Sprintf("projects/%s/services/%s", project, svc))
+	}
+
+	var disabled []string
+	for start := 0; start < len(names); start += serviceUsageBatchGetLimit {
+		end := start + serviceUsageBatchGetLimit
+		if end > len(names) {
+			end = len(names)
+		}
+
+		resp, err := suClient.Services.BatchGet("projects/" + project).Names(names[start:end]...).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("unable to check enabled services in project %q: %v", project, err)
+		}
+		for _, svc := range resp.Services {
+			if svc == nil || svc.State == "ENABLED" {
+				continue
+			}
+			disabled = append(disabled, svc.Name[strings.LastIndex(svc.Name, "/")+1:])
+		}
+	}
+
+	if len(disabled) == 0 {
+		return nil, nil
+	}
+	sort.Strings(disabled)
+	return disabled, &DisabledServicesError{Project: project, Services: disabled}
+}
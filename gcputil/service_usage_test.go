@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/serviceusage/v1"
+)
+
+// fakeServiceUsageServer answers services.batchGet for project "p", reporting
+// the services in enabled as ENABLED and all others as DISABLED.
+type fakeServiceUsageServer struct {
+	mu      sync.Mutex
+	enabled map[string]bool
+	batches [][]string
+}
+
+func (s *fakeServiceUsageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path != "/v1/projects/p/services:batchGet" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":{"code":403,"message":"permission denied","status":"PERMISSION_DENIED"}}`))
+		return
+	}
+
+	names := r.URL.Query()["names"]
+	s.batches = append(s.batches, names)
+	resp := &serviceusage.BatchGetServicesResponse{}
+	for _, name := range names {
+		state := "DISABLED"
+		if s.enabled[name[strings.LastIndex(name, "/")+1:]] {
+			state = "ENABLED"
+		}
+		resp.Services = append(resp.Services, &serviceusage.GoogleApiServiceusageV1Service{Name: name, State: state})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestCheckRequiredServices(t *testing.T) {
+	many := make([]string, serviceUsageBatchGetLimit+5)
+	for i := range many {
+		many[i] = fmt.Sprintf("api%d.googleapis.com", i)
+	}
+
+	tests := map[string]struct {
+		Project     string
+		Services    []string
+		Enabled     []string
+		Disabled    []string
+		Batches     int
+		ShouldError bool
+	}{
+		"defaults enabled": {
+			Project: "p",
+			Enabled: DefaultRequiredServices,
+			Batches: 1,
+		},
+		"defaults partly disabled": {
+			Project:     "p",
+			Enabled:     []string{IAMServiceName, CloudResourceManagerServiceName},
+			Disabled:    []string{IAMCredentialsServiceName, STSServiceName},
+			Batches:     1,
+			ShouldError: true,
+		},
+		"short names deduplicated": {
+			Project:     "p",
+			Services:    []string{"iam", "iam.googleapis.com", "sts"},
+			Enabled:     []string{IAMServiceName},
+			Disabled:    []string{STSServiceName},
+			Batches:     1,
+			ShouldError: true,
+		},
+		"batched": {
+			Project:     "p",
+			Services:    many,
+			Enabled:     many[1:],
+			Disabled:    many[:1],
+			Batches:     2,
+			ShouldError: true,
+		},
+		"api error": {
+			Project:     "other",
+			Services:    []string{"iam"},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeServiceUsageServer{enabled: map[string]bool{}}
+			for _, svc := range test.Enabled {
+				fake.enabled[svc] = true
+			}
+			srv := httptest.NewServer(fake)
+			t.Cleanup(srv.Close)
+			suClient, err := serviceusage.NewService(context.Background(), option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			disabled, err := CheckRequiredServices(context.Background(), suClient, test.Project, test.Services...)
+			if len(fake.batches) != test.Batches {
+				t.Fatalf("expected %d batchGet calls, got %d", test.Batches, len(fake.batches))
+			}
+			for _, batch := range fake.batches {
+				if len(batch) > serviceUsageBatchGetLimit {
+					t.Fatalf("batch of %d services exceeds the limit", len(batch))
+				}
+			}
+			if !reflect.DeepEqual(disabled, test.Disabled) {
+				t.Fatalf("expected disabled services %v, got %v", test.Disabled, disabled)
+			}
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				var disabledErr *DisabledServicesError
+				if test.Disabled != nil && (!errors.As(err, &disabledErr) || !reflect.DeepEqual(disabledErr.Services, test.Disabled)) {
+					t.Fatalf("expected DisabledServicesError for %v, got %v", test.Disabled, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// EnvOAuthAccessToken is the environment variable holding a raw OAuth 2.0
+// access token, as used by the Google Terraform provider.
+const EnvOAuthAccessToken = "GOOGLE_OAUTH_ACCESS_TOKEN"
+
+// staticAccessTokenSource returns a fixed access token obtained from source.
+// The token's expiry is usually unknown, in which case it is returned until
+// the API rejects it; if it is known, an expired token is reported as such
+// instead of being sent.
+type staticAccessTokenSource struct {
+	token  oauth2.Token
+	source string
+}
+
+func (ts *staticAccessTokenSource) Token() (*oauth2.Token, error) {
+	if !ts.token.Expiry.IsZero() && !ts.token.Valid() {
+		return nil, fmt.Errorf("static access token from %s expired at %v", ts.source, ts.token.Expiry)
+	}
+	tok := ts.token
+	return &tok, nil
+}
+
+// NewStaticAccessTokenSource returns a token source for a fixed access
+// token, e.g. a short-lived token injected by CI or an operator. If expiry is
+// zero, the token is used until the API rejects it; otherwise it is reported
+// as expired once expiry has passed. FindCredentialsOptions.AccessToken uses
+// the same token source.
+func NewStaticAccessTokenSource(token string, expiry time.Time) (oauth2.TokenSource, error) {
+	return newStaticAccessTokenSource(token, expiry, "static access token")
+}
+
+// accessTokenFromEnv returns a token source for the access token in
+// GOOGLE_OAUTH_ACCESS_TOKEN, or nil if it is not set.
+func accessTokenFromEnv() (oauth2.TokenSource, error) {
+	token := os.Getenv(EnvOAuthAccessToken)
+	if strings.TrimSpace(token) == "" {
+		return nil, nil
+	}
+	return newStaticAccessTokenSource(token, time.Time{}, EnvOAuthAccessToken)
+}
+
+func newStaticAccessTokenSource(token string, expiry time.Time, source string) (oauth2.TokenSource, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, fmt.Errorf("%s is empty", source)
+	}
+	if strings.ContainsAny(token, " \t\r\n") {
+		return nil, fmt.Errorf("%s must contain a single access token", source)
+	}
+	return &staticAccessTokenSource{
+		token:  oauth2.Token{AccessToken: token, TokenType: "Bearer", Expiry: expiry},
+		source: source,
+	}, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestFindCredentials_accessTokenEnv(t *testing.T) {
+	tests := map[string]struct {
+		Value       string
+		ShouldError bool
+	}{
+		"token":          {Value: "ya29.token"},
+		"trimmed":        {Value: " ya29.token\n"},
+		"multiple words": {Value: "Bearer ya29.token", ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvOAuthAccessToken, test.Value)
+			t.Setenv("GOOGLE_CREDENTIALS", `{"client_email":"ignored@p.iam.gserviceaccount.com"}`)
+
+			creds, ts, err := FindCredentials("", context.Background())
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			if creds.ClientEmail != "" {
+				t.Errorf("expected empty credentials, got %+v", creds)
+			}
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != "ya29.token" || tok.TokenType != "Bearer" || !tok.Expiry.IsZero() {
+				t.Errorf("unexpected token %+v", tok)
+			}
+		})
+	}
+}
+
+func TestStaticAccessTokenSource_expired(t *testing.T) {
+	ts := &staticAccessTokenSource{
+		token:  oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(-time.Minute)},
+		source: "test",
+	}
+	if _, err := ts.Token(); err == nil {
+		t.Fatal("expected error for an expired token")
+	}
+}
+
+func TestFindCredentialsWithOptions_accessToken(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	tests := map[string]struct {
+		Token       string
+		Expiry      time.Time
+		ShouldError bool
+	}{
+		"token":             {Token: "ya29.token"},
+		"token with expiry": {Token: "ya29.token", Expiry: expiry},
+		"multiple words":    {Token: "Bearer ya29.token", ShouldError: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(EnvOAuthAccessToken, "ya29.env")
+
+			found, err := FindCredentialsWithSource(context.Background(), &FindCredentialsOptions{
+				AccessToken:       test.Token,
+				AccessTokenExpiry: test.Expiry,
+			})
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			if found.Source != CredentialSourceAccessToken {
+				t.Errorf("unexpected source %q", found.Source)
+			}
+			tok, err := found.TokenSource.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok.AccessToken != "ya29.token" || !tok.Expiry.Equal(test.Expiry) {
+				t.Errorf("unexpected token %+v", tok)
+			}
+		})
+	}
+}
+
+func TestNewStaticAccessTokenSource(t *testing.T) {
+	if _, err := NewStaticAccessTokenSource(" ", time.Time{}); err == nil {
+		t.Fatal("expected error for an empty token")
+	}
+	ts, err := NewStaticAccessTokenSource("ya29.token", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Token(); err == nil {
+		t.Fatal("expected error for an expired token")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google/externalaccount"
+)
+
+// maxSubjectTokenSize bounds the size of subject tokens that are read.
+const maxSubjectTokenSize = 1 << 20
+
+var (
+	_ externalaccount.SubjectTokenSupplier = &FileSubjectTokenSupplier{}
+	_ externalaccount.SubjectTokenSupplier = &URLSubjectTokenSupplier{}
+)
+
+// NewSubjectTokenSupplier returns a subject token supplier for
+// ExternalAccountConfig.TokenSupplier that reads tokens from the file or URL
+// of a credential source, as the credential_source of an external_account
+// configuration does.
+func NewSubjectTokenSupplier(source *ExternalAccountCredentialSource) (externalaccount.SubjectTokenSupplier, error) {
+	if source == nil {
+		return nil, errors.New("a credential source is required")
+	}
+	if err := source.validate(); err != nil {
+		return nil, err
+	}
+	if source.File != "" {
+		return &FileSubjectTokenSupplier{Path: source.File, Format: source.Format}, nil
+	}
+	return &URLSubjectTokenSupplier{URL: source.URL, Headers: source.Headers, Format: source.Format}, nil
+}
+
+// FileSubjectTokenSupplier reads the subject token from a file on each call,
+// e.g. a projected Kubernetes service account token, which is rotated in
+// place.
+type FileSubjectTokenSupplier struct {
+	// Path is the path of the file holding the subject token.
+	Path string
+
+	// Format is the format of the file. Defaults to plain text.
+	Format *ExternalAccountCredentialFormat
+}
+
+// SubjectToken implements externalaccount.SubjectTokenSupplier.
+func (s *FileSubjectTokenSupplier) SubjectToken(ctx context.Context, _ externalaccount.SupplierOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read subject token file: %v", err)
+	}
+	defer f.Close()
+
+	b, err := readSubjectToken(&contextReader{ctx: ctx, r: f})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		return "", fmt.Errorf("unable to read subject token file %s: %v", s.Path, err)
+	}
+	return parseSubjectToken(b, s.Format)
+}
+
+// URLSubjectTokenSupplier fetches the subject token from a URL on each call,
+// e.g. a local metadata endpoint of another cloud.
+type URLSubjectTokenSupplier struct {
+	// URL is the endpoint that returns the subject token with a GET request.
+	URL string
+
+	// Headers are set on requests to URL.
+	Headers map[string]string
+
+	// Format is the format of the response. Defaults to plain text.
+	Format *ExternalAccountCredentialFormat
+
+	// HTTPClient is used for requests. Defaults to the oauth2.HTTPClient of
+	// the context, or the package default HTTP client.
+	HTTPClient *http.Client
+}
+
+// SubjectToken implements externalaccount.SubjectTokenSupplier.
+func (s *URLSubjectTokenSupplier) SubjectToken(ctx context.Context, _ externalaccount.SupplierOptions) (string, error) {
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		var ok bool
+		if httpClient, ok = ctx.Value(oauth2.HTTPClient).(*http.Client); !ok {
+			httpClient = packageHTTPClient()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch subject token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unable to fetch subject token: %s returned status %d", s.URL, resp.StatusCode)
+	}
+
+	b, err := readSubjectToken(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to read subject token response: %v", err)
+	}
+	return parseSubjectToken(b, s.Format)
+}
+
+func readSubjectToken(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxSubjectTokenSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxSubjectTokenSize {
+		return nil, fmt.Errorf("subject token is larger than %d bytes", maxSubjectTokenSize)
+	}
+	return b, nil
+}
+
+// parseSubjectToken extracts the subject token from file contents or a
+// response body in the given format.
+func parseSubjectToken(b []byte, format *ExternalAccountCredentialFormat) (string, error) {
+	var token string
+	if format == nil || format.Type != "json" {
+		token = strings.TrimSpace(string(b))
+	} else {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return "", fmt.Errorf("unable to parse subject token JSON: %v", err)
+		}
+		token, _ = fields[format.SubjectTokenFieldName].(string)
+	}
+	if token == "" {
+		return "", errors.New("subject token is empty")
+	}
+	return token, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+	"golang.org/x/oauth2/google/externalaccount"
+)
+
+func TestNewSubjectTokenSupplier(t *testing.T) {
+	dir := t.TempDir()
+	textFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(textFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	jsonFile := filepath.Join(dir, "token.json")
+	if err := os.WriteFile(jsonFile, []byte(`{"id_token":"json-file-token"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"access_token":"url-token"}`))
+	}))
+	defer srv.Close()
+	jsonFormat := func(field string) *ExternalAccountCredentialFormat {
+		return &ExternalAccountCredentialFormat{Type: "json", SubjectTokenFieldName: field}
+	}
+
+	tests := map[string]struct {
+		Source      *ExternalAccountCredentialSource
+		Expected    string
+		ShouldError bool
+	}{
+		"text file": {
+			Source:   &ExternalAccountCredentialSource{File: textFile},
+			Expected: "file-token",
+		},
+		"json file": {
+			Source:   &ExternalAccountCredentialSource{File: jsonFile, Format: jsonFormat("id_token")},
+			Expected: "json-file-token",
+		},
+		"url": {
+			Source:   &ExternalAccountCredentialSource{URL: srv.URL, Headers: map[string]string{"Metadata": "true"}, Format: jsonFormat("access_token")},
+			Expected: "url-token",
+		},
+		"url error status": {
+			Source:      &ExternalAccountCredentialSource{URL: srv.URL},
+			ShouldError: true,
+		},
+		"missing field": {
+			Source:      &ExternalAccountCredentialSource{File: jsonFile, Format: jsonFormat("token")},
+			ShouldError: true,
+		},
+		"missing file": {
+			Source:      &ExternalAccountCredentialSource{File: filepath.Join(dir, "missing")},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			supplier, err := NewSubjectTokenSupplier(test.Source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := supplier.SubjectToken(context.Background(), externalaccount.SupplierOptions{})
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != test.Expected {
+				t.Fatalf("expected %q, got %q", test.Expected, token)
+			}
+		})
+	}
+
+	if _, err := NewSubjectTokenSupplier(&ExternalAccountCredentialSource{}); err == nil {
+		t.Fatal("expected error for a source without file or URL")
+	}
+}
+
+func TestExternalAccountConfig_fileSubjectToken(t *testing.T) {
+	sts := testutil.NewSTSServer(t)
+	sts.SetToken("federated-token", 3600)
+	sts.ExpectSubjectToken("oidc-token")
+	ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL})
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("oidc-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := &ExternalAccountConfig{
+		Audience:      "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/provider",
+		TokenSupplier: &FileSubjectTokenSupplier{Path: tokenFile},
+	}
+	ts, err := config.TokenSource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "federated-token" {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+}
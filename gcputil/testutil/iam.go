@@ -0,0 +1,327 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/iam/v1"
+)
+
+const (
+	iamPathPrefix      = "/v1/projects/"
+	iamKeyValidity     = 10 * 365 * 24 * time.Hour
+	iamKeyAlgorithm    = "KEY_ALG_RSA_2048"
+	iamX509PEMFileType = "TYPE_X509_PEM_FILE"
+)
+
+// iamKey is a service account key and the private key backing it.
+type iamKey struct {
+	key        *iam.ServiceAccountKey
+	privateKey *rsa.PrivateKey
+	certPEM    []byte
+}
+
+// IAMServer is a fake of the subset of the IAM admin API used to manage
+// service accounts and their keys: serviceAccounts get/list/create and
+// keys get/list/create/delete. State is held in memory.
+type IAMServer struct {
+	*httptest.Server
+	faults
+
+	mu       sync.Mutex
+	accounts map[string]*iam.ServiceAccount // by email
+	keys     map[string]map[string]*iamKey  // by email, then key ID
+	nextID   int64
+}
+
+// NewIAMServer starts a fake IAM admin server that is closed when the test
+// ends.
+func NewIAMServer(t testing.TB) *IAMServer {
+	s := &IAMServer{
+		accounts: map[string]*iam.ServiceAccount{},
+		keys:     map[string]map[string]*iamKey{},
+		nextID:   100000000000000000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddServiceAccount creates a service account in the given project.
+func (s *IAMServer) AddServiceAccount(project, accountID string) *iam.ServiceAccount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createAccount(project, accountID, "", "")
+}
+
+// ServiceAccount returns the service account with the given email, or nil.
+func (s *IAMServer) ServiceAccount(email string) *iam.ServiceAccount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accounts[email]
+}
+
+// Keys returns the keys of the service account with the given email.
+func (s *IAMServer) Keys(email string) []*iam.ServiceAccountKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listKeys(email)
+}
+
+// DisableKey marks a key as disabled.
+func (s *IAMServer) DisableKey(email, keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[email][keyID]; ok {
+		k.key.Disabled = true
+	}
+}
+
+func (s *IAMServer) handle(w http.ResponseWriter, r *http.Request) {
+	if s.inject(w) {
+		return
+	}
+
+	// Paths are of the form /v1/projects/P/serviceAccounts[/SA[/keys[/K]]].
+	tokens := strings.Split(strings.TrimPrefix(r.URL.Path, iamPathPrefix), "/")
+	if len(tokens) < 2 || tokens[1] != "serviceAccounts" || (len(tokens) > 3 && tokens[3] != "keys") || len(tokens) > 5 {
+		writeGoogleError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", r.Method, r.URL.Path))
+		return
+	}
+	project := tokens[0]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case len(tokens) == 2 && r.Method == http.MethodGet:
+		s.handleListAccounts(w, project)
+	case len(tokens) == 2 && r.Method == http.MethodPost:
+		s.handleCreateAccount(w, r, project)
+	case len(tokens) == 3 && r.Method == http.MethodGet:
+		if sa := s.findAccount(tokens[2]); sa != nil {
+			writeJSON(w, http.StatusOK, sa)
+		} else {
+			writeNotFound(w, r)
+		}
+	case len(tokens) == 4 && r.Method == http.MethodGet:
+		if sa := s.findAccount(tokens[2]); sa != nil {
+			writeJSON(w, http.StatusOK, &iam.ListServiceAccountKeysResponse{Keys: s.listKeys(sa.Email)})
+		} else {
+			writeNotFound(w, r)
+		}
+	case len(tokens) == 4 && r.Method == http.MethodPost:
+		s.handleCreateKey(w, r, tokens[2])
+	case len(tokens) == 5 && r.Method == http.MethodGet:
+		s.handleGetKey(w, r, tokens[2], tokens[4])
+	case len(tokens) == 5 && r.Method == http.MethodDelete:
+		sa := s.findAccount(tokens[2])
+		if sa == nil || s.keys[sa.Email][tokens[4]] == nil {
+			writeNotFound(w, r)
+			return
+		}
+		delete(s.keys[sa.Email], tokens[4])
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+	default:
+		writeGoogleError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s %s not allowed", r.Method, r.URL.Path))
+	}
+}
+
+func (s *IAMServer) handleListAccounts(w http.ResponseWriter, project string) {
+	resp := &iam.ListServiceAccountsResponse{}
+	for _, sa := range s.accounts {
+		if project == "-" || sa.ProjectId == project {
+			resp.Accounts = append(resp.Accounts, sa)
+		}
+	}
+	sort.Slice(resp.Accounts, func(i, j int) bool { return resp.Accounts[i].Email < resp.Accounts[j].Email })
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *IAMServer) handleCreateAccount(w http.ResponseWriter, r *http.Request, project string) {
+	var req iam.CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AccountId == "" {
+		writeGoogleError(w, http.StatusBadRequest, "accountId is required")
+		return
+	}
+
+	email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", req.AccountId, project)
+	if _, ok := s.accounts[email]; ok {
+		writeGoogleError(w, http.StatusConflict, fmt.Sprintf("service account %s already exists", email))
+		return
+	}
+
+	var displayName, description string
+	if req.ServiceAccount != nil {
+		displayName, description = req.ServiceAccount.DisplayName, req.ServiceAccount.Description
+	}
+	writeJSON(w, http.StatusOK, s.createAccount(project, req.AccountId, displayName, description))
+}
+
+func (s *IAMServer) handleCreateKey(w http.ResponseWriter, r *http.Request, account string) {
+	sa := s.findAccount(account)
+	if sa == nil {
+		writeNotFound(w, r)
+		return
+	}
+
+	var req iam.CreateServiceAccountKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeGoogleError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+			return
+		}
+	}
+
+	k, err := s.createKey(sa)
+	if err != nil {
+		writeGoogleError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: mustMarshalPKCS8(k.privateKey)})
+	keyFile, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     sa.ProjectId,
+		"private_key_id": keyID(k.key.Name),
+		"private_key":    string(privateKeyPEM),
+		"client_email":   sa.Email,
+		"client_id":      sa.UniqueId,
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+
+	resp := *k.key
+	resp.PrivateKeyType = req.PrivateKeyType
+	if resp.PrivateKeyType == "" {
+		resp.PrivateKeyType = "TYPE_GOOGLE_CREDENTIALS_FILE"
+	}
+	resp.PrivateKeyData = base64.StdEncoding.EncodeToString(keyFile)
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+func (s *IAMServer) handleGetKey(w http.ResponseWriter, r *http.Request, account, id string) {
+	sa := s.findAccount(account)
+	if sa == nil {
+		writeNotFound(w, r)
+		return
+	}
+	k, ok := s.keys[sa.Email][id]
+	if !ok {
+		writeNotFound(w, r)
+		return
+	}
+
+	resp := *k.key
+	if r.URL.Query().Get("publicKeyType") == iamX509PEMFileType {
+		resp.PublicKeyData = base64.StdEncoding.EncodeToString(k.certPEM)
+	}
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+func (s *IAMServer) createAccount(project, accountID, displayName, description string) *iam.ServiceAccount {
+	s.nextID++
+	email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", accountID, project)
+	sa := &iam.ServiceAccount{
+		Name:           fmt.Sprintf("projects/%s/serviceAccounts/%s", project, email),
+		ProjectId:      project,
+		UniqueId:       fmt.Sprintf("%d", s.nextID),
+		Oauth2ClientId: fmt.Sprintf("%d", s.nextID),
+		Email:          email,
+		DisplayName:    displayName,
+		Description:    description,
+	}
+	s.accounts[email] = sa
+	s.keys[email] = map[string]*iamKey{}
+	return sa
+}
+
+func (s *IAMServer) createKey(sa *iam.ServiceAccount) (*iamKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	s.nextID++
+	id := fmt.Sprintf("%040x", s.nextID)
+	now := time.Now().UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(s.nextID),
+		Subject:      pkix.Name{CommonName: sa.UniqueId},
+		NotBefore:    now,
+		NotAfter:     now.Add(iamKeyValidity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &iamKey{
+		key: &iam.ServiceAccountKey{
+			Name:            fmt.Sprintf("projects/%s/serviceAccounts/%s/keys/%s", sa.ProjectId, sa.Email, id),
+			KeyAlgorithm:    iamKeyAlgorithm,
+			KeyOrigin:       "GOOGLE_PROVIDED",
+			KeyType:         "USER_MANAGED",
+			ValidAfterTime:  now.Format(time.RFC3339),
+			ValidBeforeTime: now.Add(iamKeyValidity).Format(time.RFC3339),
+		},
+		privateKey: privateKey,
+		certPEM:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+	s.keys[sa.Email][id] = k
+	return k, nil
+}
+
+func (s *IAMServer) listKeys(email string) []*iam.ServiceAccountKey {
+	var keys []*iam.ServiceAccountKey
+	for _, k := range s.keys[email] {
+		keys = append(keys, k.key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// findAccount returns the service account with the given email or unique ID.
+func (s *IAMServer) findAccount(emailOrID string) *iam.ServiceAccount {
+	if sa, ok := s.accounts[emailOrID]; ok {
+		return sa
+	}
+	for _, sa := range s.accounts {
+		if sa.UniqueId == emailOrID {
+			return sa
+		}
+	}
+	return nil
+}
+
+func keyID(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+func mustMarshalPKCS8(key *rsa.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	return der
+}
+
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeGoogleError(w, http.StatusNotFound, fmt.Sprintf("%s not found", r.URL.Path))
+}
@@ -0,0 +1,61 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+)
+
+func TestIAMServer(t *testing.T) {
+	s := NewIAMServer(t)
+	ctx := context.Background()
+	client, err := iam.NewService(ctx, option.WithEndpoint(s.URL), option.WithHTTPClient(s.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sa, err := client.Projects.ServiceAccounts.Create("projects/p", &iam.CreateServiceAccountRequest{AccountId: "vault"}).Do()
+	if err != nil {
+		t.Fatalf("create service account: %v", err)
+	}
+	if sa.Email != "vault@p.iam.gserviceaccount.com" {
+		t.Errorf("unexpected email %q", sa.Email)
+	}
+
+	got, err := gcputil.ServiceAccount(client, &gcputil.ServiceAccountId{Project: "-", EmailOrId: sa.Email})
+	if err != nil || got.UniqueId != sa.UniqueId {
+		t.Fatalf("get service account: %+v (err: %v)", got, err)
+	}
+
+	key, err := client.Projects.ServiceAccounts.Keys.Create(sa.Name, &iam.CreateServiceAccountKeyRequest{}).Do()
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	keyFile, _ := base64.StdEncoding.DecodeString(key.PrivateKeyData)
+	creds, err := gcputil.Credentials(string(keyFile))
+	if err != nil || creds.ClientEmail != sa.Email || creds.PrivateKey == "" {
+		t.Fatalf("unexpected key file credentials %+v (err: %v)", creds, err)
+	}
+
+	pub, err := gcputil.ServiceAccountKey(client, &gcputil.ServiceAccountKeyId{Project: "p", EmailOrId: sa.Email, Key: creds.PrivateKeyId})
+	if err != nil {
+		t.Fatalf("get key: %v", err)
+	}
+	if _, err := gcputil.PublicKey(pub.PublicKeyData); err != nil {
+		t.Errorf("unable to parse public key data: %v", err)
+	}
+
+	if _, err := client.Projects.ServiceAccounts.Keys.Delete(key.Name).Do(); err != nil {
+		t.Fatalf("delete key: %v", err)
+	}
+	if n := len(s.Keys(sa.Email)); n != 0 {
+		t.Errorf("expected no keys after delete, got %d", n)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// IAM Credentials API methods served by IAMCredentialsServer.
+const (
+	MethodGenerateAccessToken = "generateAccessToken"
+	MethodGenerateIdToken     = "generateIdToken"
+	MethodSignJwt             = "signJwt"
+	MethodSignBlob            = "signBlob"
+)
+
+const iamCredentialsPathPrefix = "/v1/projects/-/serviceAccounts/"
+
+// IAMCredentialsRequest is a request received by IAMCredentialsServer.
+type IAMCredentialsRequest struct {
+	// Method is one of the Method* constants.
+	Method string
+
+	// ServiceAccount is the email or unique ID from the request path.
+	ServiceAccount string
+
+	// Authorization is the value of the Authorization header.
+	Authorization string
+
+	// Body is the decoded JSON request body.
+	Body map[string]interface{}
+}
+
+// IAMCredentialsResponder produces the HTTP status and JSON response body
+// for a request.
+type IAMCredentialsResponder func(req *IAMCredentialsRequest) (int, interface{})
+
+// IAMCredentialsServer is a fake IAM Service Account Credentials API. By
+// default, generateAccessToken and generateIdToken issue fixed tokens, and
+// signJwt and signBlob sign with an RSA key generated for the server.
+type IAMCredentialsServer struct {
+	*httptest.Server
+	faults
+
+	// KeyID is the key ID reported for signatures.
+	KeyID string
+
+	// SigningKey is the key used by the default signJwt and signBlob
+	// responders.
+	SigningKey *rsa.PrivateKey
+
+	mu         sync.Mutex
+	responders map[string]IAMCredentialsResponder
+	requests   []*IAMCredentialsRequest
+}
+
+// NewIAMCredentialsServer starts a fake IAM Credentials server that is
+// closed when the test ends.
+func NewIAMCredentialsServer(t testing.TB) *IAMCredentialsServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate signing key: %v", err)
+	}
+
+	s := &IAMCredentialsServer{
+		KeyID:      "fake-key-id",
+		SigningKey: key,
+		responders: map[string]IAMCredentialsResponder{},
+	}
+	s.responders[MethodGenerateAccessToken] = s.generateAccessToken
+	s.responders[MethodGenerateIdToken] = s.generateIdToken
+	s.responders[MethodSignJwt] = s.signJwt
+	s.responders[MethodSignBlob] = s.signBlob
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SetResponder replaces the responder for the given method.
+func (s *IAMCredentialsServer) SetResponder(method string, responder IAMCredentialsResponder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responders[method] = responder
+}
+
+// Requests returns all requests received so far.
+func (s *IAMCredentialsServer) Requests() []*IAMCredentialsRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*IAMCredentialsRequest(nil), s.requests...)
+}
+
+// RequestsFor returns the requests received so far for the given method.
+func (s *IAMCredentialsServer) RequestsFor(method string) []*IAMCredentialsRequest {
+	var reqs []*IAMCredentialsRequest
+	for _, req := range s.Requests() {
+		if req.Method == method {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+func (s *IAMCredentialsServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, iamCredentialsPathPrefix) {
+		writeGoogleError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", r.Method, r.URL.Path))
+		return
+	}
+
+	resource := strings.TrimPrefix(r.URL.Path, iamCredentialsPathPrefix)
+	idx := strings.LastIndex(resource, ":")
+	if idx < 0 {
+		writeGoogleError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", r.Method, r.URL.Path))
+		return
+	}
+
+	req := &IAMCredentialsRequest{
+		Method:         resource[idx+1:],
+		ServiceAccount: resource[:idx],
+		Authorization:  r.Header.Get("Authorization"),
+		Body:           map[string]interface{}{},
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req.Body); err != nil {
+		writeGoogleError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	responder, ok := s.responders[req.Method]
+	s.mu.Unlock()
+
+	if s.inject(w) {
+		return
+	}
+	if !ok {
+		writeGoogleError(w, http.StatusNotFound, fmt.Sprintf("unknown method %q", req.Method))
+		return
+	}
+
+	status, body := responder(req)
+	writeJSON(w, status, body)
+}
+
+func (s *IAMCredentialsServer) generateAccessToken(req *IAMCredentialsRequest) (int, interface{}) {
+	if scopes, _ := req.Body["scope"].([]interface{}); len(scopes) == 0 {
+		return http.StatusBadRequest, googleErrorBody(http.StatusBadRequest, "scope is required")
+	}
+
+	lifetime := time.Hour
+	if raw, ok := req.Body["lifetime"].(string); ok && raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return http.StatusBadRequest, googleErrorBody(http.StatusBadRequest, fmt.Sprintf("invalid lifetime %q", raw))
+		}
+		lifetime = d
+	}
+
+	return http.StatusOK, map[string]string{
+		"accessToken": "iam-access-token-" + req.ServiceAccount,
+		"expireTime":  time.Now().Add(lifetime).UTC().Format(time.RFC3339),
+	}
+}
+
+func (s *IAMCredentialsServer) generateIdToken(req *IAMCredentialsRequest) (int, interface{}) {
+	audience, _ := req.Body["audience"].(string)
+	if audience == "" {
+		return http.StatusBadRequest, googleErrorBody(http.StatusBadRequest, "audience is required")
+	}
+
+	claims := map[string]interface{}{
+		"aud": audience,
+		"iss": "https://accounts.google.com",
+		"sub": req.ServiceAccount,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if includeEmail, _ := req.Body["includeEmail"].(bool); includeEmail {
+		claims["email"] = req.ServiceAccount
+		claims["email_verified"] = true
+	}
+	payload, _ := json.Marshal(claims)
+
+	token, err := s.sign(payload)
+	if err != nil {
+		return http.StatusInternalServerError, googleErrorBody(http.StatusInternalServerError, err.Error())
+	}
+	return http.StatusOK, map[string]string{"token": token}
+}
+
+func (s *IAMCredentialsServer) signJwt(req *IAMCredentialsRequest) (int, interface{}) {
+	payload, _ := req.Body["payload"].(string)
+	if !json.Valid([]byte(payload)) {
+		return http.StatusBadRequest, googleErrorBody(http.StatusBadRequest, "payload must be a JSON object")
+	}
+
+	signed, err := s.sign([]byte(payload))
+	if err != nil {
+		return http.StatusInternalServerError, googleErrorBody(http.StatusInternalServerError, err.Error())
+	}
+	return http.StatusOK, map[string]string{
+		"keyId":     s.KeyID,
+		"signedJwt": signed,
+	}
+}
+
+func (s *IAMCredentialsServer) signBlob(req *IAMCredentialsRequest) (int, interface{}) {
+	raw, _ := req.Body["payload"].(string)
+	payload, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return http.StatusBadRequest, googleErrorBody(http.StatusBadRequest, "payload must be base64 encoded")
+	}
+
+	sig, err := signRS256(s.SigningKey, payload)
+	if err != nil {
+		return http.StatusInternalServerError, googleErrorBody(http.StatusInternalServerError, err.Error())
+	}
+	return http.StatusOK, map[string]string{
+		"keyId":      s.KeyID,
+		"signedBlob": base64.StdEncoding.EncodeToString(sig),
+	}
+}
+
+// sign returns a compact RS256 JWS of the given JSON payload.
+func (s *IAMCredentialsServer) sign(payload []byte) (string, error) {
+	return signJWT(s.SigningKey, s.KeyID, payload)
+}
+
+// signJWT returns a compact RS256 JWS of the given JSON payload.
+func signJWT(key *rsa.PrivateKey, keyID string, payload []byte) (string, error) {
+	header, _ := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"kid": keyID,
+		"typ": "JWT",
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	sig, err := signRS256(key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func signRS256(key *rsa.PrivateKey, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+}
@@ -0,0 +1,61 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+func TestIAMCredentialsServer(t *testing.T) {
+	s := NewIAMCredentialsServer(t)
+	ctx := context.Background()
+	client, err := iamcredentials.NewService(ctx, option.WithEndpoint(s.URL), option.WithHTTPClient(s.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "projects/-/serviceAccounts/sa@p.iam.gserviceaccount.com"
+
+	tok, err := client.Projects.ServiceAccounts.GenerateAccessToken(name, &iamcredentials.GenerateAccessTokenRequest{
+		Scope:    []string{"https://www.googleapis.com/auth/cloud-platform"},
+		Lifetime: "600s",
+	}).Do()
+	if err != nil {
+		t.Fatalf("generateAccessToken: %v", err)
+	}
+	if tok.AccessToken != "iam-access-token-sa@p.iam.gserviceaccount.com" || tok.ExpireTime == "" {
+		t.Errorf("unexpected access token response: %+v", tok)
+	}
+
+	blob, err := client.Projects.ServiceAccounts.SignBlob(name, &iamcredentials.SignBlobRequest{
+		Payload: base64.StdEncoding.EncodeToString([]byte("data")),
+	}).Do()
+	if err != nil {
+		t.Fatalf("signBlob: %v", err)
+	}
+	sig, _ := base64.StdEncoding.DecodeString(blob.SignedBlob)
+	digest := sha256.Sum256([]byte("data"))
+	if err := rsa.VerifyPKCS1v15(&s.SigningKey.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("signBlob signature does not verify: %v", err)
+	}
+
+	s.SetResponder(MethodGenerateIdToken, func(req *IAMCredentialsRequest) (int, interface{}) {
+		return http.StatusForbidden, googleErrorBody(http.StatusForbidden, "denied")
+	})
+	if _, err := client.Projects.ServiceAccounts.GenerateIdToken(name, &iamcredentials.GenerateIdTokenRequest{Audience: "aud"}).Do(); err == nil {
+		t.Errorf("expected error from scripted generateIdToken responder")
+	}
+
+	if n := len(s.RequestsFor(MethodGenerateAccessToken)); n != 1 {
+		t.Errorf("expected 1 generateAccessToken request, got %d", n)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	serviceAccountX509PathPrefix = "/service_accounts/v1/metadata/x509/"
+	serviceAccountJWKPathPrefix  = "/service_accounts/v1/metadata/jwk/"
+	oauth2X509CertsPath          = "/oauth2/v1/certs"
+	oauth2JWKSPath               = "/oauth2/v3/certs"
+
+	// GoogleIssuer is the issuer of tokens minted by JWTIssuer.MintGoogle.
+	GoogleIssuer = "https://accounts.google.com"
+)
+
+type issuerKey struct {
+	id      string
+	key     *rsa.PrivateKey
+	certPEM string
+}
+
+// JWTIssuer is a local signing authority that mints RS256 JWTs for service
+// accounts (self-signed, iss and sub set to the service account email) and
+// Google-signed style tokens, and serves the matching public keys in the
+// same formats and paths as www.googleapis.com:
+//
+//   - /service_accounts/v1/metadata/x509/EMAIL (X.509 certificates by key ID)
+//   - /service_accounts/v1/metadata/jwk/EMAIL (JWKS)
+//   - /oauth2/v1/certs (X.509 certificates by key ID)
+//   - /oauth2/v3/certs (JWKS)
+//
+// Pass the server URL as the endpoint to the gcputil *WithEndpoint key
+// functions to verify minted tokens without Google.
+type JWTIssuer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	now    func() time.Time
+	serial int64
+	google *issuerKey
+	keys   map[string][]*issuerKey // by service account email
+}
+
+// NewJWTIssuer starts a JWT issuer that is closed when the test ends.
+func NewJWTIssuer(t testing.TB) *JWTIssuer {
+	i := &JWTIssuer{
+		now:  time.Now,
+		keys: map[string][]*issuerKey{},
+	}
+	k, err := i.newKey("google")
+	if err != nil {
+		t.Fatalf("unable to generate signing key: %v", err)
+	}
+	i.google = k
+	i.Server = httptest.NewServer(http.HandlerFunc(i.handle))
+	t.Cleanup(i.Close)
+	return i
+}
+
+// SetClock sets the function used for iat and exp claims.
+func (i *JWTIssuer) SetClock(now func() time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.now = now
+}
+
+// AddServiceAccountKey generates a new key for the service account and
+// returns its key ID. Minted tokens for the account use the newest key.
+func (i *JWTIssuer) AddServiceAccountKey(email string) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	k, err := i.newKey(email)
+	if err != nil {
+		return "", err
+	}
+	i.keys[email] = append(i.keys[email], k)
+	return k.id, nil
+}
+
+// MintServiceAccountJWT returns a JWT self-signed by the service account's
+// newest key (generating one if needed) with iss and sub set to the email
+// and the given audience, lifetime and extra claims.
+func (i *JWTIssuer) MintServiceAccountJWT(email, audience string, lifetime time.Duration, extra map[string]interface{}) (string, error) {
+	i.mu.Lock()
+	keys := i.keys[email]
+	i.mu.Unlock()
+
+	if len(keys) == 0 {
+		if _, err := i.AddServiceAccountKey(email); err != nil {
+			return "", err
+		}
+		i.mu.Lock()
+		keys = i.keys[email]
+		i.mu.Unlock()
+	}
+	return i.mint(keys[len(keys)-1], email, email, audience, lifetime, extra)
+}
+
+// MintGoogle returns a JWT signed by the issuer's Google key with iss set to
+// GoogleIssuer, as Google signs ID tokens. The key is served at
+// /oauth2/v1/certs and /oauth2/v3/certs.
+func (i *JWTIssuer) MintGoogle(subject, audience string, lifetime time.Duration, extra map[string]interface{}) (string, error) {
+	return i.mint(i.google, GoogleIssuer, subject, audience, lifetime, extra)
+}
+
+// GoogleKeyID returns the key ID of the issuer's Google key.
+func (i *JWTIssuer) GoogleKeyID() string {
+	return i.google.id
+}
+
+func (i *JWTIssuer) mint(k *issuerKey, issuer, subject, audience string, lifetime time.Duration, extra map[string]interface{}) (string, error) {
+	i.mu.Lock()
+	now := i.now()
+	i.mu.Unlock()
+
+	claims := map[string]interface{}{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["iss"] = issuer
+	claims["sub"] = subject
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(lifetime).Unix()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return signJWT(k.key, k.id, payload)
+}
+
+// newKey generates a key and self-signed certificate. It must be called with
+// the lock held or before the server is started.
+func (i *JWTIssuer) newKey(commonName string) (*issuerKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	i.serial++
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(i.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &issuerKey{
+		id:      fmt.Sprintf("test-key-%d", i.serial),
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}, nil
+}
+
+func (i *JWTIssuer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeGoogleError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s not allowed", r.Method))
+		return
+	}
+
+	var keys []*issuerKey
+	jwks := false
+	switch path := r.URL.Path; {
+	case path == oauth2X509CertsPath:
+		keys = []*issuerKey{i.google}
+	case path == oauth2JWKSPath:
+		keys, jwks = []*issuerKey{i.google}, true
+	case strings.HasPrefix(path, serviceAccountX509PathPrefix):
+		keys = i.accountKeys(strings.TrimPrefix(path, serviceAccountX509PathPrefix))
+	case strings.HasPrefix(path, serviceAccountJWKPathPrefix):
+		keys, jwks = i.accountKeys(strings.TrimPrefix(path, serviceAccountJWKPathPrefix)), true
+	default:
+		writeNotFound(w, r)
+		return
+	}
+	if keys == nil {
+		writeNotFound(w, r)
+		return
+	}
+
+	if jwks {
+		set := []map[string]string{}
+		for _, k := range keys {
+			set = append(set, map[string]string{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": k.id,
+				"n":   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": set})
+		return
+	}
+
+	certs := map[string]string{}
+	for _, k := range keys {
+		certs[k.id] = k.certPEM
+	}
+	writeJSON(w, http.StatusOK, certs)
+}
+
+func (i *JWTIssuer) accountKeys(escapedEmail string) []*issuerKey {
+	email, err := url.PathUnescape(escapedEmail)
+	if err != nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.keys[email]
+}
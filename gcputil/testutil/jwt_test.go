@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-gcp-common/gcputil"
+)
+
+func TestJWTIssuer(t *testing.T) {
+	issuer := NewJWTIssuer(t)
+	ctx := context.Background()
+	email := "sa@p.iam.gserviceaccount.com"
+
+	kid, err := issuer.AddServiceAccountKey(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := issuer.MintServiceAccountJWT(email, "vault/role", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gcputil.ServiceAccountPublicKeyWithEndpoint(ctx, email, kid, issuer.URL)
+	if err != nil {
+		t.Fatalf("unable to fetch service account key: %v", err)
+	}
+	verifyRS256(t, token, key.(*rsa.PublicKey))
+
+	token, err = issuer.MintGoogle("sub", "aud", time.Minute, map[string]interface{}{"email": email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err = gcputil.OAuth2RSAPublicKeyWithEndpoint(ctx, issuer.GoogleKeyID(), issuer.URL)
+	if err != nil {
+		t.Fatalf("unable to fetch Google key: %v", err)
+	}
+	verifyRS256(t, token, key.(*rsa.PublicKey))
+}
+
+func TestFakeTokenSource(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := NewFakeTokenSource(time.Hour)
+	ts.SetClock(func() time.Time { return now })
+
+	tok, _ := ts.Token()
+	if tok.AccessToken != "fake-token-1" || !tok.Expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected token %+v", tok)
+	}
+	tok, _ = ts.Token()
+	if tok.AccessToken != "fake-token-2" || ts.Calls() != 2 {
+		t.Errorf("unexpected token %+v after %d calls", tok, ts.Calls())
+	}
+}
+
+func verifyRS256(t *testing.T, token string, key *rsa.PublicKey) {
+	t.Helper()
+	idx := strings.LastIndex(token, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(token[idx+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(token[:idx]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("token signature does not verify: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	metadataPathPrefix = "/computeMetadata/v1/"
+	metadataHostEnv    = "GCE_METADATA_HOST"
+
+	// Defaults served by MetadataServer.
+	DefaultMetadataProjectID       = "test-project"
+	DefaultMetadataNumericProject  = "123456789012"
+	DefaultMetadataZone            = "us-central1-a"
+	DefaultMetadataInstanceName    = "test-instance"
+	DefaultMetadataInstanceID      = "1234567890123456789"
+	DefaultMetadataServiceAccount  = "test-sa@test-project.iam.gserviceaccount.com"
+	DefaultMetadataAccessToken     = "metadata-access-token"
+	defaultMetadataIdentityKeyID   = "metadata-key-id"
+	defaultMetadataTokenExpiresIn  = 3599
+	defaultMetadataServiceAccounts = "default/\n" + DefaultMetadataServiceAccount + "/\n"
+)
+
+// IdentityTokenFunc produces the instance identity token returned for the
+// given audience, format and licenses parameters.
+type IdentityTokenFunc func(audience, format string, licenses bool) (string, error)
+
+// MetadataServer is a fake GCE metadata server. It serves project and
+// instance values, custom instance attributes, access tokens and instance
+// identity tokens for a single service account, also available under the
+// "default" alias.
+type MetadataServer struct {
+	*httptest.Server
+	faults
+
+	// SigningKey signs the default instance identity tokens.
+	SigningKey *rsa.PrivateKey
+
+	mu            sync.Mutex
+	values        map[string]string
+	accessToken   string
+	expiresIn     int
+	identityToken IdentityTokenFunc
+	requests      []*http.Request
+}
+
+// NewMetadataServer starts a fake metadata server on a local port that is
+// closed when the test ends.
+func NewMetadataServer(t testing.TB) *MetadataServer {
+	s := newMetadataServer(t)
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// NewMetadataServerOnListener starts a fake metadata server on the given
+// listener, e.g. one bound to a fixed local address, that is closed when the
+// test ends.
+func NewMetadataServerOnListener(t testing.TB, l net.Listener) *MetadataServer {
+	s := newMetadataServer(t)
+	s.Listener.Close()
+	s.Listener = l
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newMetadataServer(t testing.TB) *MetadataServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate signing key: %v", err)
+	}
+
+	s := &MetadataServer{
+		SigningKey:  key,
+		accessToken: DefaultMetadataAccessToken,
+		expiresIn:   defaultMetadataTokenExpiresIn,
+		values: map[string]string{
+			"project/project-id":         DefaultMetadataProjectID,
+			"project/numeric-project-id": DefaultMetadataNumericProject,
+			"instance/id":                DefaultMetadataInstanceID,
+			"instance/name":              DefaultMetadataInstanceName,
+			"instance/hostname":          fmt.Sprintf("%s.%s.c.%s.internal", DefaultMetadataInstanceName, DefaultMetadataZone, DefaultMetadataProjectID),
+			"instance/zone":              fmt.Sprintf("projects/%s/zones/%s", DefaultMetadataNumericProject, DefaultMetadataZone),
+			"instance/service-accounts/": defaultMetadataServiceAccounts,
+		},
+	}
+	s.identityToken = s.defaultIdentityToken
+	s.SetServiceAccount(DefaultMetadataServiceAccount, "https://www.googleapis.com/auth/cloud-platform")
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Host returns the host:port of the server, suitable for GCE_METADATA_HOST.
+func (s *MetadataServer) Host() string {
+	return s.Listener.Addr().String()
+}
+
+// SetEnv points GCE_METADATA_HOST at the server for the duration of the test.
+func (s *MetadataServer) SetEnv(t testing.TB) {
+	t.Setenv(metadataHostEnv, s.Host())
+}
+
+// Set sets the value served for the given metadata path, relative to
+// /computeMetadata/v1/ (e.g. "instance/zone").
+func (s *MetadataServer) Set(path, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[strings.TrimPrefix(path, "/")] = value
+}
+
+// Delete removes the value served for the given metadata path.
+func (s *MetadataServer) Delete(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, strings.TrimPrefix(path, "/"))
+}
+
+// SetAttribute sets a custom instance metadata attribute.
+func (s *MetadataServer) SetAttribute(key, value string) {
+	s.Set("instance/attributes/"+key, value)
+}
+
+// SetServiceAccount sets the email and scopes of the instance's service
+// account.
+func (s *MetadataServer) SetServiceAccount(email string, scopes ...string) {
+	for _, alias := range []string{"default", email} {
+		s.Set(fmt.Sprintf("instance/service-accounts/%s/email", alias), email)
+		s.Set(fmt.Sprintf("instance/service-accounts/%s/scopes", alias), strings.Join(scopes, "\n")+"\n")
+	}
+}
+
+// SetAccessToken sets the access token and lifetime returned by the token
+// endpoint.
+func (s *MetadataServer) SetAccessToken(token string, expiresIn int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = token
+	s.expiresIn = expiresIn
+}
+
+// SetIdentityTokenFunc replaces the function producing instance identity
+// tokens.
+func (s *MetadataServer) SetIdentityTokenFunc(fn IdentityTokenFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identityToken = fn
+}
+
+// Requests returns all requests received so far.
+func (s *MetadataServer) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+func (s *MetadataServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	s.mu.Unlock()
+
+	if r.Header.Get("Metadata-Flavor") != "Google" {
+		http.Error(w, "Missing Metadata-Flavor:Google header!", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Metadata-Flavor", "Google")
+
+	if s.inject(w) {
+		return
+	}
+	if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, metadataPathPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, metadataPathPrefix)
+	if strings.HasPrefix(path, "instance/service-accounts/") {
+		switch {
+		case strings.HasSuffix(path, "/token"):
+			s.handleToken(w, r, strings.TrimSuffix(path, "token")+"email")
+			return
+		case strings.HasSuffix(path, "/identity"):
+			s.handleIdentity(w, r, strings.TrimSuffix(path, "identity")+"email")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	value, ok := s.values[path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/text")
+	w.Write([]byte(value))
+}
+
+func (s *MetadataServer) serviceAccountExists(emailPath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.values[emailPath]
+	return ok
+}
+
+func (s *MetadataServer) handleToken(w http.ResponseWriter, r *http.Request, emailPath string) {
+	if !s.serviceAccountExists(emailPath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	token, expiresIn := s.accessToken, s.expiresIn
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"expires_in":   expiresIn,
+		"token_type":   "Bearer",
+	})
+}
+
+func (s *MetadataServer) handleIdentity(w http.ResponseWriter, r *http.Request, emailPath string) {
+	if !s.serviceAccountExists(emailPath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	audience := query.Get("audience")
+	if audience == "" {
+		http.Error(w, "non-empty audience parameter required", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	fn := s.identityToken
+	s.mu.Unlock()
+
+	token, err := fn(audience, query.Get("format"), strings.EqualFold(query.Get("licenses"), "true"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(token))
+}
+
+// defaultIdentityToken returns an RS256 identity token signed by SigningKey,
+// including the google.compute_engine claims if the full format is requested.
+func (s *MetadataServer) defaultIdentityToken(audience, format string, licenses bool) (string, error) {
+	s.mu.Lock()
+	email := s.values["instance/service-accounts/default/email"]
+	projectID := s.values["project/project-id"]
+	numericProject := s.values["project/numeric-project-id"]
+	instanceName := s.values["instance/name"]
+	instanceID := s.values["instance/id"]
+	zone := s.values["instance/zone"]
+	s.mu.Unlock()
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud":            audience,
+		"azp":            email,
+		"email":          email,
+		"email_verified": true,
+		"iss":            "https://accounts.google.com",
+		"sub":            email,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	if format == "full" {
+		computeEngine := map[string]interface{}{
+			"project_id":                  projectID,
+			"project_number":              json.Number(numericProject),
+			"zone":                        zone[strings.LastIndex(zone, "/")+1:],
+			"instance_id":                 instanceID,
+			"instance_name":               instanceName,
+			"instance_creation_timestamp": now.Add(-time.Hour).Unix(),
+		}
+		if licenses {
+			computeEngine["license_id"] = []string{}
+		}
+		claims["google"] = map[string]interface{}{"compute_engine": computeEngine}
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return signJWT(s.SigningKey, defaultMetadataIdentityKeyID, payload)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil"
+)
+
+func TestMetadataServer(t *testing.T) {
+	s := NewMetadataServer(t)
+	s.SetEnv(t)
+	s.SetAttribute("cluster-name", "c")
+
+	ctx := context.Background()
+	client := gcputil.NewMetadataClient(nil)
+
+	if v, err := client.ProjectID(ctx); err != nil || v != DefaultMetadataProjectID {
+		t.Errorf("ProjectID: expected %s, got %q (err: %v)", DefaultMetadataProjectID, v, err)
+	}
+	if v, err := client.Get(ctx, "instance/attributes/cluster-name"); err != nil || v != "c" {
+		t.Errorf("attribute: expected c, got %q (err: %v)", v, err)
+	}
+
+	tok, err := gcputil.NewMetadataTokenSource(client, "").Token()
+	if err != nil || tok.AccessToken != DefaultMetadataAccessToken {
+		t.Errorf("Token: unexpected %+v (err: %v)", tok, err)
+	}
+
+	idToken, err := client.InstanceIdentityToken(ctx, "", "vault/gce", gcputil.IdentityTokenFormatFull, false)
+	if err != nil {
+		t.Fatalf("InstanceIdentityToken: %v", err)
+	}
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected JWT, got %q", idToken)
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims gcputil.CustomJWTClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Google == nil || claims.Google.Compute == nil || claims.Google.Compute.Zone != DefaultMetadataZone {
+		t.Errorf("expected compute_engine claims in full format token, got %s", payload)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+const (
+	stsGrantType          = "urn:ietf:params:oauth:grant-type:token-exchange"
+	stsRequestedTokenType = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// STSServer is a fake Security Token Service that implements the OAuth 2.0
+// token exchange endpoint at /v1/token.
+type STSServer struct {
+	*httptest.Server
+	faults
+
+	mu               sync.Mutex
+	accessToken      string
+	expiresIn        int
+	expectedAudience string
+	expectedSubject  string
+	grantedScope     *string
+	requests         []url.Values
+}
+
+// NewSTSServer starts a fake STS server that is closed when the test ends.
+// By default it issues the access token "sts-access-token" valid for an hour
+// to any well-formed request.
+func NewSTSServer(t testing.TB) *STSServer {
+	s := &STSServer{
+		accessToken: "sts-access-token",
+		expiresIn:   3600,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// TokenURL returns the URL of the token exchange endpoint.
+func (s *STSServer) TokenURL() string {
+	return s.URL + "/v1/token"
+}
+
+// SetToken configures the access token and lifetime issued on success.
+func (s *STSServer) SetToken(accessToken string, expiresIn int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = accessToken
+	s.expiresIn = expiresIn
+}
+
+// ExpectAudience causes requests with a different audience to be rejected.
+func (s *STSServer) ExpectAudience(audience string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectedAudience = audience
+}
+
+// ExpectSubjectToken causes requests with a different subject token to be
+// rejected.
+func (s *STSServer) ExpectSubjectToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectedSubject = token
+}
+
+// SetGrantedScope causes successful responses to list the given
+// space-delimited scopes as granted, instead of omitting the scope field.
+func (s *STSServer) SetGrantedScope(scope string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grantedScope = &scope
+}
+
+// Requests returns the form payloads of all requests received so far.
+func (s *STSServer) Requests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.requests...)
+}
+
+func (s *STSServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/token" {
+		writeGoogleError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", r.Method, r.URL.Path))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeSTSError(w, "invalid_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.PostForm)
+	accessToken, expiresIn := s.accessToken, s.expiresIn
+	expectedAudience, expectedSubject := s.expectedAudience, s.expectedSubject
+	grantedScope := s.grantedScope
+	s.mu.Unlock()
+
+	if s.inject(w) {
+		return
+	}
+
+	form := r.PostForm
+	switch {
+	case form.Get("grant_type") != stsGrantType:
+		writeSTSError(w, "unsupported_grant_type", fmt.Sprintf("unsupported grant_type %q", form.Get("grant_type")))
+	case form.Get("requested_token_type") != stsRequestedTokenType:
+		writeSTSError(w, "invalid_request", fmt.Sprintf("unsupported requested_token_type %q", form.Get("requested_token_type")))
+	case form.Get("subject_token") == "" || form.Get("subject_token_type") == "":
+		writeSTSError(w, "invalid_request", "subject_token and subject_token_type are required")
+	case form.Get("audience") == "":
+		writeSTSError(w, "invalid_request", "audience is required")
+	case expectedAudience != "" && form.Get("audience") != expectedAudience:
+		writeSTSError(w, "invalid_target", fmt.Sprintf("unexpected audience %q", form.Get("audience")))
+	case expectedSubject != "" && form.Get("subject_token") != expectedSubject:
+		writeSTSError(w, "invalid_grant", "the subject token is invalid")
+	default:
+		resp := map[string]interface{}{
+			"access_token":      accessToken,
+			"issued_token_type": stsRequestedTokenType,
+			"token_type":        "Bearer",
+			"expires_in":        expiresIn,
+		}
+		if grantedScope != nil {
+			resp["scope"] = *grantedScope
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// writeSTSError writes an OAuth 2.0 error response.
+func writeSTSError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
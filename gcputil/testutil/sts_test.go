@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSTSServer(t *testing.T) {
+	s := NewSTSServer(t)
+	s.ExpectAudience("aud")
+	s.SetToken("tok", 60)
+
+	form := url.Values{
+		"grant_type":           {stsGrantType},
+		"requested_token_type": {stsRequestedTokenType},
+		"subject_token":        {"jwt"},
+		"subject_token_type":   {"urn:ietf:params:oauth:token-type:jwt"},
+		"audience":             {"aud"},
+	}
+
+	s.FailNext(http.StatusTooManyRequests, 1)
+	resp, err := http.PostForm(s.TokenURL(), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected injected 429, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.PostForm(s.TokenURL(), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken != "tok" || body.ExpiresIn != 60 {
+		t.Errorf("unexpected response %d: %+v", resp.StatusCode, body)
+	}
+
+	form.Set("audience", "other")
+	resp, err = http.PostForm(s.TokenURL(), form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unexpected audience, got %d", resp.StatusCode)
+	}
+
+	if n := len(s.Requests()); n != 3 {
+		t.Errorf("expected 3 recorded requests, got %d", n)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package testutil provides fake Google Cloud endpoints for testing code
+// built on gcputil without access to Google.
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// faults holds injected latency and failures shared by the fake servers.
+type faults struct {
+	mu       sync.Mutex
+	latency  time.Duration
+	failures []int
+}
+
+// SetLatency delays every subsequent response by d.
+func (f *faults) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+}
+
+// FailNext causes the next n requests to fail with the given HTTP status,
+// e.g. http.StatusTooManyRequests or http.StatusServiceUnavailable.
+func (f *faults) FailNext(status, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < n; i++ {
+		f.failures = append(f.failures, status)
+	}
+}
+
+// inject applies the configured latency and writes an injected failure if
+// one is queued. It reports whether a failure was written.
+func (f *faults) inject(w http.ResponseWriter) bool {
+	f.mu.Lock()
+	latency := f.latency
+	status := 0
+	if len(f.failures) > 0 {
+		status = f.failures[0]
+		f.failures = f.failures[1:]
+	}
+	f.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if status == 0 {
+		return false
+	}
+	writeGoogleError(w, status, "injected failure")
+	return true
+}
+
+// writeGoogleError writes an error response in the format used by Google APIs.
+func writeGoogleError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, googleErrorBody(status, message))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// googleErrorBody returns an error body in the format used by Google APIs.
+func googleErrorBody(status int, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"status":  http.StatusText(status),
+		},
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package testutil
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// FakeTokenSource is an oauth2.TokenSource that issues deterministic tokens
+// ("fake-token-1", "fake-token-2", ...) with a controllable lifetime and
+// clock. It is safe for concurrent use.
+type FakeTokenSource struct {
+	mu       sync.Mutex
+	prefix   string
+	lifetime time.Duration
+	now      func() time.Time
+	err      error
+	calls    int
+}
+
+var _ oauth2.TokenSource = &FakeTokenSource{}
+
+// NewFakeTokenSource returns a FakeTokenSource whose tokens expire after the
+// given lifetime. A zero lifetime issues tokens without an expiry.
+func NewFakeTokenSource(lifetime time.Duration) *FakeTokenSource {
+	return &FakeTokenSource{
+		prefix:   "fake-token",
+		lifetime: lifetime,
+		now:      time.Now,
+	}
+}
+
+// SetPrefix sets the prefix of issued token values.
+func (ts *FakeTokenSource) SetPrefix(prefix string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.prefix = prefix
+}
+
+// SetLifetime sets the lifetime of subsequently issued tokens.
+func (ts *FakeTokenSource) SetLifetime(lifetime time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.lifetime = lifetime
+}
+
+// SetClock sets the function used to compute token expiries.
+func (ts *FakeTokenSource) SetClock(now func() time.Time) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.now = now
+}
+
+// SetError causes subsequent calls to Token to fail with err, or succeed
+// again if err is nil.
+func (ts *FakeTokenSource) SetError(err error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.err = err
+}
+
+// Calls returns the number of times Token has been called.
+func (ts *FakeTokenSource) Calls() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.calls
+}
+
+// Token returns the next token in the sequence.
+func (ts *FakeTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.calls++
+	if ts.err != nil {
+		return nil, ts.err
+	}
+
+	tok := &oauth2.Token{
+		AccessToken: fmt.Sprintf("%s-%d", ts.prefix, ts.calls),
+		TokenType:   "Bearer",
+	}
+	if ts.lifetime > 0 {
+		tok.Expiry = ts.now().Add(ts.lifetime)
+	}
+	return tok, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Paths of the OAuth 2.0 tokeninfo and OpenID Connect userinfo endpoints,
+// relative to the APIs endpoint.
+const (
+	tokenInfoURLPath = "/oauth2/v3/tokeninfo"
+	userinfoURLPath  = "/oauth2/v3/userinfo"
+)
+
+// TokenInfo describes an access token, as returned by Google's tokeninfo
+// endpoint.
+type TokenInfo struct {
+	// Audience is the client the token was issued to.
+	Audience string
+
+	// Subject is the unique ID of the principal.
+	Subject string
+
+	// Email is the email of the principal, if the token has the
+	// userinfo.email scope.
+	Email string
+
+	// Scopes are the scopes granted to the token.
+	Scopes []string
+
+	// Expiry is when the token expires.
+	Expiry time.Time
+}
+
+// TokenInfo returns information about the given access token from Google's
+// tokeninfo endpoint. An error is returned if the token is invalid or
+// expired.
+func (c *Client) TokenInfo(ctx context.Context, accessToken string) (*TokenInfo, error) {
+	defer c.measure("token_info", time.Now())
+	info, err := c.tokenInfo(ctx, accessToken)
+	if err != nil {
+		c.incrError("token_info")
+		return nil, err
+	}
+	return info, nil
+}
+
+func (c *Client) tokenInfo(ctx context.Context, accessToken string) (*TokenInfo, error) {
+	if accessToken == "" {
+		return nil, errors.New("access token is required")
+	}
+
+	body := url.Values{"access_token": {accessToken}}.Encode()
+	tokenInfoURL := joinEndpoint(c.endpointsFor(ctx).APIs, tokenInfoURLPath)
+	resp, err := c.doWithRetry(ctx, "token_info", c.httpClient, func() (*http.Request, error) {
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenInfoURL, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get token info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("unable to get token info: %w", err)
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token info response: %v", err)
+	}
+	var raw struct {
+		Aud   string `json:"aud"`
+		Sub   string `json:"sub"`
+		Email string `json:"email"`
+		Scope string `json:"scope"`
+		Exp   string `json:"exp"`
+	}
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return nil, fmt.Errorf("unable to decode token info response: %v", err)
+	}
+
+	info := &TokenInfo{
+		Audience: raw.Aud,
+		Subject:  raw.Sub,
+		Email:    raw.Email,
+		Scopes:   strings.Fields(raw.Scope),
+	}
+	if exp, err := strconv.ParseInt(raw.Exp, 10, 64); err == nil {
+		info.Expiry = time.Unix(exp, 0)
+	}
+	return info, nil
+}
+
+// Userinfo describes the principal an access token was issued to, as
+// returned by Google's OpenID Connect userinfo endpoint.
+type Userinfo struct {
+	// Subject is the unique ID of the principal.
+	Subject string `json:"sub"`
+
+	// Email is the email of the principal. It requires the userinfo.email
+	// scope.
+	Email string `json:"email"`
+
+	// EmailVerified is true if Google has verified the email.
+	EmailVerified bool `json:"email_verified"`
+
+	// HostedDomain is the Google Workspace or Cloud Identity domain of the
+	// principal, if any.
+	HostedDomain string `json:"hd"`
+}
+
+// Userinfo returns the principal the given access token was issued to, from
+// Google's userinfo endpoint.
+func (c *Client) Userinfo(ctx context.Context, accessToken string) (*Userinfo, error) {
+	defer c.measure("userinfo", time.Now())
+	info, err := c.userinfo(ctx, accessToken)
+	if err != nil {
+		c.incrError("userinfo")
+		return nil, err
+	}
+	return info, nil
+}
+
+func (c *Client) userinfo(ctx context.Context, accessToken string) (*Userinfo, error) {
+	if accessToken == "" {
+		return nil, errors.New("access token is required")
+	}
+
+	userinfoURL := joinEndpoint(c.endpointsFor(ctx).APIs, userinfoURLPath)
+	resp, err := c.doWithRetry(ctx, "userinfo", c.httpClient, func() (*http.Request, error) {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, userinfoURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", "Bearer "+accessToken)
+		return r, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get userinfo: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("unable to get userinfo: %w", err)
+	}
+
+	info := &Userinfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, fmt.Errorf("unable to decode userinfo response: %v", err)
+	}
+	return info, nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_Userinfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != userinfoURLPath || r.Header.Get("Authorization") != "Bearer user-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":401,"message":"invalid credentials"}}`))
+			return
+		}
+		w.Write([]byte(`{"sub":"123","email":"user@example.com","email_verified":true,"hd":"example.com"}`))
+	}))
+	defer srv.Close()
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{APIs: srv.URL}})
+
+	tests := map[string]struct {
+		Token       string
+		Expected    Userinfo
+		ShouldError bool
+	}{
+		"valid token": {
+			Token:    "user-token",
+			Expected: Userinfo{Subject: "123", Email: "user@example.com", EmailVerified: true, HostedDomain: "example.com"},
+		},
+		"invalid token": {
+			Token:       "other",
+			ShouldError: true,
+		},
+		"empty token": {
+			ShouldError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			info, err := c.Userinfo(context.Background(), tc.Token)
+			if tc.ShouldError {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *info != tc.Expected {
+				t.Errorf("expected %+v, got %+v", tc.Expected, *info)
+			}
+		})
+	}
+}
+
+func TestClient_HasScopes(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.FormValue("access_token") != "scoped-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_token"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"scope":"https://www.googleapis.com/auth/cloud-platform https://www.googleapis.com/auth/userinfo.email","exp":"%d"}`,
+			time.Now().Add(time.Hour).Unix())
+	}))
+	defer srv.Close()
+	c := newTestClient(t, &Options{Endpoints: &GCPEndpoints{APIs: srv.URL}})
+
+	tests := map[string]struct {
+		Token       string
+		Required    []string
+		Missing     []string
+		ShouldError bool
+	}{
+		"granted": {
+			Token:    "scoped-token",
+			Required: []string{"https://www.googleapis.com/auth/cloud-platform"},
+		},
+		"none required": {
+			Token: "scoped-token",
+		},
+		"missing": {
+			Token:    "scoped-token",
+			Required: []string{"https://www.googleapis.com/auth/devstorage.read_only", "https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/compute"},
+			Missing:  []string{"https://www.googleapis.com/auth/compute", "https://www.googleapis.com/auth/devstorage.read_only"},
+		},
+		"invalid token": {
+			Token:       "bad-token",
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ok, missing, err := c.HasScopes(context.Background(), test.Token, test.Required...)
+			if test.ShouldError != (err != nil) {
+				t.Fatalf("expected error: %t, got %v", test.ShouldError, err)
+			}
+			if err != nil {
+				return
+			}
+			if ok != (len(test.Missing) == 0) || !reflect.DeepEqual(missing, test.Missing) {
+				t.Fatalf("expected missing %v, got %t %v", test.Missing, ok, missing)
+			}
+		})
+	}
+
+	// Token info for the valid token is fetched once and then cached;
+	// invalid tokens are not cached.
+	c.HasScopes(context.Background(), "bad-token")
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 token info calls, got %d", got)
+	}
+}
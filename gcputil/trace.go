@@ -0,0 +1,247 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTraceBodyLimit is the number of body bytes included in a trace.
+const defaultTraceBodyLimit = 1024
+
+const redacted = "REDACTED"
+
+// sensitiveFields are JSON fields, form fields and query parameters whose
+// values are masked in traces.
+var sensitiveFields = []string{
+	"access_token",
+	"accessToken",
+	"assertion",
+	"client_secret",
+	"id_token",
+	"idToken",
+	"key",
+	"private_key",
+	"privateKeyData",
+	"refresh_token",
+	"signedBlob",
+	"signedJwt",
+	"subject_token",
+	"token",
+}
+
+var (
+	sensitiveJSONRegex = regexp.MustCompile(`("(?:` + strings.Join(sensitiveFields, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	sensitiveFormRegex = regexp.MustCompile(`(^|&)((?:` + strings.Join(sensitiveFields, "|") + `)=)[^&]*`)
+	bearerRegex        = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+)
+
+// HTTPTracer writes sanitized traces of HTTP requests and responses for
+// debugging. Each trace includes the method, URL, status, duration and the
+// start of the request and response bodies, with tokens, keys and other
+// secrets masked. Headers are never traced. Tracing can be enabled and
+// disabled at runtime. It is safe for concurrent use.
+type HTTPTracer struct {
+	writer io.Writer
+	logger Logger
+
+	// BodyLimit is the number of body bytes included in each trace.
+	// Defaults to 1024. A negative value omits bodies.
+	BodyLimit int
+
+	enabled int32
+	mu      sync.Mutex
+}
+
+// NewHTTPTracer returns an enabled HTTPTracer that writes one line per
+// request to w.
+func NewHTTPTracer(w io.Writer) *HTTPTracer {
+	return &HTTPTracer{writer: w, enabled: 1}
+}
+
+// NewHTTPLogTracer returns an enabled HTTPTracer that writes traces to the
+// given logger at debug level.
+func NewHTTPLogTracer(logger Logger) *HTTPTracer {
+	return &HTTPTracer{logger: logger, enabled: 1}
+}
+
+// SetEnabled enables or disables tracing.
+func (t *HTTPTracer) SetEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&t.enabled, v)
+}
+
+// Enabled reports whether tracing is enabled.
+func (t *HTTPTracer) Enabled() bool {
+	return t != nil && atomic.LoadInt32(&t.enabled) == 1
+}
+
+// Transport returns a RoundTripper that traces requests made through base.
+// If base is nil, http.DefaultTransport is used.
+func (t *HTTPTracer) Transport(base http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{base: transportOrDefault(base), tracer: t}
+}
+
+// Client returns a copy of httpClient whose requests are traced. If
+// httpClient is nil, a default client is used. It can be used with the
+// package-level functions that accept an HTTP client.
+func (t *HTTPTracer) Client(httpClient *http.Client) *http.Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return withTransport(httpClient, t.Transport(httpClient.Transport))
+}
+
+func (t *HTTPTracer) bodyLimit() int {
+	if t.BodyLimit == 0 {
+		return defaultTraceBodyLimit
+	}
+	return t.BodyLimit
+}
+
+func (t *HTTPTracer) trace(method, reqURL string, status int, elapsed time.Duration, reqBody, respBody []byte, err error) {
+	args := []interface{}{
+		"method", method,
+		"url", reqURL,
+		"status", status,
+		"duration", elapsed.String(),
+	}
+	if t.bodyLimit() > 0 {
+		args = append(args, "request_body", t.sanitizeBody(reqBody), "response_body", t.sanitizeBody(respBody))
+	}
+	if err != nil {
+		args = append(args, "error", sanitizeString(err.Error()))
+	}
+
+	if t.logger != nil {
+		t.logger.Debug("gcputil: http trace", args...)
+	}
+	if t.writer != nil {
+		var b strings.Builder
+		b.WriteString("gcputil: http trace:")
+		for i := 0; i < len(args); i += 2 {
+			fmt.Fprintf(&b, " %s=%q", args[i], fmt.Sprint(args[i+1]))
+		}
+		b.WriteString("\n")
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		io.WriteString(t.writer, b.String())
+	}
+}
+
+func (t *HTTPTracer) sanitizeBody(body []byte) string {
+	if limit := t.bodyLimit(); len(body) > limit {
+		// Mask before trimming, so a value cut off by the limit is still
+		// matched.
+		s := sanitizeString(string(body))
+		if len(s) > limit {
+			s = s[:limit] + "...(truncated)"
+		}
+		return s
+	}
+	return sanitizeString(string(body))
+}
+
+// sanitizeString masks secrets in JSON, form-encoded and bearer token text.
+func sanitizeString(s string) string {
+	s = sensitiveJSONRegex.ReplaceAllString(s, `${1}"`+redacted+`"`)
+	s = sensitiveFormRegex.ReplaceAllString(s, `${1}${2}`+redacted)
+	s = bearerRegex.ReplaceAllString(s, `${1}`+redacted)
+	return s
+}
+
+// sanitizeURL masks sensitive query parameters.
+func sanitizeURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	c := *u
+	c.User = nil
+	if c.RawQuery == "" {
+		return c.String()
+	}
+	q := c.Query()
+	for _, f := range sensitiveFields {
+		if _, ok := q[f]; ok {
+			q.Set(f, redacted)
+		}
+	}
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+// defaultTracingTransport traces requests with the tracer set with
+// SetDefaultTracer, which is looked up on every request.
+type defaultTracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *defaultTracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tracer := defaultTracer()
+	if !tracer.Enabled() {
+		return t.base.RoundTrip(req)
+	}
+	return (&tracingTransport{base: t.base, tracer: tracer}).RoundTrip(req)
+}
+
+// withDefaultTracer returns a copy of httpClient whose requests are traced
+// with the default tracer.
+func withDefaultTracer(httpClient *http.Client) *http.Client {
+	return withTransport(httpClient, &defaultTracingTransport{base: transportOrDefault(httpClient.Transport)})
+}
+
+// tracingTransport traces requests when its tracer is enabled.
+type tracingTransport struct {
+	base   http.RoundTripper
+	tracer *HTTPTracer
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.tracer.Enabled() {
+		return t.base.RoundTrip(req)
+	}
+
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = body
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.tracer.trace(req.Method, sanitizeURL(req.URL), 0, elapsed, reqBody, nil, err)
+		return nil, err
+	}
+
+	respBody, readErr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	t.tracer.trace(req.Method, sanitizeURL(req.URL), resp.StatusCode, elapsed, reqBody, respBody, readErr)
+	if readErr != nil {
+		return nil, readErr
+	}
+	return resp, nil
+}
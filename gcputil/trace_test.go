@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeString(t *testing.T) {
+	tests := map[string]struct {
+		Input    string
+		Expected string
+	}{
+		"json": {
+			Input:    `{"access_token": "ya29.secret", "expires_in": 3599}`,
+			Expected: `{"access_token": "REDACTED", "expires_in": 3599}`,
+		},
+		"json escaped quote": {
+			Input:    `{"private_key":"a\"b","name":"x"}`,
+			Expected: `{"private_key":"REDACTED","name":"x"}`,
+		},
+		"form": {
+			Input:    "grant_type=x&subject_token=eyJ.secret&audience=aud",
+			Expected: "grant_type=x&subject_token=REDACTED&audience=aud",
+		},
+		"bearer": {
+			Input:    "Authorization: Bearer ya29.secret",
+			Expected: "Authorization: Bearer REDACTED",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := sanitizeString(tc.Input); actual != tc.Expected {
+				t.Errorf("expected %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestHTTPTracer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "subject_token=secret-in" {
+			t.Errorf("request body was not preserved: %q", body)
+		}
+		w.Write([]byte(`{"access_token":"secret-out"}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	tracer := NewHTTPTracer(&buf)
+	client := tracer.Client(srv.Client())
+
+	resp, err := client.Post(srv.URL+"/v1/token?key=secret-key", "application/x-www-form-urlencoded", strings.NewReader("subject_token=secret-in"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"access_token":"secret-out"}` {
+		t.Errorf("response body was not preserved: %q", body)
+	}
+
+	trace := buf.String()
+	if strings.Contains(trace, "secret") {
+		t.Errorf("trace contains secrets: %s", trace)
+	}
+	for _, s := range []string{"POST", "/v1/token", "200"} {
+		if !strings.Contains(trace, s) {
+			t.Errorf("expected trace to contain %q: %s", s, trace)
+		}
+	}
+
+	buf.Reset()
+	tracer.SetEnabled(false)
+	resp, err = client.Post(srv.URL, "application/x-www-form-urlencoded", strings.NewReader("subject_token=secret-in"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if buf.Len() != 0 {
+		t.Errorf("expected no trace when disabled, got %s", buf.String())
+	}
+}
+
+func TestSetDefaultTracer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// Clients created before the tracer is set are traced too.
+	metadataClient := NewMetadataClient(nil)
+
+	var buf bytes.Buffer
+	SetDefaultTracer(NewHTTPTracer(&buf))
+	defer SetDefaultTracer(nil)
+
+	get := func(client *http.Client, path string) {
+		t.Helper()
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	get(packageHTTPClient(), "/package")
+	get(metadataClient.httpClient, "/metadata")
+	for _, path := range []string{"/package", "/metadata"} {
+		if !strings.Contains(buf.String(), path) {
+			t.Fatalf("expected a trace of %s, got %s", path, buf.String())
+		}
+	}
+
+	buf.Reset()
+	SetDefaultTracer(nil)
+	get(packageHTTPClient(), "/package")
+	get(metadataClient.httpClient, "/metadata")
+	if buf.Len() != 0 {
+		t.Fatalf("expected no trace once the tracer is unset, got %s", buf.String())
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/net/http2"
+)
+
+// DialContextFunc dials a network connection, as http.Transport.DialContext.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+var (
+	defaultDialerMu     sync.RWMutex
+	defaultDialContext  DialContextFunc
+	defaultDialResolver *net.Resolver
+	defaultTransport    *TransportOptions
+
+	defaultPrivateAccessV PrivateAccessPreset
+)
+
+var (
+	packageTransportMu sync.Mutex
+	packageTransportV  *http.Transport
+)
+
+// TransportOptions tunes the connection handling of an HTTP transport, e.g.
+// so that long-lived processes behind NATs that silently drop idle
+// connections detect them before the first call after an idle period stalls.
+type TransportOptions struct {
+	// MaxIdleConnsPerHost is the number of idle connections kept per host.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is how long idle connections are kept.
+	IdleConnTimeout time.Duration
+
+	// HTTP2ReadIdleTimeout enables HTTP/2 health checks: if no frame is
+	// received on a connection for this long, a ping is sent.
+	HTTP2ReadIdleTimeout time.Duration
+
+	// HTTP2PingTimeout is how long to wait for a health check ping response
+	// before closing the connection. Defaults to 15 seconds.
+	HTTP2PingTimeout time.Duration
+
+	// DisableHTTP2 restricts connections to HTTP/1.1.
+	DisableHTTP2 bool
+
+	// ForceHTTP2 attempts HTTP/2 even when the transport has a custom
+	// dialer or TLS configuration, which otherwise disables it.
+	ForceHTTP2 bool
+}
+
+// Validate checks that the options are consistent.
+func (o *TransportOptions) Validate() error {
+	if o.DisableHTTP2 && (o.ForceHTTP2 || o.HTTP2ReadIdleTimeout > 0 || o.HTTP2PingTimeout > 0) {
+		return errors.New("HTTP/2 options cannot be combined with DisableHTTP2")
+	}
+	if o.MaxIdleConnsPerHost < 0 || o.IdleConnTimeout < 0 || o.HTTP2ReadIdleTimeout < 0 || o.HTTP2PingTimeout < 0 {
+		return errors.New("transport options must not be negative")
+	}
+	return nil
+}
+
+// apply sets the options on t, which must not have been used yet.
+func (o *TransportOptions) apply(t *http.Transport) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.DisableHTTP2 {
+		// A non-nil, empty map disables HTTP/2.
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return nil
+	}
+	if o.ForceHTTP2 {
+		t.ForceAttemptHTTP2 = true
+	}
+	if o.HTTP2ReadIdleTimeout > 0 || o.HTTP2PingTimeout > 0 {
+		h2, err := http2.ConfigureTransports(t)
+		if err != nil {
+			return fmt.Errorf("unable to configure HTTP/2: %v", err)
+		}
+		h2.ReadIdleTimeout = o.HTTP2ReadIdleTimeout
+		h2.PingTimeout = o.HTTP2PingTimeout
+	}
+	return nil
+}
+
+// SetDefaultTransportOptions sets the transport options of the pooled
+// transport shared by the HTTP clients this package creates: those of the
+// package-level functions, of MetadataClients and of Clients created without
+// Options.Transport. A nil value restores the default. It is safe for
+// concurrent use. The package-level functions use the options from their
+// next call; MetadataClients and Clients only if created afterwards.
+func SetDefaultTransportOptions(opts *TransportOptions) error {
+	if opts != nil {
+		// Apply the options to a scratch transport, so that errors are
+		// returned here rather than when the shared transport is built.
+		if err := opts.apply(cleanhttp.DefaultPooledTransport()); err != nil {
+			return err
+		}
+		c := *opts
+		opts = &c
+	}
+	defaultDialerMu.Lock()
+	defaultTransport = opts
+	defaultDialerMu.Unlock()
+	resetPackageTransport()
+	return nil
+}
+
+func defaultTransportOptions() *TransportOptions {
+	defaultDialerMu.RLock()
+	defer defaultDialerMu.RUnlock()
+	return defaultTransport
+}
+
+// withTransportOptions returns a copy of httpClient whose transport is tuned
+// with opts. Its transport must be an *http.Transport.
+func withTransportOptions(httpClient *http.Client, opts *TransportOptions) (*http.Client, error) {
+	t, ok := transportOrDefault(httpClient.Transport).(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("transport options require an *http.Transport, got %T", httpClient.Transport)
+	}
+	t = t.Clone()
+	if err := opts.apply(t); err != nil {
+		return nil, err
+	}
+	return withTransport(httpClient, t), nil
+}
+
+// SetDefaultDialer sets the dial function and DNS resolver used by the HTTP
+// clients this package creates: those of the package-level functions, of
+// MetadataClients and of Clients created without an HTTPClient. If resolver
+// is set, hostnames are resolved with it and the resulting addresses dialed
+// with dial. Either may be nil to restore the default. It is safe for
+// concurrent use, and affects clients created afterwards.
+func SetDefaultDialer(dial DialContextFunc, resolver *net.Resolver) {
+	defaultDialerMu.Lock()
+	defaultDialContext = dial
+	defaultDialResolver = resolver
+	defaultDialerMu.Unlock()
+	resetPackageTransport()
+}
+
+func defaultDialer() (DialContextFunc, *net.Resolver) {
+	defaultDialerMu.RLock()
+	defer defaultDialerMu.RUnlock()
+	return defaultDialContext, defaultDialResolver
+}
+
+// newHTTPClient returns an HTTP client that uses the shared package
+// transport.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: packageTransport()}
+}
+
+// packageTransport returns the pooled transport shared by the HTTP clients
+// this package creates. It is built on first use with the default dialer,
+// private access preset and transport options, and rebuilt after they
+// change.
+func packageTransport() *http.Transport {
+	packageTransportMu.Lock()
+	defer packageTransportMu.Unlock()
+	if packageTransportV != nil {
+		return packageTransportV
+	}
+
+	t := cleanhttp.DefaultPooledTransport()
+	if dial := resolvingDialContext(defaultDialer()); dial != nil {
+		t.DialContext = dial
+	}
+	if p := defaultPrivateAccess(); p != "" {
+		t.DialContext = p.DialContext(t.DialContext)
+	}
+	if opts := defaultTransportOptions(); opts != nil {
+		// The options were applied to a scratch transport when they were
+		// set, so this is not expected to fail.
+		if err := opts.apply(t); err != nil {
+			logWarn("unable to apply the default transport options", "error", err)
+		}
+	}
+	packageTransportV = t
+	return t
+}
+
+// resetPackageTransport discards the shared package transport, so that it is
+// rebuilt with the current defaults. Clients holding the previous transport
+// keep using it; its idle connections are closed.
+func resetPackageTransport() {
+	packageTransportMu.Lock()
+	prev := packageTransportV
+	packageTransportV = nil
+	packageTransportMu.Unlock()
+	if prev != nil {
+		prev.CloseIdleConnections()
+	}
+}
+
+// withDialer returns a copy of httpClient whose transport dials with dial
+// and resolver. Its transport must be an *http.Transport.
+func withDialer(httpClient *http.Client, dial DialContextFunc, resolver *net.Resolver) (*http.Client, error) {
+	t, ok := transportOrDefault(httpClient.Transport).(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("a custom dialer or resolver requires an *http.Transport, got %T", httpClient.Transport)
+	}
+	t = t.Clone()
+	t.DialContext = resolvingDialContext(dial, resolver)
+	return withTransport(httpClient, t), nil
+}
+
+// resolvingDialContext returns a dial function that resolves hostnames with
+// resolver, if set, and dials with dial, if set. It returns nil if neither is
+// set.
+func resolvingDialContext(dial DialContextFunc, resolver *net.Resolver) DialContextFunc {
+	if resolver == nil {
+		return dial
+	}
+	if dial == nil {
+		d := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		dial = d.DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, a := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(a, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, lastErr
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetDefaultDialer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"kid": "not-a-pem"}`))
+	}))
+	defer srv.Close()
+
+	var dialed []string
+	SetDefaultDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return (&net.Dialer{}).DialContext(ctx, network, strings.TrimPrefix(srv.URL, "http://"))
+	}, nil)
+	defer SetDefaultDialer(nil, nil)
+
+	// The key is returned, but cannot be parsed.
+	_, err := ServiceAccountPublicKeyWithEndpoint(context.Background(), "sa@p.iam.gserviceaccount.com", "kid", "http://proxy.internal:8080")
+	if err == nil || !strings.Contains(err.Error(), "pem") {
+		t.Errorf("expected a PEM error from the fake server, got %v", err)
+	}
+	if len(dialed) != 1 || dialed[0] != "proxy.internal:8080" {
+		t.Errorf("expected the default dialer to be used, got %v", dialed)
+	}
+}
+
+func TestClient_DialContext(t *testing.T) {
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+	}))
+	defer sts.Close()
+
+	var dialed []string
+	c := newTestClient(t, &Options{
+		Endpoints: &GCPEndpoints{STS: "http://sts.internal"},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return (&net.Dialer{}).DialContext(ctx, network, strings.TrimPrefix(sts.URL, "http://"))
+		},
+	})
+
+	if _, err := c.ExchangeToken(context.Background(), &STSTokenExchangeRequest{Audience: "aud", SubjectToken: "jwt"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dialed) != 1 || dialed[0] != "sts.internal:80" {
+		t.Errorf("expected the client's dialer to be used, got %v", dialed)
+	}
+}
+
+func TestTransportOptions(t *testing.T) {
+	tests := map[string]struct {
+		Opts        TransportOptions
+		Check       func(t *testing.T, tr *http.Transport)
+		ShouldError bool
+	}{
+		"idle connections": {
+			Opts: TransportOptions{MaxIdleConnsPerHost: 7, IdleConnTimeout: 30 * time.Second},
+			Check: func(t *testing.T, tr *http.Transport) {
+				if tr.MaxIdleConnsPerHost != 7 || tr.IdleConnTimeout != 30*time.Second {
+					t.Fatalf("unexpected idle settings: %d, %v", tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+				}
+			},
+		},
+		"http2 health checks": {
+			Opts: TransportOptions{HTTP2ReadIdleTimeout: 15 * time.Second},
+			Check: func(t *testing.T, tr *http.Transport) {
+				if _, ok := tr.TLSNextProto["h2"]; !ok {
+					t.Fatal("expected HTTP/2 to be configured")
+				}
+			},
+		},
+		"force http2": {
+			Opts: TransportOptions{ForceHTTP2: true},
+			Check: func(t *testing.T, tr *http.Transport) {
+				if !tr.ForceAttemptHTTP2 {
+					t.Fatal("expected HTTP/2 to be forced")
+				}
+			},
+		},
+		"disable http2": {
+			Opts: TransportOptions{DisableHTTP2: true},
+			Check: func(t *testing.T, tr *http.Transport) {
+				if tr.TLSNextProto == nil || len(tr.TLSNextProto) != 0 || tr.ForceAttemptHTTP2 {
+					t.Fatal("expected HTTP/2 to be disabled")
+				}
+			},
+		},
+		"disable and ping": {
+			Opts:        TransportOptions{DisableHTTP2: true, HTTP2ReadIdleTimeout: time.Second},
+			ShouldError: true,
+		},
+		"negative": {
+			Opts:        TransportOptions{IdleConnTimeout: -time.Second},
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			httpClient, err := withTransportOptions(newHTTPClient(), &test.Opts)
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.Check(t, httpClient.Transport.(*http.Transport))
+		})
+	}
+}
+
+func TestSetDefaultTransportOptions(t *testing.T) {
+	if err := SetDefaultTransportOptions(&TransportOptions{MaxIdleConnsPerHost: 3}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDefaultTransportOptions(nil)
+
+	// The package-level functions and Clients share one pooled transport with
+	// the options applied; MetadataClients dial the metadata server directly.
+	transport := packageTransport()
+	if got := transport.MaxIdleConnsPerHost; got != 3 {
+		t.Fatalf("expected 3 idle connections per host, got %d", got)
+	}
+	if transport.DisableKeepAlives {
+		t.Fatal("expected a pooled transport")
+	}
+	if newHTTPClient().Transport != transport {
+		t.Fatal("expected the package transport to be shared")
+	}
+	if NewMetadataClient(nil).httpClient.Transport.(*defaultTracingTransport).base != metadataTransport() {
+		t.Fatal("expected metadata clients to use the metadata transport")
+	}
+	if err := SetDefaultTransportOptions(&TransportOptions{DisableHTTP2: true, ForceHTTP2: true}); err == nil {
+		t.Fatal("expected error")
+	}
+	if packageTransport() != transport {
+		t.Fatal("expected invalid options to leave the package transport unchanged")
+	}
+
+	// Changing the options rebuilds the shared transport.
+	if err := SetDefaultTransportOptions(&TransportOptions{IdleConnTimeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if got := packageTransport(); got == transport || got.IdleConnTimeout != time.Minute {
+		t.Fatalf("expected a rebuilt transport, got %+v", got)
+	}
+}
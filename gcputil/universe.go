@@ -0,0 +1,69 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultUniverseDomain is the universe domain of public Google Cloud.
+// Trusted Partner Cloud and sovereign clouds use other universe domains.
+const DefaultUniverseDomain = "googleapis.com"
+
+// GCPEndpointsForUniverse returns the Google API endpoints of the given
+// universe domain. For DefaultUniverseDomain or an empty domain, these are
+// the endpoints of DefaultGCPEndpoints.
+func GCPEndpointsForUniverse(universeDomain string) *GCPEndpoints {
+	if universeDomain == "" || universeDomain == DefaultUniverseDomain {
+		return DefaultGCPEndpoints()
+	}
+	endpoint := func(service, path string) string {
+		return fmt.Sprintf("https://%s.%s%s", service, universeDomain, path)
+	}
+	return &GCPEndpoints{
+		APIs:                 endpoint("www", ""),
+		IAM:                  endpoint("iam", ""),
+		IAMCredentials:       endpoint("iamcredentials", ""),
+		STS:                  endpoint("sts", ""),
+		OAuthCerts:           endpoint("www", ""),
+		Compute:              endpoint("compute", "/compute/v1/"),
+		CloudResourceManager: endpoint("cloudresourcemanager", "/"),
+		Monitoring:           endpoint("monitoring", "/"),
+	}
+}
+
+// GetUniverseDomain returns the universe domain of the credentials,
+// DefaultUniverseDomain if none is set.
+func (c *GcpCredentials) GetUniverseDomain() string {
+	if c.UniverseDomain == "" {
+		return DefaultUniverseDomain
+	}
+	return c.UniverseDomain
+}
+
+// Endpoints returns the Google API endpoints of the credentials' universe
+// domain.
+func (c *GcpCredentials) Endpoints() *GCPEndpoints {
+	return GCPEndpointsForUniverse(c.GetUniverseDomain())
+}
+
+// isDefaultUniverse reports whether the credentials belong to public Google
+// Cloud, where the OAuth 2.0 token endpoint is available.
+func (c *GcpCredentials) isDefaultUniverse() bool {
+	return c.GetUniverseDomain() == DefaultUniverseDomain
+}
+
+// universeDomainFromJSON returns the universe domain of credential JSON, or
+// an empty string if it has none or cannot be parsed.
+func universeDomainFromJSON(credentialsJSON string) string {
+	var f struct {
+		UniverseDomain string `json:"universe_domain"`
+	}
+	if err := json.Unmarshal([]byte(credentialsJSON), &f); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(f.UniverseDomain)
+}
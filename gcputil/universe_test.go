@@ -0,0 +1,87 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGCPEndpointsForUniverse(t *testing.T) {
+	for _, domain := range []string{"", DefaultUniverseDomain} {
+		if got := GCPEndpointsForUniverse(domain); !reflect.DeepEqual(got, DefaultGCPEndpoints()) {
+			t.Errorf("expected default endpoints for %q, got %+v", domain, got)
+		}
+	}
+
+	e := GCPEndpointsForUniverse("example-tpc.goog")
+	if err := e.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if e.IAMCredentials != "https://iamcredentials.example-tpc.goog" || e.STS != "https://sts.example-tpc.goog" || e.Compute != "https://compute.example-tpc.goog/compute/v1/" {
+		t.Fatalf("unexpected endpoints %+v", e)
+	}
+}
+
+func TestFindCredentials_universeDomain(t *testing.T) {
+	t.Setenv(EnvOAuthAccessToken, "")
+	var key map[string]string
+	if err := json.Unmarshal(testServiceAccountJSON(t, "http://127.0.0.1:0"), &key); err != nil {
+		t.Fatal(err)
+	}
+	key["universe_domain"] = "example-tpc.goog"
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, ts, err := FindCredentials(string(keyJSON), context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.GetUniverseDomain() != "example-tpc.goog" || creds.Endpoints().IAM != "https://iam.example-tpc.goog" {
+		t.Fatalf("unexpected universe domain %q", creds.GetUniverseDomain())
+	}
+
+	// No token endpoint is available outside the default universe, so a
+	// self-signed JWT is used.
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Split(tok.AccessToken, ".")) != 3 {
+		t.Fatalf("expected a self-signed JWT, got %q", tok.AccessToken)
+	}
+
+	if got := (&GcpCredentials{}).GetUniverseDomain(); got != DefaultUniverseDomain {
+		t.Fatalf("unexpected default universe domain %q", got)
+	}
+}
+
+func TestNewClient_universeDomain(t *testing.T) {
+	var key map[string]string
+	if err := json.Unmarshal(testServiceAccountJSON(t, "http://127.0.0.1:0"), &key); err != nil {
+		t.Fatal(err)
+	}
+	key["universe_domain"] = "example-tpc.goog"
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewClient(context.Background(), &Options{
+		CredentialsJSON: string(keyJSON),
+		Endpoints:       &GCPEndpoints{STS: "https://sts.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := c.Endpoints()
+	if e.IAM != "https://iam.example-tpc.goog" || e.STS != "https://sts.example.com" {
+		t.Fatalf("unexpected endpoints %+v", e)
+	}
+}
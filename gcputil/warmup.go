@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Warmup prefetches an access token and opens connections to each of the
+// client's endpoints, so that the first real request does not pay for token
+// acquisition, DNS resolution and TLS handshakes. Connections are kept in
+// the HTTP client's idle pool. An error is returned if a token cannot be
+// obtained; connection failures are only logged, since the endpoint may not
+// be needed.
+func (c *Client) Warmup(ctx context.Context) error {
+	defer c.measure("warmup", time.Now())
+
+	var wg sync.WaitGroup
+	for _, origin := range endpointOrigins(c.endpointsFor(ctx)) {
+		wg.Add(1)
+		go func(origin string) {
+			defer wg.Done()
+			if err := c.connect(ctx, origin); err != nil {
+				c.warn("unable to warm up connection", "endpoint", origin, "error", err)
+			}
+		}(origin)
+	}
+
+	_, tokenErr := c.tokenSource.Token()
+	wg.Wait()
+	if tokenErr != nil {
+		c.incrError("warmup")
+		return fmt.Errorf("unable to obtain token: %v", tokenErr)
+	}
+	return nil
+}
+
+// connect makes an unauthenticated HEAD request to origin, leaving an open
+// connection in the HTTP client's idle pool. The response status is ignored.
+func (c *Client) connect(ctx context.Context, origin string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, origin+"/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	// The body must be drained for the connection to be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// endpointOrigins returns the distinct scheme and host of each endpoint,
+// sorted.
+func endpointOrigins(e *GCPEndpoints) []string {
+	seen := make(map[string]bool)
+	var origins []string
+	for _, f := range e.fields() {
+		u, err := url.Parse(*f.value)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		origin := u.Scheme + "://" + u.Host
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	sort.Strings(origins)
+	return origins
+}
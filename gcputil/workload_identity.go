@@ -0,0 +1,261 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google/externalaccount"
+)
+
+const (
+	// DefaultGKEProjectedTokenPath is the conventional mount path of a
+	// projected Kubernetes service account token whose audience is the
+	// workload identity pool (e.g. PROJECT_ID.svc.id.goog).
+	DefaultGKEProjectedTokenPath = "/var/run/secrets/tokens/gcp-ksa/token"
+
+	// gkeProjectedTokenPathEnv overrides the projected token path used by
+	// DetectGKEWorkloadIdentity.
+	gkeProjectedTokenPathEnv = "GKE_WORKLOAD_IDENTITY_TOKEN_PATH"
+
+	// kubernetesServiceHostEnv is set by the kubelet in every pod.
+	kubernetesServiceHostEnv = "KUBERNETES_SERVICE_HOST"
+
+	// gkeWorkloadIdentityAudienceTemplate is the STS audience for a GKE
+	// cluster's workload identity pool.
+	gkeWorkloadIdentityAudienceTemplate = "identitynamespace:%s.svc.id.goog:https://container.googleapis.com/v1/projects/%s/locations/%s/clusters/%s"
+
+	// fleetWorkloadIdentityAudienceTemplate is the STS audience for a fleet
+	// membership's workload identity pool.
+	fleetWorkloadIdentityAudienceTemplate = "identitynamespace:%s.svc.id.goog:https://gkehub.googleapis.com/projects/%s/locations/%s/memberships/%s"
+)
+
+// GKEWorkloadIdentityConfig configures a token source that exchanges a
+// projected Kubernetes service account token for Google credentials through
+// STS, using GKE workload identity.
+type GKEWorkloadIdentityConfig struct {
+	// TokenPath is the path of the projected Kubernetes service account token.
+	// Defaults to DefaultGKEProjectedTokenPath.
+	TokenPath string
+
+	// Audience is the STS audience for the workload identity pool, as returned
+	// by GKEWorkloadIdentityAudience.
+	Audience string
+
+	// ServiceAccountEmail is the Google service account to impersonate. If
+	// empty, the federated token is used directly.
+	ServiceAccountEmail string
+
+	// Scopes are the scopes to request. Defaults to cloud-platform.
+	Scopes []string
+}
+
+// GKEWorkloadIdentityAudience returns the STS audience for the workload
+// identity pool of the given GKE cluster.
+func GKEWorkloadIdentityAudience(project, location, cluster string) string {
+	return fmt.Sprintf(gkeWorkloadIdentityAudienceTemplate, project, project, location, cluster)
+}
+
+// FleetWorkloadIdentityAudience returns the STS audience for the fleet
+// workload identity pool of the given fleet membership. Location is usually
+// "global".
+func FleetWorkloadIdentityAudience(fleetProject, location, membership string) string {
+	return fmt.Sprintf(fleetWorkloadIdentityAudienceTemplate, fleetProject, fleetProject, location, membership)
+}
+
+var workloadIdentityAudienceRegex = regexp.MustCompile(`^identitynamespace:([^:/]+)\.svc\.id\.goog:(https://(container|gkehub)\.googleapis\.com/(?:v1/)?projects/([^/]+)/locations/([^/]+)/(clusters|memberships)/([^/]+))$`)
+
+// WorkloadIdentityAudience is a parsed GKE or fleet workload identity
+// audience.
+type WorkloadIdentityAudience struct {
+	// Pool is the workload identity pool, e.g. "my-project.svc.id.goog".
+	Pool string
+
+	// IdentityProvider is the URL of the cluster or fleet membership that
+	// issues the Kubernetes tokens.
+	IdentityProvider string
+
+	// Project, Location and Name identify the cluster or membership.
+	Project  string
+	Location string
+	Name     string
+
+	// Fleet is true if the identity provider is a fleet membership rather
+	// than a GKE cluster.
+	Fleet bool
+}
+
+// ParseWorkloadIdentityAudience parses a GKE or fleet workload identity
+// audience of the form
+// identitynamespace:POOL.svc.id.goog:https://SERVICE.googleapis.com/.../(clusters|memberships)/NAME.
+func ParseWorkloadIdentityAudience(audience string) (*WorkloadIdentityAudience, error) {
+	matches := workloadIdentityAudienceRegex.FindStringSubmatch(audience)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid workload identity audience %q", audience)
+	}
+
+	fleet := matches[3] == "gkehub"
+	if fleet != (matches[6] == "memberships") {
+		return nil, fmt.Errorf("invalid workload identity audience %q (mismatched service and resource type)", audience)
+	}
+
+	return &WorkloadIdentityAudience{
+		Pool:             matches[1] + ".svc.id.goog",
+		IdentityProvider: matches[2],
+		Project:          matches[4],
+		Location:         matches[5],
+		Name:             matches[7],
+		Fleet:            fleet,
+	}, nil
+}
+
+// fleetCredentialConfig is the subset of the external_account credential
+// configuration produced for fleet workload identity (e.g. by
+// `gcloud container fleet memberships get-credentials` or for attached and
+// Anthos clusters) that is needed to build a token source.
+type fleetCredentialConfig struct {
+	Type                           string `json:"type"`
+	Audience                       string `json:"audience"`
+	SubjectTokenType               string `json:"subject_token_type"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	CredentialSource               struct {
+		File   string `json:"file"`
+		Format struct {
+			Type string `json:"type"`
+		} `json:"format"`
+	} `json:"credential_source"`
+}
+
+// ParseFleetCredentialConfig parses a fleet workload identity credential
+// configuration file into a GKEWorkloadIdentityConfig.
+func ParseFleetCredentialConfig(configJSON []byte) (*GKEWorkloadIdentityConfig, error) {
+	var cfg fleetCredentialConfig
+	if err := json.Unmarshal(configJSON, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse fleet credential configuration: %v", err)
+	}
+	if cfg.Type != "external_account" {
+		return nil, fmt.Errorf("unsupported credential type %q, expected external_account", cfg.Type)
+	}
+	if cfg.SubjectTokenType != "" && cfg.SubjectTokenType != defaultJWTSubjectTokenType {
+		return nil, fmt.Errorf("unsupported subject token type %q", cfg.SubjectTokenType)
+	}
+	if _, err := ParseWorkloadIdentityAudience(cfg.Audience); err != nil {
+		return nil, err
+	}
+	if cfg.CredentialSource.File == "" {
+		return nil, errors.New("fleet credential configuration must have a credential_source file")
+	}
+	if t := cfg.CredentialSource.Format.Type; t != "" && t != "text" {
+		return nil, fmt.Errorf("unsupported credential_source format %q", t)
+	}
+
+	config := &GKEWorkloadIdentityConfig{
+		TokenPath: cfg.CredentialSource.File,
+		Audience:  cfg.Audience,
+	}
+	if cfg.ServiceAccountImpersonationURL != "" {
+		email, err := serviceAccountFromImpersonationURL(cfg.ServiceAccountImpersonationURL)
+		if err != nil {
+			return nil, err
+		}
+		config.ServiceAccountEmail = email
+	}
+	return config, nil
+}
+
+// serviceAccountFromImpersonationURL extracts the service account email from
+// a generateAccessToken URL, and validates it, as the URL comes from an
+// untrusted configuration file.
+func serviceAccountFromImpersonationURL(impersonationURL string) (string, error) {
+	const marker = "/serviceAccounts/"
+	idx := strings.LastIndex(impersonationURL, marker)
+	if idx < 0 || !strings.HasSuffix(impersonationURL, ":generateAccessToken") {
+		return "", fmt.Errorf("invalid service account impersonation URL %q", impersonationURL)
+	}
+	email, err := url.PathUnescape(strings.TrimSuffix(impersonationURL[idx+len(marker):], ":generateAccessToken"))
+	if err != nil || email == "" {
+		return "", fmt.Errorf("invalid service account impersonation URL %q", impersonationURL)
+	}
+	if err := validateServiceAccountRef(email); err != nil {
+		return "", fmt.Errorf("invalid service account impersonation URL %q: %v", impersonationURL, err)
+	}
+	return email, nil
+}
+
+// DetectGKEWorkloadIdentity reports whether the process is running in a
+// Kubernetes pod with a projected service account token, and returns the
+// token path. The path is read from GKE_WORKLOAD_IDENTITY_TOKEN_PATH if set,
+// otherwise DefaultGKEProjectedTokenPath is used.
+func DetectGKEWorkloadIdentity() (string, bool) {
+	if os.Getenv(kubernetesServiceHostEnv) == "" {
+		return "", false
+	}
+
+	tokenPath := os.Getenv(gkeProjectedTokenPathEnv)
+	if tokenPath == "" {
+		tokenPath = DefaultGKEProjectedTokenPath
+	}
+	if info, err := os.Stat(tokenPath); err != nil || info.IsDir() {
+		return "", false
+	}
+	return tokenPath, true
+}
+
+// TokenSource returns a token source that reads the projected token from
+// TokenPath on every exchange, so that kubelet token rotation is honored.
+// Requests are made with the oauth2.HTTPClient from ctx, or the package
+// default HTTP client.
+func (c *GKEWorkloadIdentityConfig) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if c.Audience == "" {
+		return nil, errors.New("workload identity audience is required")
+	}
+	if strings.HasPrefix(c.Audience, "//iam.googleapis.com/") {
+		if !workloadIdentityPoolAudienceRegex.MatchString(c.Audience) {
+			return nil, fmt.Errorf("invalid workload identity pool audience %q", c.Audience)
+		}
+	} else if _, err := ParseWorkloadIdentityAudience(c.Audience); err != nil {
+		return nil, err
+	}
+
+	tokenPath := c.TokenPath
+	if tokenPath == "" {
+		tokenPath = DefaultGKEProjectedTokenPath
+	}
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultTokenAuthScopes
+	}
+
+	endpoints := resolveEndpoints(ctx, nil)
+	config := externalaccount.Config{
+		Audience:         c.Audience,
+		SubjectTokenType: defaultJWTSubjectTokenType,
+		TokenURL:         joinEndpoint(endpoints.STS, stsTokenURLPath),
+		CredentialSource: &externalaccount.CredentialSource{
+			File: tokenPath,
+		},
+		Scopes: scopes,
+	}
+	if c.ServiceAccountEmail != "" {
+		if err := validateServiceAccountRef(c.ServiceAccountEmail); err != nil {
+			return nil, err
+		}
+		config.ServiceAccountImpersonationURL = joinEndpoint(endpoints.IAMCredentials, fmt.Sprintf(iamGenerateAccessTokenURLPathTemplate, url.PathEscape(c.ServiceAccountEmail)))
+	}
+
+	if _, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); !ok {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, packageHTTPClient())
+	}
+	return externalaccount.NewTokenSource(ctx, config)
+}
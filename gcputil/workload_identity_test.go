@@ -0,0 +1,286 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package gcputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-gcp-common/gcputil/testutil"
+)
+
+func TestParseWorkloadIdentityAudience(t *testing.T) {
+	testCases := map[string]struct {
+		Expected    *WorkloadIdentityAudience
+		ShouldError bool
+	}{
+		"":                       {ShouldError: true},
+		"//iam.googleapis.com/x": {ShouldError: true},
+		"identitynamespace:p.svc.id.goog:https://container.googleapis.com/v1/projects/p/locations/l/memberships/c": {ShouldError: true},
+		GKEWorkloadIdentityAudience("p", "us-central1", "c"): {
+			Expected: &WorkloadIdentityAudience{
+				Pool:             "p.svc.id.goog",
+				IdentityProvider: "https://container.googleapis.com/v1/projects/p/locations/us-central1/clusters/c",
+				Project:          "p",
+				Location:         "us-central1",
+				Name:             "c",
+			},
+		},
+		FleetWorkloadIdentityAudience("fleet", "global", "m"): {
+			Expected: &WorkloadIdentityAudience{
+				Pool:             "fleet.svc.id.goog",
+				IdentityProvider: "https://gkehub.googleapis.com/projects/fleet/locations/global/memberships/m",
+				Project:          "fleet",
+				Location:         "global",
+				Name:             "m",
+				Fleet:            true,
+			},
+		},
+	}
+
+	for k, testCase := range testCases {
+		actual, err := ParseWorkloadIdentityAudience(k)
+		if testCase.ShouldError {
+			if err == nil {
+				t.Errorf("input '%s' should have returned error, instead got: %v", k, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("input '%s' returned error: %s", k, err)
+			continue
+		}
+		if *actual != *testCase.Expected {
+			t.Errorf("input '%s': expected %+v, got %+v", k, testCase.Expected, actual)
+		}
+	}
+}
+
+func TestParseFleetCredentialConfig(t *testing.T) {
+	configJSON := `{
+  "type": "external_account",
+  "audience": "identitynamespace:fleet.svc.id.goog:https://gkehub.googleapis.com/projects/fleet/locations/global/memberships/m",
+  "service_account_impersonation_url": "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa@fleet.iam.gserviceaccount.com:generateAccessToken",
+  "subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+  "token_url": "https://sts.googleapis.com/v1/token",
+  "credential_source": {
+    "file": "/var/run/secrets/tokens/gcp-ksa/token",
+    "format": {"type": "text"}
+  }
+}`
+
+	config, err := ParseFleetCredentialConfig([]byte(configJSON))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.ServiceAccountEmail != "sa@fleet.iam.gserviceaccount.com" {
+		t.Errorf("unexpected service account email %q", config.ServiceAccountEmail)
+	}
+	if config.TokenPath != DefaultGKEProjectedTokenPath {
+		t.Errorf("unexpected token path %q", config.TokenPath)
+	}
+
+	if _, err := ParseFleetCredentialConfig([]byte(`{"type":"service_account"}`)); err == nil {
+		t.Errorf("expected error for non-external_account credential type")
+	}
+
+	for _, impersonationURL := range []string{
+		"https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa@fleet.iam.gserviceaccount.com/../x:generateAccessToken",
+		"https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/not-an-email:generateAccessToken",
+		"https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa%zz:generateAccessToken",
+	} {
+		invalid := strings.Replace(configJSON, "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/sa@fleet.iam.gserviceaccount.com:generateAccessToken", impersonationURL, 1)
+		if _, err := ParseFleetCredentialConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected error for impersonation URL %q", impersonationURL)
+		}
+	}
+}
+
+func TestGKEWorkloadIdentityConfig_TokenSource(t *testing.T) {
+	audience := GKEWorkloadIdentityAudience("p", "us-central1", "c")
+
+	tests := map[string]struct {
+		Config      GKEWorkloadIdentityConfig
+		NoTokenFile bool
+		Scope       string
+		ShouldError bool
+	}{
+		"gke audience": {
+			Config: GKEWorkloadIdentityConfig{Audience: audience},
+			Scope:  "https://www.googleapis.com/auth/cloud-platform",
+		},
+		"workload identity pool audience with scopes": {
+			Config: GKEWorkloadIdentityConfig{
+				Audience: "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/q",
+				Scopes:   []string{"https://www.googleapis.com/auth/devstorage.read_only"},
+			},
+			Scope: "https://www.googleapis.com/auth/devstorage.read_only",
+		},
+		"missing audience": {
+			ShouldError: true,
+		},
+		"invalid audience": {
+			Config:      GKEWorkloadIdentityConfig{Audience: "p.svc.id.goog"},
+			ShouldError: true,
+		},
+		"malformed gke audience": {
+			Config:      GKEWorkloadIdentityConfig{Audience: "identitynamespace:p.svc.id.goog:https://container.googleapis.com/v1/projects/p/clusters/c"},
+			ShouldError: true,
+		},
+		"malformed pool audience": {
+			Config:      GKEWorkloadIdentityConfig{Audience: "//iam.googleapis.com/projects/p/workloadIdentityPools/p"},
+			ShouldError: true,
+		},
+		"invalid service account": {
+			Config:      GKEWorkloadIdentityConfig{Audience: audience, ServiceAccountEmail: "sa@p.iam.gserviceaccount.com/../x"},
+			ShouldError: true,
+		},
+		"missing token file": {
+			Config:      GKEWorkloadIdentityConfig{Audience: audience},
+			NoTokenFile: true,
+			ShouldError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sts := testutil.NewSTSServer(t)
+			// Tokens expire within the oauth2 expiry delta, so every call
+			// exchanges the projected token again.
+			sts.SetToken("sts-access-token", 1)
+			ctx := WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: sts.URL})
+
+			config := test.Config
+			config.TokenPath = filepath.Join(t.TempDir(), "token")
+			if !test.NoTokenFile {
+				if err := os.WriteFile(config.TokenPath, []byte("k8s-token-1"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ts, err := config.TokenSource(ctx)
+			if err == nil {
+				_, err = ts.Token()
+			}
+			if test.ShouldError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The kubelet rotates the projected token in place.
+			if err := os.WriteFile(config.TokenPath, []byte("k8s-token-2"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			token, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != "sts-access-token" {
+				t.Fatalf("unexpected access token %q", token.AccessToken)
+			}
+
+			reqs := sts.Requests()
+			if len(reqs) != 2 {
+				t.Fatalf("expected 2 token exchanges, got %d", len(reqs))
+			}
+			for i, req := range reqs {
+				if req.Get("audience") != config.Audience {
+					t.Errorf("expected audience %q, got %q", config.Audience, req.Get("audience"))
+				}
+				if req.Get("subject_token_type") != defaultJWTSubjectTokenType {
+					t.Errorf("unexpected subject token type %q", req.Get("subject_token_type"))
+				}
+				if req.Get("scope") != test.Scope {
+					t.Errorf("expected scope %q, got %q", test.Scope, req.Get("scope"))
+				}
+				if expected := []string{"k8s-token-1", "k8s-token-2"}[i]; req.Get("subject_token") != expected {
+					t.Errorf("expected subject token %q, got %q", expected, req.Get("subject_token"))
+				}
+			}
+		})
+	}
+}
+
+func TestGKEWorkloadIdentityConfig_TokenSource_packageHTTPClient(t *testing.T) {
+	var userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"sts-access-token","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(srv.Close)
+	SetDefaultUserAgent("plugin/1.0")
+	t.Cleanup(func() { SetDefaultUserAgent("") })
+
+	config := &GKEWorkloadIdentityConfig{
+		TokenPath: filepath.Join(t.TempDir(), "token"),
+		Audience:  GKEWorkloadIdentityAudience("p", "us-central1", "c"),
+	}
+	if err := os.WriteFile(config.TokenPath, []byte("k8s-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := config.TokenSource(WithEndpointOverrides(context.Background(), &GCPEndpoints{STS: srv.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(userAgent, "plugin/1.0") {
+		t.Fatalf("expected the exchange to use the package HTTP client, got User-Agent %q", userAgent)
+	}
+}
+
+func TestDetectGKEWorkloadIdentity(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("k8s-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		ServiceHost string
+		TokenPath   string
+		Expected    string
+	}{
+		"not kubernetes": {
+			TokenPath: tokenPath,
+		},
+		"projected token": {
+			ServiceHost: "10.0.0.1",
+			TokenPath:   tokenPath,
+			Expected:    tokenPath,
+		},
+		"missing token": {
+			ServiceHost: "10.0.0.1",
+			TokenPath:   filepath.Join(dir, "missing"),
+		},
+		"token path is a directory": {
+			ServiceHost: "10.0.0.1",
+			TokenPath:   dir,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(kubernetesServiceHostEnv, test.ServiceHost)
+			t.Setenv(gkeProjectedTokenPathEnv, test.TokenPath)
+
+			path, ok := DetectGKEWorkloadIdentity()
+			if ok != (test.Expected != "") || path != test.Expected {
+				t.Fatalf("expected %q, got %q (%t)", test.Expected, path, ok)
+			}
+		})
+	}
+}